@@ -0,0 +1,87 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// IPAddressClaimFinalizer allows the reconciler to release the address
+	// allocated to an IPAddressClaim before removing it from the API server.
+	IPAddressClaimFinalizer = "ipaddressclaim.infrastructure.cluster.x-k8s.io"
+)
+
+// IPAddressClaimSpec defines the desired state of IPAddressClaim.
+type IPAddressClaimSpec struct {
+	// Pool is the IPPool, in the claim's namespace, from which an address is
+	// allocated.
+	Pool corev1.LocalObjectReference `json:"pool"`
+}
+
+// IPAddressClaimStatus defines the observed state of IPAddressClaim.
+type IPAddressClaimStatus struct {
+	// Ready is true when an address has been allocated.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// Address is the allocated address with its prefix length, ex.
+	// 192.168.1.10/24.
+	// +optional
+	Address string `json:"address,omitempty"`
+
+	// Gateway is the gateway of the pool.
+	// +optional
+	Gateway string `json:"gateway,omitempty"`
+
+	// Nameservers are the DNS nameservers of the pool.
+	// +optional
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// ErrorMessage describes why an address could not be allocated. The
+	// allocation is retried until it succeeds.
+	// +optional
+	ErrorMessage *string `json:"errorMessage,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=ipaddressclaims,scope=Namespaced
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+
+// IPAddressClaim is the Schema for the ipaddressclaims API
+type IPAddressClaim struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IPAddressClaimSpec   `json:"spec,omitempty"`
+	Status IPAddressClaimStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IPAddressClaimList contains a list of IPAddressClaim
+type IPAddressClaimList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IPAddressClaim `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IPAddressClaim{}, &IPAddressClaimList{})
+}
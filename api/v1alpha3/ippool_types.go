@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// IPPoolSpec defines the desired state of IPPool.
+type IPPoolSpec struct {
+	// Subnets are the CIDRs, ex. 192.168.1.0/24, from which addresses are
+	// allocated. An allocated address has the prefix length of its subnet.
+	// The network and broadcast addresses of an IPv4 subnet are never
+	// allocated.
+	Subnets []string `json:"subnets"`
+
+	// Gateway is the gateway of the pool's addresses. The gateway is never
+	// allocated.
+	// +optional
+	Gateway string `json:"gateway,omitempty"`
+
+	// Nameservers are the DNS nameservers used by devices with an address
+	// from the pool.
+	// +optional
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// Exclusions are addresses, ranges of addresses, ex.
+	// 192.168.1.10-192.168.1.20, and CIDRs that are never allocated.
+	// +optional
+	Exclusions []string `json:"exclusions,omitempty"`
+}
+
+// IPPoolStatus defines the observed state of IPPool.
+type IPPoolStatus struct {
+	// Allocations are the addresses allocated to IPAddressClaims. The
+	// allocations are updated with optimistic concurrency, so an address is
+	// never allocated twice.
+	// +optional
+	Allocations []IPAllocation `json:"allocations,omitempty"`
+}
+
+// IPAllocation describes an address allocated to an IPAddressClaim.
+type IPAllocation struct {
+	// Claim is the name of the IPAddressClaim.
+	Claim string `json:"claim"`
+
+	// ClaimUID is the UID of the IPAddressClaim.
+	ClaimUID types.UID `json:"claimUID"`
+
+	// Address is the allocated address.
+	Address string `json:"address"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=ippools,scope=Namespaced
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+
+// IPPool is the Schema for the ippools API
+type IPPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IPPoolSpec   `json:"spec,omitempty"`
+	Status IPPoolStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IPPoolList contains a list of IPPool
+type IPPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IPPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IPPool{}, &IPPoolList{})
+}
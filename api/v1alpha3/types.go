@@ -19,6 +19,7 @@ package v1alpha3
 import (
 	"fmt"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 )
@@ -50,25 +51,269 @@ const (
 	// clone mode, but it also prevents expanding a VMs disk beyond the size of
 	// the source VM/template.
 	LinkedClone CloneMode = "linkedClone"
+
+	// InstantClone means resulting VMs are forked from the running state of
+	// the source VM. The source of the clone operation must be a powered-on
+	// VM, and vSphere 6.7 or later is required. Resulting VMs are powered on
+	// as soon as the clone operation completes, and share their memory and
+	// disks with the source VM.
+	InstantClone CloneMode = "instantClone"
+)
+
+// BootstrapFormat is the format of a VM's bootstrap data.
+type BootstrapFormat string
+
+const (
+	// BootstrapFormatCloudConfig indicates the bootstrap data is a cloud-init
+	// cloud-config. The bootstrap data and the VM's metadata are provided to
+	// cloud-init with the guestinfo.userdata and guestinfo.metadata keys.
+	BootstrapFormatCloudConfig BootstrapFormat = "cloud-config"
+
+	// BootstrapFormatIgnition indicates the bootstrap data is an Ignition
+	// config, ex. for Flatcar Container Linux or Fedora CoreOS. The VM's
+	// hostname and network configuration are embedded in the Ignition config
+	// when the VM is cloned, which is provided with the
+	// guestinfo.ignition.config.data key. Network devices are matched by the
+	// MAC addresses in the VM's spec, or by type if omitted. The VM's
+	// metadata is also provided with the guestinfo.metadata key.
+	BootstrapFormatIgnition BootstrapFormat = "ignition"
+)
+
+// HardwareUpdatePolicy describes how changes to the virtual hardware of a
+// VM are applied once the VM has been created.
+type HardwareUpdatePolicy string
+
+const (
+	// HardwareUpdatePolicyNone means changes to the virtual hardware are
+	// only applied when a VM is created.
+	HardwareUpdatePolicyNone HardwareUpdatePolicy = "none"
+
+	// HardwareUpdatePolicyInPlace means changes to the number of CPUs and
+	// the size of memory are applied to the existing VM. CPUs and memory are
+	// hot-added if the VM has hot-add enabled and the change is an increase
+	// that does not alter the number of cores per socket. Otherwise the VM is
+	// powered off, reconfigured and powered on again.
+	HardwareUpdatePolicyInPlace HardwareUpdatePolicy = "inPlace"
+)
+
+// HardwareUpdateState is the state of an in-place update of a VM's virtual
+// hardware.
+type HardwareUpdateState string
+
+const (
+	// HardwareUpdateStateHotAdd means CPUs and/or memory are being hot-added
+	// to the powered-on VM.
+	HardwareUpdateStateHotAdd HardwareUpdateState = "hotAdd"
+
+	// HardwareUpdateStatePowerOff means the VM is being powered off so that
+	// it may be reconfigured.
+	HardwareUpdateStatePowerOff HardwareUpdateState = "powerOff"
+
+	// HardwareUpdateStateReconfigure means the powered-off VM is being
+	// reconfigured.
+	HardwareUpdateStateReconfigure HardwareUpdateState = "reconfigure"
+
+	// HardwareUpdateStateSucceeded means the VM's virtual hardware matches
+	// the update's target.
+	HardwareUpdateStateSucceeded HardwareUpdateState = "succeeded"
+
+	// HardwareUpdateStateFailed means the VM could not be reconfigured. The
+	// update is not retried until the target changes.
+	HardwareUpdateStateFailed HardwareUpdateState = "failed"
+)
+
+// DriftPolicy describes how a VM whose configuration no longer matches its
+// spec is handled.
+type DriftPolicy string
+
+const (
+	// DriftPolicyIgnore means drift is not detected. This is the default.
+	DriftPolicyIgnore DriftPolicy = "ignore"
+
+	// DriftPolicyReport means drift is reported with the Drifted condition
+	// and events, but the VM is not changed.
+	DriftPolicyReport DriftPolicy = "report"
+
+	// DriftPolicyRemediate means drift is reported and the VM is changed to
+	// match its spec. Changes to the number of CPUs or the size of memory are
+	// applied the same way as the inPlace HardwareUpdatePolicy. A disk is
+	// never shrunk.
+	DriftPolicyRemediate DriftPolicy = "remediate"
+)
+
+// MetadataSource is the kind of Kubernetes metadata propagated to a VM.
+type MetadataSource string
+
+const (
+	// MetadataSourceLabel means the value is read from a label.
+	MetadataSourceLabel MetadataSource = "label"
+
+	// MetadataSourceAnnotation means the value is read from an annotation.
+	MetadataSourceAnnotation MetadataSource = "annotation"
 )
 
+// MetadataTarget is where Kubernetes metadata is stored on a VM.
+type MetadataTarget string
+
+const (
+	// MetadataTargetAnnotation means the value is stored as a field of a JSON
+	// object in the VM's annotation. The annotation is available on vCenter
+	// and ESXi.
+	MetadataTargetAnnotation MetadataTarget = "annotation"
+
+	// MetadataTargetCustomAttribute means the value is stored in a vCenter
+	// custom attribute. The custom attribute is created if it does not
+	// exist.
+	MetadataTargetCustomAttribute MetadataTarget = "customAttribute"
+)
+
+// MetadataMapping describes a label or annotation that is propagated to a
+// VM. When a VSphereMachine and its Machine both have the label or
+// annotation, the VSphereMachine's value is used.
+type MetadataMapping struct {
+	// Source is the kind of metadata that is propagated.
+	Source MetadataSource `json:"source"`
+
+	// Key is the key of the label or annotation.
+	Key string `json:"key"`
+
+	// Name is the name of the custom attribute or of the annotation's JSON
+	// field.
+	// Defaults to Key.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Target is where the value is stored on the VM.
+	// Defaults to annotation.
+	// +optional
+	Target MetadataTarget `json:"target,omitempty"`
+}
+
+// ConditionType is a valid value for Condition.Type.
+type ConditionType string
+
+const (
+	// DriftedCondition is true when the configuration of a VM no longer
+	// matches its spec.
+	DriftedCondition ConditionType = "Drifted"
+
+	// BootstrapDataScrubbedCondition is true when the bootstrap data has been
+	// removed from the VM's guestinfo.
+	BootstrapDataScrubbedCondition ConditionType = "BootstrapDataScrubbed"
+
+	// DiagnosticsCollectedCondition is true when diagnostics have been
+	// collected from a VM that was not provisioned by its deadline.
+	DiagnosticsCollectedCondition ConditionType = "DiagnosticsCollected"
+
+	// GuestReadyCondition is true when the guest reported it was
+	// bootstrapped successfully.
+	GuestReadyCondition ConditionType = "GuestReady"
+)
+
+const (
+	// DriftDetectedReason is the reason used with the Drifted condition when
+	// drift is detected.
+	DriftDetectedReason = "DriftDetected"
+
+	// NoDriftReason is the reason used with the Drifted condition when the
+	// VM matches its spec.
+	NoDriftReason = "NoDrift"
+
+	// VMReadyReason is the reason used with the BootstrapDataScrubbed
+	// condition when the bootstrap data is removed because the VM is ready.
+	VMReadyReason = "VMReady"
+
+	// NodeJoinedReason is the reason used with the BootstrapDataScrubbed
+	// condition when the bootstrap data is removed because the Machine that
+	// owns the VM has a NodeRef.
+	NodeJoinedReason = "NodeJoined"
+
+	// ProvisioningTimeoutReason is the reason used with the
+	// DiagnosticsCollected condition when diagnostics are collected because
+	// the VM was not provisioned by its deadline.
+	ProvisioningTimeoutReason = "ProvisioningTimeout"
+
+	// GuestReportedReason is the reason used with the GuestReady condition
+	// when the guest reports it was bootstrapped successfully.
+	GuestReportedReason = "GuestReported"
+)
+
+// Condition describes an aspect of the observed state of a resource.
+type Condition struct {
+	// Type is the type of the condition.
+	Type ConditionType `json:"type"`
+
+	// Status is the status of the condition, one of True, False or Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is the last time the condition's status changed.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a brief, CamelCase reason for the condition's last
+	// transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable message with details about the condition.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// AdoptSpec identifies an existing VM to adopt. Exactly one of BiosUUID and
+// InventoryPath must be set.
+type AdoptSpec struct {
+	// BiosUUID is the BIOS UUID of the VM.
+	// +optional
+	BiosUUID string `json:"biosUUID,omitempty"`
+
+	// InventoryPath is the inventory path of the VM, ex. /dc0/vm/folder/vm0.
+	// +optional
+	InventoryPath string `json:"inventoryPath,omitempty"`
+}
+
 // VirtualMachineCloneSpec is information used to clone a virtual machine.
 type VirtualMachineCloneSpec struct {
-	// Template is the name or inventory path of the template used to clone
-	// the virtual machine.
+	// Template is the name, inventory path or instance UUID of the template
+	// used to clone the virtual machine. The instance UUID of a template
+	// imported by a VSphereImage is available from its
+	// Status.TemplateInstanceUUID field.
 	Template string `json:"template"`
 
+	// Adopt identifies an existing VM that is adopted instead of a VM being
+	// cloned from the template. The VM is adopted without being powered off,
+	// and its network devices and virtual hardware must match the spec.
+	// Once adopted, the VM is owned by the VSphereVM and is destroyed when
+	// the VSphereVM is deleted.
+	// +optional
+	Adopt *AdoptSpec `json:"adopt,omitempty"`
+
 	// CloneMode specifies the type of clone operation.
 	// The LinkedClone mode is only support for templates that have at least
 	// one snapshot. If the template has no snapshots, then CloneMode defaults
 	// to FullClone.
 	// When LinkedClone mode is enabled the DiskGiB field is ignored as it is
 	// not possible to expand disks of linked clones.
+	// The InstantClone mode is only supported for sources that are powered-on
+	// VMs with the same number of network devices as the Network field, and
+	// requires vSphere 6.7 or later. If these requirements are not met, then
+	// CloneMode falls back to LinkedClone.
+	// When InstantClone mode is enabled the DiskGiB, NumCPUs,
+	// NumCoresPerSocket and MemoryMiB fields are ignored as the clone inherits
+	// the virtual hardware of the source VM.
 	// Defaults to LinkedClone, but fails gracefully to FullClone if the source
 	// of the clone operation has no snapshots.
 	// +optional
 	CloneMode CloneMode `json:"cloneMode,omitempty"`
 
+	// BootstrapFormat is the format of the bootstrap data.
+	// Defaults to the value of the bootstrap data secret's "format" key, or
+	// cloud-config if the secret has no format.
+	// The InstantClone mode is not supported for the ignition format.
+	// +kubebuilder:validation:Enum=cloud-config;ignition
+	// +optional
+	BootstrapFormat BootstrapFormat `json:"bootstrapFormat,omitempty"`
+
 	// Snapshot is the name of the snapshot from which to create a linked clone.
 	// This field is ignored if LinkedClone is not enabled.
 	// Defaults to the source's current snapshot.
@@ -124,6 +369,176 @@ type VirtualMachineCloneSpec struct {
 	// virtual machine is cloned.
 	// +optional
 	DiskGiB int32 `json:"diskGiB,omitempty"`
+
+	// HardwareUpdatePolicy specifies how changes to the NumCPUs,
+	// NumCoresPerSocket and MemoryMiB fields are applied once the virtual
+	// machine has been created. The inPlace policy may power off the virtual
+	// machine in order to reconfigure it.
+	// Defaults to none.
+	// +optional
+	HardwareUpdatePolicy HardwareUpdatePolicy `json:"hardwareUpdatePolicy,omitempty"`
+
+	// DriftPolicy specifies how changes made to the virtual machine outside
+	// of Cluster API are handled. Drift is detected for the network devices,
+	// the disk size, the number of CPUs, the size of memory, the folder and
+	// the resource pool. Drift is only detected when the policy is report
+	// or remediate.
+	// Defaults to ignore.
+	// +kubebuilder:validation:Enum=ignore;report;remediate
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// PowerState is the desired power state of the virtual machine.
+	// A powered-off virtual machine is not suspended since it must be powered
+	// on first.
+	// Defaults to poweredOn.
+	// +kubebuilder:validation:Enum=poweredOn;poweredOff;suspended
+	// +optional
+	PowerState VirtualMachinePowerState `json:"powerState,omitempty"`
+
+	// PowerOffMode specifies how the virtual machine is powered off, whether
+	// because PowerState is poweredOff, its hardware is updated, or it is
+	// destroyed. The soft and trySoft modes shut down the guest with VMware
+	// Tools so the guest may stop its services cleanly.
+	// Defaults to hard.
+	// +kubebuilder:validation:Enum=hard;soft;trySoft
+	// +optional
+	PowerOffMode VirtualMachinePowerOpMode `json:"powerOffMode,omitempty"`
+
+	// GuestShutdownTimeout is how long to wait for the guest to shut down
+	// when PowerOffMode is soft or trySoft. Once the timeout expires, the
+	// trySoft mode powers off the virtual machine, and the soft mode asks the
+	// guest to shut down again.
+	// Defaults to 5m.
+	// +optional
+	GuestShutdownTimeout *metav1.Duration `json:"guestShutdownTimeout,omitempty"`
+
+	// MetadataMappings specify the labels and annotations of the Machine and
+	// VSphereMachine resources that are propagated to the virtual machine's
+	// custom attributes or annotation. The virtual machine is kept in sync
+	// as the labels and annotations change.
+	// +optional
+	MetadataMappings []MetadataMapping `json:"metadataMappings,omitempty"`
+
+	// Diagnostics may be used to collect diagnostics from the virtual machine
+	// when it is not provisioned by a deadline.
+	// +optional
+	Diagnostics *DiagnosticsSpec `json:"diagnostics,omitempty"`
+
+	// GuestReadiness may be used to require the guest to report it was
+	// bootstrapped successfully before the virtual machine is ready.
+	// +optional
+	GuestReadiness *GuestReadinessSpec `json:"guestReadiness,omitempty"`
+}
+
+// GuestReadinessSpec describes the guestinfo key a guest sets to report
+// whether it was bootstrapped successfully, ex. with
+// "vmware-rpctool 'info-set guestinfo.cloudinit.status done'".
+//
+// The virtual machine is ready once the value of the key is "done". A value
+// of "error", optionally followed by a colon and a message, is a terminal
+// error with the guest's message. Any other value, ex. "running", means the
+// guest is still being bootstrapped. The guest's status is only checked
+// while the virtual machine is powered on.
+type GuestReadinessSpec struct {
+	// Key is the guestinfo key the guest sets to report its status.
+	// Defaults to guestinfo.cloudinit.status.
+	// +kubebuilder:validation:Pattern=`^guestinfo\.`
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// DiagnosticsSpec describes the diagnostics collected from a virtual machine
+// that is not provisioned by a deadline. A virtual machine is provisioned
+// once the Machine that owns it has a NodeRef, or once the virtual machine
+// has an IP address if it is not owned by a Machine.
+//
+// The diagnostics include a screenshot of the console, the status of VMware
+// Tools, the guest heartbeat and the guest's networks. The diagnostics are
+// collected once and stored in a Secret referenced by the VSphereVM's
+// Status.DiagnosticsRef.
+type DiagnosticsSpec struct {
+	// ProvisioningTimeout is how long after the VSphereVM is created the
+	// diagnostics are collected if the virtual machine is not provisioned.
+	// Defaults to 30m.
+	// +optional
+	ProvisioningTimeout *metav1.Duration `json:"provisioningTimeout,omitempty"`
+
+	// GuestCredentialsSecretName is the name of a Secret in the same
+	// namespace with the username and password keys. The credentials are
+	// used to download the GuestLogFiles with the guest operations API.
+	// +optional
+	GuestCredentialsSecretName string `json:"guestCredentialsSecretName,omitempty"`
+
+	// GuestLogFiles are the paths of the files downloaded from the guest when
+	// GuestCredentialsSecretName is specified.
+	// Defaults to /var/log/cloud-init.log and /var/log/cloud-init-output.log.
+	// +optional
+	GuestLogFiles []string `json:"guestLogFiles,omitempty"`
+}
+
+// DriftedField describes a field of a virtual machine's spec that no longer
+// matches the virtual machine.
+type DriftedField struct {
+	// Field is the path of the field in the spec, ex. numCPUs or
+	// network.devices[0].networkName.
+	Field string `json:"field"`
+
+	// Expected is the value described by the spec.
+	Expected string `json:"expected"`
+
+	// Actual is the value observed on the virtual machine.
+	Actual string `json:"actual"`
+}
+
+// String returns the field, expected value and actual value.
+func (d DriftedField) String() string {
+	return fmt.Sprintf("%s: expected %q, actual %q", d.Field, d.Expected, d.Actual)
+}
+
+// VirtualMachineHardware describes the virtual CPUs and memory of a virtual
+// machine.
+type VirtualMachineHardware struct {
+	// NumCPUs is the number of virtual processors.
+	// +optional
+	NumCPUs int32 `json:"numCPUs,omitempty"`
+
+	// NumCoresPerSocket is the number of cores among which the virtual
+	// processors are distributed.
+	// +optional
+	NumCoresPerSocket int32 `json:"numCoresPerSocket,omitempty"`
+
+	// MemoryMiB is the size of memory, in MiB.
+	// +optional
+	MemoryMiB int64 `json:"memoryMiB,omitempty"`
+}
+
+// HardwareUpdateStatus describes the most recent in-place update of a
+// virtual machine's virtual hardware.
+type HardwareUpdateStatus struct {
+	// State is the state of the update.
+	State HardwareUpdateState `json:"state"`
+
+	// Target is the virtual hardware the update applies.
+	Target VirtualMachineHardware `json:"target"`
+
+	// Message describes why the update failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// Tag describes a vSphere tag.
+type Tag struct {
+	// Category is the name of the tag's category.
+	Category string `json:"category"`
+
+	// Name is the name of the tag.
+	Name string `json:"name"`
+}
+
+// String returns the tag as "category:name".
+func (t Tag) String() string {
+	return t.Category + ":" + t.Name
 }
 
 // VSphereMachineTemplateResource describes the data needed to create a VSphereMachine from a template
@@ -182,6 +597,169 @@ type NetworkSpec struct {
 	// server endpoint on this machine
 	// +optional
 	PreferredAPIServerCIDR string `json:"preferredAPIServerCidr,omitempty"`
+
+	// PreferredAPIServerCIDRs are additional preferred CIDRs for the
+	// Kubernetes API server endpoint on this machine, ex. one CIDR per IP
+	// family for a dual-stack machine.
+	// +optional
+	PreferredAPIServerCIDRs []string `json:"preferredAPIServerCidrs,omitempty"`
+
+	// PreferredAPIServerIPFamily is the IP family, IPv4 or IPv6, preferred
+	// for the Kubernetes API server endpoint on this machine. The machine's
+	// addresses are ordered with this family first.
+	// Defaults to IPv4.
+	// +kubebuilder:validation:Enum=IPv4;IPv6
+	// +optional
+	PreferredAPIServerIPFamily corev1.IPFamily `json:"preferredAPIServerIPFamily,omitempty"`
+
+	// InternalCIDRs is a list of CIDRs whose addresses are reported as the
+	// machine's InternalIP addresses. All other addresses are reported as
+	// ExternalIP addresses.
+	// +optional
+	InternalCIDRs []string `json:"internalCidrs,omitempty"`
+
+	// Bonds is a list of bonds of network devices.
+	// A device that is a member of a bond or bridge should not be assigned
+	// any addresses.
+	// Bonds, VLANs and bridges are not supported with the ignition
+	// bootstrap format.
+	// +optional
+	Bonds []NetworkBondSpec `json:"bonds,omitempty"`
+
+	// VLANs is a list of tagged VLAN interfaces of network devices and
+	// bonds.
+	// +optional
+	VLANs []NetworkVLANSpec `json:"vlans,omitempty"`
+
+	// Bridges is a list of bridges of network devices, bonds and VLANs.
+	// +optional
+	Bridges []NetworkBridgeSpec `json:"bridges,omitempty"`
+}
+
+// NetworkInterfaceConfig is the IP configuration of a bond, VLAN or bridge.
+// The fields have the same meaning as the analogous fields of a
+// NetworkDeviceSpec.
+type NetworkInterfaceConfig struct {
+	// DHCP4 is a flag that indicates whether or not to use DHCP for IPv4
+	// on this interface.
+	// +optional
+	DHCP4 bool `json:"dhcp4,omitempty"`
+
+	// DHCP6 is a flag that indicates whether or not to use DHCP for IPv6
+	// on this interface.
+	// +optional
+	DHCP6 bool `json:"dhcp6,omitempty"`
+
+	// Gateway4 is the IPv4 gateway used by this interface.
+	// +optional
+	Gateway4 string `json:"gateway4,omitempty"`
+
+	// Gateway6 is the IPv6 gateway used by this interface.
+	// +optional
+	Gateway6 string `json:"gateway6,omitempty"`
+
+	// IPAddrs is a list of one or more IPv4 and/or IPv6 addresses to assign
+	// to this interface.
+	// +optional
+	IPAddrs []string `json:"ipAddrs,omitempty"`
+
+	// MTU is the interface's Maximum Transmission Unit size in bytes.
+	// +optional
+	MTU *int64 `json:"mtu,omitempty"`
+
+	// Nameservers is a list of IPv4 and/or IPv6 addresses used as DNS
+	// nameservers.
+	// +optional
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// Routes is a list of optional, static routes applied to the interface.
+	// +optional
+	Routes []NetworkRouteSpec `json:"routes,omitempty"`
+
+	// SearchDomains is a list of search domains used when resolving IP
+	// addresses with DNS.
+	// +optional
+	SearchDomains []string `json:"searchDomains,omitempty"`
+}
+
+// NetworkBondSpec defines a bond of network devices.
+type NetworkBondSpec struct {
+	// Name is the name of the bond interface, ex. bond0.
+	Name string `json:"name"`
+
+	// Devices are the indexes of the bond's member devices in the
+	// NetworkSpec's Devices.
+	Devices []int32 `json:"devices"`
+
+	// Mode is the bonding mode.
+	// Defaults to 802.3ad, i.e. LACP.
+	// +kubebuilder:validation:Enum=balance-rr;active-backup;balance-xor;broadcast;"802.3ad";balance-tlb;balance-alb
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// LACPRate is the rate, slow or fast, at which LACPDUs are transmitted
+	// in the 802.3ad mode.
+	// +kubebuilder:validation:Enum=slow;fast
+	// +optional
+	LACPRate string `json:"lacpRate,omitempty"`
+
+	// MIIMonitorInterval is the interval, in milliseconds, at which the
+	// members' link state is checked.
+	// +optional
+	MIIMonitorInterval *int32 `json:"miiMonitorInterval,omitempty"`
+
+	// TransmitHashPolicy is the policy, ex. layer3+4, used to select a
+	// member when transmitting in the balance-xor and 802.3ad modes.
+	// +optional
+	TransmitHashPolicy string `json:"transmitHashPolicy,omitempty"`
+
+	NetworkInterfaceConfig `json:",inline"`
+}
+
+// NetworkVLANSpec defines a tagged VLAN interface.
+type NetworkVLANSpec struct {
+	// Name is the name of the VLAN interface, ex. vlan100.
+	Name string `json:"name"`
+
+	// ID is the VLAN ID.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=4094
+	ID int32 `json:"id"`
+
+	// Device is the index of the device in the NetworkSpec's Devices on
+	// which the VLAN is created.
+	// Exactly one of Device and Bond must be specified.
+	// +optional
+	Device *int32 `json:"device,omitempty"`
+
+	// Bond is the name of the bond on which the VLAN is created.
+	// Exactly one of Device and Bond must be specified.
+	// +optional
+	Bond string `json:"bond,omitempty"`
+
+	NetworkInterfaceConfig `json:",inline"`
+}
+
+// NetworkBridgeSpec defines a bridge.
+type NetworkBridgeSpec struct {
+	// Name is the name of the bridge interface, ex. br0.
+	Name string `json:"name"`
+
+	// Devices are the indexes of the bridge's member devices in the
+	// NetworkSpec's Devices.
+	// +optional
+	Devices []int32 `json:"devices,omitempty"`
+
+	// Interfaces are the names of the bridge's member bonds and VLANs.
+	// +optional
+	Interfaces []string `json:"interfaces,omitempty"`
+
+	// STP is a flag that indicates whether or not the bridge uses the
+	// Spanning Tree Protocol.
+	// +optional
+	STP *bool `json:"stp,omitempty"`
+
+	NetworkInterfaceConfig `json:",inline"`
 }
 
 // NetworkDeviceSpec defines the network configuration for a virtual machine's
@@ -237,6 +815,13 @@ type NetworkDeviceSpec struct {
 	// +optional
 	Nameservers []string `json:"nameservers,omitempty"`
 
+	// IPPools are IPPools, in the VSphereMachine's namespace, from which
+	// addresses are allocated to the device. One address is allocated from
+	// each pool and added to IPAddrs, and the pool's gateway and nameservers
+	// are used if Gateway4, Gateway6 or Nameservers are empty.
+	// +optional
+	IPPools []corev1.LocalObjectReference `json:"ipPools,omitempty"`
+
 	// Routes is a list of optional, static routes applied to the device.
 	// +optional
 	Routes []NetworkRouteSpec `json:"routes,omitempty"`
@@ -304,6 +889,25 @@ const (
 	VirtualMachinePowerStateSuspended = "suspended"
 )
 
+// VirtualMachinePowerOpMode describes how a VM is powered off.
+type VirtualMachinePowerOpMode string
+
+const (
+	// VirtualMachinePowerOpModeHard means the VM is powered off without
+	// shutting down the guest.
+	VirtualMachinePowerOpModeHard VirtualMachinePowerOpMode = "hard"
+
+	// VirtualMachinePowerOpModeSoft means the guest is shut down with VMware
+	// Tools. The VM is never powered off if the guest does not shut down, or
+	// if VMware Tools is not running.
+	VirtualMachinePowerOpModeSoft VirtualMachinePowerOpMode = "soft"
+
+	// VirtualMachinePowerOpModeTrySoft means the guest is shut down with
+	// VMware Tools, and the VM is powered off if the guest does not shut down
+	// before the timeout expires or if VMware Tools is not running.
+	VirtualMachinePowerOpModeTrySoft VirtualMachinePowerOpMode = "trySoft"
+)
+
 // VirtualMachine represents data about a vSphere virtual machine object.
 type VirtualMachine struct {
 	// Name is the VM's name.
@@ -19,6 +19,7 @@ package v1alpha3
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 
 	"sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3/cloudprovider"
 )
@@ -55,11 +56,368 @@ type VSphereClusterSpec struct {
 	// non-empty Status.Address value.
 	// +optional
 	LoadBalancerRef *corev1.ObjectReference `json:"loadBalancerRef,omitempty"`
+
+	// AntiAffinity may be used to enable VM-VM anti-affinity rules that keep
+	// the cluster's VMs on separate ESXi hosts.
+	// +optional
+	AntiAffinity *AntiAffinitySpec `json:"antiAffinity,omitempty"`
+
+	// FailureDomainSelector selects the VSphereFailureDomain resources, in
+	// the cluster's namespace, that are published as the cluster's failure
+	// domains. An empty selector selects all of the namespace's
+	// VSphereFailureDomain resources.
+	// When omitted, the cluster has no failure domains.
+	// +optional
+	FailureDomainSelector *metav1.LabelSelector `json:"failureDomainSelector,omitempty"`
+
+	// Tagging may be used to attach vSphere tags to the cluster's VMs.
+	// +optional
+	Tagging *TaggingSpec `json:"tagging,omitempty"`
+
+	// ManagedPlacement may be used to have the cluster own a VM folder and
+	// a resource pool. Machines that do not specify a folder or resource
+	// pool are placed in them. The folder and resource pool are deleted with
+	// the cluster if they are empty.
+	// +optional
+	ManagedPlacement *ManagedPlacementSpec `json:"managedPlacement,omitempty"`
+
+	// DNS may be used to register the hostnames of the cluster's machines,
+	// and optionally the control plane endpoint, in DNS.
+	// +optional
+	DNS *DNSSpec `json:"dns,omitempty"`
+
+	// Hibernate powers off the cluster's VMs when true and powers them on
+	// again when false. The worker VMs are powered off first, then the
+	// control plane VMs, and finally the load balancer VM. The VMs are
+	// powered on in the reverse order, and the worker VMs are powered on
+	// once the API server is online. VMs whose VSphereVM has a terminal
+	// error are not waited on.
+	//
+	// The Nodes of powered off VMs become NotReady, so a MachineHealthCheck
+	// that targets the cluster's Machines may remediate them. Such
+	// MachineHealthChecks should be removed or paused before the cluster is
+	// hibernated.
+	// +optional
+	Hibernate bool `json:"hibernate,omitempty"`
+
+	// Snapshot may be used to snapshot the cluster's control plane VMs
+	// before the control plane is upgraded and to prune old snapshots.
+	// +optional
+	Snapshot *ClusterSnapshotSpec `json:"snapshot,omitempty"`
+}
+
+// ClusterSnapshotSpec describes the snapshots of a cluster's control plane
+// VMs.
+type ClusterSnapshotSpec struct {
+	// BeforeUpgrade creates a VSphereVMSnapshot of the control plane VMs when
+	// the version of the cluster's KubeadmControlPlane changes.
+	//
+	// The snapshot is best-effort. The KubeadmControlPlane does not wait for
+	// the snapshot, so control plane machines it replaces before the snapshot
+	// is taken are not included.
+	// +optional
+	BeforeUpgrade bool `json:"beforeUpgrade,omitempty"`
+
+	// Memory includes the memory of the VMs in the snapshots created before
+	// an upgrade.
+	// +optional
+	Memory bool `json:"memory,omitempty"`
+
+	// Quiesce quiesces the file systems of the VMs before the snapshots
+	// created before an upgrade are taken.
+	// +optional
+	Quiesce bool `json:"quiesce,omitempty"`
+
+	// Retention is the policy used to prune the cluster's VSphereVMSnapshots.
+	// +optional
+	Retention *SnapshotRetentionPolicy `json:"retention,omitempty"`
+}
+
+// SnapshotRetentionPolicy describes which of a cluster's VSphereVMSnapshots
+// are deleted. The oldest snapshots are deleted first.
+type SnapshotRetentionPolicy struct {
+	// MaxCount is the maximum number of the cluster's VSphereVMSnapshots
+	// that are retained.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxCount int32 `json:"maxCount,omitempty"`
+
+	// MaxAge is the maximum age of the cluster's VSphereVMSnapshots that
+	// are retained.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// DNSSpec describes the registration of a cluster's hostnames in DNS with
+// RFC 2136 dynamic updates.
+type DNSSpec struct {
+	// Server is the address, host or host:port, of the DNS server to which
+	// updates are sent. The port defaults to 53.
+	Server string `json:"server"`
+
+	// Zone is the forward zone, ex. k8s.example.com, in which the A and AAAA
+	// records of the machines' hostnames are registered.
+	Zone string `json:"zone"`
+
+	// ReverseZones are the reverse zones, ex. 1.168.192.in-addr.arpa, in
+	// which the PTR records of the machines' addresses are registered. The
+	// PTR record of an address not in a reverse zone is not registered.
+	// +optional
+	ReverseZones []string `json:"reverseZones,omitempty"`
+
+	// TTL is the TTL, in seconds, of the registered records.
+	// Defaults to 300.
+	// +optional
+	TTL int32 `json:"ttl,omitempty"`
+
+	// TSIGSecretRef is a Secret, in the cluster's namespace, with the TSIG
+	// key used to sign updates. The Secret's "name" key is the key's name,
+	// its "secret" key is the base64 encoded secret, and its optional
+	// "algorithm" key is the key's algorithm, which defaults to
+	// hmac-sha256. When omitted, updates are not signed.
+	// +optional
+	TSIGSecretRef *corev1.LocalObjectReference `json:"tsigSecretRef,omitempty"`
+
+	// ControlPlaneEndpointName is a hostname, ex. api, in Zone that is
+	// registered for the control plane endpoint's address. The control plane
+	// endpoint's host is the hostname's FQDN instead of the address.
+	// +optional
+	ControlPlaneEndpointName string `json:"controlPlaneEndpointName,omitempty"`
+}
+
+// ManagedPlacementSpec describes the VM folder and resource pool owned by a
+// cluster.
+type ManagedPlacementSpec struct {
+	// Name is the name of the folder and resource pool.
+	// Defaults to the name of the VSphereCluster.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Folder describes the cluster's folder. When omitted, the cluster does
+	// not own a folder.
+	// +optional
+	Folder *ManagedFolderSpec `json:"folder,omitempty"`
+
+	// ResourcePool describes the cluster's resource pool. When omitted, the
+	// cluster does not own a resource pool.
+	// +optional
+	ResourcePool *ManagedResourcePoolSpec `json:"resourcePool,omitempty"`
+}
+
+// ManagedFolderSpec describes a VM folder owned by a cluster.
+type ManagedFolderSpec struct {
+	// Parent is the name or inventory path of the folder in which the
+	// cluster's folder is created.
+	// Defaults to the datacenter's VM folder.
+	// +optional
+	Parent string `json:"parent,omitempty"`
+}
+
+// ManagedResourcePoolSpec describes a resource pool owned by a cluster.
+type ManagedResourcePoolSpec struct {
+	// Parent is the name or inventory path of the resource pool in which the
+	// cluster's resource pool is created.
+	// Defaults to the datacenter's default resource pool.
+	// +optional
+	Parent string `json:"parent,omitempty"`
+
+	// CPU is the resource pool's CPU allocation, in MHz.
+	// +optional
+	CPU ResourceAllocation `json:"cpu,omitempty"`
+
+	// Memory is the resource pool's memory allocation, in MiB.
+	// +optional
+	Memory ResourceAllocation `json:"memory,omitempty"`
+}
+
+// SharesLevel is the relative priority of a resource pool's shares.
+type SharesLevel string
+
+const (
+	// SharesLevelLow is a low priority.
+	SharesLevelLow SharesLevel = "low"
+
+	// SharesLevelNormal is a normal priority.
+	SharesLevelNormal SharesLevel = "normal"
+
+	// SharesLevelHigh is a high priority.
+	SharesLevelHigh SharesLevel = "high"
+
+	// SharesLevelCustom means the number of shares is specified.
+	SharesLevelCustom SharesLevel = "custom"
+)
+
+// ResourceAllocation describes the CPU or memory allocation of a resource
+// pool.
+type ResourceAllocation struct {
+	// Reservation is the amount of the resource that is guaranteed to the
+	// resource pool.
+	// Defaults to 0.
+	// +optional
+	Reservation int64 `json:"reservation,omitempty"`
+
+	// ExpandableReservation indicates whether the reservation may grow
+	// beyond the specified value if the parent has unreserved resources.
+	// Defaults to true.
+	// +optional
+	ExpandableReservation *bool `json:"expandableReservation,omitempty"`
+
+	// Limit is the upper bound of the resource pool's usage of the resource.
+	// When omitted, the usage is not limited.
+	// +optional
+	Limit *int64 `json:"limit,omitempty"`
+
+	// Shares is the relative priority of the resource pool's shares.
+	// Defaults to normal.
+	// +optional
+	Shares SharesLevel `json:"shares,omitempty"`
+
+	// SharesCount is the number of shares when Shares is custom.
+	// +optional
+	SharesCount int32 `json:"sharesCount,omitempty"`
+}
+
+// TaggingSpec describes the vSphere tags attached to a cluster's VMs and
+// inventory objects. Each VM is tagged with the cluster's identity, the VM's
+// role, and the zone and region of the VM's failure domain. The zone and
+// region tags use the categories named by the cloud provider
+// configuration's labels, and their names are the failure domain's name and
+// region.
+type TaggingSpec struct {
+	// ClusterCategory is the category of the tag that identifies the
+	// cluster. The tag's name is "<namespace>/<cluster name>". The tag is
+	// deleted when the cluster is deleted.
+	// Defaults to "k8s-cluster".
+	// +optional
+	ClusterCategory string `json:"clusterCategory,omitempty"`
+
+	// RoleCategory is the category of the tag that identifies a VM's role.
+	// The tag's name is either "control-plane" or "worker".
+	// Defaults to "k8s-role".
+	// +optional
+	RoleCategory string `json:"roleCategory,omitempty"`
+
+	// Topology indicates whether the datacenter and compute cluster of each
+	// of the cluster's failure domains are tagged with the region and zone
+	// tags. The vSphere cloud provider reads these tags to label nodes with
+	// their zone and region.
+	// +optional
+	Topology bool `json:"topology,omitempty"`
+}
+
+// HibernationState is the progress of a cluster's hibernation or resumption.
+type HibernationState string
+
+const (
+	// HibernationStateHibernatingWorkers means the worker VMs are being
+	// powered off.
+	HibernationStateHibernatingWorkers HibernationState = "hibernatingWorkers"
+
+	// HibernationStateHibernatingControlPlane means the worker VMs are
+	// powered off and the control plane VMs are being powered off.
+	HibernationStateHibernatingControlPlane HibernationState = "hibernatingControlPlane"
+
+	// HibernationStateHibernatingLoadBalancer means the worker and control
+	// plane VMs are powered off and the load balancer VM is being powered
+	// off.
+	HibernationStateHibernatingLoadBalancer HibernationState = "hibernatingLoadBalancer"
+
+	// HibernationStateHibernated means all of the cluster's VMs are powered
+	// off.
+	HibernationStateHibernated HibernationState = "hibernated"
+
+	// HibernationStateResumingLoadBalancer means the load balancer VM is
+	// being powered on.
+	HibernationStateResumingLoadBalancer HibernationState = "resumingLoadBalancer"
+
+	// HibernationStateResumingControlPlane means the control plane VMs are
+	// being powered on, and the cluster waits for the API server to be
+	// online.
+	HibernationStateResumingControlPlane HibernationState = "resumingControlPlane"
+
+	// HibernationStateResumingWorkers means the worker VMs are being powered
+	// on.
+	HibernationStateResumingWorkers HibernationState = "resumingWorkers"
+)
+
+// AntiAffinityPolicy describes whether VMs are kept on separate hosts.
+type AntiAffinityPolicy string
+
+const (
+	// AntiAffinityPolicyNone means no anti-affinity rule is created.
+	AntiAffinityPolicyNone AntiAffinityPolicy = "none"
+
+	// AntiAffinityPolicySoft means DRS keeps the VMs on separate hosts when
+	// possible, but may place them on the same host.
+	AntiAffinityPolicySoft AntiAffinityPolicy = "soft"
+
+	// AntiAffinityPolicyHard means DRS never places the VMs on the same host,
+	// even if this prevents a VM from being powered on.
+	AntiAffinityPolicyHard AntiAffinityPolicy = "hard"
+)
+
+// AntiAffinitySpec describes the VM-VM anti-affinity rules maintained in the
+// vSphere compute clusters that contain the cluster's VMs. A rule is updated
+// as VMs are created and destroyed, and is removed when the cluster is
+// deleted.
+type AntiAffinitySpec struct {
+	// ControlPlane is the policy of the rule that contains the control plane
+	// VMs.
+	// Defaults to soft.
+	// +optional
+	ControlPlane AntiAffinityPolicy `json:"controlPlane,omitempty"`
+
+	// MachineDeployments is the policy of the rules that contain the VMs of
+	// the cluster's MachineDeployments. A separate rule is maintained for
+	// each MachineDeployment.
+	// Defaults to none.
+	// +optional
+	MachineDeployments AntiAffinityPolicy `json:"machineDeployments,omitempty"`
 }
 
 // VSphereClusterStatus defines the observed state of VSphereClusterSpec
 type VSphereClusterStatus struct {
 	Ready bool `json:"ready"`
+
+	// FailureDomains are the failure domains selected by the cluster's
+	// FailureDomainSelector. Cluster API copies this list into the status of
+	// the owning Cluster resource.
+	// +optional
+	FailureDomains clusterv1.FailureDomains `json:"failureDomains,omitempty"`
+
+	// Folder is the inventory path of the folder owned by the cluster.
+	// +optional
+	Folder string `json:"folder,omitempty"`
+
+	// ResourcePool is the inventory path of the resource pool owned by the
+	// cluster.
+	// +optional
+	ResourcePool string `json:"resourcePool,omitempty"`
+
+	// HibernationState is the progress of the cluster's hibernation or
+	// resumption. This field is empty while the cluster is running.
+	// +optional
+	HibernationState HibernationState `json:"hibernationState,omitempty"`
+
+	// ControlPlaneVersion is the last observed Kubernetes version of the
+	// cluster's KubeadmControlPlane.
+	// +optional
+	ControlPlaneVersion string `json:"controlPlaneVersion,omitempty"`
+
+	// UpgradeSnapshotVersion is the Kubernetes version of the last control
+	// plane upgrade before which the control plane VMs were snapshotted.
+	// +optional
+	UpgradeSnapshotVersion string `json:"upgradeSnapshotVersion,omitempty"`
+
+	// ControlPlaneEndpointDNSName is the FQDN registered in DNS for the
+	// control plane endpoint.
+	// +optional
+	ControlPlaneEndpointDNSName string `json:"controlPlaneEndpointDNSName,omitempty"`
+
+	// ControlPlaneEndpointDNSAddress is the address registered in DNS for
+	// the control plane endpoint's FQDN.
+	// +optional
+	ControlPlaneEndpointDNSAddress string `json:"controlPlaneEndpointDNSAddress,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VSphereFailureDomainSpec defines the desired state of VSphereFailureDomain.
+type VSphereFailureDomainSpec struct {
+	// ControlPlane determines if the failure domain is suitable for control
+	// plane machines.
+	// Defaults to true.
+	// +optional
+	ControlPlane *bool `json:"controlPlane,omitempty"`
+
+	// Region is the name of the region that contains the failure domain.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// Topology describes where the failure domain's VMs are placed.
+	Topology FailureDomainTopology `json:"topology"`
+}
+
+// FailureDomainTopology describes the vSphere inventory objects in which the
+// VMs of a failure domain are placed.
+type FailureDomainTopology struct {
+	// Datacenter is the name or inventory path of the datacenter in which
+	// the VMs are created.
+	Datacenter string `json:"datacenter"`
+
+	// ComputeCluster is the name or inventory path of the compute cluster in
+	// which the VMs are created. The VMs are created in the compute
+	// cluster's root resource pool unless ResourcePool is also set.
+	// +optional
+	ComputeCluster string `json:"computeCluster,omitempty"`
+
+	// ResourcePool is the name or inventory path of the resource pool in
+	// which the VMs are created.
+	// +optional
+	ResourcePool string `json:"resourcePool,omitempty"`
+
+	// Hosts restricts the VMs to a group of hosts in the compute cluster.
+	// +optional
+	Hosts *FailureDomainHosts `json:"hosts,omitempty"`
+
+	// Datastore is the name or inventory path of the datastore in which the
+	// VMs are created.
+	// +optional
+	Datastore string `json:"datastore,omitempty"`
+
+	// Networks are the names of the networks to which the VMs' network
+	// devices are connected, in device order. A VM's network device without
+	// a corresponding network keeps the network from the machine's spec.
+	// +optional
+	Networks []string `json:"networks,omitempty"`
+}
+
+// FailureDomainHosts describes a DRS VM group whose VMs are kept on a DRS
+// host group by a VM-Host affinity rule. The groups and the rule must exist
+// in the compute cluster. VMs are added to the VM group after they are
+// created.
+type FailureDomainHosts struct {
+	// VMGroupName is the name of the DRS VM group.
+	VMGroupName string `json:"vmGroupName"`
+
+	// HostGroupName is the name of the DRS host group.
+	HostGroupName string `json:"hostGroupName"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=vspherefailuredomains,scope=Namespaced
+// +kubebuilder:storageversion
+
+// VSphereFailureDomain is the Schema for the vspherefailuredomains API. The
+// resource's name is the name of the failure domain published to Cluster
+// API.
+type VSphereFailureDomain struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec VSphereFailureDomainSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VSphereFailureDomainList contains a list of VSphereFailureDomain
+type VSphereFailureDomainList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VSphereFailureDomain `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VSphereFailureDomain{}, &VSphereFailureDomainList{})
+}
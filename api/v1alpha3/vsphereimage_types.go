@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ImageFinalizer allows the reconciler to clean up resources associated
+	// with a VSphereImage before removing it from the API server.
+	ImageFinalizer = "vsphereimage.infrastructure.cluster.x-k8s.io"
+)
+
+// VSphereImageSpec defines the desired state of VSphereImage.
+type VSphereImageSpec struct {
+	// Source is the location of the OVA or OVF that is imported.
+	Source VSphereImageSource `json:"source"`
+
+	// TemplateName is the name of the template created from the imported
+	// image.
+	// Defaults to the name of the VSphereImage resource.
+	// +optional
+	TemplateName string `json:"templateName,omitempty"`
+
+	// Checksum is the expected SHA-256 checksum of the image's content,
+	// formatted as "sha256:<hex digest>". If specified, the import fails
+	// when the content's checksum does not match this value.
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+
+	// Server is the IP address or FQDN of the vSphere server into which
+	// the image is imported.
+	Server string `json:"server"`
+
+	// Datacenter is the name or inventory path of the datacenter into which
+	// the image is imported.
+	// +optional
+	Datacenter string `json:"datacenter,omitempty"`
+
+	// Folder is the name or inventory path of the folder in which the
+	// template is created.
+	// +optional
+	Folder string `json:"folder,omitempty"`
+
+	// Datastore is the name or inventory path of the datastore on which the
+	// template's disks are stored.
+	// +optional
+	Datastore string `json:"datastore,omitempty"`
+
+	// ResourcePool is the name or inventory path of the resource pool used
+	// while importing the image.
+	// +optional
+	ResourcePool string `json:"resourcePool,omitempty"`
+
+	// Network is the name of the vSphere network to which all of the
+	// networks defined in the image's descriptor are mapped.
+	// +optional
+	Network string `json:"network,omitempty"`
+}
+
+// VSphereImageSource describes the location of an OVA or OVF.
+type VSphereImageSource struct {
+	// URL is an HTTP or HTTPS URL that references an OVA or OVF. The files
+	// referenced by an OVF descriptor are fetched relative to the URL.
+	URL string `json:"url"`
+}
+
+// VSphereImageStatus defines the observed state of VSphereImage.
+type VSphereImageStatus struct {
+	// Ready is true when the image has been imported, snapshotted and marked
+	// as a template.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// Progress is the percentage, from 0 to 100, of the image's content that
+	// has been uploaded to vSphere.
+	// +optional
+	Progress int32 `json:"progress,omitempty"`
+
+	// TemplateInstanceUUID is the instance UUID of the template created from
+	// the image. This value may be used as the Template field of a
+	// VirtualMachineCloneSpec.
+	// +optional
+	TemplateInstanceUUID string `json:"templateInstanceUUID,omitempty"`
+
+	// Snapshot is the name of the template's snapshot from which linked
+	// clones are created.
+	// +optional
+	Snapshot string `json:"snapshot,omitempty"`
+
+	// Checksum is the SHA-256 checksum of the imported content, formatted as
+	// "sha256:<hex digest>".
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+
+	// ErrorMessage describes the last error that occurred while importing
+	// the image. The import is retried until it succeeds.
+	// +optional
+	ErrorMessage *string `json:"errorMessage,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=vsphereimages,scope=Namespaced
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+
+// VSphereImage is the Schema for the vsphereimages API
+type VSphereImage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VSphereImageSpec   `json:"spec,omitempty"`
+	Status VSphereImageStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VSphereImageList contains a list of VSphereImage
+type VSphereImageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VSphereImage `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VSphereImage{}, &VSphereImageList{})
+}
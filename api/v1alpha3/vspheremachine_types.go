@@ -90,6 +90,11 @@ type VSphereMachineStatus struct {
 	// controller's output.
 	// +optional
 	ErrorMessage *string `json:"errorMessage,omitempty"`
+
+	// DNSAddresses are the addresses registered in DNS for the machine's
+	// hostname.
+	// +optional
+	DNSAddresses []string `json:"dnsAddresses,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -19,6 +19,7 @@ package v1alpha3
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/errors"
 )
 
 const (
@@ -44,6 +45,31 @@ type VSphereVMSpec struct {
 	// this CRD as unstructured data.
 	// +optional
 	BiosUUID string `json:"biosUUID,omitempty"`
+
+	// VMGroupName is the name of a DRS VM group, in the VM's compute
+	// cluster, to which the VM is added after it is created. This field is
+	// set from the topology of the VM's failure domain.
+	// +optional
+	VMGroupName string `json:"vmGroupName,omitempty"`
+
+	// Tags are the vSphere tags attached to the VM. Categories and tags are
+	// created if they do not exist.
+	// +optional
+	Tags []Tag `json:"tags,omitempty"`
+
+	// CustomAttributes are the values of the VM's vCenter custom attributes,
+	// keyed by the attributes' names. An empty value clears the attribute.
+	// This field is set from the MetadataMappings.
+	// +optional
+	CustomAttributes map[string]string `json:"customAttributes,omitempty"`
+
+	// AnnotationFields are the fields of the JSON object stored in the VM's
+	// annotation. The object also contains the "vsphereVM" field, which
+	// identifies the VSphereVM resource. When empty, the annotation only
+	// identifies the VSphereVM resource.
+	// This field is set from the MetadataMappings.
+	// +optional
+	AnnotationFields map[string]string `json:"annotationFields,omitempty"`
 }
 
 // VSphereVMStatus defines the observed state of VSphereVM
@@ -62,11 +88,18 @@ type VSphereVMStatus struct {
 
 	// CloneMode is the type of clone operation used to clone this VM. Since
 	// LinkedMode is the default but fails gracefully if the source of the
-	// clone has no snapshots, this field may be used to determine the actual
-	// type of clone operation used to create this VM.
+	// clone has no snapshots, and InstantClone fails gracefully to LinkedMode
+	// if the source of the clone is not a powered-on VM, this field may be
+	// used to determine the actual type of clone operation used to create
+	// this VM.
 	// +optional
 	CloneMode CloneMode `json:"cloneMode,omitempty"`
 
+	// Adopted is true if the VM existed before the VSphereVM and was adopted
+	// instead of being cloned.
+	// +optional
+	Adopted bool `json:"adopted,omitempty"`
+
 	// Snapshot is the name of the snapshot from which the VM was cloned if
 	// LinkedMode is enabled.
 	// +optional
@@ -78,10 +111,63 @@ type VSphereVMStatus struct {
 	// +optional
 	TaskRef string `json:"taskRef,omitempty"`
 
+	// PowerState is the power state of the VM as observed on vSphere.
+	// +optional
+	PowerState VirtualMachinePowerState `json:"powerState,omitempty"`
+
+	// GuestShutdownTime is when the guest was last asked to shut down by the
+	// soft or trySoft PowerOffMode. This field is cleared once the VM is
+	// powered off.
+	// +optional
+	GuestShutdownTime *metav1.Time `json:"guestShutdownTime,omitempty"`
+
 	// Network returns the network status for each of the machine's configured
 	// network interfaces.
 	// +optional
 	Network []NetworkStatus `json:"network,omitempty"`
+
+	// Hardware is the virtual hardware of the VM as observed on vSphere.
+	// +optional
+	Hardware *VirtualMachineHardware `json:"hardware,omitempty"`
+
+	// HardwareUpdate describes the most recent in-place update of the VM's
+	// virtual hardware. This field is only set when the VM's
+	// HardwareUpdatePolicy is inPlace or its DriftPolicy is remediate.
+	// +optional
+	HardwareUpdate *HardwareUpdateStatus `json:"hardwareUpdate,omitempty"`
+
+	// Conditions describe the observed state of the VM.
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// Drift lists the fields of the spec that no longer match the VM. This
+	// field is not set when the VM's DriftPolicy is ignore.
+	// +optional
+	Drift []DriftedField `json:"drift,omitempty"`
+
+	// Tags are the vSphere tags attached to the VM from the spec's Tags.
+	// +optional
+	Tags []Tag `json:"tags,omitempty"`
+
+	// DiagnosticsRef is a reference to the Secret that contains the
+	// diagnostics collected from the VM when it was not provisioned by its
+	// deadline.
+	// +optional
+	DiagnosticsRef *corev1.ObjectReference `json:"diagnosticsRef,omitempty"`
+
+	// ErrorReason will be set in the event that there is a terminal problem
+	// reconciling the VM and will contain a succinct value suitable for
+	// machine interpretation, ex. bootstrap data that is too large to be
+	// assigned to the VM's guestinfo.
+	// The VSphereMachine that owns the VM reports the same error.
+	// +optional
+	ErrorReason *errors.MachineStatusError `json:"errorReason,omitempty"`
+
+	// ErrorMessage will be set in the event that there is a terminal problem
+	// reconciling the VM and will contain a more verbose string suitable
+	// for logging and human consumption.
+	// +optional
+	ErrorMessage *string `json:"errorMessage,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,145 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// VMSnapshotFinalizer allows the reconciler to remove the vSphere
+	// snapshots of a VSphereVMSnapshot before removing it from the API
+	// server.
+	VMSnapshotFinalizer = "vspherevmsnapshot.infrastructure.cluster.x-k8s.io"
+
+	// VMSnapshotRevertAnnotation is added to a VSphereVMSnapshot to revert
+	// its VMs to their snapshots. The annotation is removed once the VMs are
+	// reverted.
+	VMSnapshotRevertAnnotation = "vspherevmsnapshot.infrastructure.cluster.x-k8s.io/revert"
+)
+
+// VSphereVMSnapshotSpec defines the desired state of VSphereVMSnapshot.
+// Exactly one of VMName and ClusterName must be specified. The spec is not
+// reconciled again once the snapshots are created.
+type VSphereVMSnapshotSpec struct {
+	// VMName is the name of a VSphereVM in the same namespace that is
+	// snapshotted.
+	// +optional
+	VMName string `json:"vmName,omitempty"`
+
+	// ClusterName is the name of a CAPI Cluster in the same namespace whose
+	// control plane VMs are snapshotted.
+	// +optional
+	ClusterName string `json:"clusterName,omitempty"`
+
+	// Description is the description of the vSphere snapshots.
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Memory includes the memory of powered-on VMs in the snapshots so the
+	// VMs are running when they are reverted.
+	// +optional
+	Memory bool `json:"memory,omitempty"`
+
+	// Quiesce quiesces the file systems of powered-on VMs with VMware Tools
+	// before the snapshots are taken.
+	// +optional
+	Quiesce bool `json:"quiesce,omitempty"`
+}
+
+// VSphereVMSnapshotVMStatus is the snapshot of a single VM.
+type VSphereVMSnapshotVMStatus struct {
+	// Name is the name of the VSphereVM.
+	Name string `json:"name"`
+
+	// Server is the vSphere server of the VM.
+	Server string `json:"server"`
+
+	// Datacenter is the datacenter of the VM.
+	// +optional
+	Datacenter string `json:"datacenter,omitempty"`
+
+	// BiosUUID is the BIOS UUID of the VM.
+	BiosUUID string `json:"biosUUID"`
+
+	// Snapshot is the managed object reference ID of the VM's snapshot.
+	// +optional
+	Snapshot string `json:"snapshot,omitempty"`
+
+	// TaskRef is the managed object reference ID of the in-flight task that
+	// is creating, reverting to or removing the VM's snapshot.
+	// +optional
+	TaskRef string `json:"taskRef,omitempty"`
+
+	// Reverted is true once the VM has been reverted to its snapshot for the
+	// current revert request.
+	// +optional
+	Reverted bool `json:"reverted,omitempty"`
+}
+
+// VSphereVMSnapshotStatus defines the observed state of VSphereVMSnapshot.
+type VSphereVMSnapshotStatus struct {
+	// Ready is true when the snapshots of all of the VMs have been created.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// VMs are the snapshots of the VMs.
+	// +optional
+	VMs []VSphereVMSnapshotVMStatus `json:"vms,omitempty"`
+
+	// CreationTime is the time at which the snapshots were created.
+	// +optional
+	CreationTime *metav1.Time `json:"creationTime,omitempty"`
+
+	// LastRevertTime is the time at which the VMs were last reverted to the
+	// snapshots.
+	// +optional
+	LastRevertTime *metav1.Time `json:"lastRevertTime,omitempty"`
+
+	// ErrorMessage describes the last error that occurred while creating,
+	// reverting or removing the snapshots. The operation is retried until it
+	// succeeds.
+	// +optional
+	ErrorMessage *string `json:"errorMessage,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=vspherevmsnapshots,scope=Namespaced
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+
+// VSphereVMSnapshot is the Schema for the vspherevmsnapshots API
+type VSphereVMSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VSphereVMSnapshotSpec   `json:"spec,omitempty"`
+	Status VSphereVMSnapshotStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VSphereVMSnapshotList contains a list of VSphereVMSnapshot
+type VSphereVMSnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VSphereVMSnapshot `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VSphereVMSnapshot{}, &VSphereVMSnapshotList{})
+}
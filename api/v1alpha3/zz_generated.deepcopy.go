@@ -21,7 +21,8 @@ limitations under the License.
 package v1alpha3
 
 import (
-	"k8s.io/api/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	apiv1alpha3 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	"sigs.k8s.io/cluster-api/errors"
@@ -42,6 +43,192 @@ func (in *APIEndpoint) DeepCopy() *APIEndpoint {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdoptSpec) DeepCopyInto(out *AdoptSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdoptSpec.
+func (in *AdoptSpec) DeepCopy() *AdoptSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AdoptSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AntiAffinitySpec) DeepCopyInto(out *AntiAffinitySpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AntiAffinitySpec.
+func (in *AntiAffinitySpec) DeepCopy() *AntiAffinitySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AntiAffinitySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterSnapshotSpec) DeepCopyInto(out *ClusterSnapshotSpec) {
+	*out = *in
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(SnapshotRetentionPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSnapshotSpec.
+func (in *ClusterSnapshotSpec) DeepCopy() *ClusterSnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterSnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
+	if in == nil {
+		return nil
+	}
+	out := new(Condition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSSpec) DeepCopyInto(out *DNSSpec) {
+	*out = *in
+	if in.ReverseZones != nil {
+		in, out := &in.ReverseZones, &out.ReverseZones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TSIGSecretRef != nil {
+		in, out := &in.TSIGSecretRef, &out.TSIGSecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSSpec.
+func (in *DNSSpec) DeepCopy() *DNSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiagnosticsSpec) DeepCopyInto(out *DiagnosticsSpec) {
+	*out = *in
+	if in.ProvisioningTimeout != nil {
+		in, out := &in.ProvisioningTimeout, &out.ProvisioningTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.GuestLogFiles != nil {
+		in, out := &in.GuestLogFiles, &out.GuestLogFiles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiagnosticsSpec.
+func (in *DiagnosticsSpec) DeepCopy() *DiagnosticsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DiagnosticsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftedField) DeepCopyInto(out *DriftedField) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftedField.
+func (in *DriftedField) DeepCopy() *DriftedField {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftedField)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailureDomainHosts) DeepCopyInto(out *FailureDomainHosts) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailureDomainHosts.
+func (in *FailureDomainHosts) DeepCopy() *FailureDomainHosts {
+	if in == nil {
+		return nil
+	}
+	out := new(FailureDomainHosts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailureDomainTopology) DeepCopyInto(out *FailureDomainTopology) {
+	*out = *in
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = new(FailureDomainHosts)
+		**out = **in
+	}
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailureDomainTopology.
+func (in *FailureDomainTopology) DeepCopy() *FailureDomainTopology {
+	if in == nil {
+		return nil
+	}
+	out := new(FailureDomainTopology)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GuestReadinessSpec) DeepCopyInto(out *GuestReadinessSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GuestReadinessSpec.
+func (in *GuestReadinessSpec) DeepCopy() *GuestReadinessSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GuestReadinessSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HAProxyLoadBalancer) DeepCopyInto(out *HAProxyLoadBalancer) {
 	*out = *in
@@ -138,148 +325,906 @@ func (in *HAProxyLoadBalancerStatus) DeepCopy() *HAProxyLoadBalancerStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NetworkDeviceSpec) DeepCopyInto(out *NetworkDeviceSpec) {
+func (in *HardwareUpdateStatus) DeepCopyInto(out *HardwareUpdateStatus) {
 	*out = *in
-	if in.IPAddrs != nil {
-		in, out := &in.IPAddrs, &out.IPAddrs
-		*out = make([]string, len(*in))
-		copy(*out, *in)
+	out.Target = in.Target
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HardwareUpdateStatus.
+func (in *HardwareUpdateStatus) DeepCopy() *HardwareUpdateStatus {
+	if in == nil {
+		return nil
 	}
-	if in.MTU != nil {
-		in, out := &in.MTU, &out.MTU
-		*out = new(int64)
-		**out = **in
+	out := new(HardwareUpdateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAddressClaim) DeepCopyInto(out *IPAddressClaim) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAddressClaim.
+func (in *IPAddressClaim) DeepCopy() *IPAddressClaim {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAddressClaim)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IPAddressClaim) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAddressClaimList) DeepCopyInto(out *IPAddressClaimList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IPAddressClaim, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAddressClaimList.
+func (in *IPAddressClaimList) DeepCopy() *IPAddressClaimList {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAddressClaimList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IPAddressClaimList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAddressClaimSpec) DeepCopyInto(out *IPAddressClaimSpec) {
+	*out = *in
+	out.Pool = in.Pool
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAddressClaimSpec.
+func (in *IPAddressClaimSpec) DeepCopy() *IPAddressClaimSpec {
+	if in == nil {
+		return nil
 	}
+	out := new(IPAddressClaimSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAddressClaimStatus) DeepCopyInto(out *IPAddressClaimStatus) {
+	*out = *in
 	if in.Nameservers != nil {
 		in, out := &in.Nameservers, &out.Nameservers
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
-	if in.Routes != nil {
-		in, out := &in.Routes, &out.Routes
-		*out = make([]NetworkRouteSpec, len(*in))
-		copy(*out, *in)
+	if in.ErrorMessage != nil {
+		in, out := &in.ErrorMessage, &out.ErrorMessage
+		*out = new(string)
+		**out = **in
 	}
-	if in.SearchDomains != nil {
-		in, out := &in.SearchDomains, &out.SearchDomains
-		*out = make([]string, len(*in))
-		copy(*out, *in)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAddressClaimStatus.
+func (in *IPAddressClaimStatus) DeepCopy() *IPAddressClaimStatus {
+	if in == nil {
+		return nil
 	}
+	out := new(IPAddressClaimStatus)
+	in.DeepCopyInto(out)
+	return out
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkDeviceSpec.
-func (in *NetworkDeviceSpec) DeepCopy() *NetworkDeviceSpec {
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAllocation) DeepCopyInto(out *IPAllocation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAllocation.
+func (in *IPAllocation) DeepCopy() *IPAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPPool) DeepCopyInto(out *IPPool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPPool.
+func (in *IPPool) DeepCopy() *IPPool {
+	if in == nil {
+		return nil
+	}
+	out := new(IPPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IPPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPPoolList) DeepCopyInto(out *IPPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IPPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPPoolList.
+func (in *IPPoolList) DeepCopy() *IPPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(IPPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IPPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPPoolSpec) DeepCopyInto(out *IPPoolSpec) {
+	*out = *in
+	if in.Subnets != nil {
+		in, out := &in.Subnets, &out.Subnets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exclusions != nil {
+		in, out := &in.Exclusions, &out.Exclusions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPPoolSpec.
+func (in *IPPoolSpec) DeepCopy() *IPPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IPPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPPoolStatus) DeepCopyInto(out *IPPoolStatus) {
+	*out = *in
+	if in.Allocations != nil {
+		in, out := &in.Allocations, &out.Allocations
+		*out = make([]IPAllocation, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPPoolStatus.
+func (in *IPPoolStatus) DeepCopy() *IPPoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IPPoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedFolderSpec) DeepCopyInto(out *ManagedFolderSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedFolderSpec.
+func (in *ManagedFolderSpec) DeepCopy() *ManagedFolderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedFolderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedPlacementSpec) DeepCopyInto(out *ManagedPlacementSpec) {
+	*out = *in
+	if in.Folder != nil {
+		in, out := &in.Folder, &out.Folder
+		*out = new(ManagedFolderSpec)
+		**out = **in
+	}
+	if in.ResourcePool != nil {
+		in, out := &in.ResourcePool, &out.ResourcePool
+		*out = new(ManagedResourcePoolSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedPlacementSpec.
+func (in *ManagedPlacementSpec) DeepCopy() *ManagedPlacementSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedPlacementSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedResourcePoolSpec) DeepCopyInto(out *ManagedResourcePoolSpec) {
+	*out = *in
+	in.CPU.DeepCopyInto(&out.CPU)
+	in.Memory.DeepCopyInto(&out.Memory)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedResourcePoolSpec.
+func (in *ManagedResourcePoolSpec) DeepCopy() *ManagedResourcePoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedResourcePoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataMapping) DeepCopyInto(out *MetadataMapping) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataMapping.
+func (in *MetadataMapping) DeepCopy() *MetadataMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkBondSpec) DeepCopyInto(out *NetworkBondSpec) {
+	*out = *in
+	if in.Devices != nil {
+		in, out := &in.Devices, &out.Devices
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	if in.MIIMonitorInterval != nil {
+		in, out := &in.MIIMonitorInterval, &out.MIIMonitorInterval
+		*out = new(int32)
+		**out = **in
+	}
+	in.NetworkInterfaceConfig.DeepCopyInto(&out.NetworkInterfaceConfig)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkBondSpec.
+func (in *NetworkBondSpec) DeepCopy() *NetworkBondSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkBondSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkBridgeSpec) DeepCopyInto(out *NetworkBridgeSpec) {
+	*out = *in
+	if in.Devices != nil {
+		in, out := &in.Devices, &out.Devices
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	if in.Interfaces != nil {
+		in, out := &in.Interfaces, &out.Interfaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.STP != nil {
+		in, out := &in.STP, &out.STP
+		*out = new(bool)
+		**out = **in
+	}
+	in.NetworkInterfaceConfig.DeepCopyInto(&out.NetworkInterfaceConfig)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkBridgeSpec.
+func (in *NetworkBridgeSpec) DeepCopy() *NetworkBridgeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkBridgeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkDeviceSpec) DeepCopyInto(out *NetworkDeviceSpec) {
+	*out = *in
+	if in.IPAddrs != nil {
+		in, out := &in.IPAddrs, &out.IPAddrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MTU != nil {
+		in, out := &in.MTU, &out.MTU
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IPPools != nil {
+		in, out := &in.IPPools, &out.IPPools
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]NetworkRouteSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.SearchDomains != nil {
+		in, out := &in.SearchDomains, &out.SearchDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkDeviceSpec.
+func (in *NetworkDeviceSpec) DeepCopy() *NetworkDeviceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkDeviceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkInterfaceConfig) DeepCopyInto(out *NetworkInterfaceConfig) {
+	*out = *in
+	if in.IPAddrs != nil {
+		in, out := &in.IPAddrs, &out.IPAddrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MTU != nil {
+		in, out := &in.MTU, &out.MTU
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]NetworkRouteSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.SearchDomains != nil {
+		in, out := &in.SearchDomains, &out.SearchDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkInterfaceConfig.
+func (in *NetworkInterfaceConfig) DeepCopy() *NetworkInterfaceConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkInterfaceConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkRouteSpec) DeepCopyInto(out *NetworkRouteSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkRouteSpec.
+func (in *NetworkRouteSpec) DeepCopy() *NetworkRouteSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkRouteSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkSpec) DeepCopyInto(out *NetworkSpec) {
+	*out = *in
+	if in.Devices != nil {
+		in, out := &in.Devices, &out.Devices
+		*out = make([]NetworkDeviceSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]NetworkRouteSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.PreferredAPIServerCIDRs != nil {
+		in, out := &in.PreferredAPIServerCIDRs, &out.PreferredAPIServerCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.InternalCIDRs != nil {
+		in, out := &in.InternalCIDRs, &out.InternalCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Bonds != nil {
+		in, out := &in.Bonds, &out.Bonds
+		*out = make([]NetworkBondSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VLANs != nil {
+		in, out := &in.VLANs, &out.VLANs
+		*out = make([]NetworkVLANSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Bridges != nil {
+		in, out := &in.Bridges, &out.Bridges
+		*out = make([]NetworkBridgeSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkSpec.
+func (in *NetworkSpec) DeepCopy() *NetworkSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkStatus) DeepCopyInto(out *NetworkStatus) {
+	*out = *in
+	if in.IPAddrs != nil {
+		in, out := &in.IPAddrs, &out.IPAddrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkStatus.
+func (in *NetworkStatus) DeepCopy() *NetworkStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkVLANSpec) DeepCopyInto(out *NetworkVLANSpec) {
+	*out = *in
+	if in.Device != nil {
+		in, out := &in.Device, &out.Device
+		*out = new(int32)
+		**out = **in
+	}
+	in.NetworkInterfaceConfig.DeepCopyInto(&out.NetworkInterfaceConfig)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkVLANSpec.
+func (in *NetworkVLANSpec) DeepCopy() *NetworkVLANSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkVLANSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceAllocation) DeepCopyInto(out *ResourceAllocation) {
+	*out = *in
+	if in.ExpandableReservation != nil {
+		in, out := &in.ExpandableReservation, &out.ExpandableReservation
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Limit != nil {
+		in, out := &in.Limit, &out.Limit
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceAllocation.
+func (in *ResourceAllocation) DeepCopy() *ResourceAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSHUser) DeepCopyInto(out *SSHUser) {
+	*out = *in
+	if in.AuthorizedKeys != nil {
+		in, out := &in.AuthorizedKeys, &out.AuthorizedKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHUser.
+func (in *SSHUser) DeepCopy() *SSHUser {
+	if in == nil {
+		return nil
+	}
+	out := new(SSHUser)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotRetentionPolicy) DeepCopyInto(out *SnapshotRetentionPolicy) {
+	*out = *in
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotRetentionPolicy.
+func (in *SnapshotRetentionPolicy) DeepCopy() *SnapshotRetentionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotRetentionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Tag) DeepCopyInto(out *Tag) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Tag.
+func (in *Tag) DeepCopy() *Tag {
+	if in == nil {
+		return nil
+	}
+	out := new(Tag)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TaggingSpec) DeepCopyInto(out *TaggingSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TaggingSpec.
+func (in *TaggingSpec) DeepCopy() *TaggingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TaggingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereCluster) DeepCopyInto(out *VSphereCluster) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereCluster.
+func (in *VSphereCluster) DeepCopy() *VSphereCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VSphereCluster) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereClusterList) DeepCopyInto(out *VSphereClusterList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VSphereCluster, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereClusterList.
+func (in *VSphereClusterList) DeepCopy() *VSphereClusterList {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereClusterList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VSphereClusterList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereClusterSpec) DeepCopyInto(out *VSphereClusterSpec) {
+	*out = *in
+	if in.Insecure != nil {
+		in, out := &in.Insecure, &out.Insecure
+		*out = new(bool)
+		**out = **in
+	}
+	in.CloudProviderConfiguration.DeepCopyInto(&out.CloudProviderConfiguration)
+	out.ControlPlaneEndpoint = in.ControlPlaneEndpoint
+	if in.LoadBalancerRef != nil {
+		in, out := &in.LoadBalancerRef, &out.LoadBalancerRef
+		*out = new(corev1.ObjectReference)
+		**out = **in
+	}
+	if in.AntiAffinity != nil {
+		in, out := &in.AntiAffinity, &out.AntiAffinity
+		*out = new(AntiAffinitySpec)
+		**out = **in
+	}
+	if in.FailureDomainSelector != nil {
+		in, out := &in.FailureDomainSelector, &out.FailureDomainSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tagging != nil {
+		in, out := &in.Tagging, &out.Tagging
+		*out = new(TaggingSpec)
+		**out = **in
+	}
+	if in.ManagedPlacement != nil {
+		in, out := &in.ManagedPlacement, &out.ManagedPlacement
+		*out = new(ManagedPlacementSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = new(DNSSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Snapshot != nil {
+		in, out := &in.Snapshot, &out.Snapshot
+		*out = new(ClusterSnapshotSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereClusterSpec.
+func (in *VSphereClusterSpec) DeepCopy() *VSphereClusterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereClusterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereClusterStatus) DeepCopyInto(out *VSphereClusterStatus) {
+	*out = *in
+	if in.FailureDomains != nil {
+		in, out := &in.FailureDomains, &out.FailureDomains
+		*out = make(apiv1alpha3.FailureDomains, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereClusterStatus.
+func (in *VSphereClusterStatus) DeepCopy() *VSphereClusterStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(NetworkDeviceSpec)
+	out := new(VSphereClusterStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NetworkRouteSpec) DeepCopyInto(out *NetworkRouteSpec) {
+func (in *VSphereFailureDomain) DeepCopyInto(out *VSphereFailureDomain) {
 	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkRouteSpec.
-func (in *NetworkRouteSpec) DeepCopy() *NetworkRouteSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereFailureDomain.
+func (in *VSphereFailureDomain) DeepCopy() *VSphereFailureDomain {
 	if in == nil {
 		return nil
 	}
-	out := new(NetworkRouteSpec)
+	out := new(VSphereFailureDomain)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VSphereFailureDomain) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NetworkSpec) DeepCopyInto(out *NetworkSpec) {
+func (in *VSphereFailureDomainList) DeepCopyInto(out *VSphereFailureDomainList) {
 	*out = *in
-	if in.Devices != nil {
-		in, out := &in.Devices, &out.Devices
-		*out = make([]NetworkDeviceSpec, len(*in))
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VSphereFailureDomain, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
-	if in.Routes != nil {
-		in, out := &in.Routes, &out.Routes
-		*out = make([]NetworkRouteSpec, len(*in))
-		copy(*out, *in)
-	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkSpec.
-func (in *NetworkSpec) DeepCopy() *NetworkSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereFailureDomainList.
+func (in *VSphereFailureDomainList) DeepCopy() *VSphereFailureDomainList {
 	if in == nil {
 		return nil
 	}
-	out := new(NetworkSpec)
+	out := new(VSphereFailureDomainList)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NetworkStatus) DeepCopyInto(out *NetworkStatus) {
-	*out = *in
-	if in.IPAddrs != nil {
-		in, out := &in.IPAddrs, &out.IPAddrs
-		*out = make([]string, len(*in))
-		copy(*out, *in)
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkStatus.
-func (in *NetworkStatus) DeepCopy() *NetworkStatus {
-	if in == nil {
-		return nil
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VSphereFailureDomainList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
 	}
-	out := new(NetworkStatus)
-	in.DeepCopyInto(out)
-	return out
+	return nil
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SSHUser) DeepCopyInto(out *SSHUser) {
+func (in *VSphereFailureDomainSpec) DeepCopyInto(out *VSphereFailureDomainSpec) {
 	*out = *in
-	if in.AuthorizedKeys != nil {
-		in, out := &in.AuthorizedKeys, &out.AuthorizedKeys
-		*out = make([]string, len(*in))
-		copy(*out, *in)
+	if in.ControlPlane != nil {
+		in, out := &in.ControlPlane, &out.ControlPlane
+		*out = new(bool)
+		**out = **in
 	}
+	in.Topology.DeepCopyInto(&out.Topology)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHUser.
-func (in *SSHUser) DeepCopy() *SSHUser {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereFailureDomainSpec.
+func (in *VSphereFailureDomainSpec) DeepCopy() *VSphereFailureDomainSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(SSHUser)
+	out := new(VSphereFailureDomainSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *VSphereCluster) DeepCopyInto(out *VSphereCluster) {
+func (in *VSphereImage) DeepCopyInto(out *VSphereImage) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereCluster.
-func (in *VSphereCluster) DeepCopy() *VSphereCluster {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereImage.
+func (in *VSphereImage) DeepCopy() *VSphereImage {
 	if in == nil {
 		return nil
 	}
-	out := new(VSphereCluster)
+	out := new(VSphereImage)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *VSphereCluster) DeepCopyObject() runtime.Object {
+func (in *VSphereImage) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -287,31 +1232,31 @@ func (in *VSphereCluster) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *VSphereClusterList) DeepCopyInto(out *VSphereClusterList) {
+func (in *VSphereImageList) DeepCopyInto(out *VSphereImageList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]VSphereCluster, len(*in))
+		*out = make([]VSphereImage, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereClusterList.
-func (in *VSphereClusterList) DeepCopy() *VSphereClusterList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereImageList.
+func (in *VSphereImageList) DeepCopy() *VSphereImageList {
 	if in == nil {
 		return nil
 	}
-	out := new(VSphereClusterList)
+	out := new(VSphereImageList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *VSphereClusterList) DeepCopyObject() runtime.Object {
+func (in *VSphereImageList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -319,43 +1264,52 @@ func (in *VSphereClusterList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *VSphereClusterSpec) DeepCopyInto(out *VSphereClusterSpec) {
+func (in *VSphereImageSource) DeepCopyInto(out *VSphereImageSource) {
 	*out = *in
-	if in.Insecure != nil {
-		in, out := &in.Insecure, &out.Insecure
-		*out = new(bool)
-		**out = **in
-	}
-	in.CloudProviderConfiguration.DeepCopyInto(&out.CloudProviderConfiguration)
-	out.ControlPlaneEndpoint = in.ControlPlaneEndpoint
-	if in.LoadBalancerRef != nil {
-		in, out := &in.LoadBalancerRef, &out.LoadBalancerRef
-		*out = new(v1.ObjectReference)
-		**out = **in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereImageSource.
+func (in *VSphereImageSource) DeepCopy() *VSphereImageSource {
+	if in == nil {
+		return nil
 	}
+	out := new(VSphereImageSource)
+	in.DeepCopyInto(out)
+	return out
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereClusterSpec.
-func (in *VSphereClusterSpec) DeepCopy() *VSphereClusterSpec {
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereImageSpec) DeepCopyInto(out *VSphereImageSpec) {
+	*out = *in
+	out.Source = in.Source
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereImageSpec.
+func (in *VSphereImageSpec) DeepCopy() *VSphereImageSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(VSphereClusterSpec)
+	out := new(VSphereImageSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *VSphereClusterStatus) DeepCopyInto(out *VSphereClusterStatus) {
+func (in *VSphereImageStatus) DeepCopyInto(out *VSphereImageStatus) {
 	*out = *in
+	if in.ErrorMessage != nil {
+		in, out := &in.ErrorMessage, &out.ErrorMessage
+		*out = new(string)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereClusterStatus.
-func (in *VSphereClusterStatus) DeepCopy() *VSphereClusterStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereImageStatus.
+func (in *VSphereImageStatus) DeepCopy() *VSphereImageStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(VSphereClusterStatus)
+	out := new(VSphereImageStatus)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -465,6 +1419,11 @@ func (in *VSphereMachineStatus) DeepCopyInto(out *VSphereMachineStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.DNSAddresses != nil {
+		in, out := &in.DNSAddresses, &out.DNSAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereMachineStatus.
@@ -628,15 +1587,156 @@ func (in *VSphereVMList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereVMSnapshot) DeepCopyInto(out *VSphereVMSnapshot) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereVMSnapshot.
+func (in *VSphereVMSnapshot) DeepCopy() *VSphereVMSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereVMSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VSphereVMSnapshot) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereVMSnapshotList) DeepCopyInto(out *VSphereVMSnapshotList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VSphereVMSnapshot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereVMSnapshotList.
+func (in *VSphereVMSnapshotList) DeepCopy() *VSphereVMSnapshotList {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereVMSnapshotList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VSphereVMSnapshotList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereVMSnapshotSpec) DeepCopyInto(out *VSphereVMSnapshotSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereVMSnapshotSpec.
+func (in *VSphereVMSnapshotSpec) DeepCopy() *VSphereVMSnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereVMSnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereVMSnapshotStatus) DeepCopyInto(out *VSphereVMSnapshotStatus) {
+	*out = *in
+	if in.VMs != nil {
+		in, out := &in.VMs, &out.VMs
+		*out = make([]VSphereVMSnapshotVMStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.CreationTime != nil {
+		in, out := &in.CreationTime, &out.CreationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRevertTime != nil {
+		in, out := &in.LastRevertTime, &out.LastRevertTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ErrorMessage != nil {
+		in, out := &in.ErrorMessage, &out.ErrorMessage
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereVMSnapshotStatus.
+func (in *VSphereVMSnapshotStatus) DeepCopy() *VSphereVMSnapshotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereVMSnapshotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereVMSnapshotVMStatus) DeepCopyInto(out *VSphereVMSnapshotVMStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereVMSnapshotVMStatus.
+func (in *VSphereVMSnapshotVMStatus) DeepCopy() *VSphereVMSnapshotVMStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereVMSnapshotVMStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VSphereVMSpec) DeepCopyInto(out *VSphereVMSpec) {
 	*out = *in
 	in.VirtualMachineCloneSpec.DeepCopyInto(&out.VirtualMachineCloneSpec)
 	if in.BootstrapRef != nil {
 		in, out := &in.BootstrapRef, &out.BootstrapRef
-		*out = new(v1.ObjectReference)
+		*out = new(corev1.ObjectReference)
 		**out = **in
 	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]Tag, len(*in))
+		copy(*out, *in)
+	}
+	if in.CustomAttributes != nil {
+		in, out := &in.CustomAttributes, &out.CustomAttributes
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.AnnotationFields != nil {
+		in, out := &in.AnnotationFields, &out.AnnotationFields
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereVMSpec.
@@ -657,6 +1757,10 @@ func (in *VSphereVMStatus) DeepCopyInto(out *VSphereVMStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.GuestShutdownTime != nil {
+		in, out := &in.GuestShutdownTime, &out.GuestShutdownTime
+		*out = (*in).DeepCopy()
+	}
 	if in.Network != nil {
 		in, out := &in.Network, &out.Network
 		*out = make([]NetworkStatus, len(*in))
@@ -664,6 +1768,48 @@ func (in *VSphereVMStatus) DeepCopyInto(out *VSphereVMStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Hardware != nil {
+		in, out := &in.Hardware, &out.Hardware
+		*out = new(VirtualMachineHardware)
+		**out = **in
+	}
+	if in.HardwareUpdate != nil {
+		in, out := &in.HardwareUpdate, &out.HardwareUpdate
+		*out = new(HardwareUpdateStatus)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = make([]DriftedField, len(*in))
+		copy(*out, *in)
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]Tag, len(*in))
+		copy(*out, *in)
+	}
+	if in.DiagnosticsRef != nil {
+		in, out := &in.DiagnosticsRef, &out.DiagnosticsRef
+		*out = new(corev1.ObjectReference)
+		**out = **in
+	}
+	if in.ErrorReason != nil {
+		in, out := &in.ErrorReason, &out.ErrorReason
+		*out = new(errors.MachineStatusError)
+		**out = **in
+	}
+	if in.ErrorMessage != nil {
+		in, out := &in.ErrorMessage, &out.ErrorMessage
+		*out = new(string)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereVMStatus.
@@ -701,7 +1847,32 @@ func (in *VirtualMachine) DeepCopy() *VirtualMachine {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VirtualMachineCloneSpec) DeepCopyInto(out *VirtualMachineCloneSpec) {
 	*out = *in
+	if in.Adopt != nil {
+		in, out := &in.Adopt, &out.Adopt
+		*out = new(AdoptSpec)
+		**out = **in
+	}
 	in.Network.DeepCopyInto(&out.Network)
+	if in.GuestShutdownTimeout != nil {
+		in, out := &in.GuestShutdownTimeout, &out.GuestShutdownTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MetadataMappings != nil {
+		in, out := &in.MetadataMappings, &out.MetadataMappings
+		*out = make([]MetadataMapping, len(*in))
+		copy(*out, *in)
+	}
+	if in.Diagnostics != nil {
+		in, out := &in.Diagnostics, &out.Diagnostics
+		*out = new(DiagnosticsSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GuestReadiness != nil {
+		in, out := &in.GuestReadiness, &out.GuestReadiness
+		*out = new(GuestReadinessSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineCloneSpec.
@@ -713,3 +1884,18 @@ func (in *VirtualMachineCloneSpec) DeepCopy() *VirtualMachineCloneSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachineHardware) DeepCopyInto(out *VirtualMachineHardware) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineHardware.
+func (in *VirtualMachineHardware) DeepCopy() *VirtualMachineHardware {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachineHardware)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -98,6 +98,23 @@ func AddHAProxyLoadBalancerControllerToManager(ctx *context.ControllerManagerCon
 				ToRequests: handler.ToRequestsFunc(reconciler.controlPlaneMachineToHAProxyLoadBalancer),
 			},
 		).
+		// Watch the CAPI cluster that the HAProxyLoadBalancer services so
+		// the HAProxyLoadBalancer is reconciled when the cluster is unpaused.
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(reconciler.clusterToHAProxyLoadBalancer),
+			},
+		).
+		// Watch the VSphereCluster that references the HAProxyLoadBalancer so
+		// the HAProxyLoadBalancer is reconciled as the cluster hibernates and
+		// resumes.
+		Watches(
+			&source.Kind{Type: &infrav1.VSphereCluster{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(reconciler.vsphereClusterToHAProxyLoadBalancer),
+			},
+		).
 		// Watch a GenericEvent channel for the controlled resource.
 		//
 		// This is useful when there are events outside of Kubernetes that
@@ -127,6 +144,24 @@ func (r haproxylbReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr
 		return reconcile.Result{}, err
 	}
 
+	// Fetch the CAPI Cluster. The Cluster may already be gone while the
+	// HAProxyLoadBalancer is being deleted, in which case only the
+	// HAProxyLoadBalancer's own paused annotation is considered.
+	cluster, err := clusterutilv1.GetOwnerCluster(r, r.Client, haproxylb.ObjectMeta)
+	if err != nil {
+		if !apierrors.IsNotFound(errors.Cause(err)) || haproxylb.ObjectMeta.DeletionTimestamp.IsZero() {
+			return reconcile.Result{}, err
+		}
+		cluster = nil
+	}
+
+	// Do not reconcile the HAProxyLoadBalancer while it or its cluster is
+	// paused, such as while the cluster is moved with clusterctl move.
+	if isPaused(cluster, haproxylb) {
+		r.Logger.V(4).Info("HAProxyLoadBalancer or linked Cluster is paused, won't reconcile", "key", req.NamespacedName)
+		return reconcile.Result{}, nil
+	}
+
 	// Create the patch helper.
 	patchHelper, err := patch.NewHelper(haproxylb, r.Client)
 	if err != nil {
@@ -163,11 +198,6 @@ func (r haproxylbReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr
 		return r.reconcileDelete(ctx)
 	}
 
-	// Fetch the CAPI Cluster.
-	cluster, err := clusterutilv1.GetOwnerCluster(r, r.Client, haproxylb.ObjectMeta)
-	if err != nil {
-		return reconcile.Result{}, err
-	}
 	if cluster == nil {
 		r.Logger.Info("Waiting for VSphereCluster Controller to set OwnerRef on HAProxyLoadBalancer")
 		return reconcile.Result{}, nil
@@ -267,13 +297,28 @@ func (r haproxylbReconciler) reconcileNormal(ctx *context.HAProxyLoadBalancerCon
 		}
 	}
 
+	// Determine whether the load balancer VM should be powered off because
+	// the cluster is hibernating.
+	hibernationState, err := r.getHibernationState(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	poweredOff := infrautilv1.IsPoweredOffForHibernation(
+		hibernationState, infrautilv1.HibernationRoleLoadBalancer)
+
 	// Reconcile the load balancer VM.
-	vm, err := r.reconcileVM(ctx)
+	vm, err := r.reconcileVM(ctx, poweredOff)
 	if err != nil {
 		return reconcile.Result{}, errors.Wrapf(err,
 			"unexpected error while reconciling vm for %s", ctx)
 	}
 
+	// The load balancer's API is unavailable while its VM is powered off.
+	if poweredOff {
+		ctx.Logger.V(4).Info("load balancer is hibernating", "hibernationState", hibernationState)
+		return reconcile.Result{}, nil
+	}
+
 	if !ctx.HAProxyLoadBalancer.Status.Ready {
 		// Reconcile the HAProxyLoadBalancer's address.
 		if ok, err := r.reconcileNetwork(ctx, vm); !ok {
@@ -471,11 +516,11 @@ func (r haproxylbReconciler) reconcileBackendServers(ctx *context.HAProxyLoadBal
 	}
 	transactionID := optional.NewString(transaction.Id)
 
-	// For each control plane machine with a reported, external IP, attempt to
-	// create a backend server config in the load balancer.
+	// For each control plane machine with a reported, internal or external
+	// IP, attempt to create a backend server config in the load balancer.
 	for _, machine := range controlPlaneMachines {
 		for _, addr := range machine.Status.Addresses {
-			if addr.Type != clusterv1.MachineExternalIP {
+			if addr.Type != clusterv1.MachineExternalIP && addr.Type != clusterv1.MachineInternalIP {
 				continue
 			}
 			// Create a backend server.
@@ -529,9 +574,30 @@ func (r haproxylbReconciler) reconcileBackendServers(ctx *context.HAProxyLoadBal
 	return nil
 }
 
-func (r haproxylbReconciler) reconcileVM(ctx *context.HAProxyLoadBalancerContext) (*unstructured.Unstructured, error) {
+// getHibernationState returns the hibernation state of the VSphereCluster
+// that is the infrastructure cluster of the HAProxyLoadBalancer's Cluster.
+func (r haproxylbReconciler) getHibernationState(ctx *context.HAProxyLoadBalancerContext) (infrav1.HibernationState, error) {
+	infraClusterRef := ctx.Cluster.Spec.InfrastructureRef
+	if infraClusterRef == nil || infraClusterRef.Kind != "VSphereCluster" {
+		return "", nil
+	}
+	vsphereCluster := &infrav1.VSphereCluster{}
+	vsphereClusterKey := client.ObjectKey{
+		Namespace: ctx.Cluster.Namespace,
+		Name:      infraClusterRef.Name,
+	}
+	if err := r.Client.Get(ctx, vsphereClusterKey, vsphereCluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "failed to get VSphereCluster %s for %s", vsphereClusterKey, ctx)
+	}
+	return vsphereCluster.Status.HibernationState, nil
+}
+
+func (r haproxylbReconciler) reconcileVM(ctx *context.HAProxyLoadBalancerContext, poweredOff bool) (*unstructured.Unstructured, error) {
 	// TODO(akutz) Determine the version of vSphere.
-	vm, err := r.reconcileVMPre7(ctx)
+	vm, err := r.reconcileVMPre7(ctx, poweredOff)
 	if err != nil {
 		if !apierrors.IsAlreadyExists(err) {
 			return nil, err
@@ -553,7 +619,7 @@ func (r haproxylbReconciler) reconcileVM(ctx *context.HAProxyLoadBalancerContext
 	return vmObj, nil
 }
 
-func (r haproxylbReconciler) reconcileVMPre7(ctx *context.HAProxyLoadBalancerContext) (runtime.Object, error) {
+func (r haproxylbReconciler) reconcileVMPre7(ctx *context.HAProxyLoadBalancerContext, poweredOff bool) (runtime.Object, error) {
 	// Create or update the VSphereVM resource.
 	vm := &infrav1.VSphereVM{
 		ObjectMeta: metav1.ObjectMeta{
@@ -592,6 +658,12 @@ func (r haproxylbReconciler) reconcileVMPre7(ctx *context.HAProxyLoadBalancerCon
 		// Copy the HAProxyLoadBalancer's VM clone spec into the VSphereVM's
 		// clone spec.
 		ctx.HAProxyLoadBalancer.Spec.VirtualMachineConfiguration.DeepCopyInto(&vm.Spec.VirtualMachineCloneSpec)
+
+		// The load balancer VM is powered off last when the cluster
+		// hibernates and powered on first when it resumes.
+		if poweredOff {
+			vm.Spec.PowerState = infrav1.VirtualMachinePowerStatePoweredOff
+		}
 		return nil
 	}
 	if _, err := ctrlutil.CreateOrUpdate(ctx, ctx.Client, vm, mutateFn); err != nil {
@@ -692,6 +764,58 @@ func (r haproxylbReconciler) controlPlaneMachineToHAProxyLoadBalancer(o handler.
 		return nil
 	}
 
+	return r.clusterToHAProxyLoadBalancerRequests(cluster)
+}
+
+// clusterToHAProxyLoadBalancer is a handler.ToRequestsFunc to be used to
+// trigger reconcile events for an HAProxyLoadBalancer when the CAPI Cluster
+// it services is reconciled, such as when the Cluster is unpaused.
+func (r haproxylbReconciler) clusterToHAProxyLoadBalancer(o handler.MapObject) []ctrl.Request {
+	cluster, ok := o.Object.(*clusterv1.Cluster)
+	if !ok {
+		r.Logger.Error(errors.New("invalid type"),
+			"Expected to receive a CAPI Cluster resource",
+			"expectedType", "Cluster",
+			"actualType", fmt.Sprintf("%T", o.Object))
+		return nil
+	}
+	return r.clusterToHAProxyLoadBalancerRequests(cluster)
+}
+
+// vsphereClusterToHAProxyLoadBalancer is a handler.ToRequestsFunc to be used
+// to trigger reconcile events for the HAProxyLoadBalancer referenced by a
+// VSphereCluster when the VSphereCluster is reconciled, such as when its
+// hibernation state changes.
+func (r haproxylbReconciler) vsphereClusterToHAProxyLoadBalancer(o handler.MapObject) []ctrl.Request {
+	vsphereCluster, ok := o.Object.(*infrav1.VSphereCluster)
+	if !ok {
+		r.Logger.Error(errors.New("invalid type"),
+			"Expected to receive a VSphereCluster resource",
+			"expectedType", "VSphereCluster",
+			"actualType", fmt.Sprintf("%T", o.Object))
+		return nil
+	}
+	loadBalancerRef := vsphereCluster.Spec.LoadBalancerRef
+	if loadBalancerRef == nil || loadBalancerRef.Kind != controlledTypeName {
+		return nil
+	}
+	namespace := loadBalancerRef.Namespace
+	if namespace == "" {
+		namespace = vsphereCluster.Namespace
+	}
+	return []ctrl.Request{
+		{
+			NamespacedName: apitypes.NamespacedName{
+				Namespace: namespace,
+				Name:      loadBalancerRef.Name,
+			},
+		},
+	}
+}
+
+// clusterToHAProxyLoadBalancerRequests returns a request for the
+// HAProxyLoadBalancer referenced by the Cluster's infrastructure cluster.
+func (r haproxylbReconciler) clusterToHAProxyLoadBalancerRequests(cluster *clusterv1.Cluster) []ctrl.Request {
 	if cluster.Spec.InfrastructureRef == nil {
 		return nil
 	}
@@ -751,7 +875,7 @@ func (r haproxylbReconciler) controlPlaneMachineToHAProxyLoadBalancer(o handler.
 	}
 
 	if loadBalancerRef.Name == "" {
-		r.Logger.Error(err, "Infrastructure cluster's spec.loadBalancerRef.Name is empty",
+		r.Logger.Error(errors.New("invalid loadBalancerRef"), "Infrastructure cluster's spec.loadBalancerRef.Name is empty",
 			"infraClusterAPIVersion", infraCluster.GetAPIVersion(),
 			"infraClusterKind", infraCluster.GetKind(),
 			"infraClusterNamespace", infraCluster.GetNamespace(),
@@ -0,0 +1,257 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/ipam"
+)
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=ipaddressclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=ipaddressclaims/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=ippools,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=ippools/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
+
+// AddIPAddressClaimControllerToManager adds the IP address claim controller
+// to the provided manager.
+func AddIPAddressClaimControllerToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) error {
+
+	var (
+		controlledType     = &infrav1.IPAddressClaim{}
+		controlledTypeName = reflect.TypeOf(controlledType).Elem().Name()
+
+		controllerNameShort = fmt.Sprintf("%s-controller", strings.ToLower(controlledTypeName))
+		controllerNameLong  = fmt.Sprintf("%s/%s/%s", ctx.Namespace, ctx.Name, controllerNameShort)
+	)
+
+	// Build the controller context.
+	controllerContext := &context.ControllerContext{
+		ControllerManagerContext: ctx,
+		Name:                     controllerNameShort,
+		Recorder:                 record.New(mgr.GetEventRecorderFor(controllerNameLong)),
+		Logger:                   ctx.Logger.WithName(controllerNameShort),
+	}
+	reconciler := ipAddressClaimReconciler{ControllerContext: controllerContext}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		// Watch the controlled, infrastructure resource.
+		For(controlledType).
+		// Watch the IPPool resources. A claim that could not be allocated an
+		// address is retried when its pool is updated, ex. when an address is
+		// released or a subnet is added.
+		Watches(
+			&source.Kind{Type: &infrav1.IPPool{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(reconciler.poolToClaims),
+			},
+		).
+		Complete(reconciler)
+}
+
+type ipAddressClaimReconciler struct {
+	*context.ControllerContext
+}
+
+// Reconcile ensures the back-end state reflects the Kubernetes resource state intent.
+func (r ipAddressClaimReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr error) {
+
+	// Get the IPAddressClaim resource for this request.
+	claim := &infrav1.IPAddressClaim{}
+	if err := r.Client.Get(r, req.NamespacedName, claim); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Logger.V(4).Info("IPAddressClaim not found, won't reconcile", "key", req.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// Create the patch helper.
+	patchHelper, err := patch.NewHelper(claim, r.Client)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(
+			err,
+			"failed to init patch helper for %s %s/%s",
+			claim.GroupVersionKind(),
+			claim.Namespace,
+			claim.Name)
+	}
+
+	// Create the claim context for this request.
+	claimContext := &context.IPAddressClaimContext{
+		ControllerContext: r.ControllerContext,
+		IPAddressClaim:    claim,
+		Logger:            r.Logger.WithName(req.Namespace).WithName(req.Name),
+		PatchHelper:       patchHelper,
+	}
+
+	// Always issue a patch when exiting this function so changes to the
+	// resource are patched back to the API server.
+	defer func() {
+		if err := claimContext.Patch(); err != nil {
+			if reterr == nil {
+				reterr = err
+			}
+			claimContext.Logger.Error(err, "patch failed", "claim", claimContext.String())
+		}
+	}()
+
+	// Handle deleted claims
+	if !claim.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(claimContext)
+	}
+
+	// Handle non-deleted claims
+	return r.reconcileNormal(claimContext)
+}
+
+func (r ipAddressClaimReconciler) reconcileDelete(ctx *context.IPAddressClaimContext) (reconcile.Result, error) {
+	ctx.Logger.Info("Handling deleted IPAddressClaim")
+
+	pool, err := r.getPool(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Release the claim's address. The pool is updated with the
+	// resourceVersion it was read with, so a concurrent allocation or
+	// release results in a conflict and the release is retried.
+	if pool != nil && ipam.Release(pool, ctx.IPAddressClaim) {
+		if err := ctx.Client.Status().Update(ctx, pool); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err,
+				"failed to release address of %s from IPPool %s/%s", ctx, pool.Namespace, pool.Name)
+		}
+		ctx.Logger.Info("released address", "address", ctx.IPAddressClaim.Status.Address)
+	}
+
+	// The address is released so remove the finalizer.
+	ctrlutil.RemoveFinalizer(ctx.IPAddressClaim, infrav1.IPAddressClaimFinalizer)
+
+	return reconcile.Result{}, nil
+}
+
+func (r ipAddressClaimReconciler) reconcileNormal(ctx *context.IPAddressClaimContext) (reconcile.Result, error) {
+	// If the IPAddressClaim doesn't have our finalizer, add it.
+	ctrlutil.AddFinalizer(ctx.IPAddressClaim, infrav1.IPAddressClaimFinalizer)
+
+	pool, err := r.getPool(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if pool == nil {
+		errorMessage := fmt.Sprintf("IPPool %s not found", ctx.IPAddressClaim.Spec.Pool.Name)
+		ctx.IPAddressClaim.Status.ErrorMessage = &errorMessage
+		ctx.Logger.Info("waiting for IPPool", "pool", ctx.IPAddressClaim.Spec.Pool.Name)
+		return reconcile.Result{}, nil
+	}
+
+	// Allocate an address to the claim. An address already allocated to the
+	// claim, ex. before the controller was restarted, is reused.
+	numAllocations := len(pool.Status.Allocations)
+	address, err := ipam.Allocate(pool, ctx.IPAddressClaim)
+	if err != nil {
+		errorMessage := err.Error()
+		ctx.IPAddressClaim.Status.ErrorMessage = &errorMessage
+		r.Recorder.Warn(ctx.IPAddressClaim, "AllocationFailed", errorMessage)
+		return reconcile.Result{}, nil
+	}
+
+	// Record a new allocation in the pool's status. The pool is updated
+	// with the resourceVersion it was read with, so an address allocated
+	// concurrently to another claim results in a conflict and the
+	// allocation is retried.
+	if len(pool.Status.Allocations) != numAllocations {
+		if err := ctx.Client.Status().Update(ctx, pool); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err,
+				"failed to allocate address to %s from IPPool %s/%s", ctx, pool.Namespace, pool.Name)
+		}
+		r.Recorder.Eventf(ctx.IPAddressClaim, "AllocationSucceeded", "allocated address %s", address)
+	}
+
+	ctx.IPAddressClaim.Status.Address = address
+	ctx.IPAddressClaim.Status.Gateway = pool.Spec.Gateway
+	ctx.IPAddressClaim.Status.Nameservers = pool.Spec.Nameservers
+	ctx.IPAddressClaim.Status.ErrorMessage = nil
+	ctx.IPAddressClaim.Status.Ready = true
+
+	return reconcile.Result{}, nil
+}
+
+// getPool returns the IPAddressClaim's IPPool, or nil if it does not exist.
+func (r ipAddressClaimReconciler) getPool(ctx *context.IPAddressClaimContext) (*infrav1.IPPool, error) {
+	pool := &infrav1.IPPool{}
+	poolKey := apitypes.NamespacedName{
+		Namespace: ctx.IPAddressClaim.Namespace,
+		Name:      ctx.IPAddressClaim.Spec.Pool.Name,
+	}
+	if err := ctx.Client.Get(ctx, poolKey, pool); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get IPPool %s", poolKey)
+	}
+	return pool, nil
+}
+
+// poolToClaims is a handler.ToRequestsFunc that triggers reconcile events
+// for the IPAddressClaim resources that reference an IPPool resource.
+func (r ipAddressClaimReconciler) poolToClaims(o handler.MapObject) []ctrl.Request {
+	pool, ok := o.Object.(*infrav1.IPPool)
+	if !ok {
+		r.Logger.Error(nil, fmt.Sprintf("expected an IPPool but got a %T", o.Object))
+		return nil
+	}
+
+	claims := &infrav1.IPAddressClaimList{}
+	if err := r.Client.List(r, claims, client.InNamespace(pool.Namespace)); err != nil {
+		r.Logger.Error(err, "failed to list IPAddressClaims",
+			"namespace", pool.Namespace)
+		return nil
+	}
+
+	var requests []ctrl.Request
+	for _, claim := range claims.Items {
+		if claim.Spec.Pool.Name != pool.Name {
+			continue
+		}
+		requests = append(requests, ctrl.Request{
+			NamespacedName: apitypes.NamespacedName{
+				Namespace: claim.Namespace,
+				Name:      claim.Name,
+			},
+		})
+	}
+	return requests
+}
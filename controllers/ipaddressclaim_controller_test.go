@@ -0,0 +1,154 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	goctx "context"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+// conflictClient is a client that fails the next status updates with a
+// conflict, as if the objects were updated concurrently.
+type conflictClient struct {
+	client.Client
+	conflicts int
+}
+
+func (c *conflictClient) Status() client.StatusWriter {
+	return conflictStatusWriter{c}
+}
+
+type conflictStatusWriter struct {
+	c *conflictClient
+}
+
+func (w conflictStatusWriter) Update(ctx goctx.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	if w.c.conflicts > 0 {
+		w.c.conflicts--
+		return apierrors.NewConflict(infrav1.GroupVersion.WithResource("ippools").GroupResource(), "pool", nil)
+	}
+	return w.c.Client.Status().Update(ctx, obj, opts...)
+}
+
+func (w conflictStatusWriter) Patch(ctx goctx.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return w.c.Client.Status().Patch(ctx, obj, patch, opts...)
+}
+
+func newIPAddressClaim(name string) *infrav1.IPAddressClaim {
+	return &infrav1.IPAddressClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			UID:       apitypes.UID(name + "-uid"),
+		},
+		Spec: infrav1.IPAddressClaimSpec{
+			Pool: corev1.LocalObjectReference{Name: "pool"},
+		},
+	}
+}
+
+func TestIPAddressClaimReconciler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	pool := &infrav1.IPPool{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pool"},
+		Spec: infrav1.IPPoolSpec{
+			Subnets:     []string{"192.168.1.0/24"},
+			Gateway:     "192.168.1.1",
+			Nameservers: []string{"192.168.1.53"},
+		},
+	}
+	controllerManagerContext := fake.NewControllerManagerContext(pool, newIPAddressClaim("a"), newIPAddressClaim("b"))
+	conflicts := &conflictClient{Client: controllerManagerContext.Client}
+	controllerManagerContext.Client = conflicts
+	reconciler := ipAddressClaimReconciler{ControllerContext: fake.NewControllerContext(controllerManagerContext)}
+
+	reconcile := func(name string) error {
+		_, err := reconciler.Reconcile(ctrl.Request{
+			NamespacedName: apitypes.NamespacedName{Namespace: "default", Name: name},
+		})
+		return err
+	}
+	getClaim := func(name string) *infrav1.IPAddressClaim {
+		claim := &infrav1.IPAddressClaim{}
+		g.Expect(controllerManagerContext.Client.Get(controllerManagerContext,
+			client.ObjectKey{Namespace: "default", Name: name}, claim)).To(gomega.Succeed())
+		return claim
+	}
+	getAllocations := func() []infrav1.IPAllocation {
+		pool := &infrav1.IPPool{}
+		g.Expect(controllerManagerContext.Client.Get(controllerManagerContext,
+			client.ObjectKey{Namespace: "default", Name: "pool"}, pool)).To(gomega.Succeed())
+		return pool.Status.Allocations
+	}
+
+	// An allocation that conflicts with a concurrent update of the pool is
+	// not recorded, and is retried.
+	conflicts.conflicts = 1
+	g.Expect(reconcile("a")).NotTo(gomega.Succeed())
+	claim := getClaim("a")
+	g.Expect(claim.Finalizers).To(gomega.ConsistOf(infrav1.IPAddressClaimFinalizer))
+	g.Expect(claim.Status.Ready).To(gomega.BeFalse())
+	g.Expect(getAllocations()).To(gomega.BeEmpty())
+
+	g.Expect(reconcile("a")).To(gomega.Succeed())
+	claim = getClaim("a")
+	g.Expect(claim.Status.Ready).To(gomega.BeTrue())
+	g.Expect(claim.Status.Address).To(gomega.Equal("192.168.1.2/24"))
+	g.Expect(claim.Status.Gateway).To(gomega.Equal("192.168.1.1"))
+	g.Expect(claim.Status.Nameservers).To(gomega.Equal([]string{"192.168.1.53"}))
+
+	// The claims are allocated unique addresses, and an allocated address
+	// is reused.
+	g.Expect(reconcile("b")).To(gomega.Succeed())
+	g.Expect(getClaim("b").Status.Address).To(gomega.Equal("192.168.1.3/24"))
+	g.Expect(reconcile("a")).To(gomega.Succeed())
+	g.Expect(getClaim("a").Status.Address).To(gomega.Equal("192.168.1.2/24"))
+	g.Expect(getAllocations()).To(gomega.HaveLen(2))
+
+	// A deleted claim's address is released before its finalizer is
+	// removed.
+	claim = getClaim("a")
+	now := metav1.NewTime(time.Now())
+	claim.DeletionTimestamp = &now
+	g.Expect(controllerManagerContext.Client.Update(controllerManagerContext, claim)).To(gomega.Succeed())
+	conflicts.conflicts = 1
+	g.Expect(reconcile("a")).NotTo(gomega.Succeed())
+	g.Expect(getClaim("a").Finalizers).To(gomega.ConsistOf(infrav1.IPAddressClaimFinalizer))
+	g.Expect(getAllocations()).To(gomega.HaveLen(2))
+
+	g.Expect(reconcile("a")).To(gomega.Succeed())
+	g.Expect(getClaim("a").Finalizers).To(gomega.BeEmpty())
+	g.Expect(getAllocations()).To(gomega.ConsistOf(infrav1.IPAllocation{
+		Claim:    "b",
+		ClaimUID: "b-uid",
+		Address:  "192.168.1.3",
+	}))
+}
@@ -0,0 +1,311 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereclusters,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspheremachines,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherevms,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get
+
+var (
+	orphanedVMs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "capv_orphaned_vms",
+			Help: "Number of VMs whose VSphereVM no longer exists.",
+		},
+		[]string{"server", "datacenter"},
+	)
+	orphanedVMsDeleted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "capv_orphaned_vms_deleted_total",
+			Help: "Total number of VMs deleted because their VSphereVM no longer exists.",
+		},
+		[]string{"server", "datacenter"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(orphanedVMs, orphanedVMsDeleted)
+}
+
+// AddOrphanVMScannerToManager adds the orphaned VM scanner to the provided
+// manager. The scanner periodically finds the VMs whose VSphereVM no longer
+// exists, ex. because the VSphereVM was deleted while its VM was being
+// cloned, on the vSphere endpoints used by the VSphereClusters, the
+// VSphereMachines and the VSphereVMs. The orphaned VMs are reported with
+// events and metrics. The orphaned VMs created by this management cluster are
+// deleted once they are orphaned for the grace period unless the scanner is
+// in dry-run mode.
+func AddOrphanVMScannerToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) error {
+	if ctx.OrphanVMScanPeriod <= 0 {
+		return nil
+	}
+
+	var (
+		scannerNameShort = "orphan-vm-scanner"
+		scannerNameLong  = fmt.Sprintf("%s/%s/%s", ctx.Namespace, ctx.Name, scannerNameShort)
+	)
+
+	// Build the controller context.
+	controllerContext := &context.ControllerContext{
+		ControllerManagerContext: ctx,
+		Name:                     scannerNameShort,
+		Recorder:                 record.New(mgr.GetEventRecorderFor(scannerNameLong)),
+		Logger:                   ctx.Logger.WithName(scannerNameShort),
+	}
+	scanner := &orphanVMScanner{
+		ControllerContext: controllerContext,
+		firstSeen:         map[string]time.Time{},
+	}
+
+	// The scanner is run only by the leader.
+	return mgr.Add(manager.RunnableFunc(scanner.Start))
+}
+
+type orphanVMScanner struct {
+	*context.ControllerContext
+
+	// firstSeen is when each orphaned VM was first found, by endpoint and
+	// managed object reference.
+	firstSeen map[string]time.Time
+
+	// pod is the controller manager's pod, on which events are recorded
+	// since an orphaned VM has no resource.
+	pod *corev1.Pod
+}
+
+// vsphereEndpoint is a vSphere server and datacenter.
+type vsphereEndpoint struct {
+	server     string
+	datacenter string
+}
+
+// Start scans for orphaned VMs until the stop channel is closed.
+func (s *orphanVMScanner) Start(stop <-chan struct{}) error {
+	s.Logger.Info("starting",
+		"period", s.OrphanVMScanPeriod,
+		"grace-period", s.OrphanVMGracePeriod,
+		"dry-run", s.OrphanVMDryRun)
+	s.pod = s.getPod()
+	wait.Until(s.scan, s.OrphanVMScanPeriod, stop)
+	return nil
+}
+
+// getPod returns the controller manager's pod, whose name and namespace are
+// provided with the downward API. The pod is read from the API server so
+// the events recorded on it include its UID.
+func (s *orphanVMScanner) getPod() *corev1.Pod {
+	pod := &corev1.Pod{}
+	podKey := client.ObjectKey{Namespace: s.Namespace, Name: s.ControllerManagerContext.Name}
+	if err := s.APIReader.Get(s, podKey, pod); err != nil {
+		s.Logger.Error(err, "failed to get controller manager pod", "pod", podKey)
+		pod.Namespace, pod.Name = podKey.Namespace, podKey.Name
+	}
+	return pod
+}
+
+func (s *orphanVMScanner) scan() {
+	uids, endpoints, err := s.getVSphereVMsAndEndpoints()
+	if err != nil {
+		s.Logger.Error(err, "failed to list resources")
+		return
+	}
+
+	seen := map[string]struct{}{}
+	for _, endpoint := range endpoints {
+		if err := s.scanEndpoint(endpoint, uids, seen); err != nil {
+			s.Logger.Error(err, "failed to scan for orphaned VMs",
+				"server", endpoint.server, "datacenter", endpoint.datacenter)
+		}
+	}
+
+	// Forget the VMs that are no longer orphaned.
+	for key := range s.firstSeen {
+		if _, ok := seen[key]; !ok {
+			delete(s.firstSeen, key)
+		}
+	}
+}
+
+// getVSphereVMsAndEndpoints returns the UIDs of the VSphereVMs and the
+// vSphere endpoints used by the VSphereClusters, VSphereMachines and
+// VSphereVMs.
+func (s *orphanVMScanner) getVSphereVMsAndEndpoints() (map[string]struct{}, []vsphereEndpoint, error) {
+	var (
+		uids         = map[string]struct{}{}
+		endpointsSet = map[vsphereEndpoint]struct{}{}
+		listOpts     = client.InNamespace(s.WatchNamespace)
+	)
+
+	vsphereVMList := &infrav1.VSphereVMList{}
+	if err := s.Client.List(s, vsphereVMList, listOpts); err != nil {
+		return nil, nil, err
+	}
+	for _, vm := range vsphereVMList.Items {
+		uids[string(vm.UID)] = struct{}{}
+		endpointsSet[vsphereEndpoint{vm.Spec.Server, vm.Spec.Datacenter}] = struct{}{}
+	}
+
+	vsphereMachineList := &infrav1.VSphereMachineList{}
+	if err := s.Client.List(s, vsphereMachineList, listOpts); err != nil {
+		return nil, nil, err
+	}
+	for _, machine := range vsphereMachineList.Items {
+		endpointsSet[vsphereEndpoint{machine.Spec.Server, machine.Spec.Datacenter}] = struct{}{}
+	}
+
+	vsphereClusterList := &infrav1.VSphereClusterList{}
+	if err := s.Client.List(s, vsphereClusterList, listOpts); err != nil {
+		return nil, nil, err
+	}
+	for _, cluster := range vsphereClusterList.Items {
+		endpointsSet[vsphereEndpoint{
+			cluster.Spec.Server,
+			cluster.Spec.CloudProviderConfiguration.Workspace.Datacenter,
+		}] = struct{}{}
+	}
+
+	endpoints := make([]vsphereEndpoint, 0, len(endpointsSet))
+	for endpoint := range endpointsSet {
+		if endpoint.server != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].server != endpoints[j].server {
+			return endpoints[i].server < endpoints[j].server
+		}
+		return endpoints[i].datacenter < endpoints[j].datacenter
+	})
+	return uids, endpoints, nil
+}
+
+// scanEndpoint reports the orphaned VMs on the vSphere endpoint, and deletes
+// those that are orphaned for the grace period unless the scanner is in
+// dry-run mode.
+func (s *orphanVMScanner) scanEndpoint(endpoint vsphereEndpoint, uids map[string]struct{}, seen map[string]struct{}) error {
+	authSession, err := session.GetOrCreate(s, endpoint.server, endpoint.datacenter, s.Username, s.Password)
+	if err != nil {
+		return err
+	}
+	orphans, err := govmomi.FindOrphanedVMs(s, authSession, s.WatchNamespace, uids)
+	if err != nil {
+		return err
+	}
+	orphanedVMs.WithLabelValues(endpoint.server, endpoint.datacenter).Set(float64(len(orphans)))
+
+	now := time.Now()
+	for _, orphan := range orphans {
+		logger := s.Logger.WithValues(
+			"server", endpoint.server,
+			"datacenter", endpoint.datacenter,
+			"vm", orphan.Name,
+			"vsphereVM", orphan.Namespace+"/"+orphan.VSphereVMName,
+			"vsphereVMUID", orphan.UID)
+
+		// A VM that was not created or adopted by this management cluster
+		// may belong to a VSphereVM in another management cluster that uses
+		// the same vSphere endpoint, so it is only reported.
+		managed := orphan.ManagementClusterID == s.ManagementClusterID
+
+		key := fmt.Sprintf("%s/%s/%s", endpoint.server, endpoint.datacenter, orphan.Ref.Value)
+		seen[key] = struct{}{}
+		firstSeen, ok := s.firstSeen[key]
+		if !ok {
+			firstSeen = now
+			s.firstSeen[key] = now
+			logger.Info("found orphaned VM", "managementClusterID", orphan.ManagementClusterID)
+			if managed {
+				s.Recorder.Warnf(s.pod, "OrphanedVM",
+					"VM %s on %s was created for VSphereVM %s/%s, which no longer exists",
+					orphan.Name, endpoint.server, orphan.Namespace, orphan.VSphereVMName)
+			} else {
+				s.Recorder.Warnf(s.pod, "OrphanedVM",
+					"VM %s on %s was created for VSphereVM %s/%s, which does not exist, but not by this management cluster, so it is not deleted",
+					orphan.Name, endpoint.server, orphan.Namespace, orphan.VSphereVMName)
+			}
+		}
+
+		if !managed || s.OrphanVMDryRun || now.Sub(firstSeen) < s.OrphanVMGracePeriod {
+			continue
+		}
+
+		// The VSphereVMs were listed from the cache, which may not yet have
+		// a VSphereVM that was just created. The VSphereVM is read from the
+		// API server before its VM is deleted.
+		if orphaned, err := s.isOrphaned(orphan); err != nil || !orphaned {
+			if err != nil {
+				logger.Error(err, "failed to get VSphereVM of orphaned VM")
+			}
+			continue
+		}
+
+		logger.Info("deleting orphaned VM")
+		if err := govmomi.DestroyOrphanedVM(s, authSession, orphan); err != nil {
+			s.Recorder.Warnf(s.pod, "OrphanedVMDeleteFailure",
+				"Failed to delete orphaned VM %s on %s: %v", orphan.Name, endpoint.server, err)
+			logger.Error(err, "failed to delete orphaned VM")
+			continue
+		}
+		delete(s.firstSeen, key)
+		orphanedVMsDeleted.WithLabelValues(endpoint.server, endpoint.datacenter).Inc()
+		s.Recorder.Eventf(s.pod, "OrphanedVMDeleted",
+			"Deleted VM %s on %s, which was created for VSphereVM %s/%s",
+			orphan.Name, endpoint.server, orphan.Namespace, orphan.VSphereVMName)
+	}
+	return nil
+}
+
+// isOrphaned returns true if the VSphereVM for which the VM was created does
+// not exist. The VSphereVM is read from the API server rather than from the
+// cache. A VM whose VSphereVM was recreated with the same name is not
+// orphaned while the VSphereVM has a task in flight, such as a clone.
+func (s *orphanVMScanner) isOrphaned(orphan govmomi.OrphanedVM) (bool, error) {
+	vsphereVM := &infrav1.VSphereVM{}
+	vsphereVMKey := client.ObjectKey{Namespace: orphan.Namespace, Name: orphan.VSphereVMName}
+	if err := s.APIReader.Get(s, vsphereVMKey, vsphereVM); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if string(vsphereVM.UID) == orphan.UID {
+		return false, nil
+	}
+	return vsphereVM.Status.TaskRef == "", nil
+}
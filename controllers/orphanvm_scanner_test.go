@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi"
+)
+
+func TestOrphanVMScannerIsOrphaned(t *testing.T) {
+	newVSphereVM := func(uid, taskRef string) *infrav1.VSphereVM {
+		return &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "vm",
+				UID:       apitypes.UID(uid),
+			},
+			Status: infrav1.VSphereVMStatus{
+				TaskRef: taskRef,
+			},
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		vsphereVM        *infrav1.VSphereVM
+		expectedOrphaned bool
+	}{
+		{
+			name:             "vspherevm does not exist",
+			expectedOrphaned: true,
+		},
+		{
+			name:      "vspherevm exists",
+			vsphereVM: newVSphereVM("uid", ""),
+		},
+		{
+			name:             "vspherevm recreated",
+			vsphereVM:        newVSphereVM("new-uid", ""),
+			expectedOrphaned: true,
+		},
+		{
+			name:      "vspherevm recreated with task in flight",
+			vsphereVM: newVSphereVM("new-uid", "task-1"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			controllerManagerContext := fake.NewControllerManagerContext()
+			if tc.vsphereVM != nil {
+				if err := controllerManagerContext.Client.Create(controllerManagerContext, tc.vsphereVM); err != nil {
+					t.Fatal(err)
+				}
+			}
+			scanner := &orphanVMScanner{
+				ControllerContext: fake.NewControllerContext(controllerManagerContext),
+			}
+
+			orphaned, err := scanner.isOrphaned(govmomi.OrphanedVM{
+				Namespace:     "default",
+				VSphereVMName: "vm",
+				UID:           "uid",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if orphaned != tc.expectedOrphaned {
+				t.Errorf("expected orphaned %v, got %v", tc.expectedOrphaned, orphaned)
+			}
+		})
+	}
+}
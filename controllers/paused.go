@@ -0,0 +1,34 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	clusterutilv1 "sigs.k8s.io/cluster-api/util"
+)
+
+// isPaused returns true if the object has the Cluster API paused annotation
+// or its cluster is paused. The cluster may be nil if the object is not yet
+// a member of a cluster.
+func isPaused(cluster *clusterv1.Cluster, obj metav1.Object) bool {
+	if cluster != nil {
+		return clusterutilv1.IsPaused(cluster, obj)
+	}
+	_, ok := obj.GetAnnotations()[clusterv1.PausedAnnotation]
+	return ok
+}
@@ -18,19 +18,25 @@ package controllers
 
 import (
 	"fmt"
+	"net"
 	"reflect"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
 	apiv1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	controlplanev1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
 	clusterutilv1 "sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -39,6 +45,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
@@ -46,17 +53,29 @@ import (
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/cloudprovider"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/dns"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/cluster"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/tags"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
 	infrautilv1 "sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
 )
 
 var (
 	defaultAPIEndpointPort = int32(6443)
+
+	// hibernationRequeuePeriod is how often a VSphereCluster is reconciled
+	// while it hibernates or resumes.
+	hibernationRequeuePeriod = 10 * time.Second
 )
 
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;patch
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereclusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherevms,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherefailuredomains,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherevmsnapshots,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=controlplane.cluster.x-k8s.io,resources=kubeadmcontrolplanes,verbs=get;list;watch
 
 // AddClusterControllerToManager adds the cluster controller to the provided
 // manager.
@@ -81,7 +100,7 @@ func AddClusterControllerToManager(ctx *context.ControllerManagerContext, mgr ma
 
 	reconciler := clusterReconciler{ControllerContext: controllerContext}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	controller, err := ctrl.NewControllerManagedBy(mgr).
 		// Watch the controlled, infrastructure resource.
 		For(controlledType).
 		// Watch the CAPI resource that owns this infrastructure resource.
@@ -112,6 +131,23 @@ func AddClusterControllerToManager(ctx *context.ControllerManagerContext, mgr ma
 				ToRequests: handler.ToRequestsFunc(reconciler.loadBalancerToCluster),
 			},
 		).
+		// Watch the cluster's VSphereVMSnapshot resources. This controller
+		// needs to prune the snapshots according to the cluster's retention
+		// policy as snapshots are created.
+		Watches(
+			&source.Kind{Type: &infrav1.VSphereVMSnapshot{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(reconciler.vmSnapshotToCluster),
+			},
+		).
+		// Watch the failure domain resources. This controller needs to publish
+		// the failure domains selected by a VSphereCluster.
+		Watches(
+			&source.Kind{Type: &infrav1.VSphereFailureDomain{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(reconciler.failureDomainToClusters),
+			},
+		).
 		// Watch a GenericEvent channel for the controlled resource.
 		//
 		// This is useful when there are events outside of Kubernetes that
@@ -121,7 +157,91 @@ func AddClusterControllerToManager(ctx *context.ControllerManagerContext, mgr ma
 			&source.Channel{Source: ctx.GetGenericEventChannelFor(controlledTypeGVK)},
 			&handler.EnqueueRequestForObject{},
 		).
-		Complete(reconciler)
+		Build(reconciler)
+	if err != nil {
+		return err
+	}
+
+	// Watch the KubeadmControlPlane resources if their CRD is installed. This
+	// controller needs to snapshot the control plane VMs as soon as the
+	// version of the control plane changes.
+	controlPlaneGVK := controlplanev1.GroupVersion.WithKind("KubeadmControlPlane")
+	if _, err := mgr.GetRESTMapper().RESTMapping(controlPlaneGVK.GroupKind(), controlPlaneGVK.Version); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return errors.Wrapf(err, "failed to get REST mapping for %s", controlPlaneGVK)
+		}
+		controllerContext.Logger.Info("KubeadmControlPlane CRD is not installed, won't watch KubeadmControlPlanes")
+	} else if err := controller.Watch(
+		&source.Kind{Type: &controlplanev1.KubeadmControlPlane{}},
+		&handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(reconciler.controlPlaneToCluster),
+		},
+		predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return isControlPlaneVersionUpdate(e.ObjectOld, e.ObjectNew)
+			},
+			DeleteFunc: func(event.DeleteEvent) bool {
+				return false
+			},
+			GenericFunc: func(event.GenericEvent) bool {
+				return false
+			},
+		},
+	); err != nil {
+		return err
+	}
+
+	// Watch the cluster's VSphereVM resources. This controller needs to
+	// reconcile the anti-affinity rules as VMs are created and destroyed, and
+	// to observe the VMs' power states while the cluster is hibernated. The
+	// anti-affinity rules are reconciled with calls to vSphere, so the other
+	// updates to the VSphereVM resources are filtered out.
+	return controller.Watch(
+		&source.Kind{Type: &infrav1.VSphereVM{}},
+		&handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(reconciler.vmToCluster),
+		},
+		predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return isClusterVMUpdate(e.ObjectOld, e.ObjectNew)
+			},
+			GenericFunc: func(event.GenericEvent) bool {
+				return false
+			},
+		},
+	)
+}
+
+// isClusterVMUpdate returns true if a VSphereVM update is relevant to the
+// VSphereCluster, i.e. it changes the VM's membership in an anti-affinity
+// rule or its power state.
+func isClusterVMUpdate(oldObj, newObj runtime.Object) bool {
+	oldVM, ok := oldObj.(*infrav1.VSphereVM)
+	if !ok {
+		return false
+	}
+	newVM, ok := newObj.(*infrav1.VSphereVM)
+	if !ok {
+		return false
+	}
+	return oldVM.Spec.BiosUUID != newVM.Spec.BiosUUID ||
+		oldVM.DeletionTimestamp.IsZero() != newVM.DeletionTimestamp.IsZero() ||
+		oldVM.Status.PowerState != newVM.Status.PowerState ||
+		!reflect.DeepEqual(oldVM.Labels, newVM.Labels)
+}
+
+// isControlPlaneVersionUpdate returns true if a KubeadmControlPlane update
+// changes the control plane's Kubernetes version.
+func isControlPlaneVersionUpdate(oldObj, newObj runtime.Object) bool {
+	oldControlPlane, ok := oldObj.(*controlplanev1.KubeadmControlPlane)
+	if !ok {
+		return false
+	}
+	newControlPlane, ok := newObj.(*controlplanev1.KubeadmControlPlane)
+	if !ok {
+		return false
+	}
+	return oldControlPlane.Spec.Version != newControlPlane.Spec.Version
 }
 
 type clusterReconciler struct {
@@ -151,6 +271,13 @@ func (r clusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr er
 		return reconcile.Result{}, nil
 	}
 
+	// Do not reconcile the VSphereCluster while it or its cluster is paused,
+	// such as while the cluster is moved with clusterctl move.
+	if isPaused(cluster, vsphereCluster) {
+		r.Logger.V(4).Info("VSphereCluster or linked Cluster is paused, won't reconcile", "key", req.NamespacedName)
+		return reconcile.Result{}, nil
+	}
+
 	// Create the patch helper.
 	patchHelper, err := patch.NewHelper(vsphereCluster, r.Client)
 	if err != nil {
@@ -194,6 +321,34 @@ func (r clusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr er
 func (r clusterReconciler) reconcileDelete(ctx *context.ClusterContext) (reconcile.Result, error) {
 	ctx.Logger.Info("Reconciling VSphereCluster delete")
 
+	// Remove the cluster's anti-affinity rules.
+	if err := r.reconcileAntiAffinityDelete(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to remove anti-affinity rules for VSphereCluster %s/%s",
+			ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
+	}
+
+	// Delete the cluster's identity tag.
+	if err := r.reconcileTagsDelete(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to delete tags for VSphereCluster %s/%s",
+			ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
+	}
+
+	// Delete the folder and resource pool owned by the cluster.
+	if err := r.reconcileManagedPlacementDelete(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to delete managed placement for VSphereCluster %s/%s",
+			ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
+	}
+
+	// Delete the control plane endpoint's DNS records.
+	if err := r.reconcileControlPlaneEndpointDNSDelete(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to delete control plane endpoint DNS records for VSphereCluster %s/%s",
+			ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
+	}
+
 	// Cluster is deleted so remove the finalizer.
 	ctrlutil.RemoveFinalizer(ctx.VSphereCluster, infrav1.ClusterFinalizer)
 
@@ -206,6 +361,27 @@ func (r clusterReconciler) reconcileNormal(ctx *context.ClusterContext) (reconci
 	// If the VSphereCluster doesn't have our finalizer, add it.
 	ctrlutil.AddFinalizer(ctx.VSphereCluster, infrav1.ClusterFinalizer)
 
+	// Publish the VSphereCluster's failure domains.
+	if err := r.reconcileFailureDomains(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to reconcile failure domains for VSphereCluster %s/%s",
+			ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
+	}
+
+	// Tag the inventory objects of the VSphereCluster's failure domains.
+	if err := r.reconcileTopologyTags(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to reconcile topology tags for VSphereCluster %s/%s",
+			ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
+	}
+
+	// Create the folder and resource pool owned by the VSphereCluster.
+	if err := r.reconcileManagedPlacement(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to reconcile managed placement for VSphereCluster %s/%s",
+			ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
+	}
+
 	// Reconcile the VSphereCluster's load balancer.
 	if ok, err := r.reconcileLoadBalancer(ctx); !ok {
 		if err != nil {
@@ -219,6 +395,37 @@ func (r clusterReconciler) reconcileNormal(ctx *context.ClusterContext) (reconci
 	// Reconcile the VSphereCluster resource's ready state.
 	ctx.VSphereCluster.Status.Ready = true
 
+	// Power the cluster's VMs off or on while the cluster hibernates or
+	// resumes.
+	if ok, err := r.reconcileHibernation(ctx); !ok {
+		if err != nil {
+			return reconcile.Result{}, errors.Wrapf(err,
+				"unexpected error while reconciling hibernation for %s", ctx)
+		}
+		if ctx.VSphereCluster.Status.HibernationState == infrav1.HibernationStateHibernated {
+			ctx.Logger.Info("cluster is hibernated")
+			return reconcile.Result{}, nil
+		}
+		ctx.Logger.Info("hibernation is not reconciled",
+			"hibernationState", ctx.VSphereCluster.Status.HibernationState)
+		return reconcile.Result{RequeueAfter: hibernationRequeuePeriod}, nil
+	}
+
+	// Snapshot the control plane VMs before an upgrade and prune the
+	// cluster's old snapshots.
+	if err := r.reconcileSnapshots(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to reconcile snapshots for VSphereCluster %s/%s",
+			ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
+	}
+
+	// Reconcile the anti-affinity rules for the cluster's VMs.
+	if err := r.reconcileAntiAffinity(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to reconcile anti-affinity rules for VSphereCluster %s/%s",
+			ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
+	}
+
 	// Reconcile the VSphereCluster resource's control plane endpoint.
 	if ok, err := r.reconcileControlPlaneEndpoint(ctx); !ok {
 		if err != nil {
@@ -380,12 +587,19 @@ func (r clusterReconciler) reconcileLoadBalancer(ctx *context.ClusterContext) (b
 		return false, nil
 	}
 
+	// Register the load balancer's address in DNS if the control plane
+	// endpoint has a DNS name.
+	host, err := r.reconcileControlPlaneEndpointDNS(ctx, address)
+	if err != nil {
+		return false, err
+	}
+
 	// Update the VSphereCluster.Spec.ControlPlaneEndpoint with the address
 	// from the load balancer.
 	// The control plane endpoint also requires a port, which is obtained
 	// either from the VSphereCluster.Spec.ControlPlaneEndpoint.Port
 	// or the default port is used.
-	ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Host = address
+	ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Host = host
 	if ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Port == 0 {
 		ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Port = defaultAPIEndpointPort
 	}
@@ -401,6 +615,21 @@ func (r clusterReconciler) reconcileControlPlaneEndpoint(ctx *context.ClusterCon
 	// ControlPlaneInitialized.
 	defer r.reconcileVSphereClusterWhenAPIServerIsOnline(ctx)
 
+	// Keep the control plane endpoint's DNS record pointed at a current
+	// control plane machine, as the machine whose address was registered
+	// may be deleted after the endpoint is set, ex. during an upgrade.
+	if ctx.VSphereCluster.Spec.LoadBalancerRef == nil && hasControlPlaneEndpointDNSName(ctx.VSphereCluster) {
+		ipAddr, err := r.getControlPlaneMachineAddress(ctx)
+		if err != nil {
+			return false, err
+		}
+		if ipAddr != "" {
+			if _, err := r.reconcileControlPlaneEndpointDNS(ctx, ipAddr); err != nil {
+				return false, err
+			}
+		}
+	}
+
 	// If the cluster already has a control plane endpoint set then there
 	// is nothing to do.
 	if !ctx.Cluster.Spec.ControlPlaneEndpoint.IsZero() {
@@ -419,15 +648,46 @@ func (r clusterReconciler) reconcileControlPlaneEndpoint(ctx *context.ClusterCon
 		return true, nil
 	}
 
+	ipAddr, err := r.getControlPlaneMachineAddress(ctx)
+	if err != nil {
+		return false, err
+	}
+	if ipAddr == "" {
+		return false, errors.Errorf("unable to determine control plane endpoint for %s", ctx)
+	}
+
+	// Register the machine's address in DNS if the control plane
+	// endpoint has a DNS name.
+	host, err := r.reconcileControlPlaneEndpointDNS(ctx, ipAddr)
+	if err != nil {
+		return false, err
+	}
+
+	// Set the ControlPlaneEndpoint so the CAPI controller can read the
+	// value into the analogous CAPI Cluster using an UnstructuredReader.
+	ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Host = host
+	ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Port = defaultAPIEndpointPort
+	ctx.Logger.Info(
+		"ControlPlaneEndpoin discovered via control plane machine",
+		"controlPlaneEndpoint", ctx.VSphereCluster.Spec.ControlPlaneEndpoint)
+	return true, nil
+}
+
+// getControlPlaneMachineAddress returns the preferred IP address of one of
+// the cluster's control plane machines, or an empty string if none of the
+// machines has an address. The address registered in DNS for the control
+// plane endpoint is returned as long as a control plane machine has it.
+func (r clusterReconciler) getControlPlaneMachineAddress(ctx *context.ClusterContext) (string, error) {
 	// Get the CAPI Machine resources for the cluster.
 	machines, err := infrautilv1.GetMachinesInCluster(ctx, ctx.Client, ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
 	if err != nil {
-		return false, errors.Wrapf(err,
+		return "", errors.Wrapf(err,
 			"failed to get Machinces for Cluster %s/%s",
 			ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
 	}
 
 	// Iterate over the cluster's control plane CAPI machines.
+	var address string
 	for _, machine := range clusterutilv1.GetControlPlaneMachines(machines) {
 
 		// Only machines with bootstrap data will have an IP address.
@@ -439,10 +699,15 @@ func (r clusterReconciler) reconcileControlPlaneEndpoint(ctx *context.ClusterCon
 			continue
 		}
 
+		// Machines that are being deleted are not a control plane endpoint.
+		if !machine.DeletionTimestamp.IsZero() {
+			continue
+		}
+
 		// Get the VSphereMachine for the CAPI Machine resource.
 		vsphereMachine, err := infrautilv1.GetVSphereMachine(ctx, ctx.Client, machine.Namespace, machine.Name)
 		if err != nil {
-			return false, errors.Wrapf(err,
+			return "", errors.Wrapf(err,
 				"failed to get VSphereMachine for Machine %s/%s/%s",
 				machine.GroupVersionKind(),
 				machine.Namespace,
@@ -455,24 +720,20 @@ func (r clusterReconciler) reconcileControlPlaneEndpoint(ctx *context.ClusterCon
 			if err == infrautilv1.ErrNoMachineIPAddr {
 				continue
 			}
-			return false, errors.Wrapf(err,
+			return "", errors.Wrapf(err,
 				"failed to get preferred IP address for VSphereMachine %s %s/%s",
 				vsphereMachine.GroupVersionKind(),
 				vsphereMachine.Namespace,
 				vsphereMachine.Name)
 		}
-
-		// Set the ControlPlaneEndpoint so the CAPI controller can read the
-		// value into the analogous CAPI Cluster using an UnstructuredReader.
-		ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Host = ipAddr
-		ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Port = defaultAPIEndpointPort
-		ctx.Logger.Info(
-			"ControlPlaneEndpoin discovered via control plane machine",
-			"controlPlaneEndpoint", ctx.VSphereCluster.Spec.ControlPlaneEndpoint)
-		return true, nil
+		if ipAddr == ctx.VSphereCluster.Status.ControlPlaneEndpointDNSAddress {
+			return ipAddr, nil
+		}
+		if address == "" {
+			address = ipAddr
+		}
 	}
-
-	return false, errors.Errorf("unable to determine control plane endpoint for %s", ctx)
+	return address, nil
 }
 
 var (
@@ -771,6 +1032,493 @@ func (r clusterReconciler) reconcileCloudConfigSecret(ctx *context.ClusterContex
 	return nil
 }
 
+// reconcileFailureDomains publishes the failure domains selected by the
+// VSphereCluster's FailureDomainSelector.
+func (r clusterReconciler) reconcileFailureDomains(ctx *context.ClusterContext) error {
+	failureDomains, err := r.getFailureDomains(ctx)
+	if err != nil {
+		return err
+	}
+	if failureDomains == nil {
+		ctx.VSphereCluster.Status.FailureDomains = nil
+		return nil
+	}
+
+	result := clusterv1.FailureDomains{}
+	for _, failureDomain := range failureDomains {
+		controlPlane := true
+		if failureDomain.Spec.ControlPlane != nil {
+			controlPlane = *failureDomain.Spec.ControlPlane
+		}
+		topology := failureDomain.Spec.Topology
+		attributes := map[string]string{
+			"datacenter": topology.Datacenter,
+		}
+		if topology.ComputeCluster != "" {
+			attributes["computeCluster"] = topology.ComputeCluster
+		}
+		if topology.Datastore != "" {
+			attributes["datastore"] = topology.Datastore
+		}
+		result[failureDomain.Name] = clusterv1.FailureDomainSpec{
+			ControlPlane: controlPlane,
+			Attributes:   attributes,
+		}
+	}
+	ctx.VSphereCluster.Status.FailureDomains = result
+	return nil
+}
+
+// getFailureDomains returns the VSphereFailureDomain resources selected by
+// the VSphereCluster's FailureDomainSelector. Resources that are being
+// deleted are not returned. Nil is returned if the VSphereCluster does not
+// have a FailureDomainSelector.
+func (r clusterReconciler) getFailureDomains(ctx *context.ClusterContext) ([]infrav1.VSphereFailureDomain, error) {
+	if ctx.VSphereCluster.Spec.FailureDomainSelector == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(ctx.VSphereCluster.Spec.FailureDomainSelector)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid failure domain selector")
+	}
+
+	failureDomains := &infrav1.VSphereFailureDomainList{}
+	if err := r.Client.List(ctx, failureDomains,
+		client.InNamespace(ctx.VSphereCluster.Namespace),
+		client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, errors.Wrap(err, "failed to list VSphereFailureDomains")
+	}
+
+	result := []infrav1.VSphereFailureDomain{}
+	for _, failureDomain := range failureDomains.Items {
+		if failureDomain.DeletionTimestamp.IsZero() {
+			result = append(result, failureDomain)
+		}
+	}
+	return result, nil
+}
+
+// reconcileTopologyTags tags the datacenter and compute cluster of each of
+// the VSphereCluster's failure domains with the failure domain's region and
+// zone tags.
+func (r clusterReconciler) reconcileTopologyTags(ctx *context.ClusterContext) error {
+	if ctx.VSphereCluster.Spec.Tagging == nil || !ctx.VSphereCluster.Spec.Tagging.Topology {
+		return nil
+	}
+	failureDomains, err := r.getFailureDomains(ctx)
+	if err != nil || len(failureDomains) == 0 {
+		return err
+	}
+	authSession, err := r.getSession(ctx)
+	if err != nil {
+		return err
+	}
+	ctx.Session = authSession
+
+	for i := range failureDomains {
+		failureDomain := &failureDomains[i]
+		topology := failureDomain.Spec.Topology
+
+		// Use a separate finder since the session's finder is shared.
+		finder := find.NewFinder(authSession.Client.Client, false)
+		datacenter, err := finder.Datacenter(ctx, topology.Datacenter)
+		if err != nil {
+			return errors.Wrapf(err, "unable to find datacenter %q of failure domain %s",
+				topology.Datacenter, failureDomain.Name)
+		}
+		finder.SetDatacenter(datacenter)
+
+		if tag, ok := tags.RegionTag(ctx.VSphereCluster, failureDomain); ok {
+			if err := tags.Attach(ctx, datacenter, tag); err != nil {
+				return err
+			}
+		}
+		if tag, ok := tags.ZoneTag(ctx.VSphereCluster, failureDomain); ok && topology.ComputeCluster != "" {
+			computeCluster, err := finder.ClusterComputeResource(ctx, topology.ComputeCluster)
+			if err != nil {
+				return errors.Wrapf(err, "unable to find compute cluster %q of failure domain %s",
+					topology.ComputeCluster, failureDomain.Name)
+			}
+			if err := tags.Attach(ctx, computeCluster, tag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileTagsDelete deletes the tag that identifies the cluster's VMs.
+func (r clusterReconciler) reconcileTagsDelete(ctx *context.ClusterContext) error {
+	if ctx.VSphereCluster.Spec.Tagging == nil {
+		return nil
+	}
+	authSession, err := r.getSession(ctx)
+	if err != nil {
+		return err
+	}
+	ctx.Session = authSession
+	return tags.Delete(ctx, tags.ClusterTag(ctx.VSphereCluster))
+}
+
+// failureDomainToClusters is a handler.ToRequestsFunc that triggers
+// reconcile events for the VSphereCluster resources in the namespace of a
+// VSphereFailureDomain resource.
+func (r clusterReconciler) failureDomainToClusters(o handler.MapObject) []ctrl.Request {
+	failureDomain, ok := o.Object.(*infrav1.VSphereFailureDomain)
+	if !ok {
+		r.Logger.Error(nil, fmt.Sprintf("expected a VSphereFailureDomain but got a %T", o.Object))
+		return nil
+	}
+
+	vsphereClusters := &infrav1.VSphereClusterList{}
+	if err := r.Client.List(r, vsphereClusters, client.InNamespace(failureDomain.Namespace)); err != nil {
+		r.Logger.Error(err, "failed to list VSphereClusters",
+			"namespace", failureDomain.Namespace)
+		return nil
+	}
+
+	var requests []ctrl.Request
+	for _, vsphereCluster := range vsphereClusters.Items {
+		if vsphereCluster.Spec.FailureDomainSelector == nil {
+			continue
+		}
+		requests = append(requests, ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: vsphereCluster.Namespace,
+				Name:      vsphereCluster.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// reconcileManagedPlacement creates the folder and resource pool owned by
+// the VSphereCluster, and records their inventory paths in the
+// VSphereCluster's status.
+func (r clusterReconciler) reconcileManagedPlacement(ctx *context.ClusterContext) error {
+	placement := ctx.VSphereCluster.Spec.ManagedPlacement
+	if placement == nil || (placement.Folder == nil && placement.ResourcePool == nil) {
+		return nil
+	}
+	name := placement.Name
+	if name == "" {
+		name = ctx.VSphereCluster.Name
+	}
+	authSession, err := r.getSession(ctx)
+	if err != nil {
+		return err
+	}
+	ctx.Session = authSession
+
+	if placement.Folder != nil {
+		folderPath, err := cluster.ReconcileFolder(ctx, placement.Folder.Parent, name)
+		if err != nil {
+			return err
+		}
+		ctx.VSphereCluster.Status.Folder = folderPath
+	}
+	if placement.ResourcePool != nil {
+		poolPath, err := cluster.ReconcileResourcePool(ctx, name, *placement.ResourcePool)
+		if err != nil {
+			return err
+		}
+		ctx.VSphereCluster.Status.ResourcePool = poolPath
+	}
+	return nil
+}
+
+// reconcileManagedPlacementDelete deletes the folder and resource pool owned
+// by the VSphereCluster if they are empty. A folder or resource pool that is
+// not empty is left in place so the cluster's deletion is not blocked.
+func (r clusterReconciler) reconcileManagedPlacementDelete(ctx *context.ClusterContext) error {
+	status := &ctx.VSphereCluster.Status
+	if status.Folder == "" && status.ResourcePool == "" {
+		return nil
+	}
+	authSession, err := r.getSession(ctx)
+	if err != nil {
+		return err
+	}
+	ctx.Session = authSession
+
+	if status.ResourcePool != "" {
+		deleted, err := cluster.DeleteResourcePoolIfEmpty(ctx, status.ResourcePool)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			r.Recorder.Warnf(ctx.VSphereCluster, "ResourcePoolNotEmpty",
+				"resource pool %s is not deleted because it is not empty", status.ResourcePool)
+		}
+		status.ResourcePool = ""
+	}
+	if status.Folder != "" {
+		deleted, err := cluster.DeleteFolderIfEmpty(ctx, status.Folder)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			r.Recorder.Warnf(ctx.VSphereCluster, "FolderNotEmpty",
+				"folder %s is not deleted because it is not empty", status.Folder)
+		}
+		status.Folder = ""
+	}
+	return nil
+}
+
+// hasControlPlaneEndpointDNSName returns true if the VSphereCluster's DNS
+// configuration names the control plane endpoint.
+func hasControlPlaneEndpointDNSName(vsphereCluster *infrav1.VSphereCluster) bool {
+	return vsphereCluster.Spec.DNS != nil && vsphereCluster.Spec.DNS.ControlPlaneEndpointName != ""
+}
+
+// reconcileControlPlaneEndpointDNS registers the address of the control
+// plane endpoint in DNS when the VSphereCluster's DNS configuration names
+// the control plane endpoint, and returns the FQDN of the name. Otherwise
+// the address is returned. The records are only updated when the FQDN or
+// the address differs from the ones recorded in the VSphereCluster's status.
+func (r clusterReconciler) reconcileControlPlaneEndpointDNS(ctx *context.ClusterContext, address string) (string, error) {
+	if !hasControlPlaneEndpointDNSName(ctx.VSphereCluster) {
+		return address, nil
+	}
+	dnsSpec := ctx.VSphereCluster.Spec.DNS
+
+	// A load balancer's address may already be a DNS name.
+	if net.ParseIP(address) == nil {
+		return address, nil
+	}
+
+	dnsClient, err := dns.NewClient(ctx, ctx.Client, ctx.VSphereCluster)
+	if err != nil {
+		return "", err
+	}
+	fqdn := strings.TrimSuffix(dnsClient.FQDN(dnsSpec.ControlPlaneEndpointName), ".")
+	status := &ctx.VSphereCluster.Status
+	if status.ControlPlaneEndpointDNSName == fqdn && status.ControlPlaneEndpointDNSAddress == address {
+		return fqdn, nil
+	}
+
+	if err := dnsClient.UpdateAddressRecords(ctx, dnsSpec.ControlPlaneEndpointName, []string{address}); err != nil {
+		return "", err
+	}
+	status.ControlPlaneEndpointDNSName = fqdn
+	status.ControlPlaneEndpointDNSAddress = address
+	r.Recorder.Eventf(ctx.VSphereCluster, "DNSRecordsUpdated",
+		"registered control plane endpoint %s with address %s", fqdn, address)
+	return fqdn, nil
+}
+
+// reconcileControlPlaneEndpointDNSDelete deletes the DNS records of the
+// control plane endpoint's name.
+func (r clusterReconciler) reconcileControlPlaneEndpointDNSDelete(ctx *context.ClusterContext) error {
+	dnsSpec := ctx.VSphereCluster.Spec.DNS
+	if dnsSpec == nil || dnsSpec.ControlPlaneEndpointName == "" {
+		return nil
+	}
+	dnsClient, err := dns.NewClient(ctx, ctx.Client, ctx.VSphereCluster)
+	if err != nil {
+		return err
+	}
+	if err := dnsClient.DeleteAddressRecords(ctx, dnsSpec.ControlPlaneEndpointName); err != nil {
+		return err
+	}
+	ctx.VSphereCluster.Status.ControlPlaneEndpointDNSName = ""
+	ctx.VSphereCluster.Status.ControlPlaneEndpointDNSAddress = ""
+	return nil
+}
+
+// antiAffinityRulePrefix returns the prefix of the names of the cluster's
+// anti-affinity rules. A Kubernetes name cannot contain a slash, so the
+// prefix of one cluster is never the prefix of another cluster's rules.
+func antiAffinityRulePrefix(ctx *context.ClusterContext) string {
+	return fmt.Sprintf("capv/%s/%s/", ctx.VSphereCluster.Namespace, ctx.VSphereCluster.Name)
+}
+
+// getSession returns a session for the datacenter that contains the
+// cluster's VMs.
+func (r clusterReconciler) getSession(ctx *context.ClusterContext) (*session.Session, error) {
+	authSession, err := session.GetOrCreate(ctx,
+		ctx.VSphereCluster.Spec.Server,
+		ctx.VSphereCluster.Spec.CloudProviderConfiguration.Workspace.Datacenter,
+		ctx.Username, ctx.Password)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create vSphere session")
+	}
+	return authSession, nil
+}
+
+// reconcileAntiAffinity maintains a VM-VM anti-affinity rule for the
+// cluster's control plane VMs and for the VMs of each of the cluster's
+// MachineDeployments.
+func (r clusterReconciler) reconcileAntiAffinity(ctx *context.ClusterContext) error {
+	if ctx.VSphereCluster.Spec.AntiAffinity == nil {
+		return nil
+	}
+	controlPlanePolicy := ctx.VSphereCluster.Spec.AntiAffinity.ControlPlane
+	if controlPlanePolicy == "" {
+		controlPlanePolicy = infrav1.AntiAffinityPolicySoft
+	}
+	machineDeploymentPolicy := ctx.VSphereCluster.Spec.AntiAffinity.MachineDeployments
+	if machineDeploymentPolicy == "" {
+		machineDeploymentPolicy = infrav1.AntiAffinityPolicyNone
+	}
+
+	vms := &infrav1.VSphereVMList{}
+	if err := r.Client.List(ctx, vms,
+		client.InNamespace(ctx.VSphereCluster.Namespace),
+		client.MatchingLabels{clusterv1.ClusterLabelName: ctx.Cluster.Name}); err != nil {
+		return errors.Wrap(err, "failed to list VSphereVMs")
+	}
+
+	authSession, err := r.getSession(ctx)
+	if err != nil {
+		return err
+	}
+	ctx.Session = authSession
+
+	// Group the VMs by rule. VMs that are being deleted or that do not yet
+	// exist in vSphere are not members of a rule.
+	prefix := antiAffinityRulePrefix(ctx)
+	rulesByName := map[string]*cluster.AntiAffinityRule{}
+	addVM := func(name string, policy infrav1.AntiAffinityPolicy, vm vimtypes.ManagedObjectReference) {
+		if policy == infrav1.AntiAffinityPolicyNone {
+			return
+		}
+		rule, ok := rulesByName[name]
+		if !ok {
+			rule = &cluster.AntiAffinityRule{
+				Name:      name,
+				Mandatory: policy == infrav1.AntiAffinityPolicyHard,
+			}
+			rulesByName[name] = rule
+		}
+		rule.VMs = append(rule.VMs, vm)
+	}
+	var members []*infrav1.VSphereVM
+	var uuids []string
+	for i := range vms.Items {
+		vm := &vms.Items[i]
+		if !vm.DeletionTimestamp.IsZero() || vm.Spec.BiosUUID == "" {
+			continue
+		}
+		_, isControlPlane := vm.Labels[clusterv1.MachineControlPlaneLabelName]
+		if !isControlPlane && vm.Labels[clusterv1.MachineDeploymentLabelName] == "" {
+			continue
+		}
+		members = append(members, vm)
+		uuids = append(uuids, vm.Spec.BiosUUID)
+	}
+	refs, err := cluster.FindVMsByBIOSUUID(ctx, uuids)
+	if err != nil {
+		return err
+	}
+	for _, vm := range members {
+		ref, ok := refs[vm.Spec.BiosUUID]
+		if !ok {
+			continue
+		}
+		if _, isControlPlane := vm.Labels[clusterv1.MachineControlPlaneLabelName]; isControlPlane {
+			addVM(prefix+"control-plane", controlPlanePolicy, ref)
+		} else {
+			addVM(prefix+"md/"+vm.Labels[clusterv1.MachineDeploymentLabelName], machineDeploymentPolicy, ref)
+		}
+	}
+
+	rules := make([]cluster.AntiAffinityRule, 0, len(rulesByName))
+	for _, rule := range rulesByName {
+		rules = append(rules, *rule)
+	}
+	return cluster.ReconcileAntiAffinityRules(ctx, prefix, rules)
+}
+
+// reconcileAntiAffinityDelete removes the cluster's anti-affinity rules.
+func (r clusterReconciler) reconcileAntiAffinityDelete(ctx *context.ClusterContext) error {
+	if ctx.VSphereCluster.Spec.AntiAffinity == nil {
+		return nil
+	}
+	authSession, err := r.getSession(ctx)
+	if err != nil {
+		return err
+	}
+	ctx.Session = authSession
+	return cluster.ReconcileAntiAffinityRules(ctx, antiAffinityRulePrefix(ctx), nil)
+}
+
+// vmToCluster is a handler.ToRequestsFunc that triggers reconcile events
+// for a VSphereCluster resource when one of the cluster's VSphereVM
+// resources is reconciled.
+func (r clusterReconciler) vmToCluster(o handler.MapObject) []ctrl.Request {
+	vsphereVM, ok := o.Object.(*infrav1.VSphereVM)
+	if !ok {
+		r.Logger.Error(nil, fmt.Sprintf("expected a VSphereVM but got a %T", o.Object))
+		return nil
+	}
+	return r.clusterMemberToCluster(vsphereVM.ObjectMeta)
+}
+
+// vmSnapshotToCluster is a handler.ToRequestsFunc that triggers reconcile
+// events for a VSphereCluster resource when one of the cluster's
+// VSphereVMSnapshot resources is reconciled.
+func (r clusterReconciler) vmSnapshotToCluster(o handler.MapObject) []ctrl.Request {
+	vsphereVMSnapshot, ok := o.Object.(*infrav1.VSphereVMSnapshot)
+	if !ok {
+		r.Logger.Error(nil, fmt.Sprintf("expected a VSphereVMSnapshot but got a %T", o.Object))
+		return nil
+	}
+	return r.clusterMemberToCluster(vsphereVMSnapshot.ObjectMeta)
+}
+
+// controlPlaneToCluster is a handler.ToRequestsFunc that enqueues a request
+// for the VSphereCluster of a KubeadmControlPlane's owner CAPI Cluster.
+func (r clusterReconciler) controlPlaneToCluster(o handler.MapObject) []ctrl.Request {
+	controlPlane, ok := o.Object.(*controlplanev1.KubeadmControlPlane)
+	if !ok {
+		r.Logger.Error(nil, fmt.Sprintf("expected a KubeadmControlPlane but got a %T", o.Object))
+		return nil
+	}
+
+	cluster, err := clusterutilv1.GetOwnerCluster(r, r.Client, controlPlane.ObjectMeta)
+	if err != nil || cluster == nil {
+		return nil
+	}
+	return clusterToVSphereCluster(cluster)
+}
+
+// clusterMemberToCluster returns a request for the VSphereCluster of the
+// CAPI Cluster named by the object's cluster label.
+func (r clusterReconciler) clusterMemberToCluster(obj metav1.ObjectMeta) []ctrl.Request {
+	if _, ok := obj.Labels[clusterv1.ClusterLabelName]; !ok {
+		return nil
+	}
+
+	cluster, err := clusterutilv1.GetClusterFromMetadata(r, r.Client, obj)
+	if err != nil {
+		return nil
+	}
+	return clusterToVSphereCluster(cluster)
+}
+
+// clusterToVSphereCluster returns a request for the VSphereCluster of the
+// CAPI Cluster.
+func clusterToVSphereCluster(cluster *clusterv1.Cluster) []ctrl.Request {
+	infraRef := cluster.Spec.InfrastructureRef
+	if infraRef == nil {
+		return nil
+	}
+
+	if infraRef.APIVersion != infrav1.GroupVersion.String() ||
+		infraRef.Kind != "VSphereCluster" {
+		return nil
+	}
+
+	return []ctrl.Request{{
+		NamespacedName: types.NamespacedName{
+			Namespace: cluster.Namespace,
+			Name:      infraRef.Name,
+		},
+	}}
+}
+
 // controlPlaneMachineToCluster is a handler.ToRequestsFunc to be used
 // to enqueue requests for reconciliation for VSphereCluster to update
 // its status.apiEndpoints field.
@@ -804,14 +1552,6 @@ func (r clusterReconciler) controlPlaneMachineToCluster(o handler.MapObject) []c
 		return nil
 	}
 
-	if cluster.Status.ControlPlaneInitialized {
-		return nil
-	}
-
-	if !cluster.Spec.ControlPlaneEndpoint.IsZero() {
-		return nil
-	}
-
 	// Fetch the VSphereCluster
 	vsphereCluster := &infrav1.VSphereCluster{}
 	vsphereClusterKey := client.ObjectKey{
@@ -824,8 +1564,14 @@ func (r clusterReconciler) controlPlaneMachineToCluster(o handler.MapObject) []c
 		return nil
 	}
 
-	if !vsphereCluster.Spec.ControlPlaneEndpoint.IsZero() {
-		return nil
+	// The control plane endpoint's DNS record follows the control plane
+	// machines after the endpoint is set.
+	if cluster.Status.ControlPlaneInitialized ||
+		!cluster.Spec.ControlPlaneEndpoint.IsZero() ||
+		!vsphereCluster.Spec.ControlPlaneEndpoint.IsZero() {
+		if vsphereCluster.Spec.LoadBalancerRef != nil || !hasControlPlaneEndpointDNSName(vsphereCluster) {
+			return nil
+		}
 	}
 
 	return []ctrl.Request{{
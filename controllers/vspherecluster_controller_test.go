@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	mdns "github.com/miekg/dns"
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestReconcileControlPlaneEndpointDNS(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ts, server, stop := startDNSTestServer(t)
+	defer stop()
+
+	controllerContext := fake.NewControllerContext(fake.NewControllerManagerContext())
+	ctx := fake.NewClusterContext(controllerContext)
+	reconciler := clusterReconciler{ControllerContext: controllerContext}
+	ctx.Cluster.Status.ControlPlaneInitialized = true
+	ctx.VSphereCluster.Spec.DNS = &infrav1.DNSSpec{
+		Server:                   server,
+		Zone:                     "k8s.example.com",
+		ControlPlaneEndpointName: "api",
+	}
+	const fqdn = "api.k8s.example.com"
+
+	newControlPlaneMachine := func(name, address string) *clusterv1.Machine {
+		dataSecretName := name + "-bootstrap"
+		machine := &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ctx.Cluster.Namespace,
+				Name:      name,
+				Labels: map[string]string{
+					clusterv1.ClusterLabelName:             ctx.Cluster.Name,
+					clusterv1.MachineControlPlaneLabelName: "true",
+				},
+			},
+			Spec: clusterv1.MachineSpec{
+				ClusterName: ctx.Cluster.Name,
+				Bootstrap: clusterv1.Bootstrap{
+					DataSecretName: &dataSecretName,
+				},
+			},
+		}
+		g.Expect(ctx.Client.Create(ctx, machine)).To(gomega.Succeed())
+		vsphereMachine := &infrav1.VSphereMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ctx.Cluster.Namespace,
+				Name:      name,
+				Labels:    machine.Labels,
+			},
+			Status: infrav1.VSphereMachineStatus{
+				Addresses: []clusterv1.MachineAddress{{Type: clusterv1.MachineExternalIP, Address: address}},
+			},
+		}
+		g.Expect(ctx.Client.Create(ctx, vsphereMachine)).To(gomega.Succeed())
+		return machine
+	}
+	reconcile := func() {
+		ok, err := reconciler.reconcileControlPlaneEndpoint(ctx)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(ok).To(gomega.BeTrue())
+		g.Expect(ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Host).To(gomega.Equal(fqdn))
+	}
+
+	// The control plane endpoint is the name registered with the address
+	// of the first control plane machine.
+	firstMachine := newControlPlaneMachine("control-plane-0", "192.168.1.10")
+	reconcile()
+	g.Expect(ts.get(fqdn+".", mdns.TypeA)).To(gomega.Equal([]string{
+		fqdn + ".\t300\tIN\tA\t192.168.1.10",
+	}))
+
+	// The record is not updated while its machine is a control plane machine.
+	newControlPlaneMachine("control-plane-1", "192.168.1.11")
+	updates := ts.getUpdates()
+	reconcile()
+	g.Expect(ts.getUpdates()).To(gomega.Equal(updates))
+
+	// The record is pointed at another control plane machine once its
+	// machine is deleted, although the endpoint is already set.
+	g.Expect(ctx.Client.Delete(ctx, firstMachine)).To(gomega.Succeed())
+	reconcile()
+	g.Expect(ctx.VSphereCluster.Status.ControlPlaneEndpointDNSAddress).To(gomega.Equal("192.168.1.11"))
+	g.Expect(ts.get(fqdn+".", mdns.TypeA)).To(gomega.Equal([]string{
+		fqdn + ".\t300\tIN\tA\t192.168.1.11",
+	}))
+}
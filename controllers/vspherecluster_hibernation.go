@@ -0,0 +1,165 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/pkg/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	infrautilv1 "sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+// reconcileHibernation powers the cluster's VMs off or on in order according
+// to VSphereCluster.Spec.Hibernate. The worker VMs are powered off first,
+// then the control plane VMs, and finally the load balancer VM. The VMs are
+// powered on in the reverse order, and the worker VMs are powered on once the
+// API server is online.
+//
+// The VM power states are reconciled by the machine and load balancer
+// controllers from VSphereCluster.Status.HibernationState. This function
+// advances the state once the VMs of the current role have the desired power
+// state, and returns true once the cluster is running.
+func (r clusterReconciler) reconcileHibernation(ctx *context.ClusterContext) (bool, error) {
+	state := ctx.VSphereCluster.Status.HibernationState
+	if !ctx.VSphereCluster.Spec.Hibernate && state == "" {
+		return true, nil
+	}
+
+	vms, err := r.getHibernationVMs(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	next := state
+	if ctx.VSphereCluster.Spec.Hibernate {
+		switch state {
+		case "", infrav1.HibernationStateResumingWorkers:
+			next = infrav1.HibernationStateHibernatingWorkers
+		case infrav1.HibernationStateResumingControlPlane:
+			next = infrav1.HibernationStateHibernatingControlPlane
+		case infrav1.HibernationStateResumingLoadBalancer:
+			next = infrav1.HibernationStateHibernatingLoadBalancer
+		case infrav1.HibernationStateHibernatingWorkers:
+			if hasPowerState(vms[infrautilv1.HibernationRoleWorker], infrav1.VirtualMachinePowerStatePoweredOff) {
+				next = infrav1.HibernationStateHibernatingControlPlane
+			}
+		case infrav1.HibernationStateHibernatingControlPlane:
+			if hasPowerState(vms[infrautilv1.HibernationRoleControlPlane], infrav1.VirtualMachinePowerStatePoweredOff) {
+				next = infrav1.HibernationStateHibernatingLoadBalancer
+			}
+		case infrav1.HibernationStateHibernatingLoadBalancer:
+			if hasPowerState(vms[infrautilv1.HibernationRoleLoadBalancer], infrav1.VirtualMachinePowerStatePoweredOff) {
+				next = infrav1.HibernationStateHibernated
+				r.Recorder.Eventf(ctx.VSphereCluster, "Hibernated",
+					"powered off %d VMs", len(vms[infrautilv1.HibernationRoleWorker])+
+						len(vms[infrautilv1.HibernationRoleControlPlane])+
+						len(vms[infrautilv1.HibernationRoleLoadBalancer]))
+			}
+		}
+	} else {
+		switch state {
+		case infrav1.HibernationStateHibernatingWorkers:
+			next = infrav1.HibernationStateResumingWorkers
+		case infrav1.HibernationStateHibernatingControlPlane:
+			next = infrav1.HibernationStateResumingControlPlane
+		case infrav1.HibernationStateHibernatingLoadBalancer, infrav1.HibernationStateHibernated:
+			next = infrav1.HibernationStateResumingLoadBalancer
+		case infrav1.HibernationStateResumingLoadBalancer:
+			if hasPowerState(vms[infrautilv1.HibernationRoleLoadBalancer], infrav1.VirtualMachinePowerStatePoweredOn) {
+				next = infrav1.HibernationStateResumingControlPlane
+			}
+		case infrav1.HibernationStateResumingControlPlane:
+			// The worker VMs are not powered on until the API server is
+			// online, as the kubelets could not register otherwise.
+			if hasPowerState(vms[infrautilv1.HibernationRoleControlPlane], infrav1.VirtualMachinePowerStatePoweredOn) &&
+				r.isAPIServerOnline(ctx) {
+				next = infrav1.HibernationStateResumingWorkers
+			}
+		case infrav1.HibernationStateResumingWorkers:
+			if hasPowerState(vms[infrautilv1.HibernationRoleWorker], infrav1.VirtualMachinePowerStatePoweredOn) {
+				next = ""
+				r.Recorder.Eventf(ctx.VSphereCluster, "Resumed",
+					"powered on %d VMs", len(vms[infrautilv1.HibernationRoleWorker])+
+						len(vms[infrautilv1.HibernationRoleControlPlane])+
+						len(vms[infrautilv1.HibernationRoleLoadBalancer]))
+			}
+		}
+	}
+
+	if next != state {
+		ctx.Logger.Info("hibernation state changed", "oldState", state, "newState", next)
+		ctx.VSphereCluster.Status.HibernationState = next
+	}
+	return next == "", nil
+}
+
+// getHibernationVMs returns the cluster's VSphereVMs by their hibernation
+// role. VSphereVMs that are being deleted are ignored, as are VSphereVMs with
+// a terminal error. The latter are no longer reconciled, so their power state
+// would never be updated and the hibernation or resumption would stall.
+func (r clusterReconciler) getHibernationVMs(ctx *context.ClusterContext) (map[infrautilv1.HibernationRole][]infrav1.VSphereVM, error) {
+	vmList := &infrav1.VSphereVMList{}
+	if err := r.Client.List(ctx, vmList,
+		client.InNamespace(ctx.Cluster.Namespace),
+		client.MatchingLabels{clusterv1.ClusterLabelName: ctx.Cluster.Name}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list VSphereVMs for %s", ctx)
+	}
+
+	vms := map[infrautilv1.HibernationRole][]infrav1.VSphereVM{}
+	for _, vm := range vmList.Items {
+		if !vm.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if vm.Status.ErrorReason != nil || vm.Status.ErrorMessage != nil {
+			ctx.Logger.Info("ignoring VSphereVM with a terminal error for hibernation",
+				"vsphereVM", vm.Name)
+			continue
+		}
+		role := infrautilv1.HibernationRoleWorker
+		switch {
+		case isOwnedByHAProxyLoadBalancer(vm):
+			role = infrautilv1.HibernationRoleLoadBalancer
+		case infrautilv1.IsControlPlaneMachine(&vm):
+			role = infrautilv1.HibernationRoleControlPlane
+		}
+		vms[role] = append(vms[role], vm)
+	}
+	return vms, nil
+}
+
+func isOwnedByHAProxyLoadBalancer(vm infrav1.VSphereVM) bool {
+	for _, ref := range vm.OwnerReferences {
+		if ref.Kind == "HAProxyLoadBalancer" && ref.APIVersion == infrav1.GroupVersion.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPowerState returns true if all of the VSphereVMs were observed to have
+// the power state.
+func hasPowerState(vms []infrav1.VSphereVM, powerState infrav1.VirtualMachinePowerState) bool {
+	for _, vm := range vms {
+		if vm.Status.PowerState != powerState {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestReconcileHibernation(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	controllerContext := fake.NewControllerContext(fake.NewControllerManagerContext())
+	ctx := fake.NewClusterContext(controllerContext)
+	reconciler := clusterReconciler{ControllerContext: controllerContext}
+
+	newVM := func(name string, mutate func(*infrav1.VSphereVM)) {
+		vm := &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ctx.Cluster.Namespace,
+				Name:      name,
+				Labels: map[string]string{
+					clusterv1.ClusterLabelName: ctx.Cluster.Name,
+				},
+			},
+			Status: infrav1.VSphereVMStatus{
+				PowerState: infrav1.VirtualMachinePowerStatePoweredOn,
+			},
+		}
+		if mutate != nil {
+			mutate(vm)
+		}
+		g.Expect(ctx.Client.Create(ctx, vm)).To(gomega.Succeed())
+	}
+	newVM("worker", nil)
+	newVM("control-plane", func(vm *infrav1.VSphereVM) {
+		vm.Labels[clusterv1.MachineControlPlaneLabelName] = "true"
+	})
+	newVM("load-balancer", func(vm *infrav1.VSphereVM) {
+		vm.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: infrav1.GroupVersion.String(),
+			Kind:       "HAProxyLoadBalancer",
+			Name:       "load-balancer",
+		}}
+	})
+	// The power state of a VSphereVM with a terminal error is never updated,
+	// so it is not waited on.
+	newVM("errored-worker", func(vm *infrav1.VSphereVM) {
+		errorMessage := "failed to clone vm"
+		vm.Status.ErrorMessage = &errorMessage
+	})
+	// The VSphereVMs of other clusters are ignored.
+	newVM("other-cluster-worker", func(vm *infrav1.VSphereVM) {
+		vm.Labels[clusterv1.ClusterLabelName] = "other-cluster"
+	})
+
+	setPowerState := func(name string, powerState infrav1.VirtualMachinePowerState) {
+		vm := &infrav1.VSphereVM{}
+		g.Expect(ctx.Client.Get(ctx, client.ObjectKey{Namespace: ctx.Cluster.Namespace, Name: name}, vm)).To(gomega.Succeed())
+		vm.Status.PowerState = powerState
+		g.Expect(ctx.Client.Status().Update(ctx, vm)).To(gomega.Succeed())
+	}
+	expectState := func(expectedState infrav1.HibernationState) {
+		running, err := reconciler.reconcileHibernation(ctx)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(ctx.VSphereCluster.Status.HibernationState).To(gomega.Equal(expectedState))
+		g.Expect(running).To(gomega.Equal(expectedState == ""))
+	}
+
+	// A running cluster is not affected.
+	expectState("")
+
+	// The worker VMs are powered off first, then the control plane VMs, and
+	// finally the load balancer VMs.
+	ctx.VSphereCluster.Spec.Hibernate = true
+	expectState(infrav1.HibernationStateHibernatingWorkers)
+	expectState(infrav1.HibernationStateHibernatingWorkers)
+	setPowerState("worker", infrav1.VirtualMachinePowerStatePoweredOff)
+	expectState(infrav1.HibernationStateHibernatingControlPlane)
+	expectState(infrav1.HibernationStateHibernatingControlPlane)
+	setPowerState("control-plane", infrav1.VirtualMachinePowerStatePoweredOff)
+	expectState(infrav1.HibernationStateHibernatingLoadBalancer)
+	expectState(infrav1.HibernationStateHibernatingLoadBalancer)
+	setPowerState("load-balancer", infrav1.VirtualMachinePowerStatePoweredOff)
+	expectState(infrav1.HibernationStateHibernated)
+	expectState(infrav1.HibernationStateHibernated)
+
+	// The VMs are powered on in the reverse order. The worker VMs are not
+	// powered on until the API server is online.
+	ctx.VSphereCluster.Spec.Hibernate = false
+	expectState(infrav1.HibernationStateResumingLoadBalancer)
+	expectState(infrav1.HibernationStateResumingLoadBalancer)
+	setPowerState("load-balancer", infrav1.VirtualMachinePowerStatePoweredOn)
+	expectState(infrav1.HibernationStateResumingControlPlane)
+	setPowerState("control-plane", infrav1.VirtualMachinePowerStatePoweredOn)
+	expectState(infrav1.HibernationStateResumingControlPlane)
+
+	ctx.VSphereCluster.Status.HibernationState = infrav1.HibernationStateResumingWorkers
+	expectState(infrav1.HibernationStateResumingWorkers)
+	setPowerState("worker", infrav1.VirtualMachinePowerStatePoweredOn)
+	expectState("")
+
+	// A cluster that is hibernated while it resumes powers off the VMs that
+	// were powered on again.
+	ctx.VSphereCluster.Status.HibernationState = infrav1.HibernationStateResumingControlPlane
+	ctx.VSphereCluster.Spec.Hibernate = true
+	expectState(infrav1.HibernationStateHibernatingControlPlane)
+}
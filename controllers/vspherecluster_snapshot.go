@@ -0,0 +1,196 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	controlplanev1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
+	clusterutilv1 "sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	infrautilv1 "sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+// reconcileSnapshots snapshots the cluster's control plane VMs before the
+// control plane is upgraded and prunes the cluster's VSphereVMSnapshots
+// according to the cluster's retention policy.
+func (r clusterReconciler) reconcileSnapshots(ctx *context.ClusterContext) error {
+	snapshotSpec := ctx.VSphereCluster.Spec.Snapshot
+	if snapshotSpec == nil {
+		return nil
+	}
+	if snapshotSpec.BeforeUpgrade {
+		if err := r.reconcileUpgradeSnapshot(ctx); err != nil {
+			return err
+		}
+	}
+	if snapshotSpec.Retention != nil {
+		if err := r.reconcileSnapshotRetention(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileUpgradeSnapshot creates a VSphereVMSnapshot of the control plane
+// VMs when the version of the cluster's KubeadmControlPlane changes. The
+// snapshot is created once per version.
+//
+// The KubeadmControlPlane does not wait for the snapshot before it replaces
+// the control plane machines, so the snapshot is best-effort. The cluster is
+// reconciled as soon as the KubeadmControlPlane changes to keep the window
+// small.
+func (r clusterReconciler) reconcileUpgradeSnapshot(ctx *context.ClusterContext) error {
+	controlPlaneRef := ctx.Cluster.Spec.ControlPlaneRef
+	if controlPlaneRef == nil || controlPlaneRef.Kind != "KubeadmControlPlane" {
+		return nil
+	}
+
+	controlPlane := &controlplanev1.KubeadmControlPlane{}
+	controlPlaneKey := client.ObjectKey{Namespace: ctx.Cluster.Namespace, Name: controlPlaneRef.Name}
+	if err := r.Client.Get(ctx, controlPlaneKey, controlPlane); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to get KubeadmControlPlane %s for %s", controlPlaneKey, ctx)
+	}
+	version := controlPlane.Spec.Version
+	if version == "" || version == ctx.VSphereCluster.Status.ControlPlaneVersion {
+		return nil
+	}
+
+	// The control plane is being upgraded if its version changed since it
+	// was last observed. If the version was not observed before, such as
+	// when BeforeUpgrade was just enabled, the control plane is being
+	// upgraded if one of its machines has a different version.
+	upgrading := ctx.VSphereCluster.Status.ControlPlaneVersion != ""
+	if !upgrading {
+		machines, err := infrautilv1.GetMachinesInCluster(ctx, ctx.Client, ctx.Cluster.Namespace, ctx.Cluster.Name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get machines for %s", ctx)
+		}
+		for _, machine := range clusterutilv1.GetControlPlaneMachines(machines) {
+			if machine.Spec.Version != nil && *machine.Spec.Version != version {
+				upgrading = true
+				break
+			}
+		}
+	}
+	if !upgrading || version == ctx.VSphereCluster.Status.UpgradeSnapshotVersion {
+		ctx.VSphereCluster.Status.ControlPlaneVersion = version
+		return nil
+	}
+
+	snapshotSpec := ctx.VSphereCluster.Spec.Snapshot
+	snapshot := &infrav1.VSphereVMSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ctx.Cluster.Namespace,
+			Name:      upgradeSnapshotName(ctx.Cluster.Name, version),
+			Labels: map[string]string{
+				clusterv1.ClusterLabelName: ctx.Cluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Cluster",
+					Name:       ctx.Cluster.Name,
+					UID:        ctx.Cluster.UID,
+				},
+			},
+		},
+		Spec: infrav1.VSphereVMSnapshotSpec{
+			ClusterName: ctx.Cluster.Name,
+			Description: fmt.Sprintf("Created before the upgrade of cluster %s/%s to %s",
+				ctx.Cluster.Namespace, ctx.Cluster.Name, version),
+			Memory:  snapshotSpec.Memory,
+			Quiesce: snapshotSpec.Quiesce,
+		},
+	}
+	if err := r.Client.Create(ctx, snapshot); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "failed to create VSphereVMSnapshot %s/%s for %s",
+			snapshot.Namespace, snapshot.Name, ctx)
+	}
+	ctx.VSphereCluster.Status.ControlPlaneVersion = version
+	ctx.VSphereCluster.Status.UpgradeSnapshotVersion = version
+	r.Recorder.Eventf(ctx.VSphereCluster, "UpgradeSnapshotCreated",
+		"created VSphereVMSnapshot %s before the upgrade to %s", snapshot.Name, version)
+	return nil
+}
+
+// upgradeSnapshotName returns the name of the VSphereVMSnapshot created
+// before a cluster is upgraded to a version.
+func upgradeSnapshotName(clusterName, version string) string {
+	version = strings.NewReplacer(".", "-", "+", "-", "_", "-").Replace(strings.ToLower(version))
+	return fmt.Sprintf("%s-pre-upgrade-%s", clusterName, version)
+}
+
+// reconcileSnapshotRetention deletes the cluster's VSphereVMSnapshots that
+// are older than the retention policy's maximum age, and then the oldest
+// snapshots in excess of the policy's maximum count.
+func (r clusterReconciler) reconcileSnapshotRetention(ctx *context.ClusterContext) error {
+	retention := ctx.VSphereCluster.Spec.Snapshot.Retention
+
+	snapshotList := &infrav1.VSphereVMSnapshotList{}
+	if err := r.Client.List(ctx, snapshotList,
+		client.InNamespace(ctx.Cluster.Namespace),
+		client.MatchingLabels{clusterv1.ClusterLabelName: ctx.Cluster.Name}); err != nil {
+		return errors.Wrapf(err, "failed to list VSphereVMSnapshots for %s", ctx)
+	}
+
+	var snapshots []infrav1.VSphereVMSnapshot
+	for _, snapshot := range snapshotList.Items {
+		if snapshot.DeletionTimestamp.IsZero() {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreationTimestamp.Before(&snapshots[j].CreationTimestamp)
+	})
+
+	var pruned []infrav1.VSphereVMSnapshot
+	if retention.MaxAge != nil {
+		oldest := metav1.NewTime(time.Now().Add(-retention.MaxAge.Duration))
+		for len(snapshots) > 0 && snapshots[0].CreationTimestamp.Before(&oldest) {
+			pruned, snapshots = append(pruned, snapshots[0]), snapshots[1:]
+		}
+	}
+	if retention.MaxCount > 0 {
+		for len(snapshots) > int(retention.MaxCount) {
+			pruned, snapshots = append(pruned, snapshots[0]), snapshots[1:]
+		}
+	}
+
+	for i := range pruned {
+		if err := r.Client.Delete(ctx, &pruned[i]); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete VSphereVMSnapshot %s/%s for %s",
+				pruned[i].Namespace, pruned[i].Name, ctx)
+		}
+		r.Recorder.Eventf(ctx.VSphereCluster, "SnapshotPruned",
+			"deleted VSphereVMSnapshot %s according to the retention policy", pruned[i].Name)
+	}
+	return nil
+}
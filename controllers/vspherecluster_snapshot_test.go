@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	controlplanev1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestReconcileSnapshotRetention(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	controllerContext := fake.NewControllerContext(fake.NewControllerManagerContext())
+	ctx := fake.NewClusterContext(controllerContext)
+	reconciler := clusterReconciler{ControllerContext: controllerContext}
+
+	now := time.Now()
+	newSnapshot := func(name, clusterName string, age time.Duration, deleted bool) {
+		snapshot := &infrav1.VSphereVMSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         ctx.Cluster.Namespace,
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				Labels: map[string]string{
+					clusterv1.ClusterLabelName: clusterName,
+				},
+			},
+		}
+		if deleted {
+			snapshot.DeletionTimestamp = &snapshot.CreationTimestamp
+		}
+		g.Expect(ctx.Client.Create(ctx, snapshot)).To(gomega.Succeed())
+	}
+	newSnapshot("expired", ctx.Cluster.Name, 3*time.Hour, false)
+	newSnapshot("oldest", ctx.Cluster.Name, 30*time.Minute, false)
+	newSnapshot("older", ctx.Cluster.Name, 20*time.Minute, false)
+	newSnapshot("newest", ctx.Cluster.Name, 10*time.Minute, false)
+	newSnapshot("deleted", ctx.Cluster.Name, 5*time.Minute, true)
+	newSnapshot("other-cluster", "other-cluster", 3*time.Hour, false)
+
+	ctx.VSphereCluster.Spec.Snapshot = &infrav1.ClusterSnapshotSpec{
+		Retention: &infrav1.SnapshotRetentionPolicy{
+			MaxCount: 2,
+			MaxAge:   &metav1.Duration{Duration: time.Hour},
+		},
+	}
+	g.Expect(reconciler.reconcileSnapshots(ctx)).To(gomega.Succeed())
+
+	// The snapshots older than the maximum age are pruned, and then the
+	// oldest snapshots in excess of the maximum count. The snapshots that
+	// are being deleted and the snapshots of other clusters are ignored.
+	snapshotList := &infrav1.VSphereVMSnapshotList{}
+	g.Expect(ctx.Client.List(ctx, snapshotList)).To(gomega.Succeed())
+	var names []string
+	for _, snapshot := range snapshotList.Items {
+		names = append(names, snapshot.Name)
+	}
+	g.Expect(names).To(gomega.ConsistOf("older", "newest", "deleted", "other-cluster"))
+}
+
+func TestReconcileUpgradeSnapshot(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	controllerContext := fake.NewControllerContext(fake.NewControllerManagerContext())
+	ctx := fake.NewClusterContext(controllerContext)
+	reconciler := clusterReconciler{ControllerContext: controllerContext}
+
+	controlPlane := &controlplanev1.KubeadmControlPlane{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ctx.Cluster.Namespace,
+			Name:      "control-plane",
+		},
+		Spec: controlplanev1.KubeadmControlPlaneSpec{
+			Version: "v1.17.0",
+		},
+	}
+	g.Expect(ctx.Client.Create(ctx, controlPlane)).To(gomega.Succeed())
+	ctx.Cluster.Spec.ControlPlaneRef = &corev1.ObjectReference{
+		APIVersion: controlplanev1.GroupVersion.String(),
+		Kind:       "KubeadmControlPlane",
+		Name:       controlPlane.Name,
+	}
+	ctx.VSphereCluster.Spec.Snapshot = &infrav1.ClusterSnapshotSpec{
+		BeforeUpgrade: true,
+		Quiesce:       true,
+	}
+	getSnapshots := func() []infrav1.VSphereVMSnapshot {
+		snapshotList := &infrav1.VSphereVMSnapshotList{}
+		g.Expect(ctx.Client.List(ctx, snapshotList)).To(gomega.Succeed())
+		return snapshotList.Items
+	}
+
+	// The version that is observed first is not an upgrade.
+	g.Expect(reconciler.reconcileSnapshots(ctx)).To(gomega.Succeed())
+	g.Expect(ctx.VSphereCluster.Status.ControlPlaneVersion).To(gomega.Equal("v1.17.0"))
+	g.Expect(getSnapshots()).To(gomega.BeEmpty())
+
+	// A change of the version is an upgrade, before which the control plane
+	// VMs are snapshotted once.
+	controlPlane.Spec.Version = "v1.17.1"
+	g.Expect(ctx.Client.Update(ctx, controlPlane)).To(gomega.Succeed())
+	g.Expect(reconciler.reconcileSnapshots(ctx)).To(gomega.Succeed())
+	g.Expect(reconciler.reconcileSnapshots(ctx)).To(gomega.Succeed())
+	g.Expect(ctx.VSphereCluster.Status.ControlPlaneVersion).To(gomega.Equal("v1.17.1"))
+	g.Expect(ctx.VSphereCluster.Status.UpgradeSnapshotVersion).To(gomega.Equal("v1.17.1"))
+	snapshots := getSnapshots()
+	g.Expect(snapshots).To(gomega.HaveLen(1))
+	g.Expect(snapshots[0].Name).To(gomega.Equal(ctx.Cluster.Name + "-pre-upgrade-v1-17-1"))
+	g.Expect(snapshots[0].Spec.ClusterName).To(gomega.Equal(ctx.Cluster.Name))
+	g.Expect(snapshots[0].Spec.Quiesce).To(gomega.BeTrue())
+
+	// A version that is observed first while a control plane machine has
+	// another version is an upgrade.
+	ctx.VSphereCluster.Status.ControlPlaneVersion = ""
+	machineVersion := "v1.17.1"
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ctx.Cluster.Namespace,
+			Name:      "control-plane-machine",
+			Labels: map[string]string{
+				clusterv1.ClusterLabelName:             ctx.Cluster.Name,
+				clusterv1.MachineControlPlaneLabelName: "true",
+			},
+		},
+		Spec: clusterv1.MachineSpec{
+			ClusterName: ctx.Cluster.Name,
+			Version:     &machineVersion,
+		},
+	}
+	g.Expect(ctx.Client.Create(ctx, machine)).To(gomega.Succeed())
+	controlPlane.Spec.Version = "v1.18.0"
+	g.Expect(ctx.Client.Update(ctx, controlPlane)).To(gomega.Succeed())
+	g.Expect(reconciler.reconcileSnapshots(ctx)).To(gomega.Succeed())
+	g.Expect(ctx.VSphereCluster.Status.UpgradeSnapshotVersion).To(gomega.Equal("v1.18.0"))
+	g.Expect(getSnapshots()).To(gomega.HaveLen(2))
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereimages,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereimages/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
+
+// AddImageControllerToManager adds the image controller to the provided
+// manager.
+func AddImageControllerToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) error {
+
+	var (
+		controlledType     = &infrav1.VSphereImage{}
+		controlledTypeName = reflect.TypeOf(controlledType).Elem().Name()
+		controlledTypeGVK  = infrav1.GroupVersion.WithKind(controlledTypeName)
+
+		controllerNameShort = fmt.Sprintf("%s-controller", strings.ToLower(controlledTypeName))
+		controllerNameLong  = fmt.Sprintf("%s/%s/%s", ctx.Namespace, ctx.Name, controllerNameShort)
+	)
+
+	// Build the controller context.
+	controllerContext := &context.ControllerContext{
+		ControllerManagerContext: ctx,
+		Name:                     controllerNameShort,
+		Recorder:                 record.New(mgr.GetEventRecorderFor(controllerNameLong)),
+		Logger:                   ctx.Logger.WithName(controllerNameShort),
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		// Watch the controlled, infrastructure resource.
+		For(controlledType).
+		// Watch a GenericEvent channel for the controlled resource. Events
+		// are sent into the channel as an import progresses and completes.
+		Watches(
+			&source.Channel{Source: ctx.GetGenericEventChannelFor(controlledTypeGVK)},
+			&handler.EnqueueRequestForObject{},
+		).
+		Complete(imageReconciler{ControllerContext: controllerContext})
+}
+
+type imageReconciler struct {
+	*context.ControllerContext
+}
+
+// Reconcile ensures the back-end state reflects the Kubernetes resource state intent.
+func (r imageReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr error) {
+
+	// Get the VSphereImage resource for this request.
+	vsphereImage := &infrav1.VSphereImage{}
+	if err := r.Client.Get(r, req.NamespacedName, vsphereImage); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Logger.Info("VSphereImage not found, won't reconcile", "key", req.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// Get or create an authenticated session to the vSphere endpoint.
+	authSession, err := session.GetOrCreate(r.Context,
+		vsphereImage.Spec.Server, vsphereImage.Spec.Datacenter,
+		r.ControllerManagerContext.Username, r.ControllerManagerContext.Password)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "failed to create vSphere session")
+	}
+
+	// Create the patch helper.
+	patchHelper, err := patch.NewHelper(vsphereImage, r.Client)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(
+			err,
+			"failed to init patch helper for %s %s/%s",
+			vsphereImage.GroupVersionKind(),
+			vsphereImage.Namespace,
+			vsphereImage.Name)
+	}
+
+	// Create the image context for this request.
+	imageContext := &context.ImageContext{
+		ControllerContext: r.ControllerContext,
+		VSphereImage:      vsphereImage,
+		Session:           authSession,
+		Logger:            r.Logger.WithName(req.Namespace).WithName(req.Name),
+		PatchHelper:       patchHelper,
+	}
+
+	// Always issue a patch when exiting this function so changes to the
+	// resource are patched back to the API server.
+	defer func() {
+		if err := imageContext.Patch(); err != nil {
+			if reterr == nil {
+				reterr = err
+			}
+			imageContext.Logger.Error(err, "patch failed", "image", imageContext.String())
+		}
+	}()
+
+	// Handle deleted images
+	if !vsphereImage.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(imageContext)
+	}
+
+	// Handle non-deleted images
+	return r.reconcileNormal(imageContext)
+}
+
+func (r imageReconciler) reconcileDelete(ctx *context.ImageContext) (reconcile.Result, error) {
+	ctx.Logger.Info("Handling deleted VSphereImage")
+
+	var imageService services.ImageService = &govmomi.ImageService{}
+
+	deleted, err := imageService.DeleteImage(ctx)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "failed to delete image")
+	}
+
+	// Requeue the operation until the template is deleted. An in-flight
+	// import triggers a reconcile event when it completes.
+	if !deleted {
+		ctx.Logger.Info("template is not deleted")
+		return reconcile.Result{}, nil
+	}
+
+	// The template is deleted so remove the finalizer.
+	ctrlutil.RemoveFinalizer(ctx.VSphereImage, infrav1.ImageFinalizer)
+
+	return reconcile.Result{}, nil
+}
+
+func (r imageReconciler) reconcileNormal(ctx *context.ImageContext) (reconcile.Result, error) {
+	// If the VSphereImage doesn't have our finalizer, add it.
+	ctrlutil.AddFinalizer(ctx.VSphereImage, infrav1.ImageFinalizer)
+
+	var imageService services.ImageService = &govmomi.ImageService{}
+
+	if err := imageService.ReconcileImage(ctx); err != nil {
+		r.Recorder.Warn(ctx.VSphereImage, "ImportFailed", err.Error())
+		return reconcile.Result{}, errors.Wrapf(err, "failed to reconcile image")
+	}
+
+	if !ctx.VSphereImage.Status.Ready {
+		ctx.Logger.Info("image is not ready", "progress", ctx.VSphereImage.Status.Progress)
+		return reconcile.Result{}, nil
+	}
+
+	ctx.Logger.Info("VSphereImage is ready")
+	return reconcile.Result{}, nil
+}
@@ -19,7 +19,10 @@ package controllers
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"path"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -29,6 +32,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	apitypes "k8s.io/apimachinery/pkg/types"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	clusterutilv1 "sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -42,12 +46,18 @@ import (
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/dns"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/tags"
 	infrautilv1 "sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
 )
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspheremachines,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspheremachines/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherefailuredomains,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=ipaddressclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
 
 // AddMachineControllerToManager adds the machine controller to the provided
@@ -71,6 +81,8 @@ func AddMachineControllerToManager(ctx *context.ControllerManagerContext, mgr ma
 		Logger:                   ctx.Logger.WithName(controllerNameShort),
 	}
 
+	reconciler := machineReconciler{ControllerContext: controllerContext}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		// Watch the controlled, infrastructure resource.
 		For(controlledType).
@@ -79,6 +91,11 @@ func AddMachineControllerToManager(ctx *context.ControllerManagerContext, mgr ma
 			&source.Kind{Type: &infrav1.VSphereVM{}},
 			&handler.EnqueueRequestForOwner{OwnerType: controlledType, IsController: false},
 		).
+		// Watch any IPAddressClaim resources owned by the controlled type.
+		Watches(
+			&source.Kind{Type: &infrav1.IPAddressClaim{}},
+			&handler.EnqueueRequestForOwner{OwnerType: controlledType, IsController: false},
+		).
 		// Watch the CAPI resource that owns this infrastructure resource.
 		Watches(
 			&source.Kind{Type: &clusterv1.Machine{}},
@@ -86,6 +103,24 @@ func AddMachineControllerToManager(ctx *context.ControllerManagerContext, mgr ma
 				ToRequests: clusterutilv1.MachineToInfrastructureMapFunc(controlledTypeGVK),
 			},
 		).
+		// Watch the VSphereCluster of which the VSphereMachine resources are
+		// members so the VSphereMachines are reconciled as the cluster
+		// hibernates and resumes.
+		Watches(
+			&source.Kind{Type: &infrav1.VSphereCluster{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(reconciler.vsphereClusterToVSphereMachines),
+			},
+		).
+		// Watch the CAPI cluster of which the VSphereMachine resources are
+		// members so the VSphereMachines are reconciled when the cluster is
+		// unpaused.
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(reconciler.clusterToVSphereMachines),
+			},
+		).
 		// Watch a GenericEvent channel for the controlled resource.
 		//
 		// This is useful when there are events outside of Kubernetes that
@@ -95,7 +130,7 @@ func AddMachineControllerToManager(ctx *context.ControllerManagerContext, mgr ma
 			&source.Channel{Source: ctx.GetGenericEventChannelFor(controlledTypeGVK)},
 			&handler.EnqueueRequestForObject{},
 		).
-		Complete(machineReconciler{ControllerContext: controllerContext})
+		Complete(reconciler)
 }
 
 type machineReconciler struct {
@@ -132,6 +167,13 @@ func (r machineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr er
 		return reconcile.Result{}, nil
 	}
 
+	// Do not reconcile the VSphereMachine while it or its cluster is paused,
+	// such as while the cluster is moved with clusterctl move.
+	if isPaused(cluster, vsphereMachine) {
+		r.Logger.V(4).Info("VSphereMachine or linked Cluster is paused, won't reconcile", "key", req.NamespacedName)
+		return reconcile.Result{}, nil
+	}
+
 	// Fetch the VSphereCluster
 	vsphereCluster := &infrav1.VSphereCluster{}
 	vsphereClusterName := client.ObjectKey{
@@ -193,6 +235,22 @@ func (r machineReconciler) reconcileDelete(ctx *context.MachineContext) (reconci
 		return reconcile.Result{}, err
 	}
 
+	// Release the VM's addresses once the VM is deleted so they are not
+	// allocated to another machine while still in use.
+	if ok, err := r.reconcileDeleteIPAddressClaims(ctx); !ok {
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		ctx.Logger.Info("waiting for VSphereVM to be deleted before releasing IP addresses")
+		return reconcile.Result{}, nil
+	}
+
+	// Delete the machine's DNS records.
+	if err := r.reconcileDeleteDNS(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to delete DNS records for %s", ctx)
+	}
+
 	// The VM is deleted so remove the finalizer.
 	ctrlutil.RemoveFinalizer(ctx.VSphereMachine, infrav1.MachineFinalizer)
 
@@ -258,8 +316,19 @@ func (r machineReconciler) reconcileNormal(ctx *context.MachineContext) (reconci
 		return reconcile.Result{}, nil
 	}
 
+	// Allocate the addresses of the network devices that reference IPPools.
+	// The VSphereVM is not created until every address is allocated.
+	ipAddressClaims, ok, err := r.reconcileIPAddressClaims(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !ok {
+		ctx.Logger.Info("Waiting for IP addresses to be allocated")
+		return reconcile.Result{}, nil
+	}
+
 	// TODO(akutz) Determine the version of vSphere.
-	vm, err := r.reconcileNormalPre7(ctx)
+	vm, err := r.reconcileNormalPre7(ctx, ipAddressClaims)
 	if err != nil {
 		if apierrors.IsAlreadyExists(err) {
 			return reconcile.Result{}, nil
@@ -279,6 +348,12 @@ func (r machineReconciler) reconcileNormal(ctx *context.MachineContext) (reconci
 	vmObj.SetAPIVersion(vm.GetObjectKind().GroupVersionKind().GroupVersion().String())
 	vmObj.SetKind(vm.GetObjectKind().GroupVersionKind().Kind)
 
+	// Report a terminal error of the VM as the VSphereMachine's error.
+	if !r.reconcileErrorState(ctx, vmObj) {
+		ctx.Logger.Info("VM is in an error state")
+		return reconcile.Result{}, nil
+	}
+
 	// Reconcile the VSphereMachine's provider ID using the VM's BIOS UUID.
 	if ok, err := r.reconcileProviderID(ctx, vmObj); !ok {
 		if err != nil {
@@ -299,6 +374,12 @@ func (r machineReconciler) reconcileNormal(ctx *context.MachineContext) (reconci
 		return reconcile.Result{}, nil
 	}
 
+	// Register the machine's hostname and addresses in DNS.
+	if err := r.reconcileDNS(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to reconcile DNS records for %s", ctx)
+	}
+
 	// Reconcile the VSphereMachine's ready state from the VM's ready state.
 	if ok, err := r.reconcileReadyState(ctx, vmObj); !ok {
 		if err != nil {
@@ -312,7 +393,13 @@ func (r machineReconciler) reconcileNormal(ctx *context.MachineContext) (reconci
 	return reconcile.Result{}, nil
 }
 
-func (r machineReconciler) reconcileNormalPre7(ctx *context.MachineContext) (runtime.Object, error) {
+func (r machineReconciler) reconcileNormalPre7(ctx *context.MachineContext, ipAddressClaims [][]*infrav1.IPAddressClaim) (runtime.Object, error) {
+	// Get the failure domain in which the Machine is placed, if any.
+	failureDomain, err := r.getFailureDomain(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create or update the VSphereVM resource.
 	vm := &infrav1.VSphereVM{
 		ObjectMeta: metav1.ObjectMeta{
@@ -349,16 +436,57 @@ func (r machineReconciler) reconcileNormalPre7(ctx *context.MachineContext) (run
 			vm.Labels[clusterv1.MachineControlPlaneLabelName] = val
 		}
 
+		// Add a label that identifies the VSphereVM's MachineDeployment, if
+		// any, so the VM may be added to the MachineDeployment's
+		// anti-affinity rule.
+		if val, ok := ctx.Machine.Labels[clusterv1.MachineDeploymentLabelName]; ok {
+			vm.Labels[clusterv1.MachineDeploymentLabelName] = val
+		}
+
 		// Copy the VSphereMachine's VM clone spec into the VSphereVM's
 		// clone spec.
 		ctx.VSphereMachine.Spec.VirtualMachineCloneSpec.DeepCopyInto(&vm.Spec.VirtualMachineCloneSpec)
 
+		// The VMs of a hibernating cluster are powered off in order.
+		role := infrautilv1.HibernationRoleWorker
+		if infrautilv1.IsControlPlaneMachine(ctx.Machine) {
+			role = infrautilv1.HibernationRoleControlPlane
+		}
+		if infrautilv1.IsPoweredOffForHibernation(ctx.VSphereCluster.Status.HibernationState, role) {
+			vm.Spec.PowerState = infrav1.VirtualMachinePowerStatePoweredOff
+		}
+
+		// The placement of a VSphereVM in a failure domain is resolved from
+		// the failure domain's topology.
+		if failureDomain != nil {
+			applyFailureDomainTopology(vm, failureDomain.Spec.Topology)
+		}
+
+		// Add the addresses allocated from the network devices' IPPools.
+		applyIPAddressClaims(vm, ipAddressClaims)
+
+		// Propagate the labels and annotations named by the metadata
+		// mappings to the VM's custom attributes and annotation.
+		vm.Spec.CustomAttributes, vm.Spec.AnnotationFields = resolveMetadataMappings(ctx)
+
+		// Tag the VM with the cluster's identity, the VM's role, and the
+		// zone and region of its failure domain.
+		vm.Spec.Tags = tags.MachineTags(ctx.VSphereCluster,
+			infrautilv1.IsControlPlaneMachine(ctx.Machine), failureDomain)
+
 		// Several of the VSphereVM's clone spec properties can be derived
 		// from multiple places. The order is:
 		//
 		//   1. From the VSphereMachine.Spec (the DeepCopyInto above)
-		//   2. From the VSphereCluster.Spec.CloudProviderConfiguration.Workspace
-		//   3. From the VSphereCluster.Spec
+		//   2. From the folder and resource pool owned by the VSphereCluster
+		//   3. From the VSphereCluster.Spec.CloudProviderConfiguration.Workspace
+		//   4. From the VSphereCluster.Spec
+		if vm.Spec.Folder == "" {
+			vm.Spec.Folder = ctx.VSphereCluster.Status.Folder
+		}
+		if vm.Spec.ResourcePool == "" {
+			vm.Spec.ResourcePool = ctx.VSphereCluster.Status.ResourcePool
+		}
 		vsphereCloudConfig := ctx.VSphereCluster.Spec.CloudProviderConfiguration.Workspace
 		if vm.Spec.Server == "" {
 			if vm.Spec.Server = vsphereCloudConfig.Server; vm.Spec.Server == "" {
@@ -392,6 +520,208 @@ func (r machineReconciler) reconcileNormalPre7(ctx *context.MachineContext) (run
 	return vm, nil
 }
 
+// resolveMetadataMappings returns the custom attributes and annotation
+// fields of a VSphereMachine's VM from the VSphereMachine's metadata
+// mappings. A custom attribute whose label or annotation does not exist is
+// given an empty value so the attribute is cleared when the label or
+// annotation is removed.
+func resolveMetadataMappings(ctx *context.MachineContext) (customAttributes, annotationFields map[string]string) {
+	for _, mapping := range ctx.VSphereMachine.Spec.MetadataMappings {
+		vsphereMachineValues, machineValues := ctx.VSphereMachine.Labels, ctx.Machine.Labels
+		if mapping.Source == infrav1.MetadataSourceAnnotation {
+			vsphereMachineValues, machineValues = ctx.VSphereMachine.Annotations, ctx.Machine.Annotations
+		}
+		value, ok := vsphereMachineValues[mapping.Key]
+		if !ok {
+			value, ok = machineValues[mapping.Key]
+		}
+		name := mapping.Name
+		if name == "" {
+			name = mapping.Key
+		}
+		switch mapping.Target {
+		case infrav1.MetadataTargetCustomAttribute:
+			if customAttributes == nil {
+				customAttributes = map[string]string{}
+			}
+			customAttributes[name] = value
+		default:
+			if !ok {
+				continue
+			}
+			if annotationFields == nil {
+				annotationFields = map[string]string{}
+			}
+			annotationFields[name] = value
+		}
+	}
+	return customAttributes, annotationFields
+}
+
+// getFailureDomain returns the VSphereFailureDomain named by the Machine's
+// failure domain, or nil if the Machine does not have a failure domain.
+func (r machineReconciler) getFailureDomain(ctx *context.MachineContext) (*infrav1.VSphereFailureDomain, error) {
+	if ctx.Machine.Spec.FailureDomain == nil || *ctx.Machine.Spec.FailureDomain == "" {
+		return nil, nil
+	}
+	failureDomain := &infrav1.VSphereFailureDomain{}
+	failureDomainKey := client.ObjectKey{
+		Namespace: ctx.VSphereMachine.Namespace,
+		Name:      *ctx.Machine.Spec.FailureDomain,
+	}
+	if err := ctx.Client.Get(ctx, failureDomainKey, failureDomain); err != nil {
+		return nil, errors.Wrapf(err, "failed to get VSphereFailureDomain %s for %s",
+			failureDomainKey, ctx)
+	}
+	return failureDomain, nil
+}
+
+// applyFailureDomainTopology sets the placement fields of a VSphereVM from
+// the topology of a failure domain.
+func applyFailureDomainTopology(vm *infrav1.VSphereVM, topology infrav1.FailureDomainTopology) {
+	vm.Spec.Datacenter = topology.Datacenter
+	switch {
+	case topology.ResourcePool != "":
+		vm.Spec.ResourcePool = topology.ResourcePool
+	case topology.ComputeCluster != "":
+		vm.Spec.ResourcePool = path.Join(topology.ComputeCluster, "Resources")
+	}
+	if topology.Datastore != "" {
+		vm.Spec.Datastore = topology.Datastore
+	}
+	for i, network := range topology.Networks {
+		if i >= len(vm.Spec.Network.Devices) {
+			break
+		}
+		vm.Spec.Network.Devices[i].NetworkName = network
+	}
+	vm.Spec.VMGroupName = ""
+	if topology.Hosts != nil {
+		vm.Spec.VMGroupName = topology.Hosts.VMGroupName
+	}
+}
+
+// ipAddressClaimName returns the name of the IPAddressClaim for a
+// VSphereMachine's network device and one of the device's IPPools.
+func ipAddressClaimName(vsphereMachine *infrav1.VSphereMachine, deviceIndex, poolIndex int) string {
+	return fmt.Sprintf("%s-%d-%d", vsphereMachine.Name, deviceIndex, poolIndex)
+}
+
+// reconcileIPAddressClaims ensures an IPAddressClaim exists for each IPPool
+// referenced by the VSphereMachine's network devices. The claims are
+// returned by device index and then by pool index, and ok is true when an
+// address is allocated to every claim.
+func (r machineReconciler) reconcileIPAddressClaims(ctx *context.MachineContext) (claims [][]*infrav1.IPAddressClaim, ok bool, err error) {
+	devices := ctx.VSphereMachine.Spec.Network.Devices
+	claims = make([][]*infrav1.IPAddressClaim, len(devices))
+	ok = true
+	for i := range devices {
+		for j, pool := range devices[i].IPPools {
+			claim := &infrav1.IPAddressClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: ctx.VSphereMachine.Namespace,
+					Name:      ipAddressClaimName(ctx.VSphereMachine, i, j),
+				},
+			}
+			mutateFn := func() error {
+				// Ensure the VSphereMachine is marked as an owner of the
+				// IPAddressClaim.
+				claim.SetOwnerReferences(clusterutilv1.EnsureOwnerRef(
+					claim.OwnerReferences,
+					metav1.OwnerReference{
+						APIVersion: ctx.VSphereMachine.APIVersion,
+						Kind:       ctx.VSphereMachine.Kind,
+						Name:       ctx.VSphereMachine.Name,
+						UID:        ctx.VSphereMachine.UID,
+					}))
+
+				// The pool of an existing claim is not changed since the
+				// claim's address is allocated from it.
+				if claim.CreationTimestamp.IsZero() {
+					claim.Spec.Pool = pool
+				}
+				return nil
+			}
+			if _, err := ctrlutil.CreateOrUpdate(ctx, ctx.Client, claim, mutateFn); err != nil {
+				return nil, false, errors.Wrapf(err,
+					"failed to CreateOrUpdate IPAddressClaim %s/%s", claim.Namespace, claim.Name)
+			}
+			if !claim.Status.Ready {
+				ctx.Logger.Info("IP address is not allocated",
+					"claim", claim.Name, "pool", claim.Spec.Pool.Name)
+				ok = false
+			}
+			claims[i] = append(claims[i], claim)
+		}
+	}
+	return claims, ok, nil
+}
+
+// applyIPAddressClaims adds the addresses allocated to the IPAddressClaims
+// to the VSphereVM's network devices. A pool's gateway and nameservers are
+// used when they are not specified by the device.
+func applyIPAddressClaims(vm *infrav1.VSphereVM, claims [][]*infrav1.IPAddressClaim) {
+	devices := vm.Spec.Network.Devices
+	for i := 0; i < len(claims) && i < len(devices); i++ {
+		for _, claim := range claims[i] {
+			devices[i].IPAddrs = append(devices[i].IPAddrs, claim.Status.Address)
+			if gateway := net.ParseIP(claim.Status.Gateway); gateway != nil {
+				if gateway.To4() != nil {
+					if devices[i].Gateway4 == "" {
+						devices[i].Gateway4 = claim.Status.Gateway
+					}
+				} else if devices[i].Gateway6 == "" {
+					devices[i].Gateway6 = claim.Status.Gateway
+				}
+			}
+			if len(devices[i].Nameservers) == 0 {
+				devices[i].Nameservers = claim.Status.Nameservers
+			}
+		}
+	}
+}
+
+// reconcileDeleteIPAddressClaims deletes the IPAddressClaims owned by the
+// VSphereMachine once its VSphereVM is deleted. The claims' addresses are
+// released when the claims are deleted.
+func (r machineReconciler) reconcileDeleteIPAddressClaims(ctx *context.MachineContext) (bool, error) {
+	claimList := &infrav1.IPAddressClaimList{}
+	if err := ctx.Client.List(ctx, claimList, client.InNamespace(ctx.VSphereMachine.Namespace)); err != nil {
+		return false, errors.Wrapf(err, "failed to list IPAddressClaims for %s", ctx)
+	}
+	var claims []*infrav1.IPAddressClaim
+	for i := range claimList.Items {
+		for _, ref := range claimList.Items[i].OwnerReferences {
+			if ref.UID == ctx.VSphereMachine.UID {
+				claims = append(claims, &claimList.Items[i])
+				break
+			}
+		}
+	}
+	if len(claims) == 0 {
+		return true, nil
+	}
+
+	// Wait for the VSphereVM to be deleted.
+	vmKey := apitypes.NamespacedName{
+		Namespace: ctx.VSphereMachine.Namespace,
+		Name:      ctx.Machine.Name,
+	}
+	if err := ctx.Client.Get(ctx, vmKey, &infrav1.VSphereVM{}); err == nil {
+		return false, nil
+	} else if !apierrors.IsNotFound(err) {
+		return false, errors.Wrapf(err, "failed to get VSphereVM %s", vmKey)
+	}
+
+	for _, claim := range claims {
+		if err := ctx.Client.Delete(ctx, claim); err != nil && !apierrors.IsNotFound(err) {
+			return false, errors.Wrapf(err,
+				"failed to delete IPAddressClaim %s/%s", claim.Namespace, claim.Name)
+		}
+	}
+	return true, nil
+}
+
 func (r machineReconciler) reconcileNetwork(ctx *context.MachineContext, vm *unstructured.Unstructured) (bool, error) {
 	if networkStatusListOfIfaces, ok, _ := unstructured.NestedSlice(vm.Object, "status", "network"); ok {
 		networkStatusList := []infrav1.NetworkStatus{}
@@ -419,12 +749,9 @@ func (r machineReconciler) reconcileNetwork(ctx *context.MachineContext, vm *uns
 	}
 
 	if addresses, ok, _ := unstructured.NestedStringSlice(vm.Object, "status", "addresses"); ok {
-		var machineAddresses []clusterv1.MachineAddress
-		for _, addr := range addresses {
-			machineAddresses = append(machineAddresses, clusterv1.MachineAddress{
-				Type:    clusterv1.MachineExternalIP,
-				Address: addr,
-			})
+		machineAddresses, err := infrautilv1.GetMachineAddresses(ctx.VSphereMachine.Spec.Network, addresses...)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to get addresses for %s", ctx)
 		}
 		ctx.VSphereMachine.Status.Addresses = machineAddresses
 	}
@@ -437,6 +764,102 @@ func (r machineReconciler) reconcileNetwork(ctx *context.MachineContext, vm *uns
 	return true, nil
 }
 
+// reconcileDNS registers the A, AAAA, and PTR records of the machine's
+// hostname and addresses when the VSphereCluster has a DNS configuration.
+// The records are updated only when the machine's addresses change.
+func (r machineReconciler) reconcileDNS(ctx *context.MachineContext) error {
+	if ctx.VSphereCluster.Spec.DNS == nil {
+		return nil
+	}
+
+	// Link-local and loopback addresses are not registered.
+	var addrs []string
+	for _, addr := range ctx.VSphereMachine.Status.Addresses {
+		if ip := net.ParseIP(addr.Address); ip != nil && ip.IsGlobalUnicast() {
+			addrs = append(addrs, ip.String())
+		}
+	}
+	sort.Strings(addrs)
+	if reflect.DeepEqual(addrs, ctx.VSphereMachine.Status.DNSAddresses) {
+		return nil
+	}
+
+	dnsClient, err := dns.NewClient(ctx, ctx.Client, ctx.VSphereCluster)
+	if err != nil {
+		return err
+	}
+
+	// The VM's hostname is the name of the VSphereVM, which is the name of
+	// the Machine.
+	hostname := ctx.Machine.Name
+	if err := dnsClient.UpdateAddressRecords(ctx, hostname, addrs); err != nil {
+		return err
+	}
+	var oldAddrs []string
+	for _, addr := range ctx.VSphereMachine.Status.DNSAddresses {
+		if !containsString(addrs, addr) {
+			oldAddrs = append(oldAddrs, addr)
+		}
+	}
+	if err := dnsClient.DeletePointerRecords(ctx, oldAddrs); err != nil {
+		return err
+	}
+	if err := dnsClient.UpdatePointerRecords(ctx, hostname, addrs); err != nil {
+		return err
+	}
+
+	ctx.VSphereMachine.Status.DNSAddresses = addrs
+	r.Recorder.Eventf(ctx.VSphereMachine, "DNSRecordsUpdated",
+		"registered %s with addresses %v", dnsClient.FQDN(hostname), addrs)
+	return nil
+}
+
+// reconcileDeleteDNS deletes the DNS records registered by reconcileDNS.
+func (r machineReconciler) reconcileDeleteDNS(ctx *context.MachineContext) error {
+	if ctx.VSphereCluster.Spec.DNS == nil || len(ctx.VSphereMachine.Status.DNSAddresses) == 0 {
+		return nil
+	}
+	dnsClient, err := dns.NewClient(ctx, ctx.Client, ctx.VSphereCluster)
+	if err != nil {
+		return err
+	}
+	if err := dnsClient.DeleteAddressRecords(ctx, ctx.Machine.Name); err != nil {
+		return err
+	}
+	if err := dnsClient.DeletePointerRecords(ctx, ctx.VSphereMachine.Status.DNSAddresses); err != nil {
+		return err
+	}
+	ctx.VSphereMachine.Status.DNSAddresses = nil
+	return nil
+}
+
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileErrorState sets the VSphereMachine's error reason and message
+// from those of the VM. It returns false if the VM has a terminal error.
+func (r machineReconciler) reconcileErrorState(ctx *context.MachineContext, vm *unstructured.Unstructured) bool {
+	errorReason, _, _ := unstructured.NestedString(vm.Object, "status", "errorReason")
+	errorMessage, _, _ := unstructured.NestedString(vm.Object, "status", "errorMessage")
+	if errorReason == "" && errorMessage == "" {
+		return true
+	}
+	if errorReason != "" {
+		machineStatusError := capierrors.MachineStatusError(errorReason)
+		ctx.VSphereMachine.Status.ErrorReason = &machineStatusError
+	}
+	if errorMessage != "" {
+		ctx.VSphereMachine.Status.ErrorMessage = &errorMessage
+	}
+	return false
+}
+
 func (r machineReconciler) reconcileProviderID(ctx *context.MachineContext, vm *unstructured.Unstructured) (bool, error) {
 	biosUUID, ok, err := unstructured.NestedString(vm.Object, "spec", "biosUUID")
 	if !ok {
@@ -507,3 +930,44 @@ func (r machineReconciler) reconcileReadyState(ctx *context.MachineContext, vm *
 	ctx.VSphereMachine.Status.Ready = true
 	return true, nil
 }
+
+// clusterToVSphereMachines is a handler.ToRequestsFunc to be used to trigger
+// reconcile events for the VSphereMachine resources that are members of a
+// CAPI Cluster when the Cluster is reconciled, such as when it is unpaused.
+func (r machineReconciler) clusterToVSphereMachines(o handler.MapObject) []ctrl.Request {
+	return r.requestsForClusterVSphereMachines(o.Meta.GetNamespace(), o.Meta.GetName())
+}
+
+// vsphereClusterToVSphereMachines is a handler.ToRequestsFunc to be used to
+// trigger reconcile events for the VSphereMachine resources that are members
+// of the CAPI Cluster that owns a VSphereCluster when the VSphereCluster is
+// reconciled, such as when its hibernation state changes.
+func (r machineReconciler) vsphereClusterToVSphereMachines(o handler.MapObject) []ctrl.Request {
+	for _, ref := range o.Meta.GetOwnerReferences() {
+		if ref.Kind == "Cluster" && ref.APIVersion == clusterv1.GroupVersion.String() {
+			return r.requestsForClusterVSphereMachines(o.Meta.GetNamespace(), ref.Name)
+		}
+	}
+	return nil
+}
+
+func (r machineReconciler) requestsForClusterVSphereMachines(namespace, clusterName string) []ctrl.Request {
+	vsphereMachines := &infrav1.VSphereMachineList{}
+	if err := r.Client.List(r, vsphereMachines,
+		client.InNamespace(namespace),
+		client.MatchingLabels{clusterv1.ClusterLabelName: clusterName}); err != nil {
+		r.Logger.Error(err, "failed to list VSphereMachines for cluster",
+			"clusterNamespace", namespace, "clusterName", clusterName)
+		return nil
+	}
+	requests := make([]ctrl.Request, len(vsphereMachines.Items))
+	for i := range vsphereMachines.Items {
+		requests[i] = ctrl.Request{
+			NamespacedName: apitypes.NamespacedName{
+				Namespace: vsphereMachines.Items[i].Namespace,
+				Name:      vsphereMachines.Items[i].Name,
+			},
+		}
+	}
+	return requests
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+
+	mdns "github.com/miekg/dns"
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+// dnsTestServer is an in-process DNS server that applies the unsigned
+// dynamic updates it receives to an in-memory set of records.
+type dnsTestServer struct {
+	sync.Mutex
+	records map[string][]string
+	updates int
+}
+
+func (s *dnsTestServer) ServeDNS(w mdns.ResponseWriter, req *mdns.Msg) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.updates++
+	for _, rr := range req.Ns {
+		hdr := rr.Header()
+		key := fmt.Sprintf("%s %s", hdr.Name, mdns.TypeToString[hdr.Rrtype])
+		if hdr.Class == mdns.ClassANY || hdr.Class == mdns.ClassNONE {
+			delete(s.records, key)
+			continue
+		}
+		s.records[key] = append(s.records[key], rr.String())
+	}
+	resp := new(mdns.Msg)
+	resp.SetReply(req)
+	_ = w.WriteMsg(resp)
+}
+
+func (s *dnsTestServer) get(name string, rrtype uint16) []string {
+	s.Lock()
+	defer s.Unlock()
+	records := append([]string{}, s.records[fmt.Sprintf("%s %s", name, mdns.TypeToString[rrtype])]...)
+	sort.Strings(records)
+	return records
+}
+
+func (s *dnsTestServer) getUpdates() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.updates
+}
+
+func startDNSTestServer(t *testing.T) (*dnsTestServer, string, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &dnsTestServer{records: map[string][]string{}}
+	started := make(chan struct{})
+	server := &mdns.Server{
+		PacketConn:        pc,
+		Handler:           ts,
+		NotifyStartedFunc: func() { close(started) },
+		// The default accept function rejects updates.
+		MsgAcceptFunc: func(mdns.Header) mdns.MsgAcceptAction { return mdns.MsgAccept },
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	return ts, pc.LocalAddr().String(), func() { _ = server.Shutdown() }
+}
+
+func newMachineTestContext() (*context.MachineContext, machineReconciler) {
+	controllerContext := fake.NewControllerContext(fake.NewControllerManagerContext())
+	ctx := fake.NewMachineContext(fake.NewClusterContext(controllerContext))
+	return ctx, machineReconciler{ControllerContext: controllerContext}
+}
+
+func TestVSphereMachineReconcileDNS(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ts, server, stop := startDNSTestServer(t)
+	defer stop()
+
+	ctx, reconciler := newMachineTestContext()
+	fqdn := ctx.Machine.Name + ".k8s.example.com."
+	setAddresses := func(addrs ...string) {
+		ctx.VSphereMachine.Status.Addresses = nil
+		for _, addr := range addrs {
+			ctx.VSphereMachine.Status.Addresses = append(ctx.VSphereMachine.Status.Addresses,
+				clusterv1.MachineAddress{Type: clusterv1.MachineExternalIP, Address: addr})
+		}
+	}
+
+	// Nothing is registered without a DNS configuration.
+	setAddresses("192.168.1.10")
+	g.Expect(reconciler.reconcileDNS(ctx)).To(gomega.Succeed())
+	g.Expect(ts.getUpdates()).To(gomega.Equal(0))
+	g.Expect(ctx.VSphereMachine.Status.DNSAddresses).To(gomega.BeEmpty())
+
+	// The machine's global unicast addresses are registered.
+	ctx.VSphereCluster.Spec.DNS = &infrav1.DNSSpec{
+		Server:       server,
+		Zone:         "k8s.example.com",
+		ReverseZones: []string{"1.168.192.in-addr.arpa"},
+	}
+	setAddresses("192.168.1.10", "fe80::1")
+	g.Expect(reconciler.reconcileDNS(ctx)).To(gomega.Succeed())
+	g.Expect(ctx.VSphereMachine.Status.DNSAddresses).To(gomega.Equal([]string{"192.168.1.10"}))
+	g.Expect(ts.get(fqdn, mdns.TypeA)).To(gomega.Equal([]string{
+		fqdn + "\t300\tIN\tA\t192.168.1.10",
+	}))
+	g.Expect(ts.get("10.1.168.192.in-addr.arpa.", mdns.TypePTR)).To(gomega.Equal([]string{
+		"10.1.168.192.in-addr.arpa.\t300\tIN\tPTR\t" + fqdn,
+	}))
+
+	// The records are not updated while the addresses are unchanged.
+	updates := ts.getUpdates()
+	g.Expect(reconciler.reconcileDNS(ctx)).To(gomega.Succeed())
+	g.Expect(ts.getUpdates()).To(gomega.Equal(updates))
+
+	// The records of an address that changed are replaced.
+	setAddresses("192.168.1.11")
+	g.Expect(reconciler.reconcileDNS(ctx)).To(gomega.Succeed())
+	g.Expect(ctx.VSphereMachine.Status.DNSAddresses).To(gomega.Equal([]string{"192.168.1.11"}))
+	g.Expect(ts.get(fqdn, mdns.TypeA)).To(gomega.Equal([]string{
+		fqdn + "\t300\tIN\tA\t192.168.1.11",
+	}))
+	g.Expect(ts.get("10.1.168.192.in-addr.arpa.", mdns.TypePTR)).To(gomega.BeEmpty())
+	g.Expect(ts.get("11.1.168.192.in-addr.arpa.", mdns.TypePTR)).To(gomega.HaveLen(1))
+
+	// The records are deleted with the machine.
+	g.Expect(reconciler.reconcileDeleteDNS(ctx)).To(gomega.Succeed())
+	g.Expect(ctx.VSphereMachine.Status.DNSAddresses).To(gomega.BeEmpty())
+	g.Expect(ts.get(fqdn, mdns.TypeA)).To(gomega.BeEmpty())
+	g.Expect(ts.get("11.1.168.192.in-addr.arpa.", mdns.TypePTR)).To(gomega.BeEmpty())
+}
+
+func TestVSphereMachineReconcileIPAddressClaims(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	ctx, reconciler := newMachineTestContext()
+	ctx.VSphereMachine.Spec.Network.Devices = []infrav1.NetworkDeviceSpec{
+		{
+			NetworkName: "VM Network",
+			IPPools:     []corev1.LocalObjectReference{{Name: "pool"}},
+		},
+	}
+
+	// A claim is created for the device's pool, and the VSphereVM is not
+	// created until an address is allocated to it.
+	claims, ok, err := reconciler.reconcileIPAddressClaims(ctx)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(ok).To(gomega.BeFalse())
+	g.Expect(claims).To(gomega.HaveLen(1))
+	g.Expect(claims[0]).To(gomega.HaveLen(1))
+	claim := claims[0][0]
+	g.Expect(claim.Name).To(gomega.Equal(ctx.VSphereMachine.Name + "-0-0"))
+	g.Expect(claim.Spec.Pool.Name).To(gomega.Equal("pool"))
+	g.Expect(claim.OwnerReferences).To(gomega.HaveLen(1))
+	g.Expect(claim.OwnerReferences[0].UID).To(gomega.Equal(ctx.VSphereMachine.UID))
+
+	claim.Status = infrav1.IPAddressClaimStatus{
+		Ready:       true,
+		Address:     "192.168.1.2/24",
+		Gateway:     "192.168.1.1",
+		Nameservers: []string{"192.168.1.53"},
+	}
+	g.Expect(ctx.Client.Status().Update(ctx, claim)).To(gomega.Succeed())
+
+	// The allocated address, and the pool's gateway and nameservers, are
+	// applied to the VSphereVM's device.
+	claims, ok, err = reconciler.reconcileIPAddressClaims(ctx)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(ok).To(gomega.BeTrue())
+	vm := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ctx.VSphereMachine.Namespace,
+			Name:      ctx.Machine.Name,
+		},
+	}
+	ctx.VSphereMachine.Spec.VirtualMachineCloneSpec.DeepCopyInto(&vm.Spec.VirtualMachineCloneSpec)
+	applyIPAddressClaims(vm, claims)
+	device := vm.Spec.Network.Devices[0]
+	g.Expect(device.IPAddrs).To(gomega.Equal([]string{"192.168.1.2/24"}))
+	g.Expect(device.Gateway4).To(gomega.Equal("192.168.1.1"))
+	g.Expect(device.Nameservers).To(gomega.Equal([]string{"192.168.1.53"}))
+	g.Expect(ctx.VSphereMachine.Spec.Network.Devices[0].IPAddrs).To(gomega.BeEmpty())
+
+	// The claims are not deleted until the VSphereVM is deleted, so the
+	// addresses are not reused while the VM exists.
+	g.Expect(ctx.Client.Create(ctx, vm)).To(gomega.Succeed())
+	ok, err = reconciler.reconcileDeleteIPAddressClaims(ctx)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(ok).To(gomega.BeFalse())
+	claimList := &infrav1.IPAddressClaimList{}
+	g.Expect(ctx.Client.List(ctx, claimList)).To(gomega.Succeed())
+	g.Expect(claimList.Items).To(gomega.HaveLen(1))
+
+	g.Expect(ctx.Client.Delete(ctx, vm)).To(gomega.Succeed())
+	ok, err = reconciler.reconcileDeleteIPAddressClaims(ctx)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(ok).To(gomega.BeTrue())
+	g.Expect(ctx.Client.List(ctx, claimList)).To(gomega.Succeed())
+	g.Expect(claimList.Items).To(gomega.BeEmpty())
+}
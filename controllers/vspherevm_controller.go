@@ -26,12 +26,18 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/pkg/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	clusterutilv1 "sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
@@ -46,6 +52,10 @@ import (
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherevms,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherevms/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get
 
 // AddVMControllerToManager adds the VM controller to the provided manager.
 func AddVMControllerToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) error {
@@ -67,9 +77,28 @@ func AddVMControllerToManager(ctx *context.ControllerManagerContext, mgr manager
 		Logger:                   ctx.Logger.WithName(controllerNameShort),
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	reconciler := vmReconciler{ControllerContext: controllerContext}
+
+	// The watches of the VMs and their tasks trigger reconcile requests for
+	// the VSphereVMs through the GenericEvent channel. They are run only by
+	// the leader.
+	if err := mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		return govmomi.RunVMWatches(controllerContext, stop)
+	})); err != nil {
+		return err
+	}
+
+	controller, err := ctrl.NewControllerManagedBy(mgr).
 		// Watch the controlled, infrastructure resource.
 		For(controlledType).
+		// Watch the CAPI cluster of which the VSphereVM resources are members
+		// so the VSphereVMs are reconciled when the cluster is unpaused.
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(reconciler.clusterToVSphereVMs),
+			},
+		).
 		// Watch a GenericEvent channel for the controlled resource.
 		//
 		// This is useful when there are events outside of Kubernetes that
@@ -79,7 +108,39 @@ func AddVMControllerToManager(ctx *context.ControllerManagerContext, mgr manager
 			&source.Channel{Source: ctx.GetGenericEventChannelFor(controlledTypeGVK)},
 			&handler.EnqueueRequestForObject{},
 		).
-		Complete(vmReconciler{ControllerContext: controllerContext})
+		Build(reconciler)
+	if err != nil {
+		return err
+	}
+
+	// Watch the Machines that own the VSphereVM resources through their
+	// VSphereMachines so a VSphereVM's bootstrap data is scrubbed and its
+	// diagnostics are no longer collected once its Machine has a NodeRef.
+	return controller.Watch(
+		&source.Kind{Type: &clusterv1.Machine{}},
+		&handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(reconciler.machineToVSphereVMs),
+		},
+		predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				oldMachine, ok := e.ObjectOld.(*clusterv1.Machine)
+				if !ok {
+					return false
+				}
+				newMachine, ok := e.ObjectNew.(*clusterv1.Machine)
+				if !ok {
+					return false
+				}
+				return (oldMachine.Status.NodeRef == nil) != (newMachine.Status.NodeRef == nil)
+			},
+			DeleteFunc: func(event.DeleteEvent) bool {
+				return false
+			},
+			GenericFunc: func(event.GenericEvent) bool {
+				return false
+			},
+		},
+	)
 }
 
 type vmReconciler struct {
@@ -99,6 +160,26 @@ func (r vmReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr error)
 		return reconcile.Result{}, err
 	}
 
+	// Fetch the CAPI Cluster. A VSphereVM that is not a member of a cluster,
+	// such as a VSphereVM created for an HAProxyLoadBalancer before the
+	// cluster label is assigned, is only paused by its own annotation.
+	var cluster *clusterv1.Cluster
+	if vsphereVM.Labels[clusterv1.ClusterLabelName] != "" {
+		var err error
+		if cluster, err = clusterutilv1.GetClusterFromMetadata(r, r.Client, vsphereVM.ObjectMeta); err != nil {
+			if !apierrors.IsNotFound(errors.Cause(err)) {
+				return reconcile.Result{}, err
+			}
+		}
+	}
+
+	// Do not reconcile the VSphereVM while it or its cluster is paused, such
+	// as while the cluster is moved with clusterctl move.
+	if isPaused(cluster, vsphereVM) {
+		r.Logger.V(4).Info("VSphereVM or linked Cluster is paused, won't reconcile", "key", req.NamespacedName)
+		return reconcile.Result{}, nil
+	}
+
 	// Get or create an authenticated session to the vSphere endpoint.
 	authSession, err := session.GetOrCreate(r.Context,
 		vsphereVM.Spec.Server, vsphereVM.Spec.Datacenter,
@@ -251,6 +332,12 @@ func (r vmReconciler) reconcileDelete(ctx *context.VMContext) (reconcile.Result,
 }
 
 func (r vmReconciler) reconcileNormal(ctx *context.VMContext) (reconcile.Result, error) {
+	// If the VSphereVM is in an error state, return early.
+	if ctx.VSphereVM.Status.ErrorReason != nil || ctx.VSphereVM.Status.ErrorMessage != nil {
+		ctx.Logger.Info("Error state detected, skipping reconciliation")
+		return reconcile.Result{}, nil
+	}
+
 	// If the VSphereVM doesn't have our finalizer, add it.
 	ctrlutil.AddFinalizer(ctx.VSphereVM, infrav1.VMFinalizer)
 
@@ -275,8 +362,12 @@ func (r vmReconciler) reconcileNormal(ctx *context.VMContext) (reconcile.Result,
 	// Update the VSphereVM's BIOS UUID.
 	ctx.VSphereVM.Spec.BiosUUID = vm.BiosUUID
 
-	// Update the VSphereVM's network status.
-	r.reconcileNetwork(ctx, vm)
+	// Update the VSphereVM's network status. The last known network status
+	// of a VM that is not powered on, such as the VM of a hibernating
+	// cluster, is retained so its addresses remain available.
+	if ctx.VSphereVM.Status.PowerState == infrav1.VirtualMachinePowerStatePoweredOn {
+		r.reconcileNetwork(ctx, vm)
+	}
 
 	// Once the network is online the VM is considered ready.
 	ctx.VSphereVM.Status.Ready = true
@@ -295,3 +386,64 @@ func (r vmReconciler) reconcileNetwork(ctx *context.VMContext, vm infrav1.Virtua
 	}
 	ctx.VSphereVM.Status.Addresses = ipAddrs
 }
+
+// clusterToVSphereVMs is a handler.ToRequestsFunc to be used to trigger
+// reconcile events for the VSphereVM resources that are members of a CAPI
+// Cluster when the Cluster is reconciled, such as when it is unpaused.
+func (r vmReconciler) clusterToVSphereVMs(o handler.MapObject) []ctrl.Request {
+	vsphereVMs := &infrav1.VSphereVMList{}
+	if err := r.Client.List(r, vsphereVMs,
+		client.InNamespace(o.Meta.GetNamespace()),
+		client.MatchingLabels{clusterv1.ClusterLabelName: o.Meta.GetName()}); err != nil {
+		r.Logger.Error(err, "failed to list VSphereVMs for cluster",
+			"clusterNamespace", o.Meta.GetNamespace(), "clusterName", o.Meta.GetName())
+		return nil
+	}
+	requests := make([]ctrl.Request, len(vsphereVMs.Items))
+	for i := range vsphereVMs.Items {
+		requests[i] = ctrl.Request{
+			NamespacedName: apitypes.NamespacedName{
+				Namespace: vsphereVMs.Items[i].Namespace,
+				Name:      vsphereVMs.Items[i].Name,
+			},
+		}
+	}
+	return requests
+}
+
+// machineToVSphereVMs is a handler.ToRequestsFunc to be used to trigger
+// reconcile events for the VSphereVM resources owned by the VSphereMachine
+// that is the infrastructure of a Machine.
+func (r vmReconciler) machineToVSphereVMs(o handler.MapObject) []ctrl.Request {
+	machine, ok := o.Object.(*clusterv1.Machine)
+	if !ok {
+		r.Logger.Error(nil, fmt.Sprintf("expected a Machine but got a %T", o.Object))
+		return nil
+	}
+	infraRef := machine.Spec.InfrastructureRef
+	if infraRef.Kind != "VSphereMachine" || infraRef.APIVersion != infrav1.GroupVersion.String() {
+		return nil
+	}
+
+	vsphereVMs := &infrav1.VSphereVMList{}
+	if err := r.Client.List(r, vsphereVMs, client.InNamespace(machine.Namespace)); err != nil {
+		r.Logger.Error(err, "failed to list VSphereVMs for machine",
+			"machineNamespace", machine.Namespace, "machineName", machine.Name)
+		return nil
+	}
+	var requests []ctrl.Request
+	for i := range vsphereVMs.Items {
+		for _, ref := range vsphereVMs.Items[i].OwnerReferences {
+			if ref.Kind == infraRef.Kind && ref.APIVersion == infraRef.APIVersion && ref.Name == infraRef.Name {
+				requests = append(requests, ctrl.Request{
+					NamespacedName: apitypes.NamespacedName{
+						Namespace: vsphereVMs.Items[i].Namespace,
+						Name:      vsphereVMs.Items[i].Name,
+					},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
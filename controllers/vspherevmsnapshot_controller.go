@@ -0,0 +1,343 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	clusterutilv1 "sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi"
+	infrautilv1 "sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+const (
+	// vmSnapshotRequeuePeriod is how often a VSphereVMSnapshot is reconciled
+	// while it waits for the VMs it snapshots to be created.
+	vmSnapshotRequeuePeriod = 30 * time.Second
+
+	// vmSnapshotTaskRequeuePeriod is how often a VSphereVMSnapshot is
+	// reconciled while the tasks that create, revert to or remove its
+	// snapshots are in flight.
+	vmSnapshotTaskRequeuePeriod = 5 * time.Second
+)
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherevmsnapshots,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherevmsnapshots/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherevms,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
+
+// AddVMSnapshotControllerToManager adds the VM snapshot controller to the
+// provided manager.
+func AddVMSnapshotControllerToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) error {
+
+	var (
+		controlledType     = &infrav1.VSphereVMSnapshot{}
+		controlledTypeName = reflect.TypeOf(controlledType).Elem().Name()
+
+		controllerNameShort = fmt.Sprintf("%s-controller", strings.ToLower(controlledTypeName))
+		controllerNameLong  = fmt.Sprintf("%s/%s/%s", ctx.Namespace, ctx.Name, controllerNameShort)
+	)
+
+	// Build the controller context.
+	controllerContext := &context.ControllerContext{
+		ControllerManagerContext: ctx,
+		Name:                     controllerNameShort,
+		Recorder:                 record.New(mgr.GetEventRecorderFor(controllerNameLong)),
+		Logger:                   ctx.Logger.WithName(controllerNameShort),
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		// Watch the controlled, infrastructure resource.
+		For(controlledType).
+		Complete(vmSnapshotReconciler{ControllerContext: controllerContext})
+}
+
+type vmSnapshotReconciler struct {
+	*context.ControllerContext
+}
+
+// Reconcile ensures the back-end state reflects the Kubernetes resource state intent.
+func (r vmSnapshotReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr error) {
+
+	// Get the VSphereVMSnapshot resource for this request.
+	vsphereVMSnapshot := &infrav1.VSphereVMSnapshot{}
+	if err := r.Client.Get(r, req.NamespacedName, vsphereVMSnapshot); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Logger.Info("VSphereVMSnapshot not found, won't reconcile", "key", req.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// Fetch the CAPI Cluster of which the snapshot is a member.
+	cluster, err := r.getCluster(vsphereVMSnapshot)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Do not reconcile the VSphereVMSnapshot while it or its cluster is
+	// paused, such as while the cluster is moved with clusterctl move.
+	if isPaused(cluster, vsphereVMSnapshot) {
+		r.Logger.V(4).Info("VSphereVMSnapshot or linked Cluster is paused, won't reconcile", "key", req.NamespacedName)
+		return reconcile.Result{}, nil
+	}
+
+	// Create the patch helper.
+	patchHelper, err := patch.NewHelper(vsphereVMSnapshot, r.Client)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(
+			err,
+			"failed to init patch helper for %s %s/%s",
+			vsphereVMSnapshot.GroupVersionKind(),
+			vsphereVMSnapshot.Namespace,
+			vsphereVMSnapshot.Name)
+	}
+
+	// Create the VM snapshot context for this request.
+	vmSnapshotContext := &context.VMSnapshotContext{
+		ControllerContext: r.ControllerContext,
+		VSphereVMSnapshot: vsphereVMSnapshot,
+		Logger:            r.Logger.WithName(req.Namespace).WithName(req.Name),
+		PatchHelper:       patchHelper,
+	}
+
+	// Always issue a patch when exiting this function so changes to the
+	// resource are patched back to the API server.
+	defer func() {
+		if err := vmSnapshotContext.Patch(); err != nil {
+			if reterr == nil {
+				reterr = err
+			}
+			vmSnapshotContext.Logger.Error(err, "patch failed", "snapshot", vmSnapshotContext.String())
+		}
+	}()
+
+	// Handle deleted snapshots
+	if !vsphereVMSnapshot.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(vmSnapshotContext)
+	}
+
+	// Handle non-deleted snapshots
+	return r.reconcileNormal(vmSnapshotContext, cluster)
+}
+
+// getCluster returns the CAPI Cluster named by the snapshot's spec or
+// cluster label, or nil if the snapshot is not a member of a cluster.
+func (r vmSnapshotReconciler) getCluster(vsphereVMSnapshot *infrav1.VSphereVMSnapshot) (*clusterv1.Cluster, error) {
+	clusterName := vsphereVMSnapshot.Spec.ClusterName
+	if clusterName == "" {
+		clusterName = vsphereVMSnapshot.Labels[clusterv1.ClusterLabelName]
+	}
+	if clusterName == "" {
+		return nil, nil
+	}
+	cluster := &clusterv1.Cluster{}
+	clusterKey := client.ObjectKey{Namespace: vsphereVMSnapshot.Namespace, Name: clusterName}
+	if err := r.Client.Get(r, clusterKey, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get Cluster %s", clusterKey)
+	}
+	return cluster, nil
+}
+
+func (r vmSnapshotReconciler) reconcileDelete(ctx *context.VMSnapshotContext) (reconcile.Result, error) {
+	ctx.Logger.Info("Handling deleted VSphereVMSnapshot")
+
+	var snapshotService services.SnapshotService = &govmomi.SnapshotService{}
+
+	deleted, err := snapshotService.DeleteSnapshot(ctx)
+	if err != nil {
+		r.Recorder.Warn(ctx.VSphereVMSnapshot, "RemoveFailed", err.Error())
+		return reconcile.Result{}, errors.Wrapf(err, "failed to delete snapshot")
+	}
+
+	// The snapshots are removed by tasks that are checked when the
+	// VSphereVMSnapshot is requeued.
+	if !deleted {
+		ctx.Logger.Info("snapshots are not removed")
+		return reconcile.Result{RequeueAfter: vmSnapshotTaskRequeuePeriod}, nil
+	}
+
+	// The snapshots are removed so remove the finalizer.
+	ctrlutil.RemoveFinalizer(ctx.VSphereVMSnapshot, infrav1.VMSnapshotFinalizer)
+
+	return reconcile.Result{}, nil
+}
+
+func (r vmSnapshotReconciler) reconcileNormal(ctx *context.VMSnapshotContext, cluster *clusterv1.Cluster) (reconcile.Result, error) {
+	// If the VSphereVMSnapshot doesn't have our finalizer, add it.
+	ctrlutil.AddFinalizer(ctx.VSphereVMSnapshot, infrav1.VMSnapshotFinalizer)
+
+	spec := ctx.VSphereVMSnapshot.Spec
+	if (spec.VMName == "") == (spec.ClusterName == "") {
+		errMsg := "exactly one of spec.vmName and spec.clusterName must be specified"
+		ctx.VSphereVMSnapshot.Status.ErrorMessage = &errMsg
+		r.Recorder.Warn(ctx.VSphereVMSnapshot, "InvalidSpec", errMsg)
+		return reconcile.Result{}, nil
+	}
+
+	// The VMs are resolved until the snapshots are first created.
+	var vms []infrav1.VSphereVM
+	if !ctx.VSphereVMSnapshot.Status.Ready && len(ctx.VSphereVMSnapshot.Status.VMs) == 0 {
+		var err error
+		if vms, err = r.getVMs(ctx); err != nil {
+			return reconcile.Result{}, err
+		}
+		if len(vms) == 0 {
+			ctx.Logger.Info("waiting for VMs to be created")
+			return reconcile.Result{RequeueAfter: vmSnapshotRequeuePeriod}, nil
+		}
+		r.reconcileOwner(ctx, cluster, vms)
+	}
+
+	wasReady := ctx.VSphereVMSnapshot.Status.Ready
+	lastRevertTime := ctx.VSphereVMSnapshot.Status.LastRevertTime
+
+	var snapshotService services.SnapshotService = &govmomi.SnapshotService{}
+
+	if err := snapshotService.ReconcileSnapshot(ctx, vms); err != nil {
+		r.Recorder.Warn(ctx.VSphereVMSnapshot, "SnapshotFailed", err.Error())
+		return reconcile.Result{}, errors.Wrapf(err, "failed to reconcile snapshot")
+	}
+
+	status := ctx.VSphereVMSnapshot.Status
+	if status.Ready && !wasReady {
+		r.Recorder.Eventf(ctx.VSphereVMSnapshot, "Created", "created snapshots of %d VMs", len(status.VMs))
+	}
+	if status.LastRevertTime != nil && status.LastRevertTime != lastRevertTime {
+		r.Recorder.Eventf(ctx.VSphereVMSnapshot, "Reverted", "reverted %d VMs to snapshots", len(status.VMs))
+	}
+
+	// The tasks are checked when the VSphereVMSnapshot is requeued.
+	if hasSnapshotTasks(status) {
+		ctx.Logger.Info("waiting for snapshot tasks to complete")
+		return reconcile.Result{RequeueAfter: vmSnapshotTaskRequeuePeriod}, nil
+	}
+
+	if !status.Ready {
+		ctx.Logger.Info("snapshot is not ready")
+		return reconcile.Result{}, nil
+	}
+
+	ctx.Logger.V(4).Info("VSphereVMSnapshot is ready")
+	return reconcile.Result{}, nil
+}
+
+// getVMs returns the VSphereVMs that are snapshotted. Only VSphereVMs whose
+// VMs have been created are returned.
+func (r vmSnapshotReconciler) getVMs(ctx *context.VMSnapshotContext) ([]infrav1.VSphereVM, error) {
+	var (
+		namespace = ctx.VSphereVMSnapshot.Namespace
+		spec      = ctx.VSphereVMSnapshot.Spec
+		vms       []infrav1.VSphereVM
+	)
+
+	if spec.VMName != "" {
+		vm := &infrav1.VSphereVM{}
+		vmKey := client.ObjectKey{Namespace: namespace, Name: spec.VMName}
+		if err := r.Client.Get(ctx, vmKey, vm); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, errors.Wrapf(err, "failed to get VSphereVM %s for %s", vmKey, ctx)
+		}
+		vms = append(vms, *vm)
+	} else {
+		vmList := &infrav1.VSphereVMList{}
+		if err := r.Client.List(ctx, vmList,
+			client.InNamespace(namespace),
+			client.MatchingLabels{clusterv1.ClusterLabelName: spec.ClusterName}); err != nil {
+			return nil, errors.Wrapf(err, "failed to list VSphereVMs for %s", ctx)
+		}
+		for i := range vmList.Items {
+			if infrautilv1.IsControlPlaneMachine(&vmList.Items[i]) {
+				vms = append(vms, vmList.Items[i])
+			}
+		}
+	}
+
+	createdVMs := vms[:0]
+	for _, vm := range vms {
+		if vm.DeletionTimestamp.IsZero() && vm.Spec.BiosUUID != "" {
+			createdVMs = append(createdVMs, vm)
+		}
+	}
+	return createdVMs, nil
+}
+
+// reconcileOwner labels the snapshot with the name of its cluster and makes
+// the snapshot owned by its cluster or VSphereVM so it is deleted with them.
+func (r vmSnapshotReconciler) reconcileOwner(ctx *context.VMSnapshotContext, cluster *clusterv1.Cluster, vms []infrav1.VSphereVM) {
+	snapshot := ctx.VSphereVMSnapshot
+	if clusterName := vms[0].Labels[clusterv1.ClusterLabelName]; clusterName != "" {
+		if snapshot.Labels == nil {
+			snapshot.Labels = map[string]string{}
+		}
+		snapshot.Labels[clusterv1.ClusterLabelName] = clusterName
+	}
+
+	owner := metav1.OwnerReference{
+		APIVersion: infrav1.GroupVersion.String(),
+		Kind:       "VSphereVM",
+		Name:       vms[0].Name,
+		UID:        vms[0].UID,
+	}
+	if snapshot.Spec.ClusterName != "" {
+		if cluster == nil {
+			return
+		}
+		owner = metav1.OwnerReference{
+			APIVersion: clusterv1.GroupVersion.String(),
+			Kind:       "Cluster",
+			Name:       cluster.Name,
+			UID:        cluster.UID,
+		}
+	}
+	snapshot.SetOwnerReferences(clusterutilv1.EnsureOwnerRef(snapshot.OwnerReferences, owner))
+}
+
+// hasSnapshotTasks returns true if a task is in flight for any of the
+// snapshot's VMs.
+func hasSnapshotTasks(status infrav1.VSphereVMSnapshotStatus) bool {
+	for _, vm := range status.VMs {
+		if vm.TaskRef != "" {
+			return true
+		}
+	}
+	return false
+}
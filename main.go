@@ -44,6 +44,10 @@ var (
 	defaultPodNamespace            = manager.DefaultPodNamespace
 	defaultPodName                 = manager.DefaultPodName
 	defaultWatchNamespace          = manager.DefaultWatchNamespace
+	defaultOrphanVMScanPeriod      = manager.DefaultOrphanVMScanPeriod
+	defaultOrphanVMGracePeriod     = manager.DefaultOrphanVMGracePeriod
+	defaultOrphanVMDryRun          = true
+	defaultManagementClusterID     = os.Getenv("MANAGEMENT_CLUSTER_ID")
 )
 
 func init() {
@@ -65,6 +69,15 @@ func init() {
 	if v := os.Getenv("WATCH_NAMESPACE"); v != "" {
 		defaultWatchNamespace = v
 	}
+	if v, err := time.ParseDuration(os.Getenv("ORPHAN_VM_SCAN_PERIOD")); err == nil {
+		defaultOrphanVMScanPeriod = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("ORPHAN_VM_GRACE_PERIOD")); err == nil {
+		defaultOrphanVMGracePeriod = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("ORPHAN_VM_DRY_RUN")); err == nil {
+		defaultOrphanVMDryRun = v
+	}
 }
 
 func main() {
@@ -119,6 +132,26 @@ func main() {
 		"pod-name",
 		defaultPodName,
 		"The name of the pod running the controller manager.")
+	flag.DurationVar(
+		&managerOpts.OrphanVMScanPeriod,
+		"orphan-vm-scan-period",
+		defaultOrphanVMScanPeriod,
+		"The interval at which vSphere is scanned for VMs whose VSphereVM no longer exists. Set to zero to disable the scan.")
+	flag.DurationVar(
+		&managerOpts.OrphanVMGracePeriod,
+		"orphan-vm-grace-period",
+		defaultOrphanVMGracePeriod,
+		"How long a VM must be orphaned before it is deleted.")
+	flag.BoolVar(
+		&managerOpts.OrphanVMDryRun,
+		"orphan-vm-dry-run",
+		defaultOrphanVMDryRun,
+		"Report orphaned VMs without deleting them.")
+	flag.StringVar(
+		&managerOpts.ManagementClusterID,
+		"management-cluster-id",
+		defaultManagementClusterID,
+		"The ID recorded on the VMs created by the controller manager. Only orphaned VMs with the ID are deleted. If unspecified, the UID of the kube-system namespace is used.")
 
 	flag.Parse()
 
@@ -150,6 +183,18 @@ func main() {
 		if err := controllers.AddHAProxyLoadBalancerControllerToManager(ctx, mgr); err != nil {
 			return err
 		}
+		if err := controllers.AddImageControllerToManager(ctx, mgr); err != nil {
+			return err
+		}
+		if err := controllers.AddIPAddressClaimControllerToManager(ctx, mgr); err != nil {
+			return err
+		}
+		if err := controllers.AddVMSnapshotControllerToManager(ctx, mgr); err != nil {
+			return err
+		}
+		if err := controllers.AddOrphanVMScannerToManager(ctx, mgr); err != nil {
+			return err
+		}
 		return nil
 	}
 
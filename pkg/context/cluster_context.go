@@ -24,6 +24,7 @@ import (
 	"sigs.k8s.io/cluster-api/util/patch"
 
 	"sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
 )
 
 // ClusterContext is a Go context used with a VSphereCluster.
@@ -33,6 +34,7 @@ type ClusterContext struct {
 	VSphereCluster *v1alpha3.VSphereCluster
 	PatchHelper    *patch.Helper
 	Logger         logr.Logger
+	Session        *session.Session
 }
 
 // String returns VSphereClusterGroupVersionKind VSphereClusterNamespace/VSphereClusterName.
@@ -44,3 +46,13 @@ func (c *ClusterContext) String() string {
 func (c *ClusterContext) Patch() error {
 	return c.PatchHelper.Patch(c, c.VSphereCluster)
 }
+
+// GetLogger returns this context's logger.
+func (c *ClusterContext) GetLogger() logr.Logger {
+	return c.Logger
+}
+
+// GetSession returns this context's session.
+func (c *ClusterContext) GetSession() *session.Session {
+	return c.Session
+}
@@ -19,6 +19,7 @@ package context
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -56,6 +57,10 @@ type ControllerManagerContext struct {
 	// Client is the controller manager's client.
 	Client client.Client
 
+	// APIReader is used to read resources directly from the API server
+	// rather than from the client's cache.
+	APIReader client.Reader
+
 	// Logger is the controller manager's logger.
 	Logger logr.Logger
 
@@ -69,6 +74,24 @@ type ControllerManagerContext struct {
 	// controller will receive concurrently.
 	MaxConcurrentReconciles int
 
+	// OrphanVMScanPeriod is the interval at which the vSphere endpoints are
+	// scanned for VMs whose VSphereVM no longer exists. The scan is disabled
+	// when the period is zero.
+	OrphanVMScanPeriod time.Duration
+
+	// OrphanVMGracePeriod is how long a VM must be orphaned before it is
+	// deleted.
+	OrphanVMGracePeriod time.Duration
+
+	// OrphanVMDryRun is a flag that prevents orphaned VMs from being deleted.
+	// Orphaned VMs are only reported.
+	OrphanVMDryRun bool
+
+	// ManagementClusterID identifies the management cluster. The ID is
+	// recorded on the VMs created or adopted by the controller manager, and
+	// only orphaned VMs with the ID are deleted.
+	ManagementClusterID string
+
 	// Username is the username for the account used to access remote vSphere
 	// endpoints.
 	Username string
@@ -35,6 +35,9 @@ const (
 	// for the fake controller manager.
 	LeaderElectionID = ControllerManagerName + "-runtime"
 
+	// ManagementClusterID is the ID of the fake management cluster.
+	ManagementClusterID = "fake-management-cluster"
+
 	// Namespace is the fake namespace.
 	Namespace = "default"
 
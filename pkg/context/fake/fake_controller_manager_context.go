@@ -23,6 +23,7 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	clientrecord "k8s.io/client-go/tools/record"
 	clusterv1a2 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	controlplanev1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 
@@ -39,17 +40,22 @@ func NewControllerManagerContext(initObjects ...runtime.Object) *context.Control
 	scheme := runtime.NewScheme()
 	_ = clientgoscheme.AddToScheme(scheme)
 	_ = clusterv1a2.AddToScheme(scheme)
+	_ = controlplanev1.AddToScheme(scheme)
 	_ = infrav1.AddToScheme(scheme)
 
+	client := fake.NewFakeClientWithScheme(scheme, initObjects...)
+
 	return &context.ControllerManagerContext{
 		Context:                 goctx.Background(),
-		Client:                  fake.NewFakeClientWithScheme(scheme, initObjects...),
+		Client:                  client,
+		APIReader:               client,
 		Logger:                  ctrllog.Log.WithName(ControllerManagerName),
 		Scheme:                  scheme,
 		Namespace:               ControllerManagerNamespace,
 		Name:                    ControllerManagerName,
 		LeaderElectionNamespace: LeaderElectionNamespace,
 		LeaderElectionID:        LeaderElectionID,
+		ManagementClusterID:     ManagementClusterID,
 		Recorder:                record.New(clientrecord.NewFakeRecorder(1024)),
 	}
 }
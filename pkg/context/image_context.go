@@ -0,0 +1,56 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package context
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/cluster-api/util/patch"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// ImageContext is a Go context used with a VSphereImage.
+type ImageContext struct {
+	*ControllerContext
+	VSphereImage *infrav1.VSphereImage
+	PatchHelper  *patch.Helper
+	Logger       logr.Logger
+	Session      *session.Session
+}
+
+// String returns VSphereImageGroupVersionKind VSphereImageNamespace/VSphereImageName.
+func (c *ImageContext) String() string {
+	return fmt.Sprintf("%s %s/%s", c.VSphereImage.GroupVersionKind(), c.VSphereImage.Namespace, c.VSphereImage.Name)
+}
+
+// Patch updates the object and its status on the API server.
+func (c *ImageContext) Patch() error {
+	return c.PatchHelper.Patch(c, c.VSphereImage)
+}
+
+// GetLogger returns this context's logger.
+func (c *ImageContext) GetLogger() logr.Logger {
+	return c.Logger
+}
+
+// GetSession returns this context's session.
+func (c *ImageContext) GetSession() *session.Session {
+	return c.Session
+}
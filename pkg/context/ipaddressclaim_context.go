@@ -0,0 +1,49 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package context
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/cluster-api/util/patch"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+// IPAddressClaimContext is a Go context used with an IPAddressClaim.
+type IPAddressClaimContext struct {
+	*ControllerContext
+	IPAddressClaim *infrav1.IPAddressClaim
+	PatchHelper    *patch.Helper
+	Logger         logr.Logger
+}
+
+// String returns IPAddressClaimGroupVersionKind IPAddressClaimNamespace/IPAddressClaimName.
+func (c *IPAddressClaimContext) String() string {
+	return fmt.Sprintf("%s %s/%s", c.IPAddressClaim.GroupVersionKind(), c.IPAddressClaim.Namespace, c.IPAddressClaim.Name)
+}
+
+// Patch updates the object and its status on the API server.
+func (c *IPAddressClaimContext) Patch() error {
+	return c.PatchHelper.Patch(c, c.IPAddressClaim)
+}
+
+// GetLogger returns this context's logger.
+func (c *IPAddressClaimContext) GetLogger() logr.Logger {
+	return c.Logger
+}
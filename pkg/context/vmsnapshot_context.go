@@ -0,0 +1,49 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package context
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/cluster-api/util/patch"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+// VMSnapshotContext is a Go context used with a VSphereVMSnapshot.
+type VMSnapshotContext struct {
+	*ControllerContext
+	VSphereVMSnapshot *infrav1.VSphereVMSnapshot
+	PatchHelper       *patch.Helper
+	Logger            logr.Logger
+}
+
+// String returns VSphereVMSnapshotGroupVersionKind VSphereVMSnapshotNamespace/VSphereVMSnapshotName.
+func (c *VMSnapshotContext) String() string {
+	return fmt.Sprintf("%s %s/%s", c.VSphereVMSnapshot.GroupVersionKind(), c.VSphereVMSnapshot.Namespace, c.VSphereVMSnapshot.Name)
+}
+
+// Patch updates the object and its status on the API server.
+func (c *VMSnapshotContext) Patch() error {
+	return c.PatchHelper.Patch(c, c.VSphereVMSnapshot)
+}
+
+// GetLogger returns this context's logger.
+func (c *VMSnapshotContext) GetLogger() logr.Logger {
+	return c.Logger
+}
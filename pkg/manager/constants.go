@@ -46,4 +46,12 @@ const (
 	// DefaultWatchNamespace is the default value for the eponymous manager
 	// option.
 	DefaultWatchNamespace = ""
+
+	// DefaultOrphanVMScanPeriod is the default value for the eponymous
+	// manager option.
+	DefaultOrphanVMScanPeriod = time.Minute * 10
+
+	// DefaultOrphanVMGracePeriod is the default value for the eponymous
+	// manager option.
+	DefaultOrphanVMGracePeriod = time.Minute * 30
 )
@@ -21,10 +21,13 @@ import (
 	"fmt"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	bootstrapv1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1alpha3"
+	controlplanev1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	ctrlmgr "sigs.k8s.io/controller-runtime/pkg/manager"
@@ -52,6 +55,7 @@ func New(opts Options) (Manager, error) {
 	_ = clusterv1.AddToScheme(opts.Scheme)
 	_ = infrav1.AddToScheme(opts.Scheme)
 	_ = bootstrapv1.AddToScheme(opts.Scheme)
+	_ = controlplanev1.AddToScheme(opts.Scheme)
 	// +kubebuilder:scaffold:scheme
 
 	// Build the controller manager.
@@ -70,6 +74,17 @@ func New(opts Options) (Manager, error) {
 		return nil, errors.Wrap(err, "unable to create manager")
 	}
 
+	// The UID of the kube-system namespace identifies the management cluster
+	// if an ID is not specified. The manager's cache is not started yet, so
+	// the namespace is read from the API server.
+	if opts.ManagementClusterID == "" {
+		namespace := &corev1.Namespace{}
+		if err := mgr.GetAPIReader().Get(goctx.Background(), client.ObjectKey{Name: metav1.NamespaceSystem}, namespace); err != nil {
+			return nil, errors.Wrap(err, "unable to get management cluster ID")
+		}
+		opts.ManagementClusterID = string(namespace.UID)
+	}
+
 	// Build the controller manager context.
 	controllerManagerContext := &context.ControllerManagerContext{
 		Context:                 goctx.Background(),
@@ -77,8 +92,14 @@ func New(opts Options) (Manager, error) {
 		Name:                    opts.PodName,
 		LeaderElectionID:        opts.LeaderElectionID,
 		LeaderElectionNamespace: opts.PodNamespace,
+		WatchNamespace:          opts.WatchNamespace,
 		MaxConcurrentReconciles: opts.MaxConcurrentReconciles,
+		OrphanVMScanPeriod:      opts.OrphanVMScanPeriod,
+		OrphanVMGracePeriod:     opts.OrphanVMGracePeriod,
+		OrphanVMDryRun:          opts.OrphanVMDryRun,
+		ManagementClusterID:     opts.ManagementClusterID,
 		Client:                  mgr.GetClient(),
+		APIReader:               mgr.GetAPIReader(),
 		Logger:                  opts.Logger.WithName(opts.PodName),
 		Recorder:                record.New(mgr.GetEventRecorderFor(fmt.Sprintf("%s/%s", opts.PodNamespace, opts.PodName))),
 		Scheme:                  opts.Scheme,
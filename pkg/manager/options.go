@@ -77,6 +77,26 @@ type Options struct {
 	// Defaults to the eponymous constant in this package.
 	WatchNamespace string
 
+	// OrphanVMScanPeriod is the interval at which the vSphere endpoints are
+	// scanned for VMs whose VSphereVM no longer exists. The scan is disabled
+	// when the period is zero.
+	OrphanVMScanPeriod time.Duration
+
+	// OrphanVMGracePeriod is how long a VM must be orphaned before it is
+	// deleted.
+	OrphanVMGracePeriod time.Duration
+
+	// OrphanVMDryRun is a flag that prevents orphaned VMs from being deleted.
+	// Orphaned VMs are only reported.
+	OrphanVMDryRun bool
+
+	// ManagementClusterID identifies the management cluster. The ID is
+	// recorded on the VMs created or adopted by the controller manager, and
+	// only orphaned VMs with the ID are deleted.
+	//
+	// Defaults to the UID of the kube-system namespace.
+	ManagementClusterID string
+
 	// Username is the username for the account used to access remote vSphere
 	// endpoints.
 	Username string
@@ -125,6 +145,10 @@ func (o *Options) defaults() {
 		o.WatchNamespace = DefaultWatchNamespace
 	}
 
+	if o.OrphanVMGracePeriod == 0 {
+		o.OrphanVMGracePeriod = DefaultOrphanVMGracePeriod
+	}
+
 	if o.MaxConcurrentReconciles == 0 {
 		o.MaxConcurrentReconciles = DefaultMaxConcurrentReconciles
 	}
@@ -0,0 +1,256 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dns registers hostnames in DNS with RFC 2136 dynamic updates.
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	mdns "github.com/miekg/dns"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+const (
+	// DefaultTTL is the TTL, in seconds, of registered records.
+	DefaultTTL = 300
+
+	// DefaultTSIGAlgorithm is the algorithm of a TSIG key that does not
+	// specify one.
+	DefaultTSIGAlgorithm = mdns.HmacSHA256
+
+	// TSIGSecretNameKey is the key of a TSIG Secret's key name.
+	TSIGSecretNameKey = "name"
+
+	// TSIGSecretSecretKey is the key of a TSIG Secret's base64 encoded
+	// secret.
+	TSIGSecretSecretKey = "secret"
+
+	// TSIGSecretAlgorithmKey is the key of a TSIG Secret's algorithm.
+	TSIGSecretAlgorithmKey = "algorithm"
+
+	defaultPort = "53"
+	tsigFudge   = 300
+)
+
+// Client sends RFC 2136 dynamic updates to a DNS server.
+type Client struct {
+	server       string
+	zone         string
+	reverseZones []string
+	ttl          uint32
+
+	tsigName      string
+	tsigAlgorithm string
+	tsigSecret    string
+}
+
+// NewClient returns a Client for the DNS configuration of a VSphereCluster.
+// The TSIG key is read from the Secret referenced by the configuration.
+func NewClient(ctx context.Context, c client.Client, vsphereCluster *infrav1.VSphereCluster) (*Client, error) {
+	spec := vsphereCluster.Spec.DNS
+	if spec == nil {
+		return nil, errors.Errorf("VSphereCluster %s/%s has no DNS configuration",
+			vsphereCluster.Namespace, vsphereCluster.Name)
+	}
+
+	server := spec.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, defaultPort)
+	}
+
+	dnsClient := &Client{
+		server: server,
+		zone:   canonicalName(spec.Zone),
+		ttl:    DefaultTTL,
+	}
+	for _, zone := range spec.ReverseZones {
+		dnsClient.reverseZones = append(dnsClient.reverseZones, canonicalName(zone))
+	}
+	if spec.TTL > 0 {
+		dnsClient.ttl = uint32(spec.TTL)
+	}
+
+	if spec.TSIGSecretRef != nil {
+		secret := &corev1.Secret{}
+		secretKey := apitypes.NamespacedName{
+			Namespace: vsphereCluster.Namespace,
+			Name:      spec.TSIGSecretRef.Name,
+		}
+		if err := c.Get(ctx, secretKey, secret); err != nil {
+			return nil, errors.Wrapf(err, "failed to get TSIG Secret %s", secretKey)
+		}
+		name, tsigSecret := string(secret.Data[TSIGSecretNameKey]), string(secret.Data[TSIGSecretSecretKey])
+		if name == "" || tsigSecret == "" {
+			return nil, errors.Errorf("TSIG Secret %s requires the %q and %q keys",
+				secretKey, TSIGSecretNameKey, TSIGSecretSecretKey)
+		}
+		dnsClient.tsigName = canonicalName(name)
+		dnsClient.tsigSecret = tsigSecret
+		dnsClient.tsigAlgorithm = DefaultTSIGAlgorithm
+		if algorithm := string(secret.Data[TSIGSecretAlgorithmKey]); algorithm != "" {
+			dnsClient.tsigAlgorithm = canonicalName(algorithm)
+		}
+	}
+
+	return dnsClient, nil
+}
+
+// FQDN returns the FQDN of a hostname in the client's zone.
+func (c *Client) FQDN(hostname string) string {
+	return canonicalName(hostname + "." + c.zone)
+}
+
+// UpdateAddressRecords replaces the A and AAAA records of a hostname in the
+// client's zone with records for the addresses.
+func (c *Client) UpdateAddressRecords(ctx context.Context, hostname string, addrs []string) error {
+	fqdn := c.FQDN(hostname)
+	msg := new(mdns.Msg)
+	msg.SetUpdate(c.zone)
+	msg.RemoveRRset([]mdns.RR{
+		&mdns.A{Hdr: mdns.RR_Header{Name: fqdn, Rrtype: mdns.TypeA}},
+		&mdns.AAAA{Hdr: mdns.RR_Header{Name: fqdn, Rrtype: mdns.TypeAAAA}},
+	})
+	var records []mdns.RR
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return errors.Errorf("invalid address %q for %s", addr, fqdn)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			records = append(records, &mdns.A{
+				Hdr: c.header(fqdn, mdns.TypeA),
+				A:   ip4,
+			})
+		} else {
+			records = append(records, &mdns.AAAA{
+				Hdr:  c.header(fqdn, mdns.TypeAAAA),
+				AAAA: ip,
+			})
+		}
+	}
+	if len(records) > 0 {
+		msg.Insert(records)
+	}
+	return errors.Wrapf(c.exchange(ctx, msg), "failed to update address records for %s", fqdn)
+}
+
+// DeleteAddressRecords deletes the A and AAAA records of a hostname in the
+// client's zone.
+func (c *Client) DeleteAddressRecords(ctx context.Context, hostname string) error {
+	return c.UpdateAddressRecords(ctx, hostname, nil)
+}
+
+// UpdatePointerRecords replaces the PTR records of the addresses with
+// records for the FQDN of a hostname in the client's zone. The PTR record of
+// an address that is not in one of the client's reverse zones is not
+// updated.
+func (c *Client) UpdatePointerRecords(ctx context.Context, hostname string, addrs []string) error {
+	return c.updatePointerRecords(ctx, c.FQDN(hostname), addrs)
+}
+
+// DeletePointerRecords deletes the PTR records of the addresses.
+func (c *Client) DeletePointerRecords(ctx context.Context, addrs []string) error {
+	return c.updatePointerRecords(ctx, "", addrs)
+}
+
+func (c *Client) updatePointerRecords(ctx context.Context, fqdn string, addrs []string) error {
+	// Updates are sent to each reverse zone in the order the zone's first
+	// address appears.
+	var zones []string
+	msgs := map[string]*mdns.Msg{}
+	for _, addr := range addrs {
+		arpa, err := mdns.ReverseAddr(addr)
+		if err != nil {
+			return errors.Wrapf(err, "invalid address %q", addr)
+		}
+		zone := c.reverseZone(arpa)
+		if zone == "" {
+			continue
+		}
+		msg, ok := msgs[zone]
+		if !ok {
+			msg = new(mdns.Msg)
+			msg.SetUpdate(zone)
+			msgs[zone] = msg
+			zones = append(zones, zone)
+		}
+		msg.RemoveRRset([]mdns.RR{
+			&mdns.PTR{Hdr: mdns.RR_Header{Name: arpa, Rrtype: mdns.TypePTR}},
+		})
+		if fqdn != "" {
+			msg.Insert([]mdns.RR{
+				&mdns.PTR{Hdr: c.header(arpa, mdns.TypePTR), Ptr: fqdn},
+			})
+		}
+	}
+	for _, zone := range zones {
+		if err := c.exchange(ctx, msgs[zone]); err != nil {
+			return errors.Wrapf(err, "failed to update pointer records in %s", zone)
+		}
+	}
+	return nil
+}
+
+// reverseZone returns the longest of the client's reverse zones that
+// contains the name, or an empty string if none do.
+func (c *Client) reverseZone(name string) string {
+	var zone string
+	for _, z := range c.reverseZones {
+		if mdns.IsSubDomain(z, name) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+	return zone
+}
+
+func (c *Client) header(name string, rrtype uint16) mdns.RR_Header {
+	return mdns.RR_Header{
+		Name:   name,
+		Rrtype: rrtype,
+		Class:  mdns.ClassINET,
+		Ttl:    c.ttl,
+	}
+}
+
+func (c *Client) exchange(ctx context.Context, msg *mdns.Msg) error {
+	dnsClient := &mdns.Client{}
+	if c.tsigName != "" {
+		dnsClient.TsigSecret = map[string]string{c.tsigName: c.tsigSecret}
+		msg.SetTsig(c.tsigName, c.tsigAlgorithm, tsigFudge, time.Now().Unix())
+	}
+	resp, _, err := dnsClient.ExchangeContext(ctx, msg, c.server)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != mdns.RcodeSuccess {
+		return errors.Errorf("server %s returned %s", c.server, strings.ToUpper(mdns.RcodeToString[resp.Rcode]))
+	}
+	return nil
+}
+
+// canonicalName returns the lowercase FQDN of a name.
+func canonicalName(name string) string {
+	return strings.ToLower(mdns.Fqdn(name))
+}
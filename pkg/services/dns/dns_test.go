@@ -0,0 +1,195 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dns_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	mdns "github.com/miekg/dns"
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/dns"
+)
+
+const (
+	testTSIGName   = "capv."
+	testTSIGSecret = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+)
+
+// testServer is an in-process DNS server that applies the dynamic updates
+// it receives to an in-memory set of records.
+type testServer struct {
+	sync.Mutex
+	records map[string][]string
+}
+
+func (s *testServer) ServeDNS(w mdns.ResponseWriter, req *mdns.Msg) {
+	s.Lock()
+	defer s.Unlock()
+
+	resp := new(mdns.Msg)
+	resp.SetReply(req)
+	defer func() {
+		if req.IsTsig() != nil {
+			resp.SetTsig(testTSIGName, mdns.HmacSHA256, 300, time.Now().Unix())
+		}
+		_ = w.WriteMsg(resp)
+	}()
+
+	if req.IsTsig() == nil || w.TsigStatus() != nil {
+		resp.Rcode = mdns.RcodeNotAuth
+		return
+	}
+	zone := req.Question[0].Name
+	for _, rr := range req.Ns {
+		hdr := rr.Header()
+		if !mdns.IsSubDomain(zone, hdr.Name) {
+			resp.Rcode = mdns.RcodeNotZone
+			return
+		}
+		key := fmt.Sprintf("%s %s", hdr.Name, mdns.TypeToString[hdr.Rrtype])
+		if hdr.Class == mdns.ClassANY {
+			delete(s.records, key)
+			continue
+		}
+		s.records[key] = append(s.records[key], rr.String())
+	}
+}
+
+func (s *testServer) get(name string, rrtype uint16) []string {
+	s.Lock()
+	defer s.Unlock()
+	records := append([]string{}, s.records[fmt.Sprintf("%s %s", name, mdns.TypeToString[rrtype])]...)
+	sort.Strings(records)
+	return records
+}
+
+func startTestServer(t *testing.T) (*testServer, string, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{records: map[string][]string{}}
+	started := make(chan struct{})
+	server := &mdns.Server{
+		PacketConn:        pc,
+		Handler:           ts,
+		TsigSecret:        map[string]string{testTSIGName: testTSIGSecret},
+		NotifyStartedFunc: func() { close(started) },
+		// The default accept function rejects updates.
+		MsgAcceptFunc: func(mdns.Header) mdns.MsgAcceptAction { return mdns.MsgAccept },
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	return ts, pc.LocalAddr().String(), func() { _ = server.Shutdown() }
+}
+
+func newTestClient(t *testing.T, server, tsigSecret string) *dns.Client {
+	vsphereCluster := &infrav1.VSphereCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec: infrav1.VSphereClusterSpec{
+			DNS: &infrav1.DNSSpec{
+				Server:        server,
+				Zone:          "k8s.example.com",
+				ReverseZones:  []string{"168.192.in-addr.arpa", "1.168.192.in-addr.arpa", "d.f.ip6.arpa"},
+				TSIGSecretRef: &corev1.LocalObjectReference{Name: "tsig"},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tsig"},
+		Data: map[string][]byte{
+			dns.TSIGSecretNameKey:   []byte("capv"),
+			dns.TSIGSecretSecretKey: []byte(tsigSecret),
+		},
+	}
+	client, err := dns.NewClient(context.Background(), fake.NewFakeClient(secret), vsphereCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestAddressRecords(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ts, server, stop := startTestServer(t)
+	defer stop()
+	client := newTestClient(t, server, testTSIGSecret)
+	ctx := context.Background()
+
+	g.Expect(client.FQDN("host")).To(gomega.Equal("host.k8s.example.com."))
+
+	g.Expect(client.UpdateAddressRecords(ctx, "host", []string{"192.168.1.10", "fd00::10"})).To(gomega.Succeed())
+	g.Expect(ts.get("host.k8s.example.com.", mdns.TypeA)).To(gomega.Equal([]string{
+		"host.k8s.example.com.\t300\tIN\tA\t192.168.1.10",
+	}))
+	g.Expect(ts.get("host.k8s.example.com.", mdns.TypeAAAA)).To(gomega.Equal([]string{
+		"host.k8s.example.com.\t300\tIN\tAAAA\tfd00::10",
+	}))
+
+	// Updating the records replaces them.
+	g.Expect(client.UpdateAddressRecords(ctx, "host", []string{"192.168.1.11"})).To(gomega.Succeed())
+	g.Expect(ts.get("host.k8s.example.com.", mdns.TypeA)).To(gomega.Equal([]string{
+		"host.k8s.example.com.\t300\tIN\tA\t192.168.1.11",
+	}))
+	g.Expect(ts.get("host.k8s.example.com.", mdns.TypeAAAA)).To(gomega.BeEmpty())
+
+	g.Expect(client.DeleteAddressRecords(ctx, "host")).To(gomega.Succeed())
+	g.Expect(ts.get("host.k8s.example.com.", mdns.TypeA)).To(gomega.BeEmpty())
+}
+
+func TestPointerRecords(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ts, server, stop := startTestServer(t)
+	defer stop()
+	client := newTestClient(t, server, testTSIGSecret)
+	ctx := context.Background()
+
+	addrs := []string{"192.168.1.10", "fd00::10", "10.0.0.10"}
+	g.Expect(client.UpdatePointerRecords(ctx, "host", addrs)).To(gomega.Succeed())
+	g.Expect(ts.get("10.1.168.192.in-addr.arpa.", mdns.TypePTR)).To(gomega.Equal([]string{
+		"10.1.168.192.in-addr.arpa.\t300\tIN\tPTR\thost.k8s.example.com.",
+	}))
+	arpa, _ := mdns.ReverseAddr("fd00::10")
+	g.Expect(ts.get(arpa, mdns.TypePTR)).To(gomega.HaveLen(1))
+
+	// The address that is not in a reverse zone is skipped.
+	g.Expect(ts.get("10.0.0.10.in-addr.arpa.", mdns.TypePTR)).To(gomega.BeEmpty())
+
+	g.Expect(client.DeletePointerRecords(ctx, addrs)).To(gomega.Succeed())
+	g.Expect(ts.get("10.1.168.192.in-addr.arpa.", mdns.TypePTR)).To(gomega.BeEmpty())
+	g.Expect(ts.get(arpa, mdns.TypePTR)).To(gomega.BeEmpty())
+}
+
+func TestInvalidTSIG(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	_, server, stop := startTestServer(t)
+	defer stop()
+	client := newTestClient(t, server, "aW52YWxpZGludmFsaWRpbnZhbGlk")
+
+	g.Expect(client.UpdateAddressRecords(context.Background(), "host", []string{"192.168.1.10"})).NotTo(gomega.Succeed())
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
+)
+
+// adoptVM takes ownership of the existing VM identified by the VSphereVM's
+// Adopt spec instead of cloning a VM. The VM's network devices and virtual
+// hardware must match the spec. The VM is not powered off; it is assigned
+// the VSphereVM's owner keys and annotation, and its BIOS UUID is recorded
+// so the VM is found by subsequent reconciles, which set its guestinfo
+// metadata.
+func (vms *VMService) adoptVM(ctx *context.VMContext) error {
+	ref, err := findAdoptableVM(ctx)
+	if err != nil {
+		return err
+	}
+	vmCtx := &virtualMachineContext{
+		VMContext: *ctx,
+		Obj:       object.NewVirtualMachine(ctx.Session.Client.Client, ref),
+		Ref:       ref,
+		State:     &infrav1.VirtualMachine{},
+	}
+
+	var obj mo.VirtualMachine
+	if err := vmCtx.Obj.Properties(ctx, ref, []string{"name", "config"}, &obj); err != nil {
+		return errors.Wrapf(err, "unable to get config for vm %s", ref.Value)
+	}
+	if obj.Config == nil {
+		return errors.Errorf("unable to get config for vm %s: missing config", obj.Name)
+	}
+	if obj.Config.Template {
+		return errors.Errorf("unable to adopt vm %s for %q: vm is a template", obj.Name, ctx)
+	}
+	if err := checkAdoptableOwner(ctx, obj.Name, obj.Config); err != nil {
+		return err
+	}
+
+	d := &drift{}
+	if err := getNetworkDrift(vmCtx, d, obj.Config.Hardware.Device); err != nil {
+		return err
+	}
+	getHardwareDrift(vmCtx, d, obj.Config.Hardware)
+	if len(d.fields) > 0 {
+		fields := make([]string, len(d.fields))
+		for i := range d.fields {
+			fields[i] = d.fields[i].String()
+		}
+		message := strings.Join(fields, "; ")
+		ctx.Recorder.Warnf(ctx.VSphereVM, "AdoptFailure", "VM %s does not match the spec: %s", obj.Name, message)
+		return errors.Errorf("unable to adopt vm %s for %q: vm does not match the spec: %s", obj.Name, ctx, message)
+	}
+
+	var extraConfig extra.Config
+	extraConfig.SetOwner(ctx.VSphereVM.Namespace, ctx.VSphereVM.Name, string(ctx.VSphereVM.UID), ctx.ManagementClusterID)
+	extraConfig.SetAdopted()
+	task, err := vmCtx.Obj.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+		Annotation:  vcenter.Annotation(ctx),
+		ExtraConfig: extraConfig,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to adopt vm %s for %q", obj.Name, ctx)
+	}
+
+	ctx.VSphereVM.Spec.BiosUUID = obj.Config.Uuid
+	ctx.VSphereVM.Status.Adopted = true
+	ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+	ctx.Logger.Info("adopted vm", "vm", obj.Name, "biosUUID", obj.Config.Uuid)
+	ctx.Recorder.Eventf(ctx.VSphereVM, "Adopted", "Adopted VM %s", obj.Name)
+	return nil
+}
+
+// findAdoptableVM returns the VM identified by the VSphereVM's Adopt spec.
+func findAdoptableVM(ctx *context.VMContext) (types.ManagedObjectReference, error) {
+	adopt := ctx.VSphereVM.Spec.Adopt
+	switch {
+	case adopt.BiosUUID != "" && adopt.InventoryPath != "":
+		return types.ManagedObjectReference{}, errors.Errorf("unable to adopt vm for %q: only one of biosUUID and inventoryPath may be set", ctx)
+	case adopt.BiosUUID != "":
+		objRef, err := ctx.Session.FindByBIOSUUID(ctx, adopt.BiosUUID)
+		if err != nil {
+			return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to find vm with bios uuid %q to adopt for %q", adopt.BiosUUID, ctx)
+		}
+		if objRef == nil {
+			return types.ManagedObjectReference{}, errors.Errorf("unable to find vm with bios uuid %q to adopt for %q", adopt.BiosUUID, ctx)
+		}
+		return objRef.Reference(), nil
+	case adopt.InventoryPath != "":
+		vm, err := ctx.Session.Finder.VirtualMachine(ctx, adopt.InventoryPath)
+		if err != nil {
+			return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to find vm %q to adopt for %q", adopt.InventoryPath, ctx)
+		}
+		return vm.Reference(), nil
+	default:
+		return types.ManagedObjectReference{}, errors.Errorf("unable to adopt vm for %q: one of biosUUID and inventoryPath must be set", ctx)
+	}
+}
+
+// checkAdoptableOwner returns an error if the VM is owned by another
+// VSphereVM that still exists. A VM whose VSphereVM no longer exists is an
+// orphan and may be adopted.
+func checkAdoptableOwner(ctx *context.VMContext, name string, config *types.VirtualMachineConfigInfo) error {
+	owner, ok := getVMOwner(config)
+	if !ok || owner.UID == string(ctx.VSphereVM.UID) {
+		return nil
+	}
+	if owner.Namespace == ctx.VSphereVM.Namespace && owner.VSphereVMName == ctx.VSphereVM.Name {
+		return nil
+	}
+	vsphereVM := &infrav1.VSphereVM{}
+	vsphereVMKey := apitypes.NamespacedName{
+		Namespace: owner.Namespace,
+		Name:      owner.VSphereVMName,
+	}
+	if err := ctx.Client.Get(ctx, vsphereVMKey, vsphereVM); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "unable to get owner %s of vm %s", vsphereVMKey, name)
+	}
+	if owner.UID != "" && owner.UID != string(vsphereVM.UID) {
+		return nil
+	}
+	return errors.Errorf("unable to adopt vm %s for %q: vm is owned by VSphereVM %s", name, ctx, vsphereVMKey)
+}
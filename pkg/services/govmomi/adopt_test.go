@@ -0,0 +1,154 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+func TestAdoptVM(t *testing.T) {
+	testCases := []struct {
+		name          string
+		byBiosUUID    bool
+		numCPUs       int32
+		owner         string
+		ownerExists   bool
+		expectedError bool
+	}{
+		{
+			name: "by inventory path",
+		},
+		{
+			name:       "by bios uuid",
+			byBiosUUID: true,
+		},
+		{
+			name:          "hardware mismatch",
+			numCPUs:       8,
+			expectedError: true,
+		},
+		{
+			name:  "orphaned",
+			owner: "orphan",
+		},
+		{
+			name:          "owned",
+			owner:         "owner",
+			ownerExists:   true,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := vcsim.New(t)
+			defer sim.Destroy()
+
+			vmContext := sim.NewVMContext(t)
+			authSession := vmContext.Session
+
+			vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+			obj := object.NewVirtualMachine(authSession.Client.Client, vm.Reference())
+
+			// Match the spec with the VM's network and hardware.
+			vmContext.VSphereVM.Spec.Network.Devices[0].NetworkName = "DC0_DVPG0"
+			vmContext.VSphereVM.Spec.NumCPUs = tc.numCPUs
+			vmContext.VSphereVM.Spec.MemoryMiB = int64(vm.Config.Hardware.MemoryMB)
+
+			vmContext.VSphereVM.Spec.Adopt = &infrav1.AdoptSpec{InventoryPath: "/DC0/vm/" + vm.Name}
+			if tc.byBiosUUID {
+				vmContext.VSphereVM.Spec.Adopt = &infrav1.AdoptSpec{BiosUUID: vm.Config.Uuid}
+			}
+
+			if tc.owner != "" {
+				owner := &infrav1.VSphereVM{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: vmContext.VSphereVM.Namespace,
+						Name:      tc.owner,
+						UID:       apitypes.UID(tc.owner + "-uid"),
+					},
+				}
+				if tc.ownerExists {
+					if err := vmContext.Client.Create(vmContext, owner); err != nil {
+						t.Fatal(err)
+					}
+				}
+				var extraConfig extra.Config
+				extraConfig.SetOwner(owner.Namespace, owner.Name, string(owner.UID), vmContext.ManagementClusterID)
+				task, err := obj.Reconfigure(vmContext, types.VirtualMachineConfigSpec{ExtraConfig: extraConfig})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := task.Wait(vmContext); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			vms := &VMService{}
+			err := vms.adoptVM(vmContext)
+			if tc.expectedError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if vmContext.VSphereVM.Status.Adopted {
+					t.Fatal("expected vm to not be adopted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			task := object.NewTask(authSession.Client.Client, types.ManagedObjectReference{Type: morefTypeTask, Value: vmContext.VSphereVM.Status.TaskRef})
+			if err := task.Wait(vmContext); err != nil {
+				t.Fatal(err)
+			}
+
+			if !vmContext.VSphereVM.Status.Adopted {
+				t.Fatal("expected vm to be adopted")
+			}
+			if vmContext.VSphereVM.Spec.BiosUUID != vm.Config.Uuid {
+				t.Fatalf("expected bios uuid %q, got %q", vm.Config.Uuid, vmContext.VSphereVM.Spec.BiosUUID)
+			}
+
+			var moVM mo.VirtualMachine
+			if err := obj.Properties(vmContext, vm.Reference(), []string{"config", "runtime.powerState"}, &moVM); err != nil {
+				t.Fatal(err)
+			}
+			if moVM.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOn {
+				t.Fatalf("expected vm to remain powered on, got %s", moVM.Runtime.PowerState)
+			}
+			owner, ok := getVMOwner(moVM.Config)
+			if !ok {
+				t.Fatal("expected vm to have an owner")
+			}
+			if owner.UID != string(vmContext.VSphereVM.UID) || owner.VSphereVMName != vmContext.VSphereVM.Name {
+				t.Fatalf("expected owner %s, got %s/%s", vmContext.VSphereVM.UID, owner.VSphereVMName, owner.UID)
+			}
+		})
+	}
+}
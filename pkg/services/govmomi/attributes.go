@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
+)
+
+// reconcileAttributes updates the VM's custom attributes and annotation
+// from the VSphereVM's CustomAttributes and AnnotationFields. False is
+// returned while the annotation is being updated.
+func (vms *VMService) reconcileAttributes(ctx *virtualMachineContext) (bool, error) {
+	var obj mo.VirtualMachine
+	if err := ctx.Obj.Properties(ctx, ctx.Ref, []string{"config.annotation", "customValue"}, &obj); err != nil {
+		return false, errors.Wrapf(err, "unable to get attributes for vm %s", ctx)
+	}
+
+	if err := vms.reconcileCustomAttributes(ctx, obj.CustomValue); err != nil {
+		return false, err
+	}
+
+	annotation := vcenter.Annotation(&ctx.VMContext)
+	if obj.Config != nil && obj.Config.Annotation == annotation {
+		return true, nil
+	}
+
+	ctx.Logger.Info("updating annotation")
+	task, err := ctx.Obj.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+		Annotation: annotation,
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to set annotation on vm %s", ctx)
+	}
+	ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+	ctx.Logger.Info("wait for VM annotation to be updated")
+	return false, nil
+}
+
+// reconcileCustomAttributes sets the values of the VM's custom attributes.
+// Custom attributes that do not exist are created.
+func (vms *VMService) reconcileCustomAttributes(ctx *virtualMachineContext, values []types.BaseCustomFieldValue) error {
+	if len(ctx.VSphereVM.Spec.CustomAttributes) == 0 {
+		return nil
+	}
+
+	manager, err := object.GetCustomFieldsManager(ctx.Session.Client.Client)
+	if err != nil {
+		return errors.Wrap(err, "custom attributes are not supported by the vSphere endpoint")
+	}
+	fields, err := manager.Field(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to get custom attributes")
+	}
+	keys := map[string]int32{}
+	for _, field := range fields {
+		if field.ManagedObjectType == "" || field.ManagedObjectType == "VirtualMachine" {
+			keys[field.Name] = field.Key
+		}
+	}
+	current := map[int32]string{}
+	for _, value := range values {
+		if value, ok := value.(*types.CustomFieldStringValue); ok {
+			current[value.Key] = value.Value
+		}
+	}
+
+	// Set the attributes in a consistent order.
+	names := make([]string, 0, len(ctx.VSphereVM.Spec.CustomAttributes))
+	for name := range ctx.VSphereVM.Spec.CustomAttributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := ctx.VSphereVM.Spec.CustomAttributes[name]
+		key, ok := keys[name]
+		if !ok {
+			if value == "" {
+				continue
+			}
+			ctx.Logger.Info("creating custom attribute", "name", name)
+			field, err := manager.Add(ctx, name, "VirtualMachine", nil, nil)
+			if err != nil {
+				return errors.Wrapf(err, "unable to create custom attribute %q", name)
+			}
+			key = field.Key
+		}
+		if current[key] == value {
+			continue
+		}
+		ctx.Logger.Info("updating custom attribute", "name", name)
+		if err := manager.Set(ctx, ctx.Ref, key, value); err != nil {
+			return errors.Wrapf(err, "unable to set custom attribute %q on vm %s", name, ctx)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
+)
+
+func TestReconcileAttributes(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+
+	vmContext := sim.NewVMContext(t)
+	vmContext.VSphereVM.Spec.CustomAttributes = map[string]string{
+		"cost-center": "1234",
+		"owner":       "ops",
+	}
+	vmContext.VSphereVM.Spec.AnnotationFields = map[string]string{
+		"cluster": "test",
+	}
+
+	authSession := vmContext.Session
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	ctx := &virtualMachineContext{
+		VMContext: *vmContext,
+		Obj:       object.NewVirtualMachine(authSession.Client.Client, vm.Reference()),
+		Ref:       vm.Reference(),
+		State:     &infrav1.VirtualMachine{},
+	}
+
+	// reconcile runs reconcileAttributes until the VM is up-to-date, waiting
+	// on the task that updates the annotation.
+	vms := &VMService{}
+	reconcile := func() {
+		for i := 0; i < 2; i++ {
+			ok, err := vms.reconcileAttributes(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				return
+			}
+			task := object.NewTask(authSession.Client.Client, types.ManagedObjectReference{
+				Type:  "Task",
+				Value: ctx.VSphereVM.Status.TaskRef,
+			})
+			if err := task.Wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+			ctx.VSphereVM.Status.TaskRef = ""
+		}
+		t.Fatal("expected attributes to be reconciled")
+	}
+
+	getAttributes := func() (map[string]string, map[string]string) {
+		manager, err := object.GetCustomFieldsManager(authSession.Client.Client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields, err := manager.Field(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var obj mo.VirtualMachine
+		if err := ctx.Obj.Properties(ctx, ctx.Ref, []string{"config.annotation", "customValue"}, &obj); err != nil {
+			t.Fatal(err)
+		}
+		// The simulator appends a value each time a field is set, so the
+		// last value of a field is its current value.
+		attributes := map[string]string{}
+		for _, value := range obj.CustomValue {
+			value := value.(*types.CustomFieldStringValue)
+			attributes[fields.ByKey(value.Key).Name] = value.Value
+		}
+		for name, value := range attributes {
+			if value == "" {
+				delete(attributes, name)
+			}
+		}
+		annotation := map[string]string{}
+		if err := json.Unmarshal([]byte(obj.Config.Annotation), &annotation); err != nil {
+			t.Fatalf("expected a JSON annotation, got %q: %v", obj.Config.Annotation, err)
+		}
+		return attributes, annotation
+	}
+
+	reconcile()
+	attributes, annotation := getAttributes()
+	if len(attributes) != 2 || attributes["cost-center"] != "1234" || attributes["owner"] != "ops" {
+		t.Errorf("unexpected custom attributes %v", attributes)
+	}
+	if annotation["cluster"] != "test" || annotation[vcenter.AnnotationVSphereVMField] != ctx.String() {
+		t.Errorf("unexpected annotation %v", annotation)
+	}
+
+	// Changing the values keeps the VM in sync.
+	ctx.VSphereVM.Spec.CustomAttributes["owner"] = ""
+	ctx.VSphereVM.Spec.AnnotationFields["cluster"] = "other"
+	reconcile()
+	attributes, annotation = getAttributes()
+	if len(attributes) != 1 || attributes["cost-center"] != "1234" {
+		t.Errorf("unexpected custom attributes %v", attributes)
+	}
+	if annotation["cluster"] != "other" {
+		t.Errorf("unexpected annotation %v", annotation)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// ReconcileVMGroupMembership ensures a VM is a member of the DRS VM group
+// with the given name in the compute cluster that contains the VM. An error
+// is returned if the VM is not in a compute cluster or if the compute
+// cluster does not have the VM group.
+func ReconcileVMGroupMembership(ctx computeClusterContext, groupName string, vm types.ManagedObjectReference) error {
+	computeCluster, err := getComputeCluster(ctx, vm)
+	if err != nil {
+		return err
+	}
+
+	var obj mo.ClusterComputeResource
+	if err := computeCluster.Properties(ctx, computeCluster.Reference(), []string{"configurationEx"}, &obj); err != nil {
+		return errors.Wrapf(err, "unable to get configuration of compute cluster %s", computeCluster.Reference())
+	}
+	var group *types.ClusterVmGroup
+	if config, ok := obj.ConfigurationEx.(*types.ClusterConfigInfoEx); ok {
+		for _, info := range config.Group {
+			if g, ok := info.(*types.ClusterVmGroup); ok && g.Name == groupName {
+				group = g
+				break
+			}
+		}
+	}
+	if group == nil {
+		return errors.Errorf("compute cluster %s does not have vm group %q", computeCluster.Reference(), groupName)
+	}
+	for _, member := range group.Vm {
+		if member == vm {
+			return nil
+		}
+	}
+
+	ctx.GetLogger().Info("adding vm to vm group", "compute-cluster", computeCluster.Reference(), "vm-group", groupName)
+	group.Vm = append(group.Vm, vm)
+	spec := &types.ClusterConfigSpecEx{
+		GroupSpec: []types.ClusterGroupSpec{
+			{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationEdit},
+				Info:            group,
+			},
+		},
+	}
+	task, err := computeCluster.Reconfigure(ctx, spec, true)
+	if err != nil {
+		return errors.Wrapf(err, "unable to add vm to vm group %q", groupName)
+	}
+	if err := task.Wait(ctx); err != nil {
+		return errors.Wrapf(err, "failed to add vm to vm group %q", groupName)
+	}
+	return nil
+}
+
+// getComputeCluster returns the compute cluster that contains a VM.
+func getComputeCluster(ctx computeClusterContext, vm types.ManagedObjectReference) (*object.ClusterComputeResource, error) {
+	computeClusters, err := groupVMsByComputeCluster(ctx, []types.ManagedObjectReference{vm})
+	if err != nil {
+		return nil, err
+	}
+	for ref := range computeClusters {
+		return object.NewClusterComputeResource(ctx.GetSession().Client.Client, ref), nil
+	}
+	return nil, errors.Errorf("vm %s is not in a compute cluster", vm)
+}
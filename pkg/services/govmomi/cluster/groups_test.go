@@ -0,0 +1,85 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+func TestReconcileVMGroupMembership(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+
+	ctx := sim.NewClusterContext(t)
+
+	const groupName = "zone-a-vms"
+	computeCluster := simulator.Map.Any("ClusterComputeResource").(*simulator.ClusterComputeResource)
+	task, err := object.NewClusterComputeResource(ctx.Session.Client.Client, computeCluster.Reference()).Reconfigure(ctx,
+		&types.ClusterConfigSpecEx{
+			GroupSpec: []types.ClusterGroupSpec{
+				{
+					ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationAdd},
+					Info:            &types.ClusterVmGroup{ClusterGroupInfo: types.ClusterGroupInfo{Name: groupName}},
+				},
+			},
+		}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Find a VM in the compute cluster.
+	var vm types.ManagedObjectReference
+	for _, obj := range simulator.Map.All("VirtualMachine") {
+		pool := simulator.Map.Get(*obj.(*simulator.VirtualMachine).ResourcePool).(*simulator.ResourcePool)
+		if pool.Owner == computeCluster.Reference() {
+			vm = obj.Reference()
+			break
+		}
+	}
+	if vm.Value == "" {
+		t.Fatal("expected a vm in the compute cluster")
+	}
+
+	// Reconciling the membership twice should add the VM to the group once.
+	for i := 0; i < 2; i++ {
+		if err := ReconcileVMGroupMembership(ctx, groupName, vm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var members []types.ManagedObjectReference
+	for _, info := range computeCluster.ConfigurationEx.(*types.ClusterConfigInfoEx).Group {
+		if group, ok := info.(*types.ClusterVmGroup); ok && group.Name == groupName {
+			members = group.Vm
+		}
+	}
+	if len(members) != 1 || members[0] != vm {
+		t.Errorf("expected vm group %q to contain only %s, got %v", groupName, vm, members)
+	}
+
+	if err := ReconcileVMGroupMembership(ctx, "missing", vm); err == nil {
+		t.Error("expected error for missing vm group")
+	}
+}
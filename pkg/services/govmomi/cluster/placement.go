@@ -0,0 +1,198 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+// ReconcileFolder ensures a folder with the given name exists in the parent
+// folder, and returns the folder's inventory path. The datacenter's VM
+// folder is used if the parent is empty.
+func ReconcileFolder(ctx computeClusterContext, parent, name string) (string, error) {
+	finder := ctx.GetSession().Finder
+	parentFolder, err := finder.FolderOrDefault(ctx, parent)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to find parent folder %q", parent)
+	}
+	folderPath := path.Join(parentFolder.InventoryPath, name)
+	if _, err := finder.Folder(ctx, folderPath); err == nil {
+		return folderPath, nil
+	} else if _, ok := err.(*find.NotFoundError); !ok {
+		return "", errors.Wrapf(err, "unable to find folder %q", folderPath)
+	}
+	ctx.GetLogger().Info("creating folder", "path", folderPath)
+	if _, err := parentFolder.CreateFolder(ctx, name); err != nil {
+		return "", errors.Wrapf(err, "unable to create folder %q", folderPath)
+	}
+	return folderPath, nil
+}
+
+// ReconcileResourcePool ensures a resource pool with the given name and
+// allocations exists in the parent resource pool, and returns the resource
+// pool's inventory path. The datacenter's default resource pool is used if
+// the parent is empty.
+func ReconcileResourcePool(ctx computeClusterContext, name string, spec infrav1.ManagedResourcePoolSpec) (string, error) {
+	finder := ctx.GetSession().Finder
+	parentPool, err := finder.ResourcePoolOrDefault(ctx, spec.Parent)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to find parent resource pool %q", spec.Parent)
+	}
+	poolPath := path.Join(parentPool.InventoryPath, name)
+	config := types.ResourceConfigSpec{
+		CpuAllocation:    newResourceAllocationInfo(spec.CPU),
+		MemoryAllocation: newResourceAllocationInfo(spec.Memory),
+	}
+
+	pool, err := finder.ResourcePool(ctx, poolPath)
+	if err != nil {
+		if _, ok := err.(*find.NotFoundError); !ok {
+			return "", errors.Wrapf(err, "unable to find resource pool %q", poolPath)
+		}
+		ctx.GetLogger().Info("creating resource pool", "path", poolPath)
+		if _, err := parentPool.Create(ctx, name, config); err != nil {
+			return "", errors.Wrapf(err, "unable to create resource pool %q", poolPath)
+		}
+		return poolPath, nil
+	}
+
+	var obj mo.ResourcePool
+	if err := pool.Properties(ctx, pool.Reference(), []string{"config"}, &obj); err != nil {
+		return "", errors.Wrapf(err, "unable to get config of resource pool %q", poolPath)
+	}
+	if isSameAllocation(obj.Config.CpuAllocation, config.CpuAllocation) &&
+		isSameAllocation(obj.Config.MemoryAllocation, config.MemoryAllocation) {
+		return poolPath, nil
+	}
+	ctx.GetLogger().Info("updating resource pool", "path", poolPath)
+	if err := pool.UpdateConfig(ctx, "", &config); err != nil {
+		return "", errors.Wrapf(err, "unable to update resource pool %q", poolPath)
+	}
+	return poolPath, nil
+}
+
+// DeleteFolderIfEmpty deletes the folder with the given inventory path if
+// the folder exists and is empty. True is returned if the folder does not
+// exist once this function returns.
+func DeleteFolderIfEmpty(ctx computeClusterContext, folderPath string) (bool, error) {
+	folder, err := ctx.GetSession().Finder.Folder(ctx, folderPath)
+	if err != nil {
+		if _, ok := err.(*find.NotFoundError); ok {
+			return true, nil
+		}
+		return false, errors.Wrapf(err, "unable to find folder %q", folderPath)
+	}
+	var obj mo.Folder
+	if err := folder.Properties(ctx, folder.Reference(), []string{"childEntity"}, &obj); err != nil {
+		return false, errors.Wrapf(err, "unable to get children of folder %q", folderPath)
+	}
+	if len(obj.ChildEntity) > 0 {
+		return false, nil
+	}
+	ctx.GetLogger().Info("deleting folder", "path", folderPath)
+	task, err := folder.Destroy(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to delete folder %q", folderPath)
+	}
+	if err := task.Wait(ctx); err != nil {
+		return false, errors.Wrapf(err, "failed to delete folder %q", folderPath)
+	}
+	return true, nil
+}
+
+// DeleteResourcePoolIfEmpty deletes the resource pool with the given
+// inventory path if the resource pool exists and contains neither VMs nor
+// resource pools. True is returned if the resource pool does not exist once
+// this function returns.
+func DeleteResourcePoolIfEmpty(ctx computeClusterContext, poolPath string) (bool, error) {
+	pool, err := ctx.GetSession().Finder.ResourcePool(ctx, poolPath)
+	if err != nil {
+		if _, ok := err.(*find.NotFoundError); ok {
+			return true, nil
+		}
+		return false, errors.Wrapf(err, "unable to find resource pool %q", poolPath)
+	}
+	var obj mo.ResourcePool
+	if err := pool.Properties(ctx, pool.Reference(), []string{"vm", "resourcePool"}, &obj); err != nil {
+		return false, errors.Wrapf(err, "unable to get children of resource pool %q", poolPath)
+	}
+	if len(obj.Vm) > 0 || len(obj.ResourcePool) > 0 {
+		return false, nil
+	}
+	ctx.GetLogger().Info("deleting resource pool", "path", poolPath)
+	task, err := pool.Destroy(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to delete resource pool %q", poolPath)
+	}
+	if err := task.Wait(ctx); err != nil {
+		return false, errors.Wrapf(err, "failed to delete resource pool %q", poolPath)
+	}
+	return true, nil
+}
+
+func newResourceAllocationInfo(allocation infrav1.ResourceAllocation) types.ResourceAllocationInfo {
+	expandable := true
+	if allocation.ExpandableReservation != nil {
+		expandable = *allocation.ExpandableReservation
+	}
+	limit := int64(-1)
+	if allocation.Limit != nil {
+		limit = *allocation.Limit
+	}
+	shares := &types.SharesInfo{Level: types.SharesLevelNormal}
+	switch allocation.Shares {
+	case infrav1.SharesLevelLow:
+		shares.Level = types.SharesLevelLow
+	case infrav1.SharesLevelHigh:
+		shares.Level = types.SharesLevelHigh
+	case infrav1.SharesLevelCustom:
+		shares.Level = types.SharesLevelCustom
+		shares.Shares = allocation.SharesCount
+	}
+	return types.ResourceAllocationInfo{
+		Reservation:           &allocation.Reservation,
+		ExpandableReservation: &expandable,
+		Limit:                 &limit,
+		Shares:                shares,
+	}
+}
+
+func isSameAllocation(actual, expected types.ResourceAllocationInfo) bool {
+	if actual.Reservation == nil || *actual.Reservation != *expected.Reservation {
+		return false
+	}
+	if actual.Limit == nil || *actual.Limit != *expected.Limit {
+		return false
+	}
+	if actual.Shares == nil || actual.Shares.Level != expected.Shares.Level {
+		return false
+	}
+	if expected.Shares.Level == types.SharesLevelCustom && actual.Shares.Shares != expected.Shares.Shares {
+		return false
+	}
+	if actual.ExpandableReservation != nil && *actual.ExpandableReservation != *expected.ExpandableReservation {
+		return false
+	}
+	return true
+}
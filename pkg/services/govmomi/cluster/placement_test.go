@@ -0,0 +1,124 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+func TestManagedPlacement(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+
+	ctx := sim.NewClusterContext(t)
+	finder := ctx.Session.Finder
+
+	// Reconciling twice should create the folder once.
+	for i := 0; i < 2; i++ {
+		folderPath, err := ReconcileFolder(ctx, "", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if folderPath != "/DC0/vm/test" {
+			t.Fatalf("unexpected folder path %q", folderPath)
+		}
+	}
+	if _, err := finder.Folder(ctx, "/DC0/vm/test"); err != nil {
+		t.Fatal(err)
+	}
+
+	limit := int64(1000)
+	spec := infrav1.ManagedResourcePoolSpec{
+		Parent: "DC0_C0/Resources",
+		CPU: infrav1.ResourceAllocation{
+			Reservation: 500,
+			Limit:       &limit,
+			Shares:      infrav1.SharesLevelHigh,
+		},
+		Memory: infrav1.ResourceAllocation{
+			Shares:      infrav1.SharesLevelCustom,
+			SharesCount: 100,
+		},
+	}
+	poolPath, err := ReconcileResourcePool(ctx, "test", spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poolPath != "/DC0/host/DC0_C0/Resources/test" {
+		t.Fatalf("unexpected resource pool path %q", poolPath)
+	}
+	getConfig := func() types.ResourceConfigSpec {
+		pool, err := finder.ResourcePool(ctx, poolPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var obj mo.ResourcePool
+		if err := pool.Properties(ctx, pool.Reference(), []string{"config"}, &obj); err != nil {
+			t.Fatal(err)
+		}
+		return obj.Config
+	}
+	config := getConfig()
+	if *config.CpuAllocation.Reservation != 500 || *config.CpuAllocation.Limit != 1000 ||
+		config.CpuAllocation.Shares.Level != types.SharesLevelHigh {
+		t.Errorf("unexpected cpu allocation %+v", config.CpuAllocation)
+	}
+	if *config.MemoryAllocation.Limit != -1 || config.MemoryAllocation.Shares.Shares != 100 {
+		t.Errorf("unexpected memory allocation %+v", config.MemoryAllocation)
+	}
+
+	// Changing the allocation updates the existing resource pool.
+	spec.CPU.Reservation = 250
+	if _, err := ReconcileResourcePool(ctx, "test", spec); err != nil {
+		t.Fatal(err)
+	}
+	if config := getConfig(); *config.CpuAllocation.Reservation != 250 {
+		t.Errorf("expected cpu reservation to be updated, got %d", *config.CpuAllocation.Reservation)
+	}
+
+	// A resource pool that contains a VM is not deleted.
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	var pool *simulator.ResourcePool
+	for _, obj := range simulator.Map.All("ResourcePool") {
+		if p := obj.(*simulator.ResourcePool); p.Name == "test" {
+			pool = p
+		}
+	}
+	pool.Vm = append(pool.Vm, vm.Reference())
+	if deleted, err := DeleteResourcePoolIfEmpty(ctx, poolPath); err != nil || deleted {
+		t.Fatalf("expected non-empty resource pool to be kept, got deleted=%v err=%v", deleted, err)
+	}
+	pool.Vm = nil
+
+	if deleted, err := DeleteResourcePoolIfEmpty(ctx, poolPath); err != nil || !deleted {
+		t.Fatalf("expected resource pool to be deleted, got deleted=%v err=%v", deleted, err)
+	}
+	if deleted, err := DeleteFolderIfEmpty(ctx, "/DC0/vm/test"); err != nil || !deleted {
+		t.Fatalf("expected folder to be deleted, got deleted=%v err=%v", deleted, err)
+	}
+	// Deleting a folder that does not exist is not an error.
+	if deleted, err := DeleteFolderIfEmpty(ctx, "/DC0/vm/test"); err != nil || !deleted {
+		t.Fatalf("expected missing folder to be deleted, got deleted=%v err=%v", deleted, err)
+	}
+}
@@ -0,0 +1,303 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+type computeClusterContext interface {
+	context.Context
+	GetLogger() logr.Logger
+	GetSession() *session.Session
+}
+
+// AntiAffinityRule describes a VM-VM anti-affinity rule.
+type AntiAffinityRule struct {
+	// Name is the name of the rule.
+	Name string
+
+	// Mandatory is true if DRS must never place the rule's VMs on the same
+	// host.
+	Mandatory bool
+
+	// VMs are the VMs kept on separate hosts.
+	VMs []types.ManagedObjectReference
+}
+
+// ReconcileAntiAffinityRules ensures the compute clusters in the session's
+// datacenter contain the given rules. A rule's VMs may span compute clusters,
+// in which case the rule is created in each compute cluster that contains
+// at least two of its VMs. Existing rules with names that start with the
+// given prefix are removed if they are not among the given rules.
+func ReconcileAntiAffinityRules(ctx computeClusterContext, prefix string, rules []AntiAffinityRule) error {
+	// Get the rules of all the compute clusters with a single request rather
+	// than one request per compute cluster.
+	var computeClusters []mo.ClusterComputeResource
+	if err := retrieveFromDatacenter(ctx, "ClusterComputeResource", []string{"name", "configurationEx"}, &computeClusters); err != nil {
+		return errors.Wrap(err, "unable to get configuration of compute clusters")
+	}
+	if len(computeClusters) == 0 {
+		return nil
+	}
+
+	var vms []types.ManagedObjectReference
+	for _, rule := range rules {
+		vms = append(vms, rule.VMs...)
+	}
+	vmsByComputeCluster, err := groupVMsByComputeCluster(ctx, vms)
+	if err != nil {
+		return err
+	}
+
+	for i := range computeClusters {
+		computeCluster := &computeClusters[i]
+		if err := reconcileComputeClusterRules(ctx, computeCluster, prefix, rules, vmsByComputeCluster[computeCluster.Reference()]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindVMsByBIOSUUID returns the VMs in the session's datacenter keyed by
+// their BIOS UUID. Only VMs with one of the given BIOS UUIDs are returned.
+// The VMs are found with a single request rather than one request per UUID.
+func FindVMsByBIOSUUID(ctx computeClusterContext, uuids []string) (map[string]types.ManagedObjectReference, error) {
+	result := map[string]types.ManagedObjectReference{}
+	if len(uuids) == 0 {
+		return result, nil
+	}
+	wanted := make(map[string]struct{}, len(uuids))
+	for _, uuid := range uuids {
+		wanted[uuid] = struct{}{}
+	}
+
+	var vms []mo.VirtualMachine
+	if err := retrieveFromDatacenter(ctx, "VirtualMachine", []string{"config.uuid", "config.template"}, &vms); err != nil {
+		return nil, errors.Wrap(err, "unable to get BIOS UUIDs of vms")
+	}
+	for _, vm := range vms {
+		if vm.Config == nil || vm.Config.Template {
+			continue
+		}
+		if _, ok := wanted[vm.Config.Uuid]; ok {
+			result[vm.Config.Uuid] = vm.Reference()
+		}
+	}
+	return result, nil
+}
+
+// retrieveFromDatacenter retrieves the given properties of all the objects of
+// the given kind in the session's datacenter.
+func retrieveFromDatacenter(ctx computeClusterContext, kind string, props []string, dst interface{}) error {
+	authSession := ctx.GetSession()
+	containerView, err := view.NewManager(authSession.Client.Client).CreateContainerView(
+		ctx, authSession.Datacenter().Reference(), []string{kind}, true)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create container view for datacenter %s", authSession.Datacenter().InventoryPath)
+	}
+	defer func() {
+		_ = containerView.Destroy(ctx)
+	}()
+	return containerView.Retrieve(ctx, []string{kind}, props, dst)
+}
+
+// groupVMsByComputeCluster returns the given VMs keyed by the compute
+// cluster that contains them.
+func groupVMsByComputeCluster(
+	ctx computeClusterContext,
+	refs []types.ManagedObjectReference) (map[types.ManagedObjectReference]map[types.ManagedObjectReference]struct{}, error) {
+
+	result := map[types.ManagedObjectReference]map[types.ManagedObjectReference]struct{}{}
+	if len(refs) == 0 {
+		return result, nil
+	}
+
+	pc := property.DefaultCollector(ctx.GetSession().Client.Client)
+
+	var vms []mo.VirtualMachine
+	if err := pc.Retrieve(ctx, refs, []string{"resourcePool"}, &vms); err != nil {
+		return nil, errors.Wrap(err, "unable to get resource pools of vms")
+	}
+
+	var poolRefs []types.ManagedObjectReference
+	for _, vm := range vms {
+		if vm.ResourcePool != nil {
+			poolRefs = append(poolRefs, *vm.ResourcePool)
+		}
+	}
+	if len(poolRefs) == 0 {
+		return result, nil
+	}
+	var pools []mo.ResourcePool
+	if err := pc.Retrieve(ctx, poolRefs, []string{"owner"}, &pools); err != nil {
+		return nil, errors.Wrap(err, "unable to get owners of resource pools")
+	}
+	owners := map[types.ManagedObjectReference]types.ManagedObjectReference{}
+	for _, pool := range pools {
+		owners[pool.Reference()] = pool.Owner
+	}
+
+	for _, vm := range vms {
+		if vm.ResourcePool == nil {
+			continue
+		}
+		owner, ok := owners[*vm.ResourcePool]
+		if !ok || owner.Type != "ClusterComputeResource" {
+			continue
+		}
+		if result[owner] == nil {
+			result[owner] = map[types.ManagedObjectReference]struct{}{}
+		}
+		result[owner][vm.Reference()] = struct{}{}
+	}
+	return result, nil
+}
+
+func reconcileComputeClusterRules(
+	ctx computeClusterContext,
+	obj *mo.ClusterComputeResource,
+	prefix string,
+	rules []AntiAffinityRule,
+	vms map[types.ManagedObjectReference]struct{}) error {
+
+	existing := map[string]*types.ClusterAntiAffinityRuleSpec{}
+	if config, ok := obj.ConfigurationEx.(*types.ClusterConfigInfoEx); ok {
+		for _, info := range config.Rule {
+			if rule, ok := info.(*types.ClusterAntiAffinityRuleSpec); ok && strings.HasPrefix(rule.Name, prefix) {
+				existing[rule.Name] = rule
+			}
+		}
+	}
+
+	var specs []types.ClusterRuleSpec
+	for _, rule := range rules {
+		// Only the rule's VMs in this compute cluster are members of the
+		// rule in this compute cluster.
+		var members []types.ManagedObjectReference
+		for _, vm := range rule.VMs {
+			if _, ok := vms[vm]; ok {
+				members = append(members, vm)
+			}
+		}
+		sortRefs(members)
+
+		current, exists := existing[rule.Name]
+		delete(existing, rule.Name)
+
+		// A rule with fewer than two VMs has no effect.
+		if len(members) < 2 {
+			if exists {
+				specs = append(specs, newRemoveRuleSpec(current))
+			}
+			continue
+		}
+
+		enabled, mandatory := true, rule.Mandatory
+		info := &types.ClusterAntiAffinityRuleSpec{
+			ClusterRuleInfo: types.ClusterRuleInfo{
+				Name:      rule.Name,
+				Enabled:   &enabled,
+				Mandatory: &mandatory,
+			},
+			Vm: members,
+		}
+		if !exists {
+			specs = append(specs, types.ClusterRuleSpec{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationAdd},
+				Info:            info,
+			})
+			continue
+		}
+		if isSameRule(current, info) {
+			continue
+		}
+		info.Key = current.Key
+		info.RuleUuid = current.RuleUuid
+		specs = append(specs, types.ClusterRuleSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationEdit},
+			Info:            info,
+		})
+	}
+
+	// Remove the remaining managed rules.
+	for _, current := range existing {
+		specs = append(specs, newRemoveRuleSpec(current))
+	}
+
+	if len(specs) == 0 {
+		return nil
+	}
+
+	ctx.GetLogger().Info("reconciling anti-affinity rules", "compute-cluster", obj.Name, "rule-changes", len(specs))
+	computeCluster := object.NewClusterComputeResource(ctx.GetSession().Client.Client, obj.Reference())
+	task, err := computeCluster.Reconfigure(ctx, &types.ClusterConfigSpecEx{RulesSpec: specs}, true)
+	if err != nil {
+		return errors.Wrapf(err, "unable to reconfigure rules of compute cluster %s", obj.Name)
+	}
+	if err := task.Wait(ctx); err != nil {
+		return errors.Wrapf(err, "failed to reconfigure rules of compute cluster %s", obj.Name)
+	}
+	return nil
+}
+
+func newRemoveRuleSpec(rule *types.ClusterAntiAffinityRuleSpec) types.ClusterRuleSpec {
+	return types.ClusterRuleSpec{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{
+			Operation: types.ArrayUpdateOperationRemove,
+			RemoveKey: rule.Key,
+		},
+	}
+}
+
+func isSameRule(a, b *types.ClusterAntiAffinityRuleSpec) bool {
+	if a.Mandatory == nil || *a.Mandatory != *b.Mandatory {
+		return false
+	}
+	if a.Enabled == nil || !*a.Enabled {
+		return false
+	}
+	vms := append([]types.ManagedObjectReference{}, a.Vm...)
+	sortRefs(vms)
+	if len(vms) != len(b.Vm) {
+		return false
+	}
+	for i := range vms {
+		if vms[i] != b.Vm[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortRefs(refs []types.ManagedObjectReference) {
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Value < refs[j].Value
+	})
+}
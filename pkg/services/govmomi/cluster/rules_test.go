@@ -0,0 +1,138 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+func TestReconcileAntiAffinityRules(t *testing.T) {
+	sim := vcsim.New(t, func(model *simulator.Model) {
+		model.Machine = 4
+	})
+	defer sim.Destroy()
+
+	ctx := sim.NewClusterContext(t)
+
+	var vms []types.ManagedObjectReference
+	for _, obj := range simulator.Map.All("VirtualMachine") {
+		vms = append(vms, obj.Reference())
+	}
+	if len(vms) < 4 {
+		t.Fatalf("expected at least 4 vms, got %d", len(vms))
+	}
+	sortRefs(vms)
+
+	computeCluster := simulator.Map.Any("ClusterComputeResource").(*simulator.ClusterComputeResource)
+	getRules := func() map[string]*types.ClusterAntiAffinityRuleSpec {
+		rules := map[string]*types.ClusterAntiAffinityRuleSpec{}
+		for _, info := range computeCluster.ConfigurationEx.(*types.ClusterConfigInfoEx).Rule {
+			if rule, ok := info.(*types.ClusterAntiAffinityRuleSpec); ok {
+				rules[rule.Name] = rule
+			}
+		}
+		return rules
+	}
+
+	const prefix = "capv/default/test/"
+
+	steps := []struct {
+		name     string
+		rules    []AntiAffinityRule
+		expected map[string]int
+		hard     map[string]bool
+	}{
+		{
+			name: "add rules",
+			rules: []AntiAffinityRule{
+				{Name: prefix + "control-plane", VMs: vms[:2]},
+				{Name: prefix + "md/a", Mandatory: true, VMs: vms[2:4]},
+			},
+			expected: map[string]int{prefix + "control-plane": 2, prefix + "md/a": 2},
+			hard:     map[string]bool{prefix + "control-plane": false, prefix + "md/a": true},
+		},
+		{
+			name: "update membership and policy",
+			rules: []AntiAffinityRule{
+				{Name: prefix + "control-plane", Mandatory: true, VMs: vms[:3]},
+				{Name: prefix + "md/a", Mandatory: true, VMs: vms[2:4]},
+			},
+			expected: map[string]int{prefix + "control-plane": 3, prefix + "md/a": 2},
+			hard:     map[string]bool{prefix + "control-plane": true, prefix + "md/a": true},
+		},
+		{
+			name: "remove rule with one vm",
+			rules: []AntiAffinityRule{
+				{Name: prefix + "control-plane", Mandatory: true, VMs: vms[:3]},
+				{Name: prefix + "md/a", Mandatory: true, VMs: vms[3:4]},
+			},
+			expected: map[string]int{prefix + "control-plane": 3},
+			hard:     map[string]bool{prefix + "control-plane": true},
+		},
+		{
+			name:     "remove all rules",
+			expected: map[string]int{},
+		},
+	}
+
+	for _, step := range steps {
+		if err := ReconcileAntiAffinityRules(ctx, prefix, step.rules); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		rules := getRules()
+		if len(rules) != len(step.expected) {
+			t.Fatalf("%s: expected %d rules, got %d", step.name, len(step.expected), len(rules))
+		}
+		for name, count := range step.expected {
+			rule, ok := rules[name]
+			if !ok {
+				t.Fatalf("%s: expected rule %q", step.name, name)
+			}
+			if len(rule.Vm) != count {
+				t.Errorf("%s: expected rule %q to have %d vms, got %d", step.name, name, count, len(rule.Vm))
+			}
+			if *rule.Mandatory != step.hard[name] {
+				t.Errorf("%s: expected rule %q mandatory=%v", step.name, name, step.hard[name])
+			}
+		}
+	}
+}
+
+func TestFindVMsByBIOSUUID(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+
+	ctx := sim.NewClusterContext(t)
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	const missing = "00000000-0000-0000-0000-000000000000"
+	refs, err := FindVMsByBIOSUUID(ctx, []string{vm.Config.Uuid, missing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 {
+		t.Fatalf("expected 1 vm, got %d", len(refs))
+	}
+	if refs[vm.Config.Uuid] != vm.Reference() {
+		t.Errorf("expected vm %s, got %s", vm.Reference(), refs[vm.Config.Uuid])
+	}
+}
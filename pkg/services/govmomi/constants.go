@@ -16,14 +16,53 @@ limitations under the License.
 
 package govmomi
 
+import "time"
+
 const (
 	morefTypeTask = "Task"
 )
 
+// defaultGuestShutdownTimeout is how long to wait for a guest to shut down
+// when a VSphereVM does not specify a GuestShutdownTimeout.
+const defaultGuestShutdownTimeout = 5 * time.Minute
+
+// defaultProvisioningTimeout is how long after a VSphereVM is created the
+// diagnostics are collected when its DiagnosticsSpec does not specify a
+// ProvisioningTimeout.
+const defaultProvisioningTimeout = 30 * time.Minute
+
+// defaultGuestLogFiles are the files downloaded from the guest when a
+// VSphereVM's DiagnosticsSpec does not specify GuestLogFiles.
+var defaultGuestLogFiles = []string{
+	"/var/log/cloud-init.log",
+	"/var/log/cloud-init-output.log",
+}
+
+// maxDiagnosticsFileSize is the maximum size of a file stored in a
+// diagnostics Secret. Only the end of a larger log file is stored so all of
+// the files fit in a single Secret.
+const maxDiagnosticsFileSize = 256 * 1024
+
+// defaultGuestReadinessKey is the guestinfo key a guest sets to report its
+// status when a VSphereVM's GuestReadinessSpec does not specify a Key.
+const defaultGuestReadinessKey = "guestinfo.cloudinit.status"
+
+// The values of a guest readiness key that are not a running status.
+const (
+	guestReadinessStatusDone  = "done"
+	guestReadinessStatusError = "error"
+)
+
+// ethCardType is the type of NIC added to VMs. This matches the type used
+// when a VM is cloned.
+const ethCardType = "vmxnet3"
+
 // nolint
 const (
 	guestInfoKeyMetadata    = "guestinfo.metadata"
 	guestInfoKeyMetadataEnc = "guestinfo.metadata.encoding"
 	guestInfoKeyUserdata    = "guestinfo.userdata"
 	guestInfoKeyUserdataEnc = "guestinfo.userdata.encoding"
+	guestInfoKeyIgnition    = "guestinfo.ignition.config.data"
+	guestInfoKeyIgnitionEnc = "guestinfo.ignition.config.data.encoding"
 )
@@ -17,14 +17,15 @@ limitations under the License.
 package govmomi
 
 import (
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/esxi"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
 )
 
-func createVM(ctx *context.VMContext, bootstrapData []byte) error {
+func createVM(ctx *context.VMContext, bootstrapData []byte, bootstrapFormat infrav1.BootstrapFormat) error {
 	if ctx.Session.IsVC() {
-		return vcenter.Clone(ctx, bootstrapData)
+		return vcenter.Clone(ctx, bootstrapData, bootstrapFormat)
 	}
-	return esxi.Clone(ctx, bootstrapData)
+	return esxi.Clone(ctx, bootstrapData, bootstrapFormat)
 }
@@ -17,55 +17,166 @@ limitations under the License.
 package govmomi
 
 import (
-	"crypto/tls"
+	"crypto/rand"
 	"testing"
 
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/simulator"
 	"github.com/vmware/govmomi/vim25/types"
 
-	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
-	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
 )
 
 func TestCreate(t *testing.T) {
-	model := simulator.VPX()
-	model.Host = 0 // ClusterHost only
+	sim := vcsim.New(t)
+	defer sim.Destroy()
 
-	defer model.Remove()
-	err := model.Create()
-	if err != nil {
+	vmContext := sim.NewVMContext(t)
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	vmContext.VSphereVM.Spec.Template = vm.Name
+
+	disk := object.VirtualDeviceList(vm.Config.Hardware.Device).SelectByType((*types.VirtualDisk)(nil))[0].(*types.VirtualDisk)
+	disk.CapacityInKB = int64(vmContext.VSphereVM.Spec.DiskGiB) * 1024 * 1024
+
+	if err := createVM(vmContext, []byte(""), infrav1.BootstrapFormatCloudConfig); err != nil {
 		t.Fatal(err)
 	}
-	model.Service.TLS = new(tls.Config)
 
-	s := model.Service.NewServer()
-	defer s.Close()
-	pass, _ := s.URL.User.Password()
+	if sim.Model.Machine+1 != sim.Model.Count().Machine {
+		t.Error("failed to clone vm")
+	}
+}
 
-	vmContext := fake.NewVMContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
-	vmContext.VSphereVM.Spec.Server = s.URL.Host
+func TestCreateIgnition(t *testing.T) {
+	testCases := []struct {
+		name          string
+		bootstrapData string
+		expectedError bool
+	}{
+		{
+			name:          "valid config",
+			bootstrapData: `{"ignition":{"version":"3.0.0"}}`,
+		},
+		{
+			// The Ignition config is generated when the VM is cloned.
+			name:          "config without version",
+			bootstrapData: `{"ignition":{}}`,
+			expectedError: true,
+		},
+	}
 
-	authSession, err := session.GetOrCreate(
-		vmContext,
-		vmContext.VSphereVM.Spec.Server, "",
-		s.URL.User.Username(), pass)
-	if err != nil {
-		t.Fatal(err)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := vcsim.New(t)
+			defer sim.Destroy()
+
+			vmContext := sim.NewVMContext(t)
+
+			vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+			vmContext.VSphereVM.Spec.Template = vm.Name
+
+			disk := object.VirtualDeviceList(vm.Config.Hardware.Device).SelectByType((*types.VirtualDisk)(nil))[0].(*types.VirtualDisk)
+			disk.CapacityInKB = int64(vmContext.VSphereVM.Spec.DiskGiB) * 1024 * 1024
+
+			err := createVM(vmContext, []byte(tc.bootstrapData), infrav1.BootstrapFormatIgnition)
+			if tc.expectedError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if sim.Model.Machine != sim.Model.Count().Machine {
+					t.Error("expected the vm not to be cloned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sim.Model.Machine+1 != sim.Model.Count().Machine {
+				t.Error("failed to clone vm")
+			}
+		})
 	}
-	vmContext.Session = authSession
+}
+
+func TestCreateBootstrapDataTooLarge(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+
+	vmContext := sim.NewVMContext(t)
 
 	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
 	vmContext.VSphereVM.Spec.Template = vm.Name
 
-	disk := object.VirtualDeviceList(vm.Config.Hardware.Device).SelectByType((*types.VirtualDisk)(nil))[0].(*types.VirtualDisk)
-	disk.CapacityInKB = int64(vmContext.VSphereVM.Spec.DiskGiB) * 1024 * 1024
-
-	if err := createVM(vmContext, []byte("")); err != nil {
+	// Random data does not compress below the maximum guestinfo value size.
+	bootstrapData := make([]byte, extra.MaxValueSize)
+	if _, err := rand.Read(bootstrapData); err != nil {
 		t.Fatal(err)
 	}
 
-	if model.Machine+1 != model.Count().Machine {
-		t.Error("failed to clone vm")
+	if err := createVM(vmContext, bootstrapData, infrav1.BootstrapFormatCloudConfig); !extra.IsValueTooLarge(err) {
+		t.Fatalf("expected a ValueTooLargeError, got %v", err)
+	}
+
+	if sim.Model.Machine != sim.Model.Count().Machine {
+		t.Error("expected the vm not to be cloned")
+	}
+}
+
+func TestCreateInstantCloneFallback(t *testing.T) {
+	testCases := []struct {
+		name       string
+		apiVersion string
+		powerOff   bool
+	}{
+		{
+			name:       "unsupported api version",
+			apiVersion: "6.5",
+		},
+		{
+			name:       "source powered off",
+			apiVersion: "6.7",
+			powerOff:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := vcsim.New(t)
+			defer sim.Destroy()
+
+			vmContext := sim.NewVMContext(t)
+			vmContext.VSphereVM.Spec.CloneMode = infrav1.InstantClone
+			authSession := vmContext.Session
+			authSession.ServiceContent.About.ApiVersion = tc.apiVersion
+
+			vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+			vmContext.VSphereVM.Spec.Template = vm.Name
+			if tc.powerOff {
+				task, err := object.NewVirtualMachine(authSession.Client.Client, vm.Reference()).PowerOff(vmContext)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := task.Wait(vmContext); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			disk := object.VirtualDeviceList(vm.Config.Hardware.Device).SelectByType((*types.VirtualDisk)(nil))[0].(*types.VirtualDisk)
+			disk.CapacityInKB = int64(vmContext.VSphereVM.Spec.DiskGiB) * 1024 * 1024
+
+			if err := createVM(vmContext, []byte(""), infrav1.BootstrapFormatCloudConfig); err != nil {
+				t.Fatal(err)
+			}
+
+			if vmContext.VSphereVM.Status.CloneMode == infrav1.InstantClone {
+				t.Errorf("expected clone mode to fall back from %q", infrav1.InstantClone)
+			}
+			if sim.Model.Machine+1 != sim.Model.Count().Machine {
+				t.Error("failed to clone vm")
+			}
+		})
 	}
 }
@@ -0,0 +1,349 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/guest"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+const (
+	// diagnosticsKeyGuest is the key of the guest state in a diagnostics
+	// Secret.
+	diagnosticsKeyGuest = "guest.json"
+
+	// diagnosticsKeyScreenshot is the key of the console screenshot in a
+	// diagnostics Secret.
+	diagnosticsKeyScreenshot = "screenshot.png"
+
+	// diagnosticsKeyErrors is the key of the errors that occurred while
+	// collecting the diagnostics in a diagnostics Secret.
+	diagnosticsKeyErrors = "errors.txt"
+)
+
+// invalidSecretKeyChars matches the characters that may not be used in the
+// key of a Secret.
+var invalidSecretKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]+`)
+
+// guestDiagnostics is the state of a VM's guest stored in a diagnostics
+// Secret.
+type guestDiagnostics struct {
+	PowerState           types.VirtualMachinePowerState `json:"powerState"`
+	GuestHeartbeatStatus types.ManagedEntityStatus      `json:"guestHeartbeatStatus,omitempty"`
+	GuestState           string                         `json:"guestState,omitempty"`
+	ToolsRunningStatus   string                         `json:"toolsRunningStatus,omitempty"`
+	ToolsVersionStatus   string                         `json:"toolsVersionStatus,omitempty"`
+	ToolsVersion         string                         `json:"toolsVersion,omitempty"`
+	HostName             string                         `json:"hostName,omitempty"`
+	IPAddress            string                         `json:"ipAddress,omitempty"`
+	Net                  []guestNicDiagnostics          `json:"net,omitempty"`
+}
+
+// guestNicDiagnostics is the state of a guest's NIC stored in a diagnostics
+// Secret.
+type guestNicDiagnostics struct {
+	Network     string   `json:"network,omitempty"`
+	MacAddress  string   `json:"macAddress,omitempty"`
+	Connected   bool     `json:"connected"`
+	IPAddresses []string `json:"ipAddresses,omitempty"`
+}
+
+// reconcileDiagnostics collects diagnostics from the VM once if it is not
+// provisioned by its deadline. The diagnostics are stored in a Secret owned
+// by the VSphereVM.
+func (vms *VMService) reconcileDiagnostics(ctx *virtualMachineContext) error {
+	spec := ctx.VSphereVM.Spec.Diagnostics
+	if spec == nil || util.GetCondition(ctx.VSphereVM.Status.Conditions, infrav1.DiagnosticsCollectedCondition) != nil {
+		return nil
+	}
+
+	provisioned, err := isProvisioned(ctx)
+	if err != nil || provisioned {
+		return err
+	}
+
+	timeout := defaultProvisioningTimeout
+	if spec.ProvisioningTimeout != nil {
+		timeout = spec.ProvisioningTimeout.Duration
+	}
+	deadline := ctx.VSphereVM.CreationTimestamp.Add(timeout)
+	if time.Now().Before(deadline) {
+		reconcileVSphereVMAfter(&ctx.VMContext, time.Until(deadline), "reason", "provisioning-deadline")
+		return nil
+	}
+
+	ctx.Logger.Info("collecting diagnostics", "provisioning-timeout", timeout)
+	data, err := collectDiagnostics(ctx)
+	if err != nil {
+		return err
+	}
+	secret, err := createOrUpdateDiagnosticsSecret(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	ctx.VSphereVM.Status.DiagnosticsRef = &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Namespace:  secret.Namespace,
+		Name:       secret.Name,
+	}
+	util.SetCondition(&ctx.VSphereVM.Status.Conditions, infrav1.Condition{
+		Type:    infrav1.DiagnosticsCollectedCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  infrav1.ProvisioningTimeoutReason,
+		Message: fmt.Sprintf("the VM was not provisioned within %s", timeout),
+	})
+	ctx.Recorder.Warnf(ctx.VSphereVM, "ProvisioningTimeout",
+		"VM was not provisioned within %s, diagnostics were stored in Secret %s", timeout, secret.Name)
+	return nil
+}
+
+// isProvisioned returns true if the Machine that owns the VM has a NodeRef.
+// A VM that is not owned by a Machine, such as a load balancer VM, is
+// provisioned once it has an IP address.
+func isProvisioned(ctx *virtualMachineContext) (bool, error) {
+	machine, err := getOwnerMachine(&ctx.VMContext)
+	if err != nil {
+		return false, err
+	}
+	if machine == nil {
+		return len(ctx.VSphereVM.Status.Addresses) > 0, nil
+	}
+	return machine.Status.NodeRef != nil, nil
+}
+
+// collectDiagnostics returns the diagnostics collected from the VM keyed by
+// the names used in the diagnostics Secret. A diagnostic that cannot be
+// collected, for example because VMware Tools is not running, is described
+// in the errors file so the other diagnostics are still collected.
+func collectDiagnostics(ctx *virtualMachineContext) (map[string][]byte, error) {
+	var obj mo.VirtualMachine
+	if err := ctx.Obj.Properties(ctx, ctx.Ref, []string{"guest", "guestHeartbeatStatus", "runtime.powerState"}, &obj); err != nil {
+		return nil, errors.Wrapf(err, "unable to get guest info for vm %s", ctx)
+	}
+
+	guestInfo := guestDiagnostics{
+		PowerState:           obj.Runtime.PowerState,
+		GuestHeartbeatStatus: obj.GuestHeartbeatStatus,
+	}
+	if g := obj.Guest; g != nil {
+		guestInfo.GuestState = g.GuestState
+		guestInfo.ToolsRunningStatus = g.ToolsRunningStatus
+		guestInfo.ToolsVersionStatus = g.ToolsVersionStatus2
+		guestInfo.ToolsVersion = g.ToolsVersion
+		guestInfo.HostName = g.HostName
+		guestInfo.IPAddress = g.IpAddress
+		for _, nic := range g.Net {
+			guestInfo.Net = append(guestInfo.Net, guestNicDiagnostics{
+				Network:     nic.Network,
+				MacAddress:  nic.MacAddress,
+				Connected:   nic.Connected,
+				IPAddresses: nic.IpAddress,
+			})
+		}
+	}
+	guestData, err := json.MarshalIndent(guestInfo, "", "  ")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal guest info for vm %s", ctx)
+	}
+
+	var (
+		data = map[string][]byte{diagnosticsKeyGuest: guestData}
+		errs []string
+	)
+
+	if obj.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOn {
+		if screenshot, err := getScreenshot(ctx); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			data[diagnosticsKeyScreenshot] = screenshot
+		}
+	}
+
+	if secretName := ctx.VSphereVM.Spec.Diagnostics.GuestCredentialsSecretName; secretName != "" {
+		if guestInfo.ToolsRunningStatus != string(types.VirtualMachineToolsRunningStatusGuestToolsRunning) {
+			errs = append(errs, "unable to download guest log files: VMware Tools is not running")
+		} else if auth, err := getGuestCredentials(ctx, secretName); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			logFiles := ctx.VSphereVM.Spec.Diagnostics.GuestLogFiles
+			if len(logFiles) == 0 {
+				logFiles = defaultGuestLogFiles
+			}
+			for _, path := range logFiles {
+				content, err := downloadGuestFile(ctx, auth, path)
+				if err != nil {
+					errs = append(errs, err.Error())
+					continue
+				}
+				data[diagnosticsKey(path)] = content
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		data[diagnosticsKeyErrors] = []byte(strings.Join(errs, "\n") + "\n")
+	}
+	return data, nil
+}
+
+// getScreenshot returns a PNG screenshot of the VM's console.
+func getScreenshot(ctx *virtualMachineContext) ([]byte, error) {
+	client := ctx.Session.Client.Client
+	res, err := methods.CreateScreenshot_Task(ctx, client, &types.CreateScreenshot_Task{This: ctx.Ref})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to trigger create screenshot op for vm %s", ctx)
+	}
+	info, err := object.NewTask(client, res.Returnval).WaitForResult(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create screenshot for vm %s", ctx)
+	}
+
+	// The result of the task is the datastore path of the screenshot.
+	screenshotPath, _ := info.Result.(string)
+	var dsPath object.DatastorePath
+	if !dsPath.FromString(screenshotPath) {
+		return nil, errors.Errorf("invalid screenshot path %q for vm %s", screenshotPath, ctx)
+	}
+	ds, err := ctx.Session.Finder.Datastore(ctx, dsPath.Datastore)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find datastore of screenshot for vm %s", ctx)
+	}
+	r, _, err := ds.Download(ctx, dsPath.Path, &soap.DefaultDownload)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download screenshot for vm %s", ctx)
+	}
+	defer r.Close()
+	screenshot, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read screenshot for vm %s", ctx)
+	}
+	if len(screenshot) > maxDiagnosticsFileSize {
+		return nil, errors.Errorf("screenshot for vm %s is larger than %d bytes", ctx, maxDiagnosticsFileSize)
+	}
+	return screenshot, nil
+}
+
+// getGuestCredentials returns the guest credentials from the username and
+// password keys of the Secret.
+func getGuestCredentials(ctx *virtualMachineContext, secretName string) (types.BaseGuestAuthentication, error) {
+	secret := &corev1.Secret{}
+	secretKey := apitypes.NamespacedName{
+		Namespace: ctx.VSphereVM.Namespace,
+		Name:      secretName,
+	}
+	if err := ctx.Client.Get(ctx, secretKey, secret); err != nil {
+		return nil, errors.Wrapf(err, "failed to get guest credentials Secret %s", secretKey)
+	}
+	return &types.NamePasswordAuthentication{
+		Username: string(secret.Data["username"]),
+		Password: string(secret.Data["password"]),
+	}, nil
+}
+
+// downloadGuestFile downloads a file from the guest with the guest operations
+// API. Only the end of a file larger than maxDiagnosticsFileSize is returned.
+func downloadGuestFile(ctx *virtualMachineContext, auth types.BaseGuestAuthentication, path string) ([]byte, error) {
+	client := ctx.Session.Client.Client
+	fm, err := guest.NewOperationsManager(client, ctx.Ref).FileManager(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get guest file manager for vm %s", ctx)
+	}
+	info, err := fm.InitiateFileTransferFromGuest(ctx, auth, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to initiate transfer of %q from vm %s", path, ctx)
+	}
+	u, err := fm.TransferURL(ctx, info.Url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get transfer url of %q from vm %s", path, ctx)
+	}
+	r, _, err := client.Download(ctx, u, &soap.DefaultDownload)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download %q from vm %s", path, ctx)
+	}
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %q from vm %s", path, ctx)
+	}
+	if len(content) > maxDiagnosticsFileSize {
+		content = content[len(content)-maxDiagnosticsFileSize:]
+	}
+	return content, nil
+}
+
+// diagnosticsKey returns the key of a guest file in a diagnostics Secret.
+func diagnosticsKey(path string) string {
+	return strings.Trim(invalidSecretKeyChars.ReplaceAllString(path, "_"), "_")
+}
+
+// createOrUpdateDiagnosticsSecret stores the diagnostics in a Secret owned
+// by the VSphereVM.
+func createOrUpdateDiagnosticsSecret(ctx *virtualMachineContext, data map[string][]byte) (*corev1.Secret, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ctx.VSphereVM.Namespace,
+			Name:      ctx.VSphereVM.Name + "-diagnostics",
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: infrav1.GroupVersion.String(),
+					Kind:       "VSphereVM",
+					Name:       ctx.VSphereVM.Name,
+					UID:        ctx.VSphereVM.UID,
+				},
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+	if err := ctx.Client.Create(ctx, secret); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return nil, errors.Wrapf(err, "failed to create diagnostics Secret %s/%s", secret.Namespace, secret.Name)
+		}
+		existing := &corev1.Secret{}
+		secretKey := apitypes.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
+		if err := ctx.Client.Get(ctx, secretKey, existing); err != nil {
+			return nil, errors.Wrapf(err, "failed to get diagnostics Secret %s", secretKey)
+		}
+		existing.Data = data
+		if err := ctx.Client.Update(ctx, existing); err != nil {
+			return nil, errors.Wrapf(err, "failed to update diagnostics Secret %s", secretKey)
+		}
+		secret = existing
+	}
+	return secret, nil
+}
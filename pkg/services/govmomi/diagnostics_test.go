@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+func TestReconcileDiagnostics(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+
+	vmContext := sim.NewVMContext(t)
+	authSession := vmContext.Session
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	ctx := &virtualMachineContext{
+		VMContext: *vmContext,
+		Obj:       object.NewVirtualMachine(authSession.Client.Client, vm.Reference()),
+		Ref:       vm.Reference(),
+		State:     &infrav1.VirtualMachine{},
+	}
+	vms := &VMService{}
+
+	// Diagnostics are not collected unless they are enabled.
+	if err := vms.reconcileDiagnostics(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.VSphereVM.Status.DiagnosticsRef != nil {
+		t.Fatal("expected no diagnostics when they are not enabled")
+	}
+
+	// Diagnostics are not collected from a provisioned VM.
+	ctx.VSphereVM.Spec.Diagnostics = &infrav1.DiagnosticsSpec{
+		ProvisioningTimeout: &metav1.Duration{Duration: time.Minute},
+	}
+	ctx.VSphereVM.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	ctx.VSphereVM.Status.Addresses = []string{"192.168.0.10"}
+	if err := vms.reconcileDiagnostics(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.VSphereVM.Status.DiagnosticsRef != nil {
+		t.Fatal("expected no diagnostics for a provisioned vm")
+	}
+
+	// Diagnostics are collected from a VM that was not provisioned by its
+	// deadline.
+	ctx.VSphereVM.Status.Addresses = nil
+	if err := vms.reconcileDiagnostics(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ref := ctx.VSphereVM.Status.DiagnosticsRef
+	if ref == nil {
+		t.Fatal("expected diagnostics ref")
+	}
+	condition := util.GetCondition(ctx.VSphereVM.Status.Conditions, infrav1.DiagnosticsCollectedCondition)
+	if condition == nil || condition.Reason != infrav1.ProvisioningTimeoutReason {
+		t.Fatalf("expected condition %s with reason %s, got %+v",
+			infrav1.DiagnosticsCollectedCondition, infrav1.ProvisioningTimeoutReason, condition)
+	}
+
+	secret := &corev1.Secret{}
+	if err := ctx.Client.Get(ctx, apitypes.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, secret); err != nil {
+		t.Fatal(err)
+	}
+	var guestInfo guestDiagnostics
+	if err := json.Unmarshal(secret.Data[diagnosticsKeyGuest], &guestInfo); err != nil {
+		t.Fatal(err)
+	}
+	if guestInfo.PowerState != types.VirtualMachinePowerStatePoweredOn {
+		t.Fatalf("expected power state %s, got %q", types.VirtualMachinePowerStatePoweredOn, guestInfo.PowerState)
+	}
+	// The simulator does not support screenshots.
+	if _, ok := secret.Data[diagnosticsKeyErrors]; !ok {
+		t.Fatal("expected errors for the screenshot")
+	}
+}
+
+func TestDiagnosticsKey(t *testing.T) {
+	testCases := map[string]string{
+		"/var/log/cloud-init.log":        "var_log_cloud-init.log",
+		"/var/log/cloud-init-output.log": "var_log_cloud-init-output.log",
+		`C:\Windows\Temp\setup.log`:      "C_Windows_Temp_setup.log",
+	}
+	for path, expected := range testCases {
+		if actual := diagnosticsKey(path); actual != expected {
+			t.Errorf("expected key %q for %q, got %q", expected, path, actual)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+// drift is the difference between a VM and its spec along with the changes
+// required to remediate it.
+type drift struct {
+	fields        []infrav1.DriftedField
+	pool          *object.ResourcePool
+	folder        *object.Folder
+	deviceChanges []types.BaseVirtualDeviceConfigSpec
+}
+
+func (d *drift) add(field string, expected, actual interface{}) {
+	d.fields = append(d.fields, infrav1.DriftedField{
+		Field:    field,
+		Expected: fmt.Sprint(expected),
+		Actual:   fmt.Sprint(actual),
+	})
+}
+
+// reconcileDrift compares the VM with its spec and reports the differences
+// with the Drifted condition. If the VM's DriftPolicy is remediate then the
+// VM is changed to match its spec, and false is returned while a change is
+// in progress. Changes to the number of CPUs and the size of memory are
+// remediated by reconcileHardware.
+func (vms *VMService) reconcileDrift(ctx *virtualMachineContext) (bool, error) {
+	status := &ctx.VSphereVM.Status
+	// Drift detection is opt-in, an empty policy means ignore.
+	policy := ctx.VSphereVM.Spec.DriftPolicy
+	if policy != infrav1.DriftPolicyReport && policy != infrav1.DriftPolicyRemediate {
+		status.Drift = nil
+		util.RemoveCondition(&status.Conditions, infrav1.DriftedCondition)
+		return true, nil
+	}
+
+	d, err := getDrift(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	previous := status.Drift
+	status.Drift = d.fields
+
+	if len(d.fields) == 0 {
+		util.SetCondition(&status.Conditions, infrav1.Condition{
+			Type:   infrav1.DriftedCondition,
+			Status: corev1.ConditionFalse,
+			Reason: infrav1.NoDriftReason,
+		})
+		if len(previous) > 0 {
+			ctx.Logger.Info("drift resolved")
+			ctx.Recorder.Event(ctx.VSphereVM, "DriftResolved", "VM matches its spec")
+		}
+		return true, nil
+	}
+
+	fields := make([]string, len(d.fields))
+	for i := range d.fields {
+		fields[i] = d.fields[i].String()
+	}
+	message := strings.Join(fields, "; ")
+	util.SetCondition(&status.Conditions, infrav1.Condition{
+		Type:    infrav1.DriftedCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  infrav1.DriftDetectedReason,
+		Message: message,
+	})
+	if !reflect.DeepEqual(previous, d.fields) {
+		ctx.Logger.Info("drift detected", "drift", message)
+		ctx.Recorder.Warn(ctx.VSphereVM, "Drifted", message)
+	}
+
+	if policy != infrav1.DriftPolicyRemediate {
+		return true, nil
+	}
+
+	// Remediate one kind of drift at a time since only a single task may be
+	// tracked for the VM.
+	var (
+		task *object.Task
+		what string
+	)
+	switch {
+	case d.pool != nil:
+		what = "resource pool"
+		task, err = ctx.Obj.Relocate(ctx, types.VirtualMachineRelocateSpec{
+			Pool: types.NewReference(d.pool.Reference()),
+		}, types.VirtualMachineMovePriorityDefaultPriority)
+	case d.folder != nil:
+		what = "folder"
+		task, err = d.folder.MoveInto(ctx, []types.ManagedObjectReference{ctx.Ref})
+	case len(d.deviceChanges) > 0:
+		what = "devices"
+		task, err = ctx.Obj.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+			DeviceChange: d.deviceChanges,
+		})
+	default:
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to trigger remediation of %s drift for vm %s", what, ctx)
+	}
+	ctx.Logger.Info("remediating drift", "what", what)
+	ctx.Recorder.Eventf(ctx.VSphereVM, "RemediatingDrift", "Remediating drift of the VM's %s", what)
+	status.TaskRef = task.Reference().Value
+	return false, nil
+}
+
+// getDrift returns the difference between the VM and its spec.
+func getDrift(ctx *virtualMachineContext) (*drift, error) {
+	var obj mo.VirtualMachine
+	if err := ctx.Obj.Properties(ctx, ctx.Ref, []string{"config.hardware", "parent", "resourcePool"}, &obj); err != nil {
+		return nil, errors.Wrapf(err, "unable to get config for vm %s", ctx)
+	}
+	if obj.Config == nil {
+		return nil, errors.Errorf("unable to get config for vm %s: missing config", ctx)
+	}
+
+	d := &drift{}
+	if err := getNetworkDrift(ctx, d, obj.Config.Hardware.Device); err != nil {
+		return nil, err
+	}
+	getDiskDrift(ctx, d, obj.Config.Hardware.Device)
+	getHardwareDrift(ctx, d, obj.Config.Hardware)
+	if err := getFolderDrift(ctx, d, obj.Parent); err != nil {
+		return nil, err
+	}
+	if err := getResourcePoolDrift(ctx, d, obj.ResourcePool); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func getNetworkDrift(ctx *virtualMachineContext, d *drift, devices object.VirtualDeviceList) error {
+	nics := devices.SelectByType((*types.VirtualEthernetCard)(nil))
+	specs := ctx.VSphereVM.Spec.Network.Devices
+
+	if len(nics) != len(specs) {
+		d.add("network.devices", len(specs), len(nics))
+	}
+
+	key := int32(-100)
+	for i := range specs {
+		netSpec := &specs[i]
+		ref, err := ctx.Session.Finder.Network(ctx, netSpec.NetworkName)
+		if err != nil {
+			return errors.Wrapf(err, "unable to find network %q", netSpec.NetworkName)
+		}
+		backing, err := ref.EthernetCardBackingInfo(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "unable to create new ethernet card backing info for network %q on %q", netSpec.NetworkName, ctx)
+		}
+
+		// Add the NICs that are missing.
+		if i >= len(nics) {
+			dev, err := object.EthernetCardTypes().CreateEthernetCard(ethCardType, backing)
+			if err != nil {
+				return errors.Wrapf(err, "unable to create new ethernet card %q for network %q on %q", ethCardType, netSpec.NetworkName, ctx)
+			}
+			nic := dev.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+			if netSpec.MACAddr != "" {
+				nic.MacAddress = netSpec.MACAddr
+				nic.AddressType = string(types.VirtualEthernetCardMacTypeManual)
+			}
+			nic.Key = key
+			key--
+			d.deviceChanges = append(d.deviceChanges, &types.VirtualDeviceConfigSpec{
+				Device:    dev,
+				Operation: types.VirtualDeviceConfigSpecOperationAdd,
+			})
+			continue
+		}
+
+		nic := nics[i].(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+		changed := false
+		if !isSameNetworkBacking(backing, nic.Backing) {
+			d.add(fmt.Sprintf("network.devices[%d].networkName", i), netSpec.NetworkName, getNetworkBackingName(nic.Backing))
+			nic.Backing = backing
+			changed = true
+		}
+		if netSpec.MACAddr != "" && !strings.EqualFold(netSpec.MACAddr, nic.MacAddress) {
+			d.add(fmt.Sprintf("network.devices[%d].macAddr", i), netSpec.MACAddr, nic.MacAddress)
+			nic.MacAddress = netSpec.MACAddr
+			nic.AddressType = string(types.VirtualEthernetCardMacTypeManual)
+			changed = true
+		}
+		if changed {
+			d.deviceChanges = append(d.deviceChanges, &types.VirtualDeviceConfigSpec{
+				Device:    nics[i],
+				Operation: types.VirtualDeviceConfigSpecOperationEdit,
+			})
+		}
+	}
+
+	// Remove the NICs that are not in the spec.
+	for i := len(specs); i < len(nics); i++ {
+		d.deviceChanges = append(d.deviceChanges, &types.VirtualDeviceConfigSpec{
+			Device:    nics[i],
+			Operation: types.VirtualDeviceConfigSpecOperationRemove,
+		})
+	}
+
+	return nil
+}
+
+// getDiskDrift detects changes to the size of the VM's disk. The size of
+// the disk is only applied to full clones, and a disk is only ever grown.
+func getDiskDrift(ctx *virtualMachineContext, d *drift, devices object.VirtualDeviceList) {
+	diskGiB := ctx.VSphereVM.Spec.DiskGiB
+	if diskGiB == 0 || ctx.VSphereVM.Status.CloneMode != infrav1.FullClone {
+		return
+	}
+	disks := devices.SelectByType((*types.VirtualDisk)(nil))
+	if len(disks) != 1 {
+		return
+	}
+	disk := disks[0].(*types.VirtualDisk)
+	capacityInKB := int64(diskGiB) * 1024 * 1024
+	if disk.CapacityInKB == capacityInKB {
+		return
+	}
+	d.add("diskGiB", diskGiB, strconv.FormatFloat(float64(disk.CapacityInKB)/1024/1024, 'f', -1, 64))
+	if disk.CapacityInKB < capacityInKB {
+		disk.CapacityInKB = capacityInKB
+		d.deviceChanges = append(d.deviceChanges, &types.VirtualDeviceConfigSpec{
+			Device:    disk,
+			Operation: types.VirtualDeviceConfigSpecOperationEdit,
+		})
+	}
+}
+
+// getHardwareDrift detects changes to the number of CPUs and the size of
+// memory. The VM's hardware is not compared with the spec if the VM was
+// instant cloned since it inherits the hardware of its source.
+func getHardwareDrift(ctx *virtualMachineContext, d *drift, hardware types.VirtualHardware) {
+	if ctx.VSphereVM.Status.CloneMode == infrav1.InstantClone {
+		return
+	}
+	observed := infrav1.VirtualMachineHardware{
+		NumCPUs:           hardware.NumCPU,
+		NumCoresPerSocket: hardware.NumCoresPerSocket,
+		MemoryMiB:         int64(hardware.MemoryMB),
+	}
+	target := getTargetHardware(ctx.VSphereVM.Spec.VirtualMachineCloneSpec, observed)
+	if target.NumCPUs != observed.NumCPUs {
+		d.add("numCPUs", target.NumCPUs, observed.NumCPUs)
+	}
+	if target.NumCoresPerSocket != observed.NumCoresPerSocket {
+		d.add("numCoresPerSocket", target.NumCoresPerSocket, observed.NumCoresPerSocket)
+	}
+	if target.MemoryMiB != observed.MemoryMiB {
+		d.add("memoryMiB", target.MemoryMiB, observed.MemoryMiB)
+	}
+}
+
+func getFolderDrift(ctx *virtualMachineContext, d *drift, parent *types.ManagedObjectReference) error {
+	folder, err := ctx.Session.Finder.FolderOrDefault(ctx, ctx.VSphereVM.Spec.Folder)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get folder for %q", ctx)
+	}
+	if parent == nil || *parent == folder.Reference() {
+		return nil
+	}
+	actual, err := object.NewCommon(ctx.Session.Client.Client, *parent).ObjectName(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get name of folder %s for %q", parent.Value, ctx)
+	}
+	d.add("folder", folder.Name(), actual)
+	d.folder = folder
+	return nil
+}
+
+func getResourcePoolDrift(ctx *virtualMachineContext, d *drift, pool *types.ManagedObjectReference) error {
+	expected, err := ctx.Session.Finder.ResourcePoolOrDefault(ctx, ctx.VSphereVM.Spec.ResourcePool)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get resource pool for %q", ctx)
+	}
+	if pool == nil || *pool == expected.Reference() {
+		return nil
+	}
+	actual, err := object.NewCommon(ctx.Session.Client.Client, *pool).ObjectName(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get name of resource pool %s for %q", pool.Value, ctx)
+	}
+	d.add("resourcePool", expected.Name(), actual)
+	d.pool = expected
+	return nil
+}
+
+// isSameNetworkBacking returns true if the backings connect a NIC to the same
+// network.
+func isSameNetworkBacking(a, b types.BaseVirtualDeviceBackingInfo) bool {
+	switch a := a.(type) {
+	case *types.VirtualEthernetCardNetworkBackingInfo:
+		b, ok := b.(*types.VirtualEthernetCardNetworkBackingInfo)
+		return ok && a.DeviceName == b.DeviceName
+	case *types.VirtualEthernetCardDistributedVirtualPortBackingInfo:
+		b, ok := b.(*types.VirtualEthernetCardDistributedVirtualPortBackingInfo)
+		return ok && a.Port.PortgroupKey == b.Port.PortgroupKey
+	case *types.VirtualEthernetCardOpaqueNetworkBackingInfo:
+		b, ok := b.(*types.VirtualEthernetCardOpaqueNetworkBackingInfo)
+		return ok && a.OpaqueNetworkId == b.OpaqueNetworkId
+	default:
+		return false
+	}
+}
+
+// getNetworkBackingName returns a description of the network to which a
+// backing connects a NIC.
+func getNetworkBackingName(backing types.BaseVirtualDeviceBackingInfo) string {
+	switch b := backing.(type) {
+	case *types.VirtualEthernetCardNetworkBackingInfo:
+		return b.DeviceName
+	case *types.VirtualEthernetCardDistributedVirtualPortBackingInfo:
+		return b.Port.PortgroupKey
+	case *types.VirtualEthernetCardOpaqueNetworkBackingInfo:
+		return b.OpaqueNetworkId
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+func TestReconcileDrift(t *testing.T) {
+	testCases := []struct {
+		name            string
+		policy          infrav1.DriftPolicy
+		expectedFields  []string
+		expectedDrifted corev1.ConditionStatus
+	}{
+		{
+			name:            "ignore",
+			policy:          infrav1.DriftPolicyIgnore,
+			expectedDrifted: "",
+		},
+		{
+			name:            "default",
+			expectedDrifted: "",
+		},
+		{
+			name:            "report",
+			policy:          infrav1.DriftPolicyReport,
+			expectedFields:  []string{"network.devices[0].networkName", "numCPUs", "folder"},
+			expectedDrifted: corev1.ConditionTrue,
+		},
+		{
+			name:   "remediate",
+			policy: infrav1.DriftPolicyRemediate,
+			// The number of CPUs is remediated by reconcileHardware.
+			expectedFields:  []string{"numCPUs"},
+			expectedDrifted: corev1.ConditionTrue,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := vcsim.New(t)
+			defer sim.Destroy()
+
+			vmContext := sim.NewVMContext(t)
+			vmContext.VSphereVM.Spec.DriftPolicy = tc.policy
+			vmContext.VSphereVM.Spec.NumCPUs = 4
+			vmContext.VSphereVM.Spec.NumCoresPerSocket = 1
+			vmContext.VSphereVM.Spec.MemoryMiB = 0
+
+			authSession := vmContext.Session
+
+			vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+			obj := object.NewVirtualMachine(authSession.Client.Client, vm.Reference())
+
+			// Connect the VM's NIC to another network.
+			network, err := authSession.Finder.Network(vmContext, "DC0_DVPG0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			backing, err := network.EthernetCardBackingInfo(vmContext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			devices, err := obj.Device(vmContext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nic := devices.SelectByType((*types.VirtualEthernetCard)(nil))[0]
+			nic.GetVirtualDevice().Backing = backing
+			if err := obj.EditDevice(vmContext, nic); err != nil {
+				t.Fatal(err)
+			}
+
+			// Move the VM to another folder.
+			defaultFolder, err := authSession.Finder.DefaultFolder(vmContext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			folder, err := defaultFolder.CreateFolder(vmContext, "drifted")
+			if err != nil {
+				t.Fatal(err)
+			}
+			task, err := folder.MoveInto(vmContext, []types.ManagedObjectReference{vm.Reference()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := task.Wait(vmContext); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := &virtualMachineContext{
+				VMContext: *vmContext,
+				Obj:       obj,
+				Ref:       vm.Reference(),
+				State:     &infrav1.VirtualMachine{},
+			}
+
+			vms := &VMService{}
+			for i := 0; ; i++ {
+				if i == 5 {
+					t.Fatal("drift was not reconciled")
+				}
+				ok, err := vms.reconcileDrift(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok {
+					break
+				}
+				task := object.NewTask(authSession.Client.Client, types.ManagedObjectReference{Type: morefTypeTask, Value: ctx.VSphereVM.Status.TaskRef})
+				if err := task.Wait(ctx); err != nil {
+					t.Fatal(err)
+				}
+				ctx.VSphereVM.Status.TaskRef = ""
+			}
+
+			var fields []string
+			for _, d := range ctx.VSphereVM.Status.Drift {
+				fields = append(fields, d.Field)
+			}
+			if len(fields) != len(tc.expectedFields) {
+				t.Fatalf("expected drifted fields %v, got %v", tc.expectedFields, fields)
+			}
+			for i := range fields {
+				if fields[i] != tc.expectedFields[i] {
+					t.Fatalf("expected drifted fields %v, got %v", tc.expectedFields, fields)
+				}
+			}
+
+			var drifted corev1.ConditionStatus
+			if c := util.GetCondition(ctx.VSphereVM.Status.Conditions, infrav1.DriftedCondition); c != nil {
+				drifted = c.Status
+			}
+			if drifted != tc.expectedDrifted {
+				t.Errorf("expected Drifted condition %q, got %q", tc.expectedDrifted, drifted)
+			}
+		})
+	}
+}
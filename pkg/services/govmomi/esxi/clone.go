@@ -19,10 +19,11 @@ package esxi
 import (
 	"github.com/pkg/errors"
 
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 )
 
 // Clone kicks off a clone operation on ESXi to create a new virtual machine.
-func Clone(ctx *context.VMContext, bootstrapData []byte) error {
+func Clone(ctx *context.VMContext, bootstrapData []byte, bootstrapFormat infrav1.BootstrapFormat) error {
 	return errors.New("temporarily disabled esxi support")
 }
@@ -17,30 +17,159 @@ limitations under the License.
 package extra
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/base64"
+	"fmt"
 
+	"github.com/pkg/errors"
 	"github.com/vmware/govmomi/vim25/types"
 )
 
+const (
+	// GzipThreshold is the size, in bytes, of the base64-encoded cloud init
+	// user data above which the user data is gzipped before it is encoded.
+	GzipThreshold = 16 * 1024
+
+	// MaxValueSize is the maximum size, in bytes, of an encoded value
+	// assigned to a guestinfo key.
+	MaxValueSize = 64 * 1024
+
+	// OwnerKey is the key whose value is the namespace and name, in the form
+	// NAMESPACE/NAME, of the VSphereVM for which a VM was created.
+	OwnerKey = "capv.vspherevm"
+
+	// OwnerUIDKey is the key whose value is the UID of the VSphereVM for
+	// which a VM was created.
+	OwnerUIDKey = "capv.vspherevm.uid"
+
+	// ManagementClusterIDKey is the key whose value is the ID of the
+	// management cluster whose controller manager created or adopted a VM.
+	ManagementClusterIDKey = "capv.managementcluster.id"
+
+	// CloneModeKey is the key whose value is the type of clone operation
+	// used to create a VM.
+	CloneModeKey = "capv.clonemode"
+
+	// SnapshotKey is the key whose value is the MoRef of the snapshot from
+	// which a VM was linked cloned.
+	SnapshotKey = "capv.snapshot"
+
+	// AdoptedKey is the key whose value is "true" if a VM was adopted
+	// instead of being cloned.
+	AdoptedKey = "capv.adopted"
+
+	// ImageOwnerUIDKey is the key whose value is the UID of the VSphereImage
+	// for which a VM was imported.
+	ImageOwnerUIDKey = "capv.vsphereimage.uid"
+)
+
+// ValueTooLargeError is returned when an encoded value is larger than
+// MaxValueSize.
+type ValueTooLargeError struct {
+	// Key is the guestinfo key.
+	Key string
+
+	// Size is the size, in bytes, of the encoded value.
+	Size int
+}
+
+func (e ValueTooLargeError) Error() string {
+	return fmt.Sprintf(
+		"the encoded value of %s is %d bytes, which exceeds the maximum guestinfo value size of %d bytes",
+		e.Key, e.Size, MaxValueSize)
+}
+
+// IsValueTooLarge returns true if the cause of the error is a
+// ValueTooLargeError.
+func IsValueTooLarge(err error) bool {
+	switch errors.Cause(err).(type) {
+	case ValueTooLargeError, *ValueTooLargeError:
+		return true
+	default:
+		return false
+	}
+}
+
 // Config is data used with a VM's guestInfo RPC interface.
 type Config []types.BaseOptionValue
 
 // SetCloudInitUserData sets the cloud init user data at the key
-// "guestinfo.userdata" as a base64-encoded string.
+// "guestinfo.userdata" as a base64-encoded string. User data whose encoded
+// size exceeds GzipThreshold is gzipped before it is encoded, and a
+// ValueTooLargeError is returned if the encoded size still exceeds
+// MaxValueSize.
 func (e *Config) SetCloudInitUserData(data []byte) error {
+	value, encoding := e.encode(data), "base64"
+	if len(value) > GzipThreshold {
+		var err error
+		if value, err = e.encodeGzip(data); err != nil {
+			return errors.Wrap(err, "failed to gzip cloud init user data")
+		}
+		encoding = "gzip+base64"
+	}
+	if len(value) > MaxValueSize {
+		return ValueTooLargeError{Key: "guestinfo.userdata", Size: len(value)}
+	}
 	*e = append(*e,
 		&types.OptionValue{
 			Key:   "guestinfo.userdata",
-			Value: e.encode(data),
+			Value: value,
 		},
 		&types.OptionValue{
 			Key:   "guestinfo.userdata.encoding",
-			Value: "base64",
+			Value: encoding,
 		},
 	)
 	return nil
 }
 
+// SetOwner sets the namespace, name and UID of the VSphereVM for which the VM
+// is created, and the ID of the management cluster that manages the
+// VSphereVM, at the keys OwnerKey, OwnerUIDKey and ManagementClusterIDKey.
+// The keys are not guestinfo keys, so they are not available to the guest.
+func (e *Config) SetOwner(namespace, name, uid, managementClusterID string) {
+	*e = append(*e,
+		&types.OptionValue{
+			Key:   OwnerKey,
+			Value: namespace + "/" + name,
+		},
+		&types.OptionValue{
+			Key:   OwnerUIDKey,
+			Value: uid,
+		},
+		&types.OptionValue{
+			Key:   ManagementClusterIDKey,
+			Value: managementClusterID,
+		},
+	)
+}
+
+// SetCloneMode sets the type of clone operation used to create the VM and
+// the snapshot from which it was linked cloned at the keys CloneModeKey and
+// SnapshotKey. The keys allow a VSphereVM's status to be rebuilt from the VM,
+// such as after the VSphereVM is moved to another management cluster.
+func (e *Config) SetCloneMode(cloneMode, snapshot string) {
+	*e = append(*e,
+		&types.OptionValue{
+			Key:   CloneModeKey,
+			Value: cloneMode,
+		},
+		&types.OptionValue{
+			Key:   SnapshotKey,
+			Value: snapshot,
+		},
+	)
+}
+
+// SetAdopted records at the key AdoptedKey that the VM was adopted.
+func (e *Config) SetAdopted() {
+	*e = append(*e, &types.OptionValue{
+		Key:   AdoptedKey,
+		Value: "true",
+	})
+}
+
 // SetCloudInitMetadata sets the cloud init user data at the key
 // "guestinfo.metadata" as a base64-encoded string.
 func (e *Config) SetCloudInitMetadata(data []byte) error {
@@ -58,6 +187,23 @@ func (e *Config) SetCloudInitMetadata(data []byte) error {
 	return nil
 }
 
+// SetIgnitionConfigData sets the Ignition config at the key
+// "guestinfo.ignition.config.data" as a base64-encoded string.
+func (e *Config) SetIgnitionConfigData(data []byte) error {
+	*e = append(*e,
+		&types.OptionValue{
+			Key:   "guestinfo.ignition.config.data",
+			Value: e.encode(data),
+		},
+		&types.OptionValue{
+			Key:   "guestinfo.ignition.config.data.encoding",
+			Value: "base64",
+		},
+	)
+
+	return nil
+}
+
 // encode first attempts to decode the data as many times as necessary
 // to ensure it is plain-text before returning the result as a base64
 // encoded string
@@ -65,12 +211,34 @@ func (e *Config) encode(data []byte) string {
 	if len(data) == 0 {
 		return ""
 	}
+	return base64.StdEncoding.EncodeToString(e.decode(data))
+}
+
+// encodeGzip is like encode, but gzips the plain-text data before it is
+// encoded.
+func (e *Config) encodeGzip(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(e.decode(data)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decode decodes the data as many times as necessary to ensure it is
+// plain-text.
+func (e *Config) decode(data []byte) []byte {
 	for {
 		decoded, err := base64.StdEncoding.DecodeString(string(data))
 		if err != nil {
-			break
+			return data
 		}
 		data = decoded
 	}
-	return base64.StdEncoding.EncodeToString(data)
 }
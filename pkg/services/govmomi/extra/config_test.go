@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extra
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestSetCloudInitUserData(t *testing.T) {
+	randomData := func(n int) []byte {
+		data := make([]byte, n)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	testCases := []struct {
+		name             string
+		data             []byte
+		expectedEncoding string
+		expectedErr      bool
+	}{
+		{
+			name:             "small user data",
+			data:             []byte("#cloud-config\n"),
+			expectedEncoding: "base64",
+		},
+		{
+			name:             "base64-encoded small user data",
+			data:             []byte(base64.StdEncoding.EncodeToString([]byte("#cloud-config\n"))),
+			expectedEncoding: "base64",
+		},
+		{
+			name:             "large user data",
+			data:             bytes.Repeat([]byte("#cloud-config\n"), MaxValueSize),
+			expectedEncoding: "gzip+base64",
+		},
+		{
+			name:        "large user data that does not compress",
+			data:        randomData(MaxValueSize),
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var config Config
+			err := config.SetCloudInitUserData(tc.data)
+			if tc.expectedErr {
+				if !IsValueTooLarge(err) {
+					t.Fatalf("expected a ValueTooLargeError, got %v", err)
+				}
+				if len(config) != 0 {
+					t.Fatalf("expected no config, got %d values", len(config))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(config) != 2 {
+				t.Fatalf("expected 2 config values, got %d", len(config))
+			}
+			value := config[0].(*types.OptionValue).Value.(string)
+			if encoding := config[1].(*types.OptionValue).Value; encoding != tc.expectedEncoding {
+				t.Fatalf("expected encoding %q, got %q", tc.expectedEncoding, encoding)
+			}
+
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expectedEncoding == "gzip+base64" {
+				r, err := gzip.NewReader(bytes.NewReader(decoded))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decoded, err = ioutil.ReadAll(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if expected := config.decode(tc.data); !bytes.Equal(expected, decoded) {
+				t.Fatal("decoded user data does not match")
+			}
+		})
+	}
+}
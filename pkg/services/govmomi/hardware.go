@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+// reconcileHardware records the VM's virtual hardware and, if the VM's
+// HardwareUpdatePolicy is inPlace or its DriftPolicy is remediate, applies
+// changes to the number of CPUs and the size of memory. False is returned
+// while an update is in progress.
+func (vms *VMService) reconcileHardware(ctx *virtualMachineContext) (bool, error) {
+	var obj mo.VirtualMachine
+	if err := ctx.Obj.Properties(ctx, ctx.Ref, []string{"config.hardware", "config.cpuHotAddEnabled", "config.memoryHotAddEnabled", "runtime.powerState"}, &obj); err != nil {
+		return false, errors.Wrapf(err, "unable to get hardware for vm %s", ctx)
+	}
+	if obj.Config == nil {
+		return false, errors.Errorf("unable to get hardware for vm %s: missing config", ctx)
+	}
+
+	observed := infrav1.VirtualMachineHardware{
+		NumCPUs:           obj.Config.Hardware.NumCPU,
+		NumCoresPerSocket: obj.Config.Hardware.NumCoresPerSocket,
+		MemoryMiB:         int64(obj.Config.Hardware.MemoryMB),
+	}
+	ctx.VSphereVM.Status.Hardware = &observed
+
+	// Drift of the hardware is remediated the same way as an in-place update,
+	// except for instant clones, which inherit the hardware of their source.
+	remediateDrift := ctx.VSphereVM.Spec.DriftPolicy == infrav1.DriftPolicyRemediate &&
+		ctx.VSphereVM.Status.CloneMode != infrav1.InstantClone
+	if ctx.VSphereVM.Spec.HardwareUpdatePolicy != infrav1.HardwareUpdatePolicyInPlace && !remediateDrift {
+		ctx.VSphereVM.Status.HardwareUpdate = nil
+		return true, nil
+	}
+
+	target := getTargetHardware(ctx.VSphereVM.Spec.VirtualMachineCloneSpec, observed)
+	update := ctx.VSphereVM.Status.HardwareUpdate
+
+	// If the VM's hardware matches the target then any update that was in
+	// progress has succeeded.
+	if target == observed {
+		if update != nil && update.State != infrav1.HardwareUpdateStateSucceeded && update.State != infrav1.HardwareUpdateStateFailed {
+			ctx.Logger.Info("hardware updated", "hardware", observed)
+			ctx.Recorder.Eventf(ctx.VSphereVM, "HardwareUpdated",
+				"Updated hardware to %d CPUs, %d cores per socket and %d MiB of memory",
+				observed.NumCPUs, observed.NumCoresPerSocket, observed.MemoryMiB)
+			update.State = infrav1.HardwareUpdateStateSucceeded
+			update.Message = ""
+		}
+		return true, nil
+	}
+
+	// Determine whether a previous attempt to apply the same target failed.
+	var hotAddFailed bool
+	if update != nil && update.Target == target {
+		switch update.State {
+		case infrav1.HardwareUpdateStateFailed:
+			return true, nil
+		case infrav1.HardwareUpdateStateHotAdd:
+			ctx.Logger.Info("hot-add did not apply the target hardware, falling back to power cycle", "target", target)
+			hotAddFailed = true
+		case infrav1.HardwareUpdateStateReconfigure:
+			update.State = infrav1.HardwareUpdateStateFailed
+			update.Message = "the powered-off VM was reconfigured but its hardware does not match the target"
+			ctx.Logger.Info("hardware update failed", "target", target, "hardware", observed)
+			ctx.Recorder.Warn(ctx.VSphereVM, "HardwareUpdateFailed", update.Message)
+			return true, nil
+		}
+	}
+
+	ctx.VSphereVM.Status.HardwareUpdate = &infrav1.HardwareUpdateStatus{Target: target}
+	update = ctx.VSphereVM.Status.HardwareUpdate
+
+	switch obj.Runtime.PowerState {
+	case types.VirtualMachinePowerStatePoweredOn:
+		if !hotAddFailed && canHotAdd(obj.Config, observed, target) {
+			update.State = infrav1.HardwareUpdateStateHotAdd
+			ctx.Logger.Info("hot-adding hardware", "target", target, "hardware", observed)
+			ctx.Recorder.Eventf(ctx.VSphereVM, "HardwareUpdate",
+				"Hot-adding hardware to reach %d CPUs and %d MiB of memory",
+				target.NumCPUs, target.MemoryMiB)
+			return false, vms.reconfigureHardware(ctx, target)
+		}
+
+		update.State = infrav1.HardwareUpdateStatePowerOff
+		ctx.Logger.Info("powering off to update hardware", "target", target, "hardware", observed)
+		if ctx.VSphereVM.Status.GuestShutdownTime == nil {
+			ctx.Recorder.Event(ctx.VSphereVM, "HardwareUpdate", "Powering off VM to update hardware")
+		}
+		_, err := vms.powerOffVM(ctx)
+		return false, err
+
+	case types.VirtualMachinePowerStatePoweredOff:
+		update.State = infrav1.HardwareUpdateStateReconfigure
+		ctx.Logger.Info("reconfiguring hardware", "target", target, "hardware", observed)
+		ctx.Recorder.Eventf(ctx.VSphereVM, "HardwareUpdate",
+			"Reconfiguring hardware to %d CPUs, %d cores per socket and %d MiB of memory",
+			target.NumCPUs, target.NumCoresPerSocket, target.MemoryMiB)
+		return false, vms.reconfigureHardware(ctx, target)
+
+	default:
+		// A suspended VM cannot be reconfigured, so the update is deferred
+		// until the VM is powered on or off.
+		ctx.VSphereVM.Status.HardwareUpdate = nil
+		ctx.Logger.Info("skipping hardware update", "reason", "power-state", "power-state", obj.Runtime.PowerState)
+		return true, nil
+	}
+}
+
+func (vms *VMService) reconfigureHardware(ctx *virtualMachineContext, target infrav1.VirtualMachineHardware) error {
+	spec := types.VirtualMachineConfigSpec{
+		NumCPUs:           target.NumCPUs,
+		NumCoresPerSocket: target.NumCoresPerSocket,
+		MemoryMB:          target.MemoryMiB,
+	}
+	task, err := ctx.Obj.Reconfigure(ctx, spec)
+	if err != nil {
+		return errors.Wrapf(err, "failed to trigger reconfigure op for vm %s", ctx)
+	}
+	ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+	ctx.Logger.Info("wait for VM to be reconfigured")
+	return nil
+}
+
+// getTargetHardware returns the hardware described by the clone spec. Fields
+// that are not set in the clone spec default to the observed hardware, and
+// the remaining fields are defaulted the same way they are when the VM is
+// cloned.
+func getTargetHardware(
+	spec infrav1.VirtualMachineCloneSpec,
+	observed infrav1.VirtualMachineHardware) infrav1.VirtualMachineHardware {
+
+	target := observed
+	if spec.NumCPUs > 0 {
+		target.NumCPUs = spec.NumCPUs
+		if target.NumCPUs < 2 {
+			target.NumCPUs = 2
+		}
+		target.NumCoresPerSocket = target.NumCPUs
+	}
+	if spec.NumCoresPerSocket > 0 {
+		target.NumCoresPerSocket = spec.NumCoresPerSocket
+	}
+	if spec.MemoryMiB > 0 {
+		target.MemoryMiB = spec.MemoryMiB
+	}
+	return target
+}
+
+// canHotAdd returns true if the VM's hardware may be updated to the target
+// while the VM is powered on. Only increases to the number of CPUs and size
+// of memory are supported, and only if hot-add is enabled for them.
+func canHotAdd(
+	config *types.VirtualMachineConfigInfo,
+	observed, target infrav1.VirtualMachineHardware) bool {
+
+	if target.NumCoresPerSocket != observed.NumCoresPerSocket {
+		return false
+	}
+	if target.NumCPUs != observed.NumCPUs {
+		if target.NumCPUs < observed.NumCPUs || config.CpuHotAddEnabled == nil || !*config.CpuHotAddEnabled {
+			return false
+		}
+	}
+	if target.MemoryMiB != observed.MemoryMiB {
+		if target.MemoryMiB < observed.MemoryMiB || config.MemoryHotAddEnabled == nil || !*config.MemoryHotAddEnabled {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+func TestReconcileHardware(t *testing.T) {
+	testCases := []struct {
+		name           string
+		hotAdd         bool
+		expectedStates []infrav1.HardwareUpdateState
+		expectedPower  types.VirtualMachinePowerState
+	}{
+		{
+			name:   "hot-add",
+			hotAdd: true,
+			expectedStates: []infrav1.HardwareUpdateState{
+				infrav1.HardwareUpdateStateHotAdd,
+				infrav1.HardwareUpdateStateSucceeded,
+			},
+			expectedPower: types.VirtualMachinePowerStatePoweredOn,
+		},
+		{
+			name: "power cycle",
+			expectedStates: []infrav1.HardwareUpdateState{
+				infrav1.HardwareUpdateStatePowerOff,
+				infrav1.HardwareUpdateStateReconfigure,
+				infrav1.HardwareUpdateStateSucceeded,
+			},
+			expectedPower: types.VirtualMachinePowerStatePoweredOff,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := vcsim.New(t)
+			defer sim.Destroy()
+
+			vmContext := sim.NewVMContext(t)
+			vmContext.VSphereVM.Spec.HardwareUpdatePolicy = infrav1.HardwareUpdatePolicyInPlace
+			vmContext.VSphereVM.Spec.NumCPUs = 4
+			vmContext.VSphereVM.Spec.NumCoresPerSocket = 1
+			vmContext.VSphereVM.Spec.MemoryMiB = 4096
+
+			authSession := vmContext.Session
+
+			vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+			obj := object.NewVirtualMachine(authSession.Client.Client, vm.Reference())
+			task, err := obj.Reconfigure(vmContext, types.VirtualMachineConfigSpec{
+				CpuHotAddEnabled:    &tc.hotAdd,
+				MemoryHotAddEnabled: &tc.hotAdd,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := task.Wait(vmContext); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := &virtualMachineContext{
+				VMContext: *vmContext,
+				Obj:       obj,
+				Ref:       vm.Reference(),
+				State:     &infrav1.VirtualMachine{},
+			}
+
+			vms := &VMService{}
+			for i, expectedState := range tc.expectedStates {
+				ok, err := vms.reconcileHardware(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if state := ctx.VSphereVM.Status.HardwareUpdate.State; state != expectedState {
+					t.Fatalf("step %d: expected state %q, got %q", i, expectedState, state)
+				}
+				if ok != (expectedState == infrav1.HardwareUpdateStateSucceeded) {
+					t.Fatalf("step %d: unexpected result %v", i, ok)
+				}
+				if taskRef := ctx.VSphereVM.Status.TaskRef; taskRef != "" {
+					task := object.NewTask(authSession.Client.Client, types.ManagedObjectReference{Type: morefTypeTask, Value: taskRef})
+					if err := task.Wait(ctx); err != nil {
+						t.Fatal(err)
+					}
+					ctx.VSphereVM.Status.TaskRef = ""
+				}
+			}
+
+			expectedHardware := infrav1.VirtualMachineHardware{NumCPUs: 4, NumCoresPerSocket: 1, MemoryMiB: 4096}
+			if hw := *ctx.VSphereVM.Status.Hardware; hw != expectedHardware {
+				t.Errorf("expected hardware %+v, got %+v", expectedHardware, hw)
+			}
+			powerState, err := obj.PowerState(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if powerState != tc.expectedPower {
+				t.Errorf("expected power state %q, got %q", tc.expectedPower, powerState)
+			}
+		})
+	}
+}
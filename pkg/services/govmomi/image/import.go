@@ -0,0 +1,324 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/nfc"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+)
+
+// SnapshotName is the name of the snapshot created on an imported template.
+const SnapshotName = "capv-image"
+
+// Result is the outcome of a successful import.
+type Result struct {
+	// InstanceUUID is the instance UUID of the created template.
+	InstanceUUID string
+
+	// Snapshot is the name of the template's snapshot.
+	Snapshot string
+
+	// Checksum is the SHA-256 checksum of the imported content.
+	Checksum string
+}
+
+// TemplateName returns the name of the template created for the image.
+func TemplateName(ctx *context.ImageContext) string {
+	if name := ctx.VSphereImage.Spec.TemplateName; name != "" {
+		return name
+	}
+	return ctx.VSphereImage.Name
+}
+
+// Import imports the OVA or OVF described by the context's VSphereImage,
+// snapshots the resulting VM and marks it as a template. The onProgress
+// function is invoked with the percentage of the image's content that has
+// been uploaded.
+func Import(ctx *context.ImageContext, onProgress func(int32)) (Result, error) {
+	ctx.Logger.Info("opening image source")
+	src, err := openSource(ctx, ctx.VSphereImage.Spec.Source)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "unable to open image source for %s", ctx)
+	}
+	defer src.Close()
+
+	checksum := src.Checksum()
+	if expected := ctx.VSphereImage.Spec.Checksum; expected != "" && expected != checksum {
+		return Result{}, errors.Errorf("checksum mismatch for %s: expected %q, actual %q", ctx, expected, checksum)
+	}
+
+	descriptor, err := src.Descriptor()
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "unable to read ovf descriptor for %s", ctx)
+	}
+
+	folder, err := ctx.Session.Finder.FolderOrDefault(ctx, ctx.VSphereImage.Spec.Folder)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "unable to get folder for %s", ctx)
+	}
+
+	datastore, err := ctx.Session.Finder.DatastoreOrDefault(ctx, ctx.VSphereImage.Spec.Datastore)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "unable to get datastore for %s", ctx)
+	}
+
+	pool, err := ctx.Session.Finder.ResourcePoolOrDefault(ctx, ctx.VSphereImage.Spec.ResourcePool)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "unable to get resource pool for %s", ctx)
+	}
+
+	networkMapping, err := getNetworkMapping(ctx, descriptor)
+	if err != nil {
+		return Result{}, err
+	}
+
+	templateName := TemplateName(ctx)
+	cisp := types.OvfCreateImportSpecParams{
+		EntityName:     templateName,
+		NetworkMapping: networkMapping,
+	}
+	spec, err := ovf.NewManager(ctx.Session.Client.Client).CreateImportSpec(ctx, string(descriptor), pool, datastore, cisp)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "unable to create import spec for %s", ctx)
+	}
+	if spec.Error != nil {
+		return Result{}, errors.Errorf("invalid import spec for %s: %s", ctx, spec.Error[0].LocalizedMessage)
+	}
+
+	// The VM is tagged with the image's UID so a VM left over from an import
+	// that did not complete, ex. because the controller restarted, is
+	// replaced by the next import of the image.
+	if vmSpec, ok := spec.ImportSpec.(*types.VirtualMachineImportSpec); ok {
+		vmSpec.ConfigSpec.ExtraConfig = append(vmSpec.ConfigSpec.ExtraConfig, &types.OptionValue{
+			Key:   extra.ImageOwnerUIDKey,
+			Value: string(ctx.VSphereImage.UID),
+		})
+	}
+
+	ctx.Logger.Info("importing image", "templateName", templateName)
+	lease, err := pool.ImportVApp(ctx, spec.ImportSpec, folder, nil)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "unable to import image for %s", ctx)
+	}
+
+	info, err := lease.Wait(ctx, spec.FileItem)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "error waiting on nfc lease for %s", ctx)
+	}
+
+	vm := object.NewVirtualMachine(ctx.Session.Client.Client, info.Entity)
+	if err := completeImport(ctx, src, lease, info, vm, onProgress); err != nil {
+		// The VM is not a template until the import completes, and would
+		// otherwise prevent the image from being imported again.
+		if destroyErr := DestroyVM(ctx, vm); destroyErr != nil {
+			ctx.Logger.Error(destroyErr, "failed to destroy partially imported vm")
+		}
+		return Result{}, err
+	}
+
+	var obj mo.VirtualMachine
+	if err := vm.Properties(ctx, vm.Reference(), []string{"config.instanceUuid"}, &obj); err != nil {
+		return Result{}, errors.Wrapf(err, "unable to get instance uuid of template for %s", ctx)
+	}
+
+	return Result{
+		InstanceUUID: obj.Config.InstanceUuid,
+		Snapshot:     SnapshotName,
+		Checksum:     checksum,
+	}, nil
+}
+
+// completeImport uploads the image's files, snapshots the imported VM and
+// marks it as a template.
+func completeImport(ctx *context.ImageContext, src source, lease *nfc.Lease, info *nfc.LeaseInfo, vm *object.VirtualMachine, onProgress func(int32)) error {
+	if err := upload(ctx, src, lease, info, onProgress); err != nil {
+		if abortErr := lease.Abort(ctx, nil); abortErr != nil {
+			ctx.Logger.Error(abortErr, "failed to abort nfc lease")
+		}
+		return errors.Wrapf(err, "unable to upload image for %s", ctx)
+	}
+
+	if err := lease.Complete(ctx); err != nil {
+		return errors.Wrapf(err, "unable to complete nfc lease for %s", ctx)
+	}
+
+	ctx.Logger.Info("creating snapshot", "snapshot", SnapshotName)
+	snapshotTask, err := vm.CreateSnapshot(ctx, SnapshotName, ctx.String(), false, false)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create snapshot for %s", ctx)
+	}
+	if err := snapshotTask.Wait(ctx); err != nil {
+		return errors.Wrapf(err, "error waiting on snapshot task for %s", ctx)
+	}
+
+	ctx.Logger.Info("marking vm as template")
+	if err := vm.MarkAsTemplate(ctx); err != nil {
+		return errors.Wrapf(err, "unable to mark vm as template for %s", ctx)
+	}
+	return nil
+}
+
+// IsPartialImport returns true if the VM is not a template and was imported
+// for the context's VSphereImage, i.e. the VM is left over from an import of
+// the image that did not complete.
+func IsPartialImport(ctx *context.ImageContext, config *types.VirtualMachineConfigInfo) bool {
+	if config == nil || config.Template {
+		return false
+	}
+	for _, ec := range config.ExtraConfig {
+		if optVal := ec.GetOptionValue(); optVal != nil && optVal.Key == extra.ImageOwnerUIDKey {
+			return optVal.Value == string(ctx.VSphereImage.UID)
+		}
+	}
+	return false
+}
+
+// DestroyVM destroys a VM created by an import. A VM that no longer exists,
+// ex. because vSphere removed it when the import's lease was aborted, is not
+// an error.
+func DestroyVM(ctx *context.ImageContext, vm *object.VirtualMachine) error {
+	ctx.Logger.Info("destroying partially imported vm", "vm", vm.Reference())
+	destroyTask, err := vm.Destroy(ctx)
+	if err == nil {
+		err = destroyTask.Wait(ctx)
+	}
+	if err != nil {
+		if isManagedObjectNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "unable to destroy vm %s for %s", vm.Reference(), ctx)
+	}
+	return nil
+}
+
+func isManagedObjectNotFound(err error) bool {
+	if soap.IsSoapFault(err) {
+		_, ok := soap.ToSoapFault(err).VimFault().(types.ManagedObjectNotFound)
+		return ok
+	}
+	if taskErr, ok := err.(task.Error); ok {
+		_, ok := taskErr.Fault().(*types.ManagedObjectNotFound)
+		return ok
+	}
+	return false
+}
+
+// getNetworkMapping maps each of the networks in the descriptor to the
+// image's network. An empty mapping is returned when the image does not
+// specify a network.
+func getNetworkMapping(ctx *context.ImageContext, descriptor []byte) ([]types.OvfNetworkMapping, error) {
+	if ctx.VSphereImage.Spec.Network == "" {
+		return nil, nil
+	}
+	network, err := ctx.Session.Finder.Network(ctx, ctx.VSphereImage.Spec.Network)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find network %q for %s", ctx.VSphereImage.Spec.Network, ctx)
+	}
+	env, err := ovf.Unmarshal(bytes.NewReader(descriptor))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse ovf descriptor for %s", ctx)
+	}
+	if env.Network == nil {
+		return nil, nil
+	}
+	mappings := make([]types.OvfNetworkMapping, len(env.Network.Networks))
+	for i, n := range env.Network.Networks {
+		mappings[i] = types.OvfNetworkMapping{
+			Name:    n.Name,
+			Network: network.Reference(),
+		}
+	}
+	return mappings, nil
+}
+
+// upload sends each of the files requested by the lease to vSphere.
+func upload(ctx *context.ImageContext, src source, lease *nfc.Lease, info *nfc.LeaseInfo, onProgress func(int32)) error {
+	updater := lease.StartUpdater(ctx, info)
+	defer updater.Done()
+
+	var total int64
+	for _, item := range info.Items {
+		total += item.Size
+	}
+	counter := &progressCounter{total: total, onProgress: onProgress}
+
+	for _, item := range info.Items {
+		ctx.Logger.V(4).Info("uploading file", "path", item.Path)
+		r, size, err := src.Open(item.Path)
+		if err != nil {
+			return errors.Wrapf(err, "unable to open %q", item.Path)
+		}
+		err = lease.Upload(ctx, item, &countingReader{Reader: r, counter: counter}, soap.Upload{ContentLength: size})
+		r.Close()
+		if err != nil {
+			return errors.Wrapf(err, "unable to upload %q", item.Path)
+		}
+	}
+	counter.report(100)
+	return nil
+}
+
+// progressCounter tracks the number of bytes uploaded and reports the
+// percentage of the total each time it changes.
+type progressCounter struct {
+	total      int64
+	read       int64
+	percent    int32
+	onProgress func(int32)
+}
+
+func (c *progressCounter) add(n int64) {
+	if c.total <= 0 {
+		return
+	}
+	percent := int32(atomic.AddInt64(&c.read, n) * 100 / c.total)
+	if percent > 99 {
+		// The import is not complete until the lease is completed.
+		percent = 99
+	}
+	c.report(percent)
+}
+
+func (c *progressCounter) report(percent int32) {
+	if atomic.SwapInt32(&c.percent, percent) != percent && c.onProgress != nil {
+		c.onProgress(percent)
+	}
+}
+
+type countingReader struct {
+	io.Reader
+	counter *progressCounter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.counter.add(int64(n))
+	return n, err
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/mo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+const testOVF = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData">
+  <References/>
+  <NetworkSection>
+    <Info>The list of logical networks</Info>
+    <Network ovf:name="nat">
+      <Description>The nat network</Description>
+    </Network>
+  </NetworkSection>
+  <VirtualSystem ovf:id="capv-test">
+    <Info>A virtual machine</Info>
+    <Name>capv-test</Name>
+    <OperatingSystemSection ovf:id="100">
+      <Info>The kind of installed guest operating system</Info>
+    </OperatingSystemSection>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemIdentifier>capv-test</vssd:VirtualSystemIdentifier>
+        <vssd:VirtualSystemType>vmx-13</vssd:VirtualSystemType>
+      </System>
+      <Item>
+        <rasd:AllocationUnits>hertz * 10^6</rasd:AllocationUnits>
+        <rasd:Description>Number of Virtual CPUs</rasd:Description>
+        <rasd:ElementName>1 virtual CPU(s)</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>1</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AllocationUnits>byte * 2^20</rasd:AllocationUnits>
+        <rasd:Description>Memory Size</rasd:Description>
+        <rasd:ElementName>32MB of memory</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceType>4</rasd:ResourceType>
+        <rasd:VirtualQuantity>32</rasd:VirtualQuantity>
+      </Item>
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>
+`
+
+// testOVFWithISO is testOVF with a CD-ROM backed by an ISO that is not in
+// the OVA, so the upload fails once the VM is created.
+var testOVFWithISO = strings.NewReplacer(
+	"<References/>", `<References>
+    <File ovf:href="capv-test.iso" ovf:id="file1" ovf:size="1"/>
+  </References>`,
+	"    </VirtualHardwareSection>", `      <Item>
+        <rasd:Address>0</rasd:Address>
+        <rasd:ElementName>IDE Controller 0</rasd:ElementName>
+        <rasd:InstanceID>3</rasd:InstanceID>
+        <rasd:ResourceType>5</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:ElementName>CD/DVD drive 1</rasd:ElementName>
+        <rasd:HostResource>ovf:/file/file1</rasd:HostResource>
+        <rasd:InstanceID>4</rasd:InstanceID>
+        <rasd:Parent>3</rasd:Parent>
+        <rasd:ResourceType>15</rasd:ResourceType>
+      </Item>
+    </VirtualHardwareSection>`,
+).Replace(testOVF)
+
+func newTestOVA(t *testing.T, descriptor string) []byte {
+	buf := &bytes.Buffer{}
+	w := tar.NewWriter(buf)
+	if err := w.WriteHeader(&tar.Header{Name: "capv-test.ovf", Mode: 0644, Size: int64(len(descriptor))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(descriptor)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestImageContext(t *testing.T, server, imageURL string) *context.ImageContext {
+	controllerCtx := fake.NewControllerContext(fake.NewControllerManagerContext())
+	ctx := &context.ImageContext{
+		ControllerContext: controllerCtx,
+		VSphereImage: &infrav1.VSphereImage{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: fake.Namespace,
+				Name:      "capv-test-image",
+				UID:       "capv-test-image-uid",
+			},
+			Spec: infrav1.VSphereImageSpec{
+				Source: infrav1.VSphereImageSource{URL: imageURL},
+				Server: server,
+			},
+		},
+		Logger: controllerCtx.Logger,
+	}
+	return ctx
+}
+
+func TestImport(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+
+	ova := newTestOVA(t, testOVF)
+	ovaWithISO := newTestOVA(t, testOVFWithISO)
+	sum := sha256.Sum256(ova)
+	checksum := formatChecksum(sum[:])
+
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/capv-test.ova":
+			_, _ = w.Write(ova)
+		case "/capv-test.ovf":
+			_, _ = w.Write([]byte(testOVF))
+		case "/capv-test-iso.ova":
+			_, _ = w.Write(ovaWithISO)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer images.Close()
+
+	testCases := []struct {
+		name          string
+		url           string
+		templateName  string
+		checksum      string
+		expectedError bool
+	}{
+		{
+			name:         "ova",
+			url:          images.URL + "/capv-test.ova",
+			templateName: "capv-test-ova",
+			checksum:     checksum,
+		},
+		{
+			name:         "ovf",
+			url:          images.URL + "/capv-test.ovf",
+			templateName: "capv-test-ovf",
+		},
+		{
+			name:          "checksum mismatch",
+			url:           images.URL + "/capv-test.ova",
+			templateName:  "capv-test-mismatch",
+			checksum:      "sha256:0000",
+			expectedError: true,
+		},
+		{
+			name:          "not found",
+			url:           images.URL + "/missing.ova",
+			templateName:  "capv-test-missing",
+			expectedError: true,
+		},
+		{
+			name:          "upload failure",
+			url:           images.URL + "/capv-test-iso.ova",
+			templateName:  "capv-test-upload-failure",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := newTestImageContext(t, sim.ServerURL(), tc.url)
+			ctx.VSphereImage.Spec.TemplateName = tc.templateName
+			ctx.VSphereImage.Spec.Checksum = tc.checksum
+
+			authSession := sim.NewSession(t, ctx)
+			ctx.Session = authSession
+
+			var progress int32
+			result, err := Import(ctx, func(p int32) { progress = p })
+			if tc.expectedError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				// A VM created before the import failed is destroyed.
+				if _, err := authSession.Finder.VirtualMachine(ctx, tc.templateName); err == nil {
+					t.Error("expected vm not to exist")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if progress != 100 {
+				t.Errorf("expected progress 100, got %d", progress)
+			}
+			if tc.checksum != "" && result.Checksum != tc.checksum {
+				t.Errorf("expected checksum %q, got %q", tc.checksum, result.Checksum)
+			}
+
+			tpl, err := authSession.Finder.VirtualMachine(ctx, tc.templateName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var obj mo.VirtualMachine
+			if err := tpl.Properties(ctx, tpl.Reference(), []string{"config", "snapshot"}, &obj); err != nil {
+				t.Fatal(err)
+			}
+			if !obj.Config.Template {
+				t.Error("expected vm to be a template")
+			}
+			if obj.Config.InstanceUuid != result.InstanceUUID {
+				t.Errorf("expected instance uuid %q, got %q", obj.Config.InstanceUuid, result.InstanceUUID)
+			}
+			if obj.Snapshot == nil || obj.Snapshot.RootSnapshotList[0].Name != SnapshotName {
+				t.Errorf("expected snapshot %q", SnapshotName)
+			}
+			if IsPartialImport(ctx, obj.Config) {
+				t.Error("expected template not to be a partial import")
+			}
+			obj.Config.Template = false
+			if !IsPartialImport(ctx, obj.Config) {
+				t.Errorf("expected vm to be tagged with the image's uid")
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+// source provides access to the OVF descriptor and the files it references.
+type source interface {
+	// Descriptor returns the OVF descriptor.
+	Descriptor() ([]byte, error)
+
+	// Open returns a reader for the named file referenced by the descriptor
+	// along with the file's size.
+	Open(name string) (io.ReadCloser, int64, error)
+
+	// Checksum returns the SHA-256 checksum of the source's content.
+	Checksum() string
+
+	// Close releases any resources held by the source.
+	Close() error
+}
+
+// openSource returns a source for an OVA or OVF described by the given
+// VSphereImageSource.
+func openSource(ctx context.Context, src infrav1.VSphereImageSource) (source, error) {
+	if src.URL == "" {
+		return nil, errors.New("url must be specified")
+	}
+	u, err := url.Parse(src.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse image url %q", src.URL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("unsupported image url scheme %q", u.Scheme)
+	}
+	if isOVF(u.Path) {
+		return newHTTPSource(ctx, u)
+	}
+	return downloadArchive(ctx, u)
+}
+
+func isOVF(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".ovf")
+}
+
+// archiveSource is an OVA downloaded to a temporary file.
+type archiveSource struct {
+	filePath string
+	checksum string
+}
+
+// downloadArchive downloads an OVA to a temporary file.
+func downloadArchive(ctx context.Context, u *url.URL) (*archiveSource, error) {
+	body, _, err := httpGet(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	f, err := ioutil.TempFile("", "capv-image-*.ova")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary file for image")
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), body); err != nil {
+		os.Remove(f.Name())
+		return nil, errors.Wrapf(err, "failed to download image %q", u)
+	}
+
+	return &archiveSource{
+		filePath: f.Name(),
+		checksum: formatChecksum(h.Sum(nil)),
+	}, nil
+}
+
+func (s *archiveSource) Descriptor() ([]byte, error) {
+	f, err := os.Open(s.filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := tar.NewReader(f)
+	for {
+		hdr, err := r.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil, errors.New("ova does not contain an ovf descriptor")
+			}
+			return nil, errors.Wrap(err, "failed to read ova")
+		}
+		if isOVF(hdr.Name) {
+			return ioutil.ReadAll(r)
+		}
+	}
+}
+
+func (s *archiveSource) Open(name string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(s.filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	r := tar.NewReader(f)
+	for {
+		hdr, err := r.Next()
+		if err != nil {
+			f.Close()
+			if err == io.EOF {
+				return nil, 0, errors.Errorf("ova does not contain %q", name)
+			}
+			return nil, 0, errors.Wrap(err, "failed to read ova")
+		}
+		if path.Clean(hdr.Name) == path.Clean(name) {
+			return readCloser{Reader: r, Closer: f}, hdr.Size, nil
+		}
+	}
+}
+
+func (s *archiveSource) Checksum() string {
+	return s.checksum
+}
+
+func (s *archiveSource) Close() error {
+	return os.Remove(s.filePath)
+}
+
+// httpSource is an OVF served over HTTP. The files referenced by the
+// descriptor are fetched relative to the descriptor's URL.
+type httpSource struct {
+	ctx        context.Context
+	url        *url.URL
+	descriptor []byte
+}
+
+func newHTTPSource(ctx context.Context, u *url.URL) (*httpSource, error) {
+	body, _, err := httpGet(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	descriptor, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download ovf descriptor %q", u)
+	}
+	return &httpSource{ctx: ctx, url: u, descriptor: descriptor}, nil
+}
+
+func (s *httpSource) Descriptor() ([]byte, error) {
+	return s.descriptor, nil
+}
+
+func (s *httpSource) Open(name string) (io.ReadCloser, int64, error) {
+	ref, err := url.Parse(name)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "invalid file reference %q", name)
+	}
+	return httpGet(s.ctx, s.url.ResolveReference(ref))
+}
+
+func (s *httpSource) Checksum() string {
+	sum := sha256.Sum256(s.descriptor)
+	return formatChecksum(sum[:])
+}
+
+func (s *httpSource) Close() error {
+	return nil
+}
+
+func httpGet(ctx context.Context, u *url.URL) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to get %q", u)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, errors.Errorf("failed to get %q: %s", u, resp.Status)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func formatChecksum(sum []byte) string {
+	return "sha256:" + hex.EncodeToString(sum)
+}
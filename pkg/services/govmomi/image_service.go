@@ -0,0 +1,240 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/image"
+)
+
+// imageProgressStep is the number of percentage points the progress of an
+// import must advance before a reconcile event is triggered for the image.
+const imageProgressStep = 10
+
+// imageImports tracks the in-flight imports keyed by the UID of the
+// VSphereImage resource.
+var imageImports sync.Map
+
+// imageImport is the state of an import running in a background goroutine.
+type imageImport struct {
+	sync.Mutex
+	progress int32
+	done     bool
+	result   image.Result
+	err      error
+}
+
+// ImageService provides an API to import images into vSphere using govmomi.
+type ImageService struct{}
+
+// ReconcileImage makes sure the image's template exists by:
+//   1. Updating the image's status from an in-flight or completed import, or...
+//   2. Verifying the template recorded in the image's status exists, or...
+//   3. Adopting an existing template with the image's template name, or
+//      replacing a VM left over from an import that did not complete, or...
+//   4. Starting an import of the image in a background goroutine.
+func (is *ImageService) ReconcileImage(ctx *context.ImageContext) error {
+	status := &ctx.VSphereImage.Status
+
+	if obj, ok := imageImports.Load(ctx.VSphereImage.UID); ok {
+		imp := obj.(*imageImport)
+		imp.Lock()
+		defer imp.Unlock()
+		if !imp.done {
+			ctx.Logger.V(4).Info("import is in flight", "progress", imp.progress)
+			status.Progress = imp.progress
+			return nil
+		}
+		imageImports.Delete(ctx.VSphereImage.UID)
+		if imp.err != nil {
+			errMsg := imp.err.Error()
+			status.ErrorMessage = &errMsg
+			status.Progress = 0
+			return errors.Wrapf(imp.err, "failed to import image for %s", ctx)
+		}
+		status.TemplateInstanceUUID = imp.result.InstanceUUID
+		status.Snapshot = imp.result.Snapshot
+		status.Checksum = imp.result.Checksum
+		status.Progress = 100
+		status.ErrorMessage = nil
+		status.Ready = true
+		ctx.Logger.Info("image imported", "instance-uuid", status.TemplateInstanceUUID)
+		return nil
+	}
+
+	if instanceUUID := status.TemplateInstanceUUID; instanceUUID != "" {
+		ref, err := ctx.Session.FindByInstanceUUID(ctx, instanceUUID)
+		if err != nil {
+			return errors.Wrapf(err, "failed to find template for %s", ctx)
+		}
+		if ref != nil {
+			status.Ready = true
+			return nil
+		}
+		ctx.Logger.Info("template no longer exists", "instance-uuid", instanceUUID)
+		status.Ready = false
+		status.TemplateInstanceUUID = ""
+		status.Snapshot = ""
+		status.Progress = 0
+	}
+
+	templateName := image.TemplateName(ctx)
+	tpl, err := ctx.Session.Finder.VirtualMachine(ctx, templateName)
+	if err != nil {
+		if _, ok := err.(*find.NotFoundError); !ok {
+			return errors.Wrapf(err, "failed to find template %q for %s", templateName, ctx)
+		}
+		startImageImport(ctx)
+		return nil
+	}
+
+	return adoptTemplate(ctx, tpl)
+}
+
+// DeleteImage destroys the template recorded in the image's status.
+func (is *ImageService) DeleteImage(ctx *context.ImageContext) (bool, error) {
+	// Wait for an in-flight import to complete before deleting its result.
+	if obj, ok := imageImports.Load(ctx.VSphereImage.UID); ok {
+		imp := obj.(*imageImport)
+		imp.Lock()
+		defer imp.Unlock()
+		if !imp.done {
+			ctx.Logger.Info("waiting for in-flight import to complete before deleting image")
+			return false, nil
+		}
+		imageImports.Delete(ctx.VSphereImage.UID)
+		if imp.err == nil {
+			ctx.VSphereImage.Status.TemplateInstanceUUID = imp.result.InstanceUUID
+		}
+	}
+
+	instanceUUID := ctx.VSphereImage.Status.TemplateInstanceUUID
+	if instanceUUID == "" {
+		return true, nil
+	}
+	ref, err := ctx.Session.FindByInstanceUUID(ctx, instanceUUID)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to find template for %s", ctx)
+	}
+	if ref == nil {
+		return true, nil
+	}
+
+	ctx.Logger.Info("destroying template", "instance-uuid", instanceUUID)
+	task, err := object.NewVirtualMachine(ctx.Session.Client.Client, ref.Reference()).Destroy(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to trigger destroy op for template for %s", ctx)
+	}
+	if err := task.Wait(ctx); err != nil {
+		return false, errors.Wrapf(err, "failed to destroy template for %s", ctx)
+	}
+	return true, nil
+}
+
+// adoptTemplate records an existing template in the image's status. A VM
+// left over from an import of the image that did not complete is destroyed
+// and the image is imported again.
+func adoptTemplate(ctx *context.ImageContext, tpl *object.VirtualMachine) error {
+	var obj mo.VirtualMachine
+	if err := tpl.Properties(ctx, tpl.Reference(), []string{"config", "snapshot"}, &obj); err != nil {
+		return errors.Wrapf(err, "failed to get properties of template for %s", ctx)
+	}
+	if image.IsPartialImport(ctx, obj.Config) {
+		if err := image.DestroyVM(ctx, tpl); err != nil {
+			return err
+		}
+		startImageImport(ctx)
+		return nil
+	}
+	if obj.Config == nil || !obj.Config.Template {
+		return errors.Errorf("vm %q exists and is not a template for %s", tpl.InventoryPath, ctx)
+	}
+	status := &ctx.VSphereImage.Status
+	status.TemplateInstanceUUID = obj.Config.InstanceUuid
+	status.Snapshot = ""
+	if obj.Snapshot != nil && len(obj.Snapshot.RootSnapshotList) > 0 {
+		status.Snapshot = obj.Snapshot.RootSnapshotList[0].Name
+	}
+	status.Progress = 100
+	status.ErrorMessage = nil
+	status.Ready = true
+	ctx.Logger.Info("adopted existing template", "instance-uuid", status.TemplateInstanceUUID)
+	return nil
+}
+
+// startImageImport imports the image in a background goroutine. A reconcile
+// event is triggered for the image as the import progresses and once it
+// completes.
+func startImageImport(ctx *context.ImageContext) {
+	imp := &imageImport{}
+	if _, loaded := imageImports.LoadOrStore(ctx.VSphereImage.UID, imp); loaded {
+		return
+	}
+
+	// The goroutine outlives the reconcile request, so it operates on a copy
+	// of the resource.
+	ctx = &context.ImageContext{
+		ControllerContext: ctx.ControllerContext,
+		VSphereImage:      ctx.VSphereImage.DeepCopy(),
+		Session:           ctx.Session,
+		Logger:            ctx.Logger.WithName("import"),
+	}
+
+	ctx.Logger.Info("starting import")
+	go func() {
+		var lastProgress int32
+		result, err := image.Import(ctx, func(progress int32) {
+			imp.Lock()
+			imp.progress = progress
+			imp.Unlock()
+			if progress-lastProgress >= imageProgressStep {
+				lastProgress = progress
+				reconcileVSphereImage(ctx, "reason", "progress", "progress", progress)
+			}
+		})
+
+		imp.Lock()
+		imp.done, imp.result, imp.err = true, result, err
+		imp.Unlock()
+
+		if err != nil {
+			ctx.Logger.Error(err, "import failed")
+		}
+		reconcileVSphereImage(ctx, "reason", "import-completed")
+	}()
+}
+
+// reconcileVSphereImage triggers a reconcile event for the image by sending a
+// GenericEvent into the event channel for the resource type.
+func reconcileVSphereImage(ctx *context.ImageContext, loggerKeysAndValues ...interface{}) {
+	obj := ctx.VSphereImage
+	ctx.Logger.Info("triggering GenericEvent", loggerKeysAndValues...)
+	eventChannel := ctx.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereImage"))
+	eventChannel <- event.GenericEvent{
+		Meta:   obj,
+		Object: obj,
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+func TestReconcileImagePartialImport(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+
+	images := httptest.NewServer(http.NotFoundHandler())
+	defer images.Close()
+
+	controllerCtx := fake.NewControllerContext(fake.NewControllerManagerContext())
+	ctx := &context.ImageContext{
+		ControllerContext: controllerCtx,
+		VSphereImage: &infrav1.VSphereImage{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: fake.Namespace,
+				Name:      "capv-test-image",
+				UID:       "capv-test-image-uid",
+			},
+			Spec: infrav1.VSphereImageSpec{
+				Source: infrav1.VSphereImageSource{URL: images.URL + "/capv-test.ova"},
+				Server: sim.ServerURL(),
+			},
+		},
+		Logger: controllerCtx.Logger,
+	}
+	ctx.Session = sim.NewSession(t, ctx)
+
+	// A VM with the template's name that was not imported for the image is
+	// not replaced.
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	ctx.VSphereImage.Spec.TemplateName = vm.Name
+	obj := object.NewVirtualMachine(ctx.Session.Client.Client, vm.Reference())
+	setImageOwner := func(uid string) {
+		task, err := obj.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+			ExtraConfig: []types.BaseOptionValue{
+				&types.OptionValue{Key: extra.ImageOwnerUIDKey, Value: uid},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := task.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An imported VM is powered off.
+	task, err := obj.PowerOff(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	is := &ImageService{}
+	if err := is.ReconcileImage(ctx); err == nil {
+		t.Fatal("expected error for a vm that is not a template")
+	}
+
+	// A VM left over from an import of the image is destroyed and the image
+	// is imported again.
+	setImageOwner(string(ctx.VSphereImage.UID))
+	if err := is.ReconcileImage(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Session.Finder.VirtualMachine(ctx, vm.Name); err == nil {
+		t.Error("expected the partially imported vm to be destroyed")
+	}
+	if _, ok := imageImports.Load(ctx.VSphereImage.UID); !ok {
+		t.Fatal("expected the image to be imported again")
+	}
+
+	// Wait for the import, which fails as the image does not exist, to
+	// complete.
+	eventChannel := ctx.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereImage"))
+	<-eventChannel
+	if err := is.ReconcileImage(ctx); err == nil {
+		t.Error("expected the import to fail")
+	}
+}
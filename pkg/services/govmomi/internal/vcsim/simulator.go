@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vcsim provides a vCenter simulator for the tests of the govmomi
+// services.
+package vcsim
+
+import (
+	goctx "context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/vmware/govmomi/simulator"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// Simulator is a running vCenter simulator.
+type Simulator struct {
+	Model  *simulator.Model
+	Server *simulator.Server
+}
+
+// New creates and starts a vCenter simulator with a single cluster of hosts.
+// The optional funcs may customize the model before it is created. The
+// simulator must be destroyed when the test is done.
+func New(t *testing.T, configure ...func(*simulator.Model)) *Simulator {
+	model := simulator.VPX()
+	model.Host = 0 // ClusterHost only
+	for _, fn := range configure {
+		fn(model)
+	}
+	if err := model.Create(); err != nil {
+		model.Remove()
+		t.Fatal(err)
+	}
+	model.Service.TLS = new(tls.Config)
+	return &Simulator{
+		Model:  model,
+		Server: model.Service.NewServer(),
+	}
+}
+
+// Destroy stops the simulator and removes its model.
+func (s *Simulator) Destroy() {
+	s.Server.Close()
+	s.Model.Remove()
+}
+
+// ServerURL returns the host and port of the simulator.
+func (s *Simulator) ServerURL() string {
+	return s.Server.URL.Host
+}
+
+// Username returns the username of the simulator's user.
+func (s *Simulator) Username() string {
+	return s.Server.URL.User.Username()
+}
+
+// Password returns the password of the simulator's user.
+func (s *Simulator) Password() string {
+	pass, _ := s.Server.URL.User.Password()
+	return pass
+}
+
+// NewSession returns a session for the simulator's default datacenter.
+func (s *Simulator) NewSession(t *testing.T, ctx goctx.Context) *session.Session {
+	authSession, err := session.GetOrCreate(ctx, s.ServerURL(), "", s.Username(), s.Password())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authSession
+}
+
+// NewVMContext returns a fake VMContext for a VSphereVM on the simulator with
+// a session.
+func (s *Simulator) NewVMContext(t *testing.T) *context.VMContext {
+	vmContext := fake.NewVMContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
+	vmContext.VSphereVM.Spec.Server = s.ServerURL()
+	vmContext.Session = s.NewSession(t, vmContext)
+	return vmContext
+}
+
+// NewClusterContext returns a fake ClusterContext with a session on the
+// simulator.
+func (s *Simulator) NewClusterContext(t *testing.T) *context.ClusterContext {
+	clusterContext := fake.NewClusterContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
+	clusterContext.Session = s.NewSession(t, clusterContext)
+	return clusterContext
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	goctx "context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// OrphanedVM is a VM that was created for a VSphereVM that no longer exists.
+type OrphanedVM struct {
+	// Ref is the VM's managed object reference.
+	Ref types.ManagedObjectReference
+
+	// Name is the name of the VM.
+	Name string
+
+	// Namespace is the namespace of the VSphereVM.
+	Namespace string
+
+	// VSphereVMName is the name of the VSphereVM.
+	VSphereVMName string
+
+	// UID is the UID of the VSphereVM.
+	UID string
+
+	// ManagementClusterID is the ID of the management cluster that created
+	// or adopted the VM. The ID is empty if the VM was created before the
+	// ID was recorded.
+	ManagementClusterID string
+}
+
+// FindOrphanedVMs returns the VMs in the session's datacenter that were
+// created for a VSphereVM that no longer exists, i.e. whose UID is not one of
+// the uids. Only VMs created for a VSphereVM in the namespace are returned,
+// or in any namespace if the namespace is empty.
+//
+// A VM is created for a VSphereVM if its extra config has the owner keys set
+// when the VM is cloned. The owner keys include the ID of the management
+// cluster, since a VM created by another management cluster is orphaned from
+// the point of view of this one. A VM cloned before the owner keys were set is
+// identified by its annotation, and its instance or BIOS UUID is the UID of
+// the VSphereVM.
+func FindOrphanedVMs(ctx goctx.Context, s *session.Session, namespace string, uids map[string]struct{}) ([]OrphanedVM, error) {
+	manager := view.NewManager(s.Client.Client)
+	containerView, err := manager.CreateContainerView(
+		ctx, s.Datacenter().Reference(), []string{"VirtualMachine"}, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create container view for datacenter %s", s.Datacenter().InventoryPath)
+	}
+	defer func() {
+		_ = containerView.Destroy(ctx)
+	}()
+
+	var vms []mo.VirtualMachine
+	if err := containerView.Retrieve(
+		ctx,
+		[]string{"VirtualMachine"},
+		[]string{"name", "config.annotation", "config.extraConfig", "config.instanceUuid", "config.template", "config.uuid"},
+		&vms); err != nil {
+		return nil, errors.Wrapf(err, "unable to retrieve vms in datacenter %s", s.Datacenter().InventoryPath)
+	}
+
+	var orphans []OrphanedVM
+	for _, vm := range vms {
+		if vm.Config == nil || vm.Config.Template {
+			continue
+		}
+		orphan, ok := getVMOwner(vm.Config)
+		if !ok {
+			continue
+		}
+		if namespace != "" && orphan.Namespace != namespace {
+			continue
+		}
+		if _, ok := uids[orphan.UID]; ok {
+			continue
+		}
+		if _, ok := uids[vm.Config.Uuid]; ok {
+			continue
+		}
+		orphan.Ref = vm.Reference()
+		orphan.Name = vm.Name
+		orphans = append(orphans, orphan)
+	}
+	return orphans, nil
+}
+
+// getVMOwner returns the VSphereVM for which the VM was created. False is
+// returned if the VM was not created for a VSphereVM.
+func getVMOwner(config *types.VirtualMachineConfigInfo) (OrphanedVM, bool) {
+	var owner OrphanedVM
+	for _, ec := range config.ExtraConfig {
+		if optVal := ec.GetOptionValue(); optVal != nil {
+			value, _ := optVal.Value.(string)
+			switch optVal.Key {
+			case extra.OwnerKey:
+				owner.Namespace, owner.VSphereVMName = splitNamespacedName(value)
+			case extra.OwnerUIDKey:
+				owner.UID = value
+			case extra.ManagementClusterIDKey:
+				owner.ManagementClusterID = value
+			}
+		}
+	}
+	if owner.UID != "" && owner.VSphereVMName != "" {
+		return owner, true
+	}
+
+	namespace, name, ok := parseAnnotation(config.Annotation)
+	if !ok {
+		return OrphanedVM{}, false
+	}
+	return OrphanedVM{
+		Namespace:     namespace,
+		VSphereVMName: name,
+		UID:           config.InstanceUuid,
+	}, true
+}
+
+// parseAnnotation returns the namespace and name of the VSphereVM identified
+// by a VM's annotation. False is returned if the annotation does not identify
+// a VSphereVM.
+func parseAnnotation(annotation string) (string, string, bool) {
+	if strings.HasPrefix(annotation, "{") {
+		var fields map[string]string
+		if err := json.Unmarshal([]byte(annotation), &fields); err != nil {
+			return "", "", false
+		}
+		annotation = fields[vcenter.AnnotationVSphereVMField]
+	}
+	gvk := infrav1.GroupVersion.WithKind("VSphereVM").String()
+	if !strings.HasPrefix(annotation, gvk+" ") {
+		return "", "", false
+	}
+	namespace, name := splitNamespacedName(strings.TrimPrefix(annotation, gvk+" "))
+	return namespace, name, name != ""
+}
+
+func splitNamespacedName(value string) (string, string) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// DestroyOrphanedVM powers off and destroys an orphaned VM.
+func DestroyOrphanedVM(ctx goctx.Context, s *session.Session, orphan OrphanedVM) error {
+	vm := object.NewVirtualMachine(s.Client.Client, orphan.Ref)
+	powerState, err := vm.PowerState(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get power state of vm %s", orphan.Name)
+	}
+	if powerState == types.VirtualMachinePowerStatePoweredOn {
+		task, err := vm.PowerOff(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "unable to power off vm %s", orphan.Name)
+		}
+		if err := task.Wait(ctx); err != nil {
+			return errors.Wrapf(err, "unable to power off vm %s", orphan.Name)
+		}
+	}
+	task, err := vm.Destroy(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "unable to destroy vm %s", orphan.Name)
+	}
+	if err := task.Wait(ctx); err != nil {
+		return errors.Wrapf(err, "unable to destroy vm %s", orphan.Name)
+	}
+	return nil
+}
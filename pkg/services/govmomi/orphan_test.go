@@ -0,0 +1,151 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+func TestFindOrphanedVMs(t *testing.T) {
+	sim := vcsim.New(t, func(model *simulator.Model) {
+		model.Machine = 4
+	})
+	defer sim.Destroy()
+
+	ctx := fake.NewControllerManagerContext()
+	authSession := sim.NewSession(t, ctx)
+
+	vms := simulator.Map.All("VirtualMachine")
+	if len(vms) < 4 {
+		t.Fatalf("expected at least 4 vms, got %d", len(vms))
+	}
+	reconfigure := func(ref types.ManagedObjectReference, spec types.VirtualMachineConfigSpec) {
+		task, err := object.NewVirtualMachine(authSession.Client.Client, ref).Reconfigure(ctx, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := task.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first VM belongs to an existing VSphereVM, the second and third to
+	// VSphereVMs that no longer exist, and the fourth to a VSphereVM in
+	// another namespace of another management cluster.
+	owners := []struct{ namespace, name, uid, managementClusterID string }{
+		{"default", "existing", "existing-uid", ctx.ManagementClusterID},
+		{"default", "deleted", "deleted-uid", ctx.ManagementClusterID},
+		{"", "", "", ""},
+		{"other", "deleted", "other-uid", "other-management-cluster"},
+	}
+	for i, owner := range owners {
+		var extraConfig extra.Config
+		if owner.uid != "" {
+			extraConfig.SetOwner(owner.namespace, owner.name, owner.uid, owner.managementClusterID)
+		}
+		reconfigure(vms[i].Reference(), types.VirtualMachineConfigSpec{ExtraConfig: extraConfig})
+	}
+	// The third VM was cloned before the owner keys were set.
+	reconfigure(vms[2].Reference(), types.VirtualMachineConfigSpec{
+		Annotation: `{"vsphereVM":"infrastructure.cluster.x-k8s.io/v1alpha3, Kind=VSphereVM default/legacy"}`,
+	})
+
+	uids := map[string]struct{}{"existing-uid": {}}
+	orphans, err := FindOrphanedVMs(ctx, authSession, "default", uids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 2 {
+		t.Fatalf("expected 2 orphaned vms, got %+v", orphans)
+	}
+	byName := map[string]OrphanedVM{}
+	for _, orphan := range orphans {
+		byName[orphan.VSphereVMName] = orphan
+	}
+	if orphan, ok := byName["deleted"]; !ok || orphan.UID != "deleted-uid" || orphan.Ref != vms[1].Reference() ||
+		orphan.ManagementClusterID != ctx.ManagementClusterID {
+		t.Errorf("expected orphaned vm for VSphereVM default/deleted, got %+v", orphans)
+	}
+	// The management cluster of a VM cloned before the owner keys were set
+	// is unknown.
+	if orphan, ok := byName["legacy"]; !ok || orphan.Ref != vms[2].Reference() || orphan.ManagementClusterID != "" {
+		t.Errorf("expected orphaned vm for VSphereVM default/legacy, got %+v", orphans)
+	}
+
+	if orphans, err = FindOrphanedVMs(ctx, authSession, "", uids); err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 3 {
+		t.Fatalf("expected 3 orphaned vms in all namespaces, got %+v", orphans)
+	}
+	for _, orphan := range orphans {
+		if orphan.Namespace == "other" && orphan.ManagementClusterID != "other-management-cluster" {
+			t.Errorf("expected orphaned vm of another management cluster, got %+v", orphan)
+		}
+	}
+
+	if err := DestroyOrphanedVM(ctx, authSession, byName["deleted"]); err != nil {
+		t.Fatal(err)
+	}
+	if simulator.Map.Get(vms[1].Reference()) != nil {
+		t.Error("expected the orphaned vm to be destroyed")
+	}
+}
+
+func TestParseAnnotation(t *testing.T) {
+	testCases := []struct {
+		annotation        string
+		expectedNamespace string
+		expectedName      string
+		expectedOK        bool
+	}{
+		{
+			annotation:        "infrastructure.cluster.x-k8s.io/v1alpha3, Kind=VSphereVM default/vm",
+			expectedNamespace: "default",
+			expectedName:      "vm",
+			expectedOK:        true,
+		},
+		{
+			annotation:        `{"owner":"team","vsphereVM":"infrastructure.cluster.x-k8s.io/v1alpha3, Kind=VSphereVM default/vm"}`,
+			expectedNamespace: "default",
+			expectedName:      "vm",
+			expectedOK:        true,
+		},
+		{
+			annotation: "a VM that was not created by CAPV",
+		},
+		{
+			annotation: `{"owner":"team"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		namespace, name, ok := parseAnnotation(tc.annotation)
+		if namespace != tc.expectedNamespace || name != tc.expectedName || ok != tc.expectedOK {
+			t.Errorf("expected %q to be parsed as (%q, %q, %v), got (%q, %q, %v)",
+				tc.annotation, tc.expectedNamespace, tc.expectedName, tc.expectedOK, namespace, name, ok)
+		}
+	}
+}
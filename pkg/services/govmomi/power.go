@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+// getDesiredPowerState returns the VSphereVM's desired power state.
+func getDesiredPowerState(vsphereVM *infrav1.VSphereVM) infrav1.VirtualMachinePowerState {
+	if vsphereVM.Spec.PowerState == "" {
+		return infrav1.VirtualMachinePowerStatePoweredOn
+	}
+	return vsphereVM.Spec.PowerState
+}
+
+// getGuestShutdownTimeout returns how long to wait for the VSphereVM's guest
+// to shut down.
+func getGuestShutdownTimeout(vsphereVM *infrav1.VSphereVM) time.Duration {
+	if timeout := vsphereVM.Spec.GuestShutdownTimeout; timeout != nil {
+		return timeout.Duration
+	}
+	return defaultGuestShutdownTimeout
+}
+
+// powerOffVM powers off the VM with the VSphereVM's PowerOffMode. The guest
+// of a powered-on VM is shut down with VMware Tools if the mode is soft or
+// trySoft, and a reconcile request is triggered once the VM is powered off
+// or the timeout expires. True is returned once the VM is powered off.
+func (vms *VMService) powerOffVM(ctx *virtualMachineContext) (bool, error) {
+	var obj mo.VirtualMachine
+	if err := ctx.Obj.Properties(ctx, ctx.Ref, []string{"runtime.powerState", "guest.toolsRunningStatus"}, &obj); err != nil {
+		return false, errors.Wrapf(err, "unable to get power state for vm %s", ctx)
+	}
+	status := &ctx.VSphereVM.Status
+	if obj.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOff {
+		status.GuestShutdownTime = nil
+		return true, nil
+	}
+
+	// The guest of a suspended VM cannot be shut down.
+	mode := ctx.VSphereVM.Spec.PowerOffMode
+	if obj.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOn &&
+		(mode == infrav1.VirtualMachinePowerOpModeSoft || mode == infrav1.VirtualMachinePowerOpModeTrySoft) {
+
+		timeout := getGuestShutdownTimeout(ctx.VSphereVM)
+		timedOut := false
+		if status.GuestShutdownTime != nil {
+			remaining := timeout - time.Since(status.GuestShutdownTime.Time)
+			if remaining > 0 {
+				ctx.Logger.Info("wait for guest to shut down", "remaining", remaining)
+				reconcileVSphereVMWhenPoweredOff(ctx, remaining)
+				return false, nil
+			}
+			ctx.Logger.Info("guest did not shut down", "timeout", timeout)
+			ctx.Recorder.Warnf(ctx.VSphereVM, "GuestShutdownTimeout", "Guest did not shut down within %s", timeout)
+			status.GuestShutdownTime = nil
+			timedOut = true
+		}
+
+		// The trySoft mode powers off the VM once the guest has not shut
+		// down within the timeout.
+		if mode == infrav1.VirtualMachinePowerOpModeSoft || !timedOut {
+			if obj.Guest != nil && obj.Guest.ToolsRunningStatus == string(types.VirtualMachineToolsRunningStatusGuestToolsRunning) {
+				ctx.Logger.Info("shutting down guest")
+				if err := ctx.Obj.ShutdownGuest(ctx); err != nil {
+					return false, errors.Wrapf(err, "failed to trigger guest shutdown for vm %s", ctx)
+				}
+				now := metav1.Now()
+				status.GuestShutdownTime = &now
+				reconcileVSphereVMWhenPoweredOff(ctx, timeout)
+				ctx.Logger.Info("wait for guest to shut down", "remaining", timeout)
+				return false, nil
+			}
+			if mode == infrav1.VirtualMachinePowerOpModeSoft {
+				return false, errors.Errorf("unable to shut down guest of vm %s: VMware Tools is not running", ctx)
+			}
+			ctx.Logger.Info("VMware Tools is not running, falling back to power off")
+		}
+	}
+
+	ctx.Logger.Info("powering off")
+	task, err := ctx.Obj.PowerOff(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to trigger power off op for vm %s", ctx)
+	}
+	status.GuestShutdownTime = nil
+	status.TaskRef = task.Reference().Value
+	ctx.Logger.Info("wait for VM to be powered off")
+	return false, nil
+}
+
+// reconcileVSphereVMWhenPoweredOff triggers a reconcile request for the
+// VSphereVM once the VM is powered off or the timeout expires.
+func reconcileVSphereVMWhenPoweredOff(ctx *virtualMachineContext, timeout time.Duration) {
+	watchVMProperty(ctx, "runtime.powerState", func(value interface{}) (bool, bool) {
+		poweredOff := value == types.VirtualMachinePowerStatePoweredOff
+		return poweredOff, poweredOff
+	})
+	reconcileVSphereVMAfter(&ctx.VMContext, timeout, "reason", "guest-shutdown-timeout")
+}
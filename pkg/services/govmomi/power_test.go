@@ -0,0 +1,215 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+func TestReconcilePowerState(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		initialPowerState     types.VirtualMachinePowerState
+		desiredPowerState     infrav1.VirtualMachinePowerState
+		powerOffMode          infrav1.VirtualMachinePowerOpMode
+		toolsRunning          bool
+		guestShutdownTimedOut bool
+		expectedPowerState    types.VirtualMachinePowerState
+		expectedGuestShutdown bool
+		expectedPowerOffTask  bool
+		expectedError         bool
+	}{
+		{
+			name:               "power on",
+			initialPowerState:  types.VirtualMachinePowerStatePoweredOff,
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOn,
+		},
+		{
+			name:               "resume",
+			initialPowerState:  types.VirtualMachinePowerStateSuspended,
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOn,
+		},
+		{
+			name:                 "hard power off",
+			initialPowerState:    types.VirtualMachinePowerStatePoweredOn,
+			desiredPowerState:    infrav1.VirtualMachinePowerStatePoweredOff,
+			expectedPowerState:   types.VirtualMachinePowerStatePoweredOff,
+			expectedPowerOffTask: true,
+		},
+		{
+			name:                  "soft power off",
+			initialPowerState:     types.VirtualMachinePowerStatePoweredOn,
+			desiredPowerState:     infrav1.VirtualMachinePowerStatePoweredOff,
+			powerOffMode:          infrav1.VirtualMachinePowerOpModeSoft,
+			toolsRunning:          true,
+			expectedPowerState:    types.VirtualMachinePowerStatePoweredOff,
+			expectedGuestShutdown: true,
+		},
+		{
+			name:              "soft power off without tools",
+			initialPowerState: types.VirtualMachinePowerStatePoweredOn,
+			desiredPowerState: infrav1.VirtualMachinePowerStatePoweredOff,
+			powerOffMode:      infrav1.VirtualMachinePowerOpModeSoft,
+			expectedError:     true,
+		},
+		{
+			name:                 "try soft power off without tools",
+			initialPowerState:    types.VirtualMachinePowerStatePoweredOn,
+			desiredPowerState:    infrav1.VirtualMachinePowerStatePoweredOff,
+			powerOffMode:         infrav1.VirtualMachinePowerOpModeTrySoft,
+			expectedPowerState:   types.VirtualMachinePowerStatePoweredOff,
+			expectedPowerOffTask: true,
+		},
+		{
+			name:                  "try soft power off timed out",
+			initialPowerState:     types.VirtualMachinePowerStatePoweredOn,
+			desiredPowerState:     infrav1.VirtualMachinePowerStatePoweredOff,
+			powerOffMode:          infrav1.VirtualMachinePowerOpModeTrySoft,
+			toolsRunning:          true,
+			guestShutdownTimedOut: true,
+			expectedPowerState:    types.VirtualMachinePowerStatePoweredOff,
+			expectedPowerOffTask:  true,
+		},
+		{
+			name:               "suspend",
+			initialPowerState:  types.VirtualMachinePowerStatePoweredOn,
+			desiredPowerState:  infrav1.VirtualMachinePowerStateSuspended,
+			expectedPowerState: types.VirtualMachinePowerStateSuspended,
+		},
+		{
+			name:               "suspend powered off",
+			initialPowerState:  types.VirtualMachinePowerStatePoweredOff,
+			desiredPowerState:  infrav1.VirtualMachinePowerStateSuspended,
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOff,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := vcsim.New(t)
+			defer sim.Destroy()
+
+			vmContext := sim.NewVMContext(t)
+			vmContext.VSphereVM.Spec.PowerState = tc.desiredPowerState
+			vmContext.VSphereVM.Spec.PowerOffMode = tc.powerOffMode
+			if tc.guestShutdownTimedOut {
+				shutdownTime := metav1.NewTime(time.Now().Add(-defaultGuestShutdownTimeout))
+				vmContext.VSphereVM.Status.GuestShutdownTime = &shutdownTime
+			}
+
+			authSession := vmContext.Session
+
+			vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+			obj := object.NewVirtualMachine(authSession.Client.Client, vm.Reference())
+
+			// Put the VM into its initial power state.
+			var (
+				task *object.Task
+				err  error
+			)
+			switch tc.initialPowerState {
+			case types.VirtualMachinePowerStatePoweredOff:
+				task, err = obj.PowerOff(vmContext)
+			case types.VirtualMachinePowerStateSuspended:
+				task, err = obj.Suspend(vmContext)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if task != nil {
+				if err := task.Wait(vmContext); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.toolsRunning {
+				vm.Guest.ToolsRunningStatus = string(types.VirtualMachineToolsRunningStatusGuestToolsRunning)
+			}
+
+			ctx := &virtualMachineContext{
+				VMContext: *vmContext,
+				Obj:       obj,
+				Ref:       vm.Reference(),
+				State:     &infrav1.VirtualMachine{},
+			}
+
+			vms := &VMService{}
+			var (
+				guestShutdown bool
+				powerOffTask  bool
+			)
+			for i := 0; ; i++ {
+				if i == 5 {
+					t.Fatal("power state was not reconciled")
+				}
+				ok, err := vms.reconcilePowerState(ctx)
+				if tc.expectedError {
+					if err == nil {
+						t.Fatal("expected error")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok {
+					break
+				}
+				if ctx.VSphereVM.Status.GuestShutdownTime != nil {
+					guestShutdown = true
+				}
+				if ctx.VSphereVM.Status.TaskRef == "" {
+					continue
+				}
+				task := object.NewTask(authSession.Client.Client, types.ManagedObjectReference{Type: morefTypeTask, Value: ctx.VSphereVM.Status.TaskRef})
+				info, err := task.WaitForResult(ctx, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.DescriptionId == "VirtualMachine.powerOff" {
+					powerOffTask = true
+				}
+				ctx.VSphereVM.Status.TaskRef = ""
+			}
+
+			powerState, err := obj.PowerState(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if powerState != tc.expectedPowerState {
+				t.Fatalf("expected power state %s, got %s", tc.expectedPowerState, powerState)
+			}
+			if guestShutdown != tc.expectedGuestShutdown {
+				t.Fatalf("expected guest shutdown %t, got %t", tc.expectedGuestShutdown, guestShutdown)
+			}
+			if powerOffTask != tc.expectedPowerOffTask {
+				t.Fatalf("expected power off task %t, got %t", tc.expectedPowerOffTask, powerOffTask)
+			}
+			if ctx.VSphereVM.Status.GuestShutdownTime != nil {
+				t.Fatal("expected guest shutdown time to be cleared")
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+// reconcileGuestReadiness returns true once the guest reports it was
+// bootstrapped successfully. A guest that reports an error puts the
+// VSphereVM into a terminal error state with the guest's message. False is
+// returned while the guest is being bootstrapped, and a reconcile is
+// triggered when the value of the guest readiness key changes.
+func (vms *VMService) reconcileGuestReadiness(ctx *virtualMachineContext) (bool, error) {
+	spec := ctx.VSphereVM.Spec.GuestReadiness
+	if spec == nil {
+		return true, nil
+	}
+	if condition := util.GetCondition(ctx.VSphereVM.Status.Conditions, infrav1.GuestReadyCondition); condition != nil && condition.Status == corev1.ConditionTrue {
+		return true, nil
+	}
+
+	// The guest can only report its status while it is running.
+	if ctx.VSphereVM.Status.PowerState != infrav1.VirtualMachinePowerStatePoweredOn {
+		return true, nil
+	}
+
+	key := spec.Key
+	if key == "" {
+		key = defaultGuestReadinessKey
+	}
+
+	var obj mo.VirtualMachine
+	if err := ctx.Obj.Properties(ctx, ctx.Ref, []string{"config.extraConfig"}, &obj); err != nil {
+		return false, errors.Wrapf(err, "unable to get extra config for vm %s", ctx)
+	}
+	var value string
+	if obj.Config != nil {
+		value = getGuestReadinessValue(obj.Config.ExtraConfig, key)
+	}
+
+	status, message := parseGuestReadinessValue(value)
+	switch status {
+	case guestReadinessStatusDone:
+		util.SetCondition(&ctx.VSphereVM.Status.Conditions, infrav1.Condition{
+			Type:    infrav1.GuestReadyCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  infrav1.GuestReportedReason,
+			Message: "the guest reported it was bootstrapped successfully",
+		})
+		return true, nil
+	case guestReadinessStatusError:
+		errorReason := capierrors.CreateMachineError
+		errorMessage := "the guest failed to bootstrap"
+		if message != "" {
+			errorMessage += ": " + message
+		}
+		ctx.VSphereVM.Status.ErrorReason = &errorReason
+		ctx.VSphereVM.Status.ErrorMessage = &errorMessage
+		ctx.Logger.Info("guest failed to bootstrap", "key", key, "message", message)
+		ctx.Recorder.Warn(ctx.VSphereVM, "GuestFailed", errorMessage)
+		return false, nil
+	}
+
+	ctx.Logger.Info("wait for guest to report it is ready", "key", key, "status", status)
+	reconcileVSphereVMOnGuestReadinessChange(ctx, key, value)
+	return false, nil
+}
+
+// reconcileVSphereVMOnGuestReadinessChange triggers a reconcile request for
+// the VSphereVM once the value of the guest readiness key is no longer the
+// given value.
+func reconcileVSphereVMOnGuestReadinessChange(ctx *virtualMachineContext, key, value string) {
+	watchVMProperty(ctx, "config.extraConfig", func(v interface{}) (bool, bool) {
+		extraConfig, _ := v.(types.ArrayOfOptionValue)
+		changed := getGuestReadinessValue(extraConfig.OptionValue, key) != value
+		return changed, changed
+	})
+}
+
+// getGuestReadinessValue returns the value of the guest readiness key.
+func getGuestReadinessValue(extraConfig []types.BaseOptionValue, key string) string {
+	for _, ec := range extraConfig {
+		if optVal := ec.GetOptionValue(); optVal != nil && optVal.Key == key {
+			if v, ok := optVal.Value.(string); ok {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// parseGuestReadinessValue returns the status and message of a guest
+// readiness value in the form "<status>[: <message>]".
+func parseGuestReadinessValue(value string) (string, string) {
+	parts := strings.SplitN(value, ":", 2)
+	status := strings.ToLower(strings.TrimSpace(parts[0]))
+	if len(parts) == 1 {
+		return status, ""
+	}
+	return status, strings.TrimSpace(parts[1])
+}
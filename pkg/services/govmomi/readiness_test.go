@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+func TestReconcileGuestReadiness(t *testing.T) {
+	sim := vcsim.New(t, func(model *simulator.Model) {
+		model.Machine = 3
+	})
+	defer sim.Destroy()
+
+	vmContext := sim.NewVMContext(t)
+	vmContext.VSphereVM.Spec.GuestReadiness = &infrav1.GuestReadinessSpec{}
+	vmContext.VSphereVM.Status.PowerState = infrav1.VirtualMachinePowerStatePoweredOn
+
+	authSession := vmContext.Session
+
+	eventChannel, stopVMWatches := startVMWatches(vmContext.ControllerContext)
+	defer stopVMWatches()
+
+	// newContext returns a context for a VM with the guest readiness key
+	// set like the guest would. Each VM's key is only set once since the
+	// simulator appends extra config rather than updating it.
+	vms := &VMService{}
+	vmRefs := simulator.Map.All("VirtualMachine")
+	newContext := func(i int, value string) *virtualMachineContext {
+		obj := object.NewVirtualMachine(authSession.Client.Client, vmRefs[i].Reference())
+		ctx := &virtualMachineContext{
+			VMContext: *vmContext,
+			Obj:       obj,
+			Ref:       obj.Reference(),
+			State:     &infrav1.VirtualMachine{},
+		}
+		ctx.VSphereVM = vmContext.VSphereVM.DeepCopy()
+		if value != "" {
+			setGuestStatus(t, ctx, value)
+		}
+		return ctx
+	}
+
+	// A guest that has not reported its status is not ready, and a reconcile
+	// is triggered once it reports its status.
+	ctx := newContext(0, "")
+	if ok, err := vms.reconcileGuestReadiness(ctx); err != nil || ok {
+		t.Fatalf("expected guest not to be ready, got %t, %v", ok, err)
+	}
+	setGuestStatus(t, ctx, "done")
+	expectGenericEvent(t, eventChannel, ctx.VSphereVM, "the guest reported its status")
+	if ok, err := vms.reconcileGuestReadiness(ctx); err != nil || !ok {
+		t.Fatalf("expected guest to be ready, got %t, %v", ok, err)
+	}
+	if util.GetCondition(ctx.VSphereVM.Status.Conditions, infrav1.GuestReadyCondition) == nil {
+		t.Fatalf("expected condition %s", infrav1.GuestReadyCondition)
+	}
+
+	// A guest that is being bootstrapped is not ready.
+	ctx = newContext(1, "running")
+	if ok, err := vms.reconcileGuestReadiness(ctx); err != nil || ok {
+		t.Fatalf("expected guest not to be ready, got %t, %v", ok, err)
+	}
+
+	// A guest that reports an error is a terminal error.
+	ctx = newContext(2, "error: kubeadm init failed")
+	if ok, err := vms.reconcileGuestReadiness(ctx); err != nil || ok {
+		t.Fatalf("expected guest not to be ready, got %t, %v", ok, err)
+	}
+	if ctx.VSphereVM.Status.ErrorMessage == nil {
+		t.Fatal("expected error message")
+	}
+	if expected, actual := "the guest failed to bootstrap: kubeadm init failed", *ctx.VSphereVM.Status.ErrorMessage; actual != expected {
+		t.Fatalf("expected error message %q, got %q", expected, actual)
+	}
+}
+
+// setGuestStatus sets the guest readiness key like the guest would.
+func setGuestStatus(t *testing.T, ctx *virtualMachineContext, value string) {
+	task, err := ctx.Obj.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+		ExtraConfig: []types.BaseOptionValue{
+			&types.OptionValue{Key: defaultGuestReadinessKey, Value: value},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseGuestReadinessValue(t *testing.T) {
+	testCases := []struct {
+		value           string
+		expectedStatus  string
+		expectedMessage string
+	}{
+		{value: "", expectedStatus: ""},
+		{value: "running", expectedStatus: "running"},
+		{value: "done", expectedStatus: guestReadinessStatusDone},
+		{value: " Done\n", expectedStatus: guestReadinessStatusDone},
+		{value: "error", expectedStatus: guestReadinessStatusError},
+		{value: "error: a: b", expectedStatus: guestReadinessStatusError, expectedMessage: "a: b"},
+	}
+	for _, tc := range testCases {
+		status, message := parseGuestReadinessValue(tc.value)
+		if status != tc.expectedStatus || message != tc.expectedMessage {
+			t.Errorf("expected %q, %q for %q, got %q, %q",
+				tc.expectedStatus, tc.expectedMessage, tc.value, status, message)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+)
+
+// findVMByOwner returns the VM in the VSphereVM's folder that has the
+// VSphereVM's name and is owned by a VSphereVM with the same namespace and
+// name. False is returned if there is no such VM.
+func findVMByOwner(ctx *context.VMContext) (types.ManagedObjectReference, bool, error) {
+	folder, err := ctx.Session.Finder.FolderOrDefault(ctx, ctx.VSphereVM.Spec.Folder)
+	if err != nil {
+		return types.ManagedObjectReference{}, false, errors.Wrapf(err, "unable to get folder for %q", ctx)
+	}
+	vm, err := ctx.Session.Finder.VirtualMachine(ctx, path.Join(folder.InventoryPath, ctx.VSphereVM.Name))
+	if err != nil {
+		if _, ok := err.(*find.NotFoundError); ok {
+			return types.ManagedObjectReference{}, false, nil
+		}
+		return types.ManagedObjectReference{}, false, errors.Wrapf(err, "unable to find vm for %q", ctx)
+	}
+	var obj mo.VirtualMachine
+	if err := vm.Properties(ctx, vm.Reference(), []string{"config.annotation", "config.extraConfig", "config.instanceUuid"}, &obj); err != nil {
+		return types.ManagedObjectReference{}, false, errors.Wrapf(err, "unable to get config for vm %s", vm.Reference().Value)
+	}
+	if obj.Config == nil {
+		return types.ManagedObjectReference{}, false, nil
+	}
+	owner, ok := getVMOwner(obj.Config)
+	if !ok || owner.Namespace != ctx.VSphereVM.Namespace || owner.VSphereVMName != ctx.VSphereVM.Name {
+		return types.ManagedObjectReference{}, false, nil
+	}
+	return vm.Reference(), true, nil
+}
+
+// isStatusRebuildRequired returns true if the VSphereVM's status has not been
+// observed from the VM. clusterctl move does not copy the status of the
+// resources it moves, so a moved VSphereVM has neither a clone mode nor the
+// adopted flag.
+func isStatusRebuildRequired(ctx *context.VMContext) bool {
+	return ctx.VSphereVM.Status.CloneMode == "" && !ctx.VSphereVM.Status.Adopted
+}
+
+// reconcileStatusRebuild rebuilds the status of a VSphereVM, such as one that
+// was moved to this management cluster, from its VM. An in-flight task of
+// the VM is tracked until it completes, and the VM is then reassigned the
+// owner keys and instance UUID of the VSphereVM. False is returned while a
+// task is in-flight.
+func (vms *VMService) reconcileStatusRebuild(ctx *virtualMachineContext) (bool, error) {
+	if !isStatusRebuildRequired(&ctx.VMContext) {
+		return true, nil
+	}
+
+	var obj mo.VirtualMachine
+	if err := ctx.Obj.Properties(ctx, ctx.Ref, []string{"config", "recentTask"}, &obj); err != nil {
+		return false, errors.Wrapf(err, "unable to get config for vm %s", ctx)
+	}
+	if obj.Config == nil {
+		return false, errors.Errorf("unable to get config for vm %s: missing config", ctx)
+	}
+
+	// Do not interfere with a task that was started before the VSphereVM
+	// was moved.
+	taskRef, err := getInFlightTask(ctx, obj.RecentTask)
+	if err != nil {
+		return false, err
+	}
+	if taskRef != "" {
+		ctx.Logger.Info("found in-flight task while rebuilding status", "task-ref", taskRef)
+		ctx.VSphereVM.Status.TaskRef = taskRef
+		return false, nil
+	}
+
+	// The last value for a key wins since values are appended by some
+	// implementations of the vSphere API.
+	existing := map[string]string{}
+	for _, ec := range obj.Config.ExtraConfig {
+		if optVal := ec.GetOptionValue(); optVal != nil {
+			existing[optVal.Key], _ = optVal.Value.(string)
+		}
+	}
+	cloneMode := infrav1.CloneMode(existing[extra.CloneModeKey])
+	adopted := existing[extra.AdoptedKey] == "true"
+
+	// Reassign the VM to the VSphereVM and to this management cluster. An
+	// instant clone is found by its BIOS UUID instead of its instance UUID,
+	// so its instance UUID is not reassigned.
+	uid := string(ctx.VSphereVM.UID)
+	var spec types.VirtualMachineConfigSpec
+	if existing[extra.OwnerUIDKey] != uid ||
+		existing[extra.OwnerKey] != ctx.VSphereVM.Namespace+"/"+ctx.VSphereVM.Name ||
+		existing[extra.ManagementClusterIDKey] != ctx.ManagementClusterID {
+		var extraConfig extra.Config
+		extraConfig.SetOwner(ctx.VSphereVM.Namespace, ctx.VSphereVM.Name, uid, ctx.ManagementClusterID)
+		spec.ExtraConfig = extraConfig
+	}
+	if cloneMode != infrav1.InstantClone && !adopted && obj.Config.InstanceUuid != uid {
+		spec.InstanceUuid = uid
+	}
+	if spec.ExtraConfig != nil || spec.InstanceUuid != "" {
+		task, err := ctx.Obj.Reconfigure(ctx, spec)
+		if err != nil {
+			return false, errors.Wrapf(err, "unable to reassign vm %s", ctx)
+		}
+		ctx.Logger.Info("reassigning vm", "instance-uuid", spec.InstanceUuid)
+		ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+		return false, nil
+	}
+
+	// A VM that was cloned before its clone mode was recorded is a linked
+	// clone if its disk has a parent.
+	if cloneMode == "" && !adopted {
+		cloneMode = infrav1.FullClone
+		for _, dev := range obj.Config.Hardware.Device {
+			if disk, ok := dev.(*types.VirtualDisk); ok {
+				if backing, ok := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo); ok && backing.Parent != nil {
+					cloneMode = infrav1.LinkedClone
+				}
+			}
+		}
+	}
+
+	ctx.VSphereVM.Status.CloneMode = cloneMode
+	ctx.VSphereVM.Status.Snapshot = existing[extra.SnapshotKey]
+	ctx.VSphereVM.Status.Adopted = adopted
+	ctx.Logger.Info("rebuilt status", "clone-mode", cloneMode, "snapshot", ctx.VSphereVM.Status.Snapshot, "adopted", adopted)
+	ctx.Recorder.Event(ctx.VSphereVM, "StatusRebuilt", "Rebuilt status from the VM")
+	return true, nil
+}
+
+// getInFlightTask returns the MoRef value of the first of the VM's recent
+// tasks that is queued or running. An empty string is returned if there is
+// no such task.
+func getInFlightTask(ctx *virtualMachineContext, recentTasks []types.ManagedObjectReference) (string, error) {
+	if len(recentTasks) == 0 {
+		return "", nil
+	}
+	var tasks []mo.Task
+	pc := property.DefaultCollector(ctx.Session.Client.Client)
+	if err := pc.Retrieve(ctx, recentTasks, []string{"info"}, &tasks); err != nil {
+		return "", errors.Wrapf(err, "unable to get recent tasks for vm %s", ctx)
+	}
+	for _, task := range tasks {
+		switch task.Info.State {
+		case types.TaskInfoStateQueued, types.TaskInfoStateRunning:
+			return task.Reference().Value, nil
+		}
+	}
+	return "", nil
+}
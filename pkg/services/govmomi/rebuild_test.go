@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+func TestReconcileStatusRebuild(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+
+	vmContext := sim.NewVMContext(t)
+	authSession := vmContext.Session
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	obj := object.NewVirtualMachine(authSession.Client.Client, vm.Reference())
+
+	// Simulate a VM that was linked cloned for the VSphereVM before it was
+	// moved to this management cluster and assigned a new UID.
+	vmContext.VSphereVM.Name = vm.Name
+	var extraConfig extra.Config
+	extraConfig.SetOwner(vmContext.VSphereVM.Namespace, vmContext.VSphereVM.Name, "previous-uid", "previous-management-cluster")
+	extraConfig.SetCloneMode(string(infrav1.LinkedClone), "snapshot-1")
+	task, err := obj.Reconfigure(vmContext, types.VirtualMachineConfigSpec{ExtraConfig: extraConfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(vmContext); err != nil {
+		t.Fatal(err)
+	}
+
+	// The VM is found by its name and owner.
+	ref, err := findVM(vmContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != vm.Reference() {
+		t.Fatalf("expected vm %s, got %s", vm.Reference(), ref)
+	}
+
+	ctx := &virtualMachineContext{
+		VMContext: *vmContext,
+		Obj:       obj,
+		Ref:       ref,
+		State:     &infrav1.VirtualMachine{},
+	}
+
+	vms := &VMService{}
+	for i := 0; ; i++ {
+		if i == 5 {
+			t.Fatal("status rebuild was not reconciled")
+		}
+		ok, err := vms.reconcileStatusRebuild(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			break
+		}
+		task := object.NewTask(authSession.Client.Client, types.ManagedObjectReference{Type: morefTypeTask, Value: ctx.VSphereVM.Status.TaskRef})
+		if err := task.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		ctx.VSphereVM.Status.TaskRef = ""
+	}
+
+	if ctx.VSphereVM.Status.CloneMode != infrav1.LinkedClone {
+		t.Fatalf("expected clone mode %s, got %q", infrav1.LinkedClone, ctx.VSphereVM.Status.CloneMode)
+	}
+	if ctx.VSphereVM.Status.Snapshot != "snapshot-1" {
+		t.Fatalf("expected snapshot snapshot-1, got %q", ctx.VSphereVM.Status.Snapshot)
+	}
+
+	var moVM mo.VirtualMachine
+	if err := obj.Properties(ctx, ref, []string{"config"}, &moVM); err != nil {
+		t.Fatal(err)
+	}
+	uid := string(ctx.VSphereVM.UID)
+	if moVM.Config.InstanceUuid != uid {
+		t.Fatalf("expected instance uuid %q, got %q", uid, moVM.Config.InstanceUuid)
+	}
+	owner, ok := getVMOwner(moVM.Config)
+	if !ok || owner.UID != uid {
+		t.Fatalf("expected owner uid %q, got %q", uid, owner.UID)
+	}
+	if owner.ManagementClusterID != ctx.ManagementClusterID {
+		t.Fatalf("expected management cluster id %q, got %q", ctx.ManagementClusterID, owner.ManagementClusterID)
+	}
+
+	// The VM is now found by its instance UUID.
+	if _, err := findVM(vmContext); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	clusterutilv1 "sigs.k8s.io/cluster-api/util"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+// bootstrapDataKeys are the guestinfo keys that may contain the bootstrap
+// data, which includes secrets such as kubeadm join tokens.
+var bootstrapDataKeys = []string{
+	guestInfoKeyUserdata,
+	guestInfoKeyUserdataEnc,
+	guestInfoKeyIgnition,
+	guestInfoKeyIgnitionEnc,
+}
+
+// isBootstrapDataScrubbed returns true if the VM's bootstrap data has been
+// removed from its guestinfo.
+func isBootstrapDataScrubbed(ctx *context.VMContext) bool {
+	condition := util.GetCondition(ctx.VSphereVM.Status.Conditions, infrav1.BootstrapDataScrubbedCondition)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// reconcileBootstrapDataScrub removes the bootstrap data from the VM's
+// guestinfo once the VSphereVM is ready or the Machine that owns the VM has
+// a NodeRef. Otherwise the bootstrap data remains readable by anyone with
+// read access to the VM in vCenter. False is returned while the VM is being
+// reconfigured.
+func (vms *VMService) reconcileBootstrapDataScrub(ctx *virtualMachineContext) (bool, error) {
+	if isBootstrapDataScrubbed(&ctx.VMContext) {
+		return true, nil
+	}
+
+	reason := ""
+	if ctx.VSphereVM.Status.Ready {
+		reason = infrav1.VMReadyReason
+	} else {
+		hasNodeRef, err := machineHasNodeRef(&ctx.VMContext)
+		if err != nil {
+			return false, err
+		}
+		if !hasNodeRef {
+			return true, nil
+		}
+		reason = infrav1.NodeJoinedReason
+	}
+
+	var obj mo.VirtualMachine
+	if err := ctx.Obj.Properties(ctx, ctx.Ref, []string{"config.extraConfig"}, &obj); err != nil {
+		return false, errors.Wrapf(err, "unable to get extra config for vm %s", ctx)
+	}
+	existing := map[string]interface{}{}
+	if obj.Config != nil {
+		for _, ec := range obj.Config.ExtraConfig {
+			if optVal := ec.GetOptionValue(); optVal != nil {
+				existing[optVal.Key] = optVal.Value
+			}
+		}
+	}
+
+	// Assigning an empty value removes a key from the VM's extra config.
+	var extraConfig []types.BaseOptionValue
+	for _, key := range bootstrapDataKeys {
+		if value, ok := existing[key]; ok && value != "" {
+			extraConfig = append(extraConfig, &types.OptionValue{Key: key, Value: ""})
+		}
+	}
+
+	// The condition is only set once the VM no longer has the bootstrap
+	// data, which also verifies the reconfigure task succeeded.
+	if len(extraConfig) == 0 {
+		util.SetCondition(&ctx.VSphereVM.Status.Conditions, infrav1.Condition{
+			Type:    infrav1.BootstrapDataScrubbedCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  reason,
+			Message: "the bootstrap data was removed from the VM's guestinfo",
+		})
+		return true, nil
+	}
+
+	ctx.Logger.Info("scrubbing bootstrap data", "reason", reason)
+	task, err := ctx.Obj.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+		ExtraConfig: extraConfig,
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to scrub bootstrap data from vm %s", ctx)
+	}
+	ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+	ctx.Logger.Info("wait for VM bootstrap data to be scrubbed")
+	return false, nil
+}
+
+// machineHasNodeRef returns true if the Machine that owns the VM has a
+// NodeRef.
+func machineHasNodeRef(ctx *context.VMContext) (bool, error) {
+	machine, err := getOwnerMachine(ctx)
+	if err != nil || machine == nil {
+		return false, err
+	}
+	return machine.Status.NodeRef != nil, nil
+}
+
+// getOwnerMachine returns the Machine that owns the VSphereMachine that owns
+// the VM. Nil is returned if the VM is not owned by a VSphereMachine, such as
+// a load balancer VM, or if the VSphereMachine or its Machine do not exist.
+func getOwnerMachine(ctx *context.VMContext) (*clusterv1.Machine, error) {
+	for _, ref := range ctx.VSphereVM.OwnerReferences {
+		if ref.Kind != "VSphereMachine" || ref.APIVersion != infrav1.GroupVersion.String() {
+			continue
+		}
+		vsphereMachine := &infrav1.VSphereMachine{}
+		vsphereMachineKey := apitypes.NamespacedName{
+			Namespace: ctx.VSphereVM.Namespace,
+			Name:      ref.Name,
+		}
+		if err := ctx.Client.Get(ctx, vsphereMachineKey, vsphereMachine); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, errors.Wrapf(err, "failed to get VSphereMachine %s", vsphereMachineKey)
+		}
+		machine, err := clusterutilv1.GetOwnerMachine(ctx, ctx.Client, vsphereMachine.ObjectMeta)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, errors.Wrapf(err, "failed to get Machine for VSphereMachine %s", vsphereMachineKey)
+		}
+		return machine, nil
+	}
+	return nil, nil
+}
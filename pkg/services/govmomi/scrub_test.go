@@ -0,0 +1,170 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+func TestReconcileBootstrapDataScrub(t *testing.T) {
+	testCases := []struct {
+		name             string
+		ready            bool
+		nodeRef          bool
+		expectedScrubbed bool
+		expectedReason   string
+	}{
+		{
+			name: "not ready",
+		},
+		{
+			name:             "ready",
+			ready:            true,
+			expectedScrubbed: true,
+			expectedReason:   infrav1.VMReadyReason,
+		},
+		{
+			name:             "node joined",
+			nodeRef:          true,
+			expectedScrubbed: true,
+			expectedReason:   infrav1.NodeJoinedReason,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := vcsim.New(t)
+			defer sim.Destroy()
+
+			vmContext := sim.NewVMContext(t)
+			vmContext.VSphereVM.Status.Ready = tc.ready
+			if tc.nodeRef {
+				// The Machine is found through the VSphereMachine that owns
+				// the VSphereVM, and may have another name.
+				machine := &clusterv1.Machine{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: vmContext.VSphereVM.Namespace,
+						Name:      "machine",
+					},
+					Status: clusterv1.MachineStatus{
+						NodeRef: &corev1.ObjectReference{Name: vmContext.VSphereVM.Name},
+					},
+				}
+				vsphereMachine := &infrav1.VSphereMachine{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: vmContext.VSphereVM.Namespace,
+						Name:      "vsphere-machine",
+						OwnerReferences: []metav1.OwnerReference{{
+							APIVersion: clusterv1.GroupVersion.String(),
+							Kind:       "Machine",
+							Name:       machine.Name,
+						}},
+					},
+				}
+				for _, obj := range []runtime.Object{machine, vsphereMachine} {
+					if err := vmContext.Client.Create(vmContext, obj); err != nil {
+						t.Fatal(err)
+					}
+				}
+				vmContext.VSphereVM.OwnerReferences = []metav1.OwnerReference{{
+					APIVersion: infrav1.GroupVersion.String(),
+					Kind:       "VSphereMachine",
+					Name:       vsphereMachine.Name,
+				}}
+			}
+
+			authSession := vmContext.Session
+
+			vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+			obj := object.NewVirtualMachine(authSession.Client.Client, vm.Reference())
+
+			// Assign bootstrap data to the VM.
+			var extraConfig extra.Config
+			if err := extraConfig.SetCloudInitUserData([]byte("#cloud-config\n")); err != nil {
+				t.Fatal(err)
+			}
+			task, err := obj.Reconfigure(vmContext, types.VirtualMachineConfigSpec{ExtraConfig: extraConfig})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := task.Wait(vmContext); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := &virtualMachineContext{
+				VMContext: *vmContext,
+				Obj:       obj,
+				Ref:       vm.Reference(),
+				State:     &infrav1.VirtualMachine{},
+			}
+
+			vms := &VMService{}
+			for i := 0; ; i++ {
+				if i == 5 {
+					t.Fatal("bootstrap data scrub was not reconciled")
+				}
+				ok, err := vms.reconcileBootstrapDataScrub(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok {
+					break
+				}
+				task := object.NewTask(authSession.Client.Client, types.ManagedObjectReference{Type: morefTypeTask, Value: ctx.VSphereVM.Status.TaskRef})
+				if err := task.Wait(ctx); err != nil {
+					t.Fatal(err)
+				}
+				ctx.VSphereVM.Status.TaskRef = ""
+			}
+
+			if scrubbed := isBootstrapDataScrubbed(&ctx.VMContext); scrubbed != tc.expectedScrubbed {
+				t.Fatalf("expected scrubbed %v, got %v", tc.expectedScrubbed, scrubbed)
+			}
+			if c := util.GetCondition(ctx.VSphereVM.Status.Conditions, infrav1.BootstrapDataScrubbedCondition); c != nil && c.Reason != tc.expectedReason {
+				t.Errorf("expected reason %q, got %q", tc.expectedReason, c.Reason)
+			}
+
+			var moVM mo.VirtualMachine
+			if err := obj.Properties(ctx, vm.Reference(), []string{"config.extraConfig"}, &moVM); err != nil {
+				t.Fatal(err)
+			}
+			hasUserdata := false
+			for _, ec := range moVM.Config.ExtraConfig {
+				if optVal := ec.GetOptionValue(); optVal.Key == guestInfoKeyUserdata {
+					hasUserdata = optVal.Value != ""
+				}
+			}
+			if hasUserdata == tc.expectedScrubbed {
+				t.Errorf("expected the VM to have userdata %v, got %v", !tc.expectedScrubbed, hasUserdata)
+			}
+		})
+	}
+}
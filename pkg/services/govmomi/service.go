@@ -18,6 +18,7 @@ package govmomi
 
 import (
 	"encoding/base64"
+	"reflect"
 
 	"github.com/pkg/errors"
 
@@ -27,11 +28,14 @@ import (
 	"github.com/vmware/govmomi/vim25/types"
 	corev1 "k8s.io/api/core/v1"
 	apitypes "k8s.io/apimachinery/pkg/types"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/cluster"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/net"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/tags"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
 )
 
@@ -39,9 +43,9 @@ import (
 type VMService struct{}
 
 // ReconcileVM makes sure that the VM is in the desired state by:
-//   1. Creating the VM if it does not exist, then...
+//   1. Creating or adopting the VM if it does not exist, then...
 //   2. Updating the VM with the bootstrap data, such as the cloud-init meta and user data, before...
-//   3. Powering on the VM, and finally...
+//   3. Changing the VM's power state to the desired power state, and finally...
 //   4. Returning the real-time state of the VM to the caller
 func (vms *VMService) ReconcileVM(ctx *context.VMContext) (vm infrav1.VirtualMachine, _ error) {
 
@@ -70,16 +74,31 @@ func (vms *VMService) ReconcileVM(ctx *context.VMContext) (vm infrav1.VirtualMac
 			return vm, err
 		}
 		// If VM's MoRef could not be found then the VM does not exist,
-		// and the VM should be created.
+		// and the VM should be created or adopted.
+
+		// Adopt the existing VM instead of creating a VM.
+		if ctx.VSphereVM.Spec.Adopt != nil {
+			return vm, vms.adoptVM(ctx)
+		}
 
 		// Get the bootstrap data.
-		bootstrapData, err := vms.getBootstrapData(ctx)
+		bootstrapData, bootstrapFormat, err := vms.getBootstrapData(ctx)
 		if err != nil {
 			return vm, err
 		}
 
-		// Create the VM.
-		return vm, createVM(ctx, bootstrapData)
+		// Create the VM. Bootstrap data that cannot be assigned to the VM's
+		// guestinfo is a terminal error since the VM will never be created.
+		if err := createVM(ctx, bootstrapData, bootstrapFormat); err != nil {
+			if !extra.IsValueTooLarge(err) {
+				return vm, err
+			}
+			errorReason, errorMessage := capierrors.InvalidConfigurationMachineError, err.Error()
+			ctx.VSphereVM.Status.ErrorReason = &errorReason
+			ctx.VSphereVM.Status.ErrorMessage = &errorMessage
+			ctx.Logger.Error(err, "bootstrap data is too large")
+		}
+		return vm, nil
 	}
 
 	//
@@ -98,23 +117,60 @@ func (vms *VMService) ReconcileVM(ctx *context.VMContext) (vm infrav1.VirtualMac
 		return vm, err
 	}
 
+	if ok, err := vms.reconcileStatusRebuild(vmCtx); err != nil || !ok {
+		return vm, err
+	}
+
 	if err := vms.reconcileNetworkStatus(vmCtx); err != nil {
 		return vm, nil
 	}
 
+	if err := vms.reconcileDiagnostics(vmCtx); err != nil {
+		return vm, err
+	}
+
 	if ok, err := vms.reconcileMetadata(vmCtx); err != nil || !ok {
 		return vm, err
 	}
 
+	if ok, err := vms.reconcileDrift(vmCtx); err != nil || !ok {
+		return vm, err
+	}
+
+	if ok, err := vms.reconcileHardware(vmCtx); err != nil || !ok {
+		return vm, err
+	}
+
+	if err := vms.reconcileVMGroup(vmCtx); err != nil {
+		return vm, err
+	}
+
+	if err := vms.reconcileTags(vmCtx); err != nil {
+		return vm, err
+	}
+
+	if ok, err := vms.reconcileAttributes(vmCtx); err != nil || !ok {
+		return vm, err
+	}
+
 	if ok, err := vms.reconcilePowerState(vmCtx); err != nil || !ok {
 		return vm, err
 	}
 
+	if ok, err := vms.reconcileGuestReadiness(vmCtx); err != nil || !ok {
+		return vm, err
+	}
+
+	if ok, err := vms.reconcileBootstrapDataScrub(vmCtx); err != nil || !ok {
+		return vm, err
+	}
+
 	vm.State = infrav1.VirtualMachineStateReady
 	return vm, nil
 }
 
-// DestroyVM powers off and destroys a virtual machine.
+// DestroyVM powers off and destroys a virtual machine. The VM is powered off
+// with the VSphereVM's PowerOffMode.
 func (vms *VMService) DestroyVM(ctx *context.VMContext) (infrav1.VirtualMachine, error) {
 
 	vm := infrav1.VirtualMachine{
@@ -158,18 +214,16 @@ func (vms *VMService) DestroyVM(ctx *context.VMContext) (infrav1.VirtualMachine,
 		State:     &vm,
 	}
 
-	// Power off the VM.
+	// Power off the VM with the VSphereVM's PowerOffMode so the guest may
+	// be shut down cleanly.
 	powerState, err := vms.getPowerState(vmCtx)
 	if err != nil {
 		return vm, err
 	}
 	if powerState == infrav1.VirtualMachinePowerStatePoweredOn {
-		task, err := vmCtx.Obj.PowerOff(ctx)
-		if err != nil {
+		if _, err := vms.powerOffVM(vmCtx); err != nil {
 			return vm, err
 		}
-		ctx.VSphereVM.Status.TaskRef = task.Reference().Value
-		ctx.Logger.Info("wait for VM to be powered off")
 		return vm, nil
 	}
 
@@ -195,12 +249,14 @@ func (vms *VMService) reconcileNetworkStatus(ctx *virtualMachineContext) error {
 }
 
 func (vms *VMService) reconcileMetadata(ctx *virtualMachineContext) (bool, error) {
-	existingMetadata, err := vms.getMetadata(ctx)
+	// The Ignition config is only written when the VM is cloned, so only the
+	// metadata is reconciled for VMs bootstrapped with Ignition as well.
+	newMetadata, err := util.GetMachineMetadata(ctx.VSphereVM.Name, *ctx.VSphereVM, ctx.State.Network...)
 	if err != nil {
 		return false, err
 	}
 
-	newMetadata, err := util.GetMachineMetadata(ctx.VSphereVM.Name, *ctx.VSphereVM, ctx.State.Network...)
+	existingMetadata, err := vms.getMetadata(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -221,13 +277,76 @@ func (vms *VMService) reconcileMetadata(ctx *virtualMachineContext) (bool, error
 	return false, nil
 }
 
+// reconcileVMGroup adds the VM to the DRS VM group of its failure domain so
+// the VM is placed on the failure domain's hosts when it is powered on.
+func (vms *VMService) reconcileVMGroup(ctx *virtualMachineContext) error {
+	if ctx.VSphereVM.Spec.VMGroupName == "" {
+		return nil
+	}
+	if err := cluster.ReconcileVMGroupMembership(ctx, ctx.VSphereVM.Spec.VMGroupName, ctx.Ref); err != nil {
+		return errors.Wrapf(err, "unable to reconcile vm group of vm %s", ctx)
+	}
+	return nil
+}
+
+// reconcileTags attaches the spec's tags to the VM and detaches the tags
+// that were removed from the spec.
+func (vms *VMService) reconcileTags(ctx *virtualMachineContext) error {
+	desired, attached := ctx.VSphereVM.Spec.Tags, ctx.VSphereVM.Status.Tags
+	if reflect.DeepEqual(desired, attached) {
+		return nil
+	}
+	if err := tags.Attach(ctx, ctx.Ref, desired...); err != nil {
+		return errors.Wrapf(err, "unable to attach tags to vm %s", ctx)
+	}
+	var removed []infrav1.Tag
+	for _, tag := range attached {
+		if !containsTag(desired, tag) {
+			removed = append(removed, tag)
+		}
+	}
+	if err := tags.Detach(ctx, ctx.Ref, removed...); err != nil {
+		return errors.Wrapf(err, "unable to detach tags from vm %s", ctx)
+	}
+	ctx.VSphereVM.Status.Tags = append([]infrav1.Tag(nil), desired...)
+	return nil
+}
+
+func containsTag(list []infrav1.Tag, tag infrav1.Tag) bool {
+	for _, t := range list {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcilePowerState changes the VM's power state to the VSphereVM's
+// desired power state. False is returned while the power state is changing.
 func (vms *VMService) reconcilePowerState(ctx *virtualMachineContext) (bool, error) {
 	powerState, err := vms.getPowerState(ctx)
 	if err != nil {
 		return false, err
 	}
-	switch powerState {
-	case infrav1.VirtualMachinePowerStatePoweredOff:
+	ctx.VSphereVM.Status.PowerState = powerState
+	desired := getDesiredPowerState(ctx.VSphereVM)
+
+	switch {
+	case powerState == desired:
+		ctx.Logger.Info(string(powerState))
+		ctx.VSphereVM.Status.GuestShutdownTime = nil
+
+		// An instant clone is powered on as soon as it is created, so a
+		// reconcile request should be triggered once the VM reports IP
+		// addresses are available the first time the VM is seen powered on.
+		if powerState == infrav1.VirtualMachinePowerStatePoweredOn &&
+			ctx.VSphereVM.Status.CloneMode == infrav1.InstantClone && !ctx.VSphereVM.Status.Ready {
+			reconcileVSphereVMWhenNetworkIsReady(ctx)
+		}
+		return true, nil
+
+	case desired == infrav1.VirtualMachinePowerStatePoweredOn:
+		// Powering on a suspended VM resumes it.
 		ctx.Logger.Info("powering on")
 		task, err := ctx.Obj.PowerOn(ctx)
 		if err != nil {
@@ -239,15 +358,31 @@ func (vms *VMService) reconcilePowerState(ctx *virtualMachineContext) (bool, err
 
 		// Once the VM is successfully powered on, a reconcile request should be
 		// triggered once the VM reports IP addresses are available.
-		reconcileVSphereVMWhenNetworkIsReady(ctx, task)
+		reconcileVSphereVMWhenNetworkIsReady(ctx)
 
 		ctx.Logger.Info("wait for VM to be powered on")
 		return false, nil
-	case infrav1.VirtualMachinePowerStatePoweredOn:
-		ctx.Logger.Info("powered on")
-		return true, nil
+
+	case desired == infrav1.VirtualMachinePowerStatePoweredOff:
+		return vms.powerOffVM(ctx)
+
+	case desired == infrav1.VirtualMachinePowerStateSuspended:
+		// A powered-off VM cannot be suspended.
+		if powerState == infrav1.VirtualMachinePowerStatePoweredOff {
+			ctx.Logger.Info("skipping suspend", "reason", "power-state", "power-state", powerState)
+			return true, nil
+		}
+		ctx.Logger.Info("suspending")
+		task, err := ctx.Obj.Suspend(ctx)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to trigger suspend op for vm %s", ctx)
+		}
+		ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+		ctx.Logger.Info("wait for VM to be suspended")
+		return false, nil
+
 	default:
-		return false, errors.Errorf("unexpected power state %q for vm %s", powerState, ctx)
+		return false, errors.Errorf("unexpected desired power state %q for vm %s", desired, ctx)
 	}
 }
 
@@ -350,10 +485,17 @@ func (vms *VMService) getNetworkStatus(ctx *virtualMachineContext) ([]infrav1.Ne
 	return apiNetStatus, nil
 }
 
-func (vms *VMService) getBootstrapData(ctx *context.VMContext) ([]byte, error) {
+// getBootstrapData returns the VM's bootstrap data and its format. The
+// format is the VM's BootstrapFormat, the value of the bootstrap data
+// secret's "format" key, or cloud-config, in that order.
+func (vms *VMService) getBootstrapData(ctx *context.VMContext) ([]byte, infrav1.BootstrapFormat, error) {
+	format := ctx.VSphereVM.Spec.BootstrapFormat
 	if ctx.VSphereVM.Spec.BootstrapRef == nil {
 		ctx.Logger.Info("VM has no bootstrap data")
-		return nil, nil
+		if format == "" {
+			format = infrav1.BootstrapFormatCloudConfig
+		}
+		return nil, format, nil
 	}
 
 	secret := &corev1.Secret{}
@@ -362,13 +504,24 @@ func (vms *VMService) getBootstrapData(ctx *context.VMContext) ([]byte, error) {
 		Name:      ctx.VSphereVM.Spec.BootstrapRef.Name,
 	}
 	if err := ctx.Client.Get(ctx, secretKey, secret); err != nil {
-		return nil, errors.Wrapf(err, "failed to retrieve bootstrap data secret for %s", ctx)
+		return nil, "", errors.Wrapf(err, "failed to retrieve bootstrap data secret for %s", ctx)
 	}
 
 	value, ok := secret.Data["value"]
 	if !ok {
-		return nil, errors.New("error retrieving bootstrap data: secret value key is missing")
+		return nil, "", errors.New("error retrieving bootstrap data: secret value key is missing")
+	}
+
+	if format == "" {
+		format = infrav1.BootstrapFormat(secret.Data["format"])
+	}
+	switch format {
+	case "":
+		format = infrav1.BootstrapFormatCloudConfig
+	case infrav1.BootstrapFormatCloudConfig, infrav1.BootstrapFormatIgnition:
+	default:
+		return nil, "", errors.Errorf("unsupported bootstrap data format %q for %s", format, ctx)
 	}
 
-	return value, nil
+	return value, format, nil
 }
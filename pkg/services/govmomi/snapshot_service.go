@@ -0,0 +1,404 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// SnapshotService provides an API to manage the snapshots of VMs using
+// govmomi.
+type SnapshotService struct{}
+
+// ReconcileSnapshot makes sure the snapshots exist by:
+//   1. Creating the snapshot of each VM that does not have one, or...
+//   2. Reverting each VM to its snapshot if the snapshot has the revert
+//      annotation.
+// At most one task is submitted per VM per reconcile. The task is recorded in
+// the VM's status and checked on the next reconcile, so the operation is
+// resumed if the controller restarts while the task is in flight.
+func (ss *SnapshotService) ReconcileSnapshot(ctx *context.VMSnapshotContext, vms []infrav1.VSphereVM) error {
+	status := &ctx.VSphereVMSnapshot.Status
+
+	if !status.Ready {
+		// The VMs that are snapshotted are recorded the first time the
+		// snapshots are created so a failed operation is retried for the
+		// same VMs.
+		if len(status.VMs) == 0 {
+			if len(vms) == 0 {
+				return errors.Errorf("no vms to snapshot for %s", ctx)
+			}
+			for _, vm := range vms {
+				status.VMs = append(status.VMs, infrav1.VSphereVMSnapshotVMStatus{
+					Name:       vm.Name,
+					Server:     vm.Spec.Server,
+					Datacenter: vm.Spec.Datacenter,
+					BiosUUID:   vm.Spec.BiosUUID,
+				})
+			}
+		}
+		return recordSnapshotError(ctx, errors.Wrapf(createSnapshots(ctx), "failed to create snapshots for %s", ctx))
+	}
+
+	if _, ok := ctx.VSphereVMSnapshot.Annotations[infrav1.VMSnapshotRevertAnnotation]; ok {
+		return recordSnapshotError(ctx, errors.Wrapf(revertSnapshots(ctx), "failed to revert snapshots for %s", ctx))
+	}
+	return nil
+}
+
+// DeleteSnapshot removes the snapshots recorded in the snapshot's status.
+func (ss *SnapshotService) DeleteSnapshot(ctx *context.VMSnapshotContext) (bool, error) {
+	removed, err := removeSnapshots(ctx)
+	return removed, recordSnapshotError(ctx, errors.Wrapf(err, "failed to remove snapshots for %s", ctx))
+}
+
+// recordSnapshotError records the error in the snapshot's status, or clears
+// the status's error if the error is nil.
+func recordSnapshotError(ctx *context.VMSnapshotContext, err error) error {
+	ctx.VSphereVMSnapshot.Status.ErrorMessage = nil
+	if err != nil {
+		errMsg := err.Error()
+		ctx.VSphereVMSnapshot.Status.ErrorMessage = &errMsg
+	}
+	return err
+}
+
+// createSnapshots creates a snapshot of each VM that does not have one. The
+// snapshot is ready once the snapshots of all of the VMs are created.
+func createSnapshots(ctx *context.VMSnapshotContext) error {
+	spec := ctx.VSphereVMSnapshot.Spec
+	description := spec.Description
+	if description == "" {
+		description = fmt.Sprintf("Created by VSphereVMSnapshot %s/%s",
+			ctx.VSphereVMSnapshot.Namespace, ctx.VSphereVMSnapshot.Name)
+	}
+
+	status := &ctx.VSphereVMSnapshot.Status
+	inFlight := false
+	for i := range status.VMs {
+		vm := &status.VMs[i]
+		if vm.Snapshot != "" {
+			continue
+		}
+		obj, err := getSnapshotVM(ctx, *vm)
+		if err != nil {
+			return err
+		}
+		if obj == nil {
+			return errors.Errorf("vm %q with bios uuid %q not found", vm.Name, vm.BiosUUID)
+		}
+		info, err := getSnapshotTask(ctx, obj, vm)
+		if err != nil {
+			return err
+		}
+		if info != nil {
+			if isSnapshotTaskInFlight(info) {
+				inFlight = true
+				continue
+			}
+			// The result of the task is the new snapshot.
+			if ref, ok := info.Result.(types.ManagedObjectReference); ok {
+				vm.Snapshot = ref.Value
+				continue
+			}
+		}
+
+		// The snapshot may already have been created by a task that was not
+		// recorded in the status, so it is looked up by name before another
+		// snapshot is created.
+		ref, err := findSnapshotByName(ctx, obj, ctx.VSphereVMSnapshot.Name)
+		if err != nil {
+			return err
+		}
+		if ref != nil {
+			vm.Snapshot = ref.Value
+			continue
+		}
+
+		ctx.Logger.Info("creating snapshot", "vm", vm.Name)
+		task, err := obj.CreateSnapshot(ctx, ctx.VSphereVMSnapshot.Name, description, spec.Memory, spec.Quiesce)
+		if err != nil {
+			return errors.Wrapf(err, "failed to trigger create snapshot op for vm %q", vm.Name)
+		}
+		vm.TaskRef = task.Reference().Value
+		inFlight = true
+	}
+	if inFlight {
+		return nil
+	}
+
+	now := metav1.Now()
+	status.Ready = true
+	status.CreationTime = &now
+	ctx.Logger.Info("snapshots created")
+	return nil
+}
+
+// revertSnapshots reverts each VM to its snapshot. The revert annotation is
+// removed once all of the VMs are reverted.
+func revertSnapshots(ctx *context.VMSnapshotContext) error {
+	status := &ctx.VSphereVMSnapshot.Status
+	inFlight := false
+	for i := range status.VMs {
+		vm := &status.VMs[i]
+		if vm.Reverted {
+			continue
+		}
+		obj, err := getSnapshotVM(ctx, *vm)
+		if err != nil {
+			return err
+		}
+		if obj == nil {
+			return errors.Errorf("vm %q with bios uuid %q not found", vm.Name, vm.BiosUUID)
+		}
+		info, err := getSnapshotTask(ctx, obj, vm)
+		if err != nil {
+			return err
+		}
+		if info != nil {
+			if isSnapshotTaskInFlight(info) {
+				inFlight = true
+				continue
+			}
+			vm.Reverted = true
+			continue
+		}
+
+		ctx.Logger.Info("reverting to snapshot", "vm", vm.Name, "snapshot", vm.Snapshot)
+		task, err := obj.RevertToSnapshot(ctx, vm.Snapshot, false)
+		if err != nil {
+			return errors.Wrapf(err, "failed to trigger revert snapshot op for vm %q", vm.Name)
+		}
+		vm.TaskRef = task.Reference().Value
+		inFlight = true
+	}
+	if inFlight {
+		return nil
+	}
+
+	for i := range status.VMs {
+		status.VMs[i].Reverted = false
+	}
+	now := metav1.Now()
+	status.LastRevertTime = &now
+	delete(ctx.VSphereVMSnapshot.Annotations, infrav1.VMSnapshotRevertAnnotation)
+	ctx.Logger.Info("snapshots reverted")
+	return nil
+}
+
+// removeSnapshots removes the snapshot of each VM. True is returned once all
+// of the snapshots are removed. Snapshots of VMs that no longer exist are
+// considered removed.
+func removeSnapshots(ctx *context.VMSnapshotContext) (bool, error) {
+	status := &ctx.VSphereVMSnapshot.Status
+	consolidate := true
+	removed := true
+	for i := range status.VMs {
+		vm := &status.VMs[i]
+		// The snapshot of a VM may have been created by a task that was not
+		// recorded in the status until the snapshots are ready.
+		if vm.Snapshot == "" && vm.TaskRef == "" && status.Ready {
+			continue
+		}
+		obj, err := getSnapshotVM(ctx, *vm)
+		if err != nil {
+			return false, err
+		}
+		if obj == nil {
+			vm.Snapshot, vm.TaskRef = "", ""
+			continue
+		}
+		info, err := getSnapshotTask(ctx, obj, vm)
+		if err != nil {
+			return false, err
+		}
+		if info != nil && isSnapshotTaskInFlight(info) {
+			ctx.Logger.Info("waiting for in-flight task to complete before removing snapshot", "vm", vm.Name)
+			removed = false
+			continue
+		}
+		if vm.Snapshot == "" {
+			ref, err := findSnapshotByName(ctx, obj, ctx.VSphereVMSnapshot.Name)
+			if err != nil {
+				return false, err
+			}
+			if ref == nil {
+				continue
+			}
+			vm.Snapshot = ref.Value
+		}
+		ok, err := hasSnapshot(ctx, obj, vm.Snapshot)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			vm.Snapshot = ""
+			continue
+		}
+
+		ctx.Logger.Info("removing snapshot", "vm", vm.Name, "snapshot", vm.Snapshot)
+		task, err := obj.RemoveSnapshot(ctx, vm.Snapshot, false, &consolidate)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to trigger remove snapshot op for vm %q", vm.Name)
+		}
+		vm.TaskRef = task.Reference().Value
+		removed = false
+	}
+	return removed, nil
+}
+
+// getSnapshotTask returns the info of the task recorded for the VM, or nil if
+// the VM does not have a task or the task no longer exists. The VM's TaskRef
+// is cleared once the task completes, and an error is returned if the task
+// failed.
+func getSnapshotTask(ctx *context.VMSnapshotContext, obj *object.VirtualMachine, vm *infrav1.VSphereVMSnapshotVMStatus) (*types.TaskInfo, error) {
+	if vm.TaskRef == "" {
+		return nil, nil
+	}
+	var task mo.Task
+	moRef := types.ManagedObjectReference{
+		Type:  morefTypeTask,
+		Value: vm.TaskRef,
+	}
+	if err := property.DefaultCollector(obj.Client()).RetrieveOne(ctx, moRef, []string{"info"}, &task); err != nil {
+		if !isManagedObjectNotFound(err) {
+			return nil, errors.Wrapf(err, "failed to get task %q for vm %q", vm.TaskRef, vm.Name)
+		}
+		ctx.Logger.Info("task no longer exists", "vm", vm.Name, "task", vm.TaskRef)
+		vm.TaskRef = ""
+		return nil, nil
+	}
+
+	logger := ctx.Logger.WithName(vm.TaskRef)
+	logger.Info("task found", "vm", vm.Name, "state", task.Info.State, "description-id", task.Info.DescriptionId)
+	switch task.Info.State {
+	case types.TaskInfoStateQueued, types.TaskInfoStateRunning:
+		return &task.Info, nil
+	case types.TaskInfoStateSuccess:
+		vm.TaskRef = ""
+		return &task.Info, nil
+	case types.TaskInfoStateError:
+		vm.TaskRef = ""
+		errMsg := "unknown error"
+		if task.Info.Error != nil {
+			errMsg = task.Info.Error.LocalizedMessage
+		}
+		return nil, errors.Errorf("task %q for vm %q failed: %s", task.Info.Key, vm.Name, errMsg)
+	default:
+		return nil, errors.Errorf("unknown task state %q for vm %q", task.Info.State, vm.Name)
+	}
+}
+
+// isSnapshotTaskInFlight returns true if the task has not completed.
+func isSnapshotTaskInFlight(info *types.TaskInfo) bool {
+	return info.State == types.TaskInfoStateQueued || info.State == types.TaskInfoStateRunning
+}
+
+// isManagedObjectNotFound returns true if the error is a ManagedObjectNotFound
+// fault.
+func isManagedObjectNotFound(err error) bool {
+	if !soap.IsSoapFault(err) {
+		return false
+	}
+	_, ok := soap.ToSoapFault(err).VimFault().(types.ManagedObjectNotFound)
+	return ok
+}
+
+// getSnapshotVM returns the VM of a snapshot, or nil if the VM does not
+// exist.
+func getSnapshotVM(ctx *context.VMSnapshotContext, vm infrav1.VSphereVMSnapshotVMStatus) (*object.VirtualMachine, error) {
+	authSession, err := session.GetOrCreate(ctx,
+		vm.Server, vm.Datacenter,
+		ctx.ControllerManagerContext.Username, ctx.ControllerManagerContext.Password)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create vSphere session for vm %q", vm.Name)
+	}
+	ref, err := authSession.FindByBIOSUUID(ctx, vm.BiosUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find vm %q", vm.Name)
+	}
+	if ref == nil {
+		return nil, nil
+	}
+	return object.NewVirtualMachine(authSession.Client.Client, ref.Reference()), nil
+}
+
+// hasSnapshot returns true if the VM has the snapshot with the given managed
+// object reference ID.
+func hasSnapshot(ctx *context.VMSnapshotContext, obj *object.VirtualMachine, snapshot string) (bool, error) {
+	trees, err := getSnapshotTrees(ctx, obj)
+	if err != nil {
+		return false, err
+	}
+	for _, tree := range trees {
+		if tree.Snapshot.Value == snapshot {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// findSnapshotByName returns the most recently created snapshot of the VM with
+// the given name, or nil if the VM does not have such a snapshot.
+func findSnapshotByName(ctx *context.VMSnapshotContext, obj *object.VirtualMachine, name string) (*types.ManagedObjectReference, error) {
+	trees, err := getSnapshotTrees(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	var found *types.VirtualMachineSnapshotTree
+	for i := range trees {
+		if trees[i].Name != name {
+			continue
+		}
+		if found == nil || trees[i].CreateTime.After(found.CreateTime) {
+			found = &trees[i]
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	return &found.Snapshot, nil
+}
+
+// getSnapshotTrees returns all of the snapshots of the VM.
+func getSnapshotTrees(ctx *context.VMSnapshotContext, obj *object.VirtualMachine) ([]types.VirtualMachineSnapshotTree, error) {
+	var vm mo.VirtualMachine
+	if err := obj.Properties(ctx, obj.Reference(), []string{"snapshot"}, &vm); err != nil {
+		return nil, errors.Wrapf(err, "failed to get snapshots of vm %s", obj.Reference())
+	}
+	if vm.Snapshot == nil {
+		return nil, nil
+	}
+	var trees []types.VirtualMachineSnapshotTree
+	for pending := vm.Snapshot.RootSnapshotList; len(pending) > 0; pending = pending[1:] {
+		trees = append(trees, pending[0])
+		pending = append(pending, pending[0].ChildSnapshotList...)
+	}
+	return trees, nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+func TestSnapshotOperations(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+
+	controllerManagerContext := fake.NewControllerManagerContext()
+	controllerManagerContext.Username = sim.Username()
+	controllerManagerContext.Password = sim.Password()
+	ctx := &context.VMSnapshotContext{
+		ControllerContext: fake.NewControllerContext(controllerManagerContext),
+		VSphereVMSnapshot: &infrav1.VSphereVMSnapshot{},
+		Logger:            controllerManagerContext.Logger,
+	}
+	ctx.VSphereVMSnapshot.Name = "fake-snapshot"
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	ctx.VSphereVMSnapshot.Status.VMs = []infrav1.VSphereVMSnapshotVMStatus{
+		{
+			Name:     vm.Name,
+			Server:   sim.ServerURL(),
+			BiosUUID: vm.Config.Uuid,
+		},
+	}
+	status := &ctx.VSphereVMSnapshot.Status
+
+	// A task is submitted and recorded by one reconcile and checked by the
+	// next.
+	if err := createSnapshots(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status.VMs[0].TaskRef == "" || status.Ready {
+		t.Fatalf("expected create snapshot task to be recorded, got %+v", status)
+	}
+	if err := createSnapshots(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status.VMs[0].Snapshot == "" || status.VMs[0].TaskRef != "" || !status.Ready {
+		t.Fatalf("expected snapshot to be recorded, got %+v", status)
+	}
+	obj, err := getSnapshotVM(ctx, status.VMs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertHasSnapshot(t, ctx, obj, status.VMs[0].Snapshot, true)
+	snapshot := status.VMs[0].Snapshot
+
+	// A snapshot whose task was not recorded, i.e. because the controller
+	// restarted, is found by name instead of being created again.
+	status.Ready = false
+	status.VMs[0].Snapshot = ""
+	status.VMs[0].TaskRef = "task-does-not-exist"
+	if err := createSnapshots(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status.VMs[0].Snapshot != snapshot || status.VMs[0].TaskRef != "" || !status.Ready {
+		t.Fatalf("expected snapshot %q to be found, got %+v", snapshot, status)
+	}
+
+	ctx.VSphereVMSnapshot.Annotations = map[string]string{infrav1.VMSnapshotRevertAnnotation: ""}
+	for i := 0; i < 2; i++ {
+		if err := revertSnapshots(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := ctx.VSphereVMSnapshot.Annotations[infrav1.VMSnapshotRevertAnnotation]; ok || status.LastRevertTime == nil {
+		t.Fatalf("expected vms to be reverted, got %+v", status)
+	}
+	if status.VMs[0].Reverted {
+		t.Fatal("expected reverted vms to be reset")
+	}
+
+	removed, err := removeSnapshots(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed || status.VMs[0].TaskRef == "" {
+		t.Fatalf("expected remove snapshot task to be recorded, got %+v", status)
+	}
+	if removed, err = removeSnapshots(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !removed || status.VMs[0].Snapshot != "" {
+		t.Fatalf("expected removed snapshot to be cleared, got %+v", status)
+	}
+	assertHasSnapshot(t, ctx, obj, snapshot, false)
+
+	// The snapshot of a VM that no longer exists is considered removed.
+	status.VMs = []infrav1.VSphereVMSnapshotVMStatus{
+		{
+			Name:     "missing",
+			Server:   sim.ServerURL(),
+			BiosUUID: "00000000-0000-0000-0000-000000000000",
+			Snapshot: snapshot,
+		},
+	}
+	if removed, err = removeSnapshots(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !removed || status.VMs[0].Snapshot != "" {
+		t.Fatalf("expected snapshot of missing vm to be cleared, got %+v", status)
+	}
+	status.Ready = false
+	if err := createSnapshots(ctx); err == nil {
+		t.Fatal("expected error creating snapshot of missing vm")
+	}
+}
+
+func assertHasSnapshot(t *testing.T, ctx *context.VMSnapshotContext, obj *object.VirtualMachine, snapshot string, expected bool) {
+	t.Helper()
+	ok, err := hasSnapshot(ctx, obj, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != expected {
+		t.Fatalf("expected snapshot %q to exist=%t, got %t", snapshot, expected, ok)
+	}
+}
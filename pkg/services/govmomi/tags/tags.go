@@ -0,0 +1,282 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tags manages the vSphere tags attached to the objects created or
+// used by CAPV.
+package tags
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/mo"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+const (
+	// DefaultClusterCategory is the default category of the tag that
+	// identifies a VM's cluster.
+	DefaultClusterCategory = "k8s-cluster"
+
+	// DefaultRoleCategory is the default category of the tag that identifies
+	// a VM's role.
+	DefaultRoleCategory = "k8s-role"
+
+	// ControlPlaneRole is the name of the role tag of control plane VMs.
+	ControlPlaneRole = "control-plane"
+
+	// WorkerRole is the name of the role tag of worker VMs.
+	WorkerRole = "worker"
+)
+
+type tagContext interface {
+	context.Context
+	GetLogger() logr.Logger
+	GetSession() *session.Session
+}
+
+// ClusterTag returns the tag that identifies the given cluster.
+func ClusterTag(vsphereCluster *infrav1.VSphereCluster) infrav1.Tag {
+	category := DefaultClusterCategory
+	if t := vsphereCluster.Spec.Tagging; t != nil && t.ClusterCategory != "" {
+		category = t.ClusterCategory
+	}
+	return infrav1.Tag{
+		Category: category,
+		Name:     vsphereCluster.Namespace + "/" + vsphereCluster.Name,
+	}
+}
+
+// ZoneTag returns the tag that identifies the zone of the given failure
+// domain. The ok value is false if the cluster's cloud provider
+// configuration does not name a zone category.
+func ZoneTag(vsphereCluster *infrav1.VSphereCluster, failureDomain *infrav1.VSphereFailureDomain) (infrav1.Tag, bool) {
+	category := vsphereCluster.Spec.CloudProviderConfiguration.Labels.Zone
+	if category == "" {
+		return infrav1.Tag{}, false
+	}
+	return infrav1.Tag{Category: category, Name: failureDomain.Name}, true
+}
+
+// RegionTag returns the tag that identifies the region of the given failure
+// domain. The ok value is false if the failure domain does not have a region
+// or if the cluster's cloud provider configuration does not name a region
+// category.
+func RegionTag(vsphereCluster *infrav1.VSphereCluster, failureDomain *infrav1.VSphereFailureDomain) (infrav1.Tag, bool) {
+	category := vsphereCluster.Spec.CloudProviderConfiguration.Labels.Region
+	if category == "" || failureDomain.Spec.Region == "" {
+		return infrav1.Tag{}, false
+	}
+	return infrav1.Tag{Category: category, Name: failureDomain.Spec.Region}, true
+}
+
+// MachineTags returns the tags attached to a machine's VM. Nil is returned
+// if the cluster does not enable tagging. The failure domain may be nil.
+func MachineTags(
+	vsphereCluster *infrav1.VSphereCluster,
+	isControlPlane bool,
+	failureDomain *infrav1.VSphereFailureDomain) []infrav1.Tag {
+
+	if vsphereCluster.Spec.Tagging == nil {
+		return nil
+	}
+
+	roleCategory := DefaultRoleCategory
+	if vsphereCluster.Spec.Tagging.RoleCategory != "" {
+		roleCategory = vsphereCluster.Spec.Tagging.RoleCategory
+	}
+	role := WorkerRole
+	if isControlPlane {
+		role = ControlPlaneRole
+	}
+
+	result := []infrav1.Tag{
+		ClusterTag(vsphereCluster),
+		{Category: roleCategory, Name: role},
+	}
+	if failureDomain != nil {
+		if tag, ok := ZoneTag(vsphereCluster, failureDomain); ok {
+			result = append(result, tag)
+		}
+		if tag, ok := RegionTag(vsphereCluster, failureDomain); ok {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// Attach attaches the given tags to an object. Categories and tags are
+// created if they do not exist.
+func Attach(ctx tagContext, ref mo.Reference, desired ...infrav1.Tag) error {
+	if len(desired) == 0 {
+		return nil
+	}
+	manager, err := ctx.GetSession().TagManager(ctx)
+	if err != nil {
+		return err
+	}
+	attached, err := listAttachedTagIDs(ctx, manager, ref)
+	if err != nil {
+		return err
+	}
+	for _, tag := range desired {
+		id, err := ensureTag(ctx, manager, tag)
+		if err != nil {
+			return err
+		}
+		if _, ok := attached[id]; ok {
+			continue
+		}
+		ctx.GetLogger().Info("attaching tag", "tag", tag.String(), "object", ref.Reference())
+		if err := manager.AttachTag(ctx, id, ref); err != nil {
+			return errors.Wrapf(err, "unable to attach tag %q to %s", tag, ref.Reference())
+		}
+	}
+	return nil
+}
+
+// Detach detaches the given tags from an object. Tags that do not exist or
+// that are not attached to the object are ignored.
+func Detach(ctx tagContext, ref mo.Reference, tagsToDetach ...infrav1.Tag) error {
+	if len(tagsToDetach) == 0 {
+		return nil
+	}
+	manager, err := ctx.GetSession().TagManager(ctx)
+	if err != nil {
+		return err
+	}
+	attached, err := listAttachedTagIDs(ctx, manager, ref)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tagsToDetach {
+		id, err := findTag(ctx, manager, tag)
+		if err != nil {
+			return err
+		}
+		if _, ok := attached[id]; !ok {
+			continue
+		}
+		ctx.GetLogger().Info("detaching tag", "tag", tag.String(), "object", ref.Reference())
+		if err := manager.DetachTag(ctx, id, ref); err != nil {
+			return errors.Wrapf(err, "unable to detach tag %q from %s", tag, ref.Reference())
+		}
+	}
+	return nil
+}
+
+// Delete deletes the given tag, which also detaches the tag from all
+// objects. A tag that does not exist is ignored.
+func Delete(ctx tagContext, tag infrav1.Tag) error {
+	manager, err := ctx.GetSession().TagManager(ctx)
+	if err != nil {
+		return err
+	}
+	id, err := findTag(ctx, manager, tag)
+	if err != nil || id == "" {
+		return err
+	}
+	ctx.GetLogger().Info("deleting tag", "tag", tag.String())
+	if err := manager.DeleteTag(ctx, &tags.Tag{ID: id}); err != nil {
+		return errors.Wrapf(err, "unable to delete tag %q", tag)
+	}
+	return nil
+}
+
+func listAttachedTagIDs(ctx tagContext, manager *tags.Manager, ref mo.Reference) (map[string]struct{}, error) {
+	ids, err := manager.ListAttachedTags(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list tags attached to %s", ref.Reference())
+	}
+	result := map[string]struct{}{}
+	for _, id := range ids {
+		result[id] = struct{}{}
+	}
+	return result, nil
+}
+
+// findCategory returns the ID of the category with the given name, or an
+// empty string if the category does not exist.
+func findCategory(ctx tagContext, manager *tags.Manager, name string) (string, error) {
+	categories, err := manager.GetCategories(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get tag categories")
+	}
+	for _, category := range categories {
+		if category.Name == name {
+			return category.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// findTag returns the ID of the given tag, or an empty string if the tag
+// does not exist.
+func findTag(ctx tagContext, manager *tags.Manager, tag infrav1.Tag) (string, error) {
+	categoryID, err := findCategory(ctx, manager, tag.Category)
+	if err != nil || categoryID == "" {
+		return "", err
+	}
+	return findTagInCategory(ctx, manager, categoryID, tag)
+}
+
+func findTagInCategory(ctx tagContext, manager *tags.Manager, categoryID string, tag infrav1.Tag) (string, error) {
+	categoryTags, err := manager.GetTagsForCategory(ctx, categoryID)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get tags in category %q", tag.Category)
+	}
+	for _, t := range categoryTags {
+		if t.Name == tag.Name {
+			return t.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// ensureTag returns the ID of the given tag, creating the tag and its
+// category if they do not exist.
+func ensureTag(ctx tagContext, manager *tags.Manager, tag infrav1.Tag) (string, error) {
+	categoryID, err := findCategory(ctx, manager, tag.Category)
+	if err != nil {
+		return "", err
+	}
+	if categoryID == "" {
+		ctx.GetLogger().Info("creating tag category", "category", tag.Category)
+		if categoryID, err = manager.CreateCategory(ctx, &tags.Category{
+			Name:        tag.Category,
+			Cardinality: "MULTIPLE",
+		}); err != nil {
+			return "", errors.Wrapf(err, "unable to create tag category %q", tag.Category)
+		}
+	}
+
+	id, err := findTagInCategory(ctx, manager, categoryID, tag)
+	if err != nil || id != "" {
+		return id, err
+	}
+	ctx.GetLogger().Info("creating tag", "tag", tag.String())
+	if id, err = manager.CreateTag(ctx, &tags.Tag{
+		Name:       tag.Name,
+		CategoryID: categoryID,
+	}); err != nil {
+		return "", errors.Wrapf(err, "unable to create tag %q", tag)
+	}
+	return id, nil
+}
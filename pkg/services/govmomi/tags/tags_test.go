@@ -0,0 +1,138 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tags
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/simulator"
+	vapi "github.com/vmware/govmomi/vapi/simulator"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+func TestMachineTags(t *testing.T) {
+	vsphereCluster := &infrav1.VSphereCluster{}
+	vsphereCluster.Namespace = "default"
+	vsphereCluster.Name = "test"
+	failureDomain := &infrav1.VSphereFailureDomain{}
+	failureDomain.Name = "zone-a"
+	failureDomain.Spec.Region = "region-1"
+
+	if tags := MachineTags(vsphereCluster, true, failureDomain); tags != nil {
+		t.Fatalf("expected no tags when tagging is disabled, got %v", tags)
+	}
+
+	vsphereCluster.Spec.Tagging = &infrav1.TaggingSpec{RoleCategory: "role"}
+	expected := []infrav1.Tag{
+		{Category: DefaultClusterCategory, Name: "default/test"},
+		{Category: "role", Name: WorkerRole},
+	}
+	if tags := MachineTags(vsphereCluster, false, failureDomain); !equalTags(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+
+	vsphereCluster.Spec.CloudProviderConfiguration.Labels.Zone = "k8s-zone"
+	vsphereCluster.Spec.CloudProviderConfiguration.Labels.Region = "k8s-region"
+	expected = []infrav1.Tag{
+		{Category: DefaultClusterCategory, Name: "default/test"},
+		{Category: "role", Name: ControlPlaneRole},
+		{Category: "k8s-zone", Name: "zone-a"},
+		{Category: "k8s-region", Name: "region-1"},
+	}
+	if tags := MachineTags(vsphereCluster, true, failureDomain); !equalTags(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+}
+
+func TestAttachDetachDelete(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+	sim.Model.Service.Handle(vapi.New(sim.Server.URL, simulator.Map.OptionManager().Setting))
+
+	ctx := sim.NewClusterContext(t)
+	authSession := ctx.Session
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine).Reference()
+	clusterTag := infrav1.Tag{Category: DefaultClusterCategory, Name: "default/test"}
+	roleTag := infrav1.Tag{Category: DefaultRoleCategory, Name: WorkerRole}
+
+	attachedTags := func() []infrav1.Tag {
+		manager, err := authSession.TagManager(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attached, err := manager.GetAttachedTags(ctx, vm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []infrav1.Tag
+		for _, tag := range attached {
+			category, err := manager.GetCategory(ctx, tag.CategoryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, infrav1.Tag{Category: category.Name, Name: tag.Name})
+		}
+		return result
+	}
+
+	// Attaching the tags twice should create and attach each tag once.
+	for i := 0; i < 2; i++ {
+		if err := Attach(ctx, vm, clusterTag, roleTag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if attached := attachedTags(); len(attached) != 2 {
+		t.Fatalf("expected 2 attached tags, got %v", attached)
+	}
+
+	if err := Detach(ctx, vm, roleTag, infrav1.Tag{Category: "missing", Name: "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if attached := attachedTags(); len(attached) != 1 || attached[0] != clusterTag {
+		t.Fatalf("expected only %v to be attached, got %v", clusterTag, attached)
+	}
+
+	if err := Delete(ctx, clusterTag); err != nil {
+		t.Fatal(err)
+	}
+	if attached := attachedTags(); len(attached) != 0 {
+		t.Fatalf("expected no attached tags, got %v", attached)
+	}
+	manager, _ := authSession.TagManager(ctx)
+	if id, err := findTag(ctx, manager, clusterTag); err != nil || id != "" {
+		t.Fatalf("expected tag %v to be deleted, got id=%q err=%v", clusterTag, id, err)
+	}
+	// Deleting a tag that does not exist is not an error.
+	if err := Delete(ctx, clusterTag); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func equalTags(a, b []infrav1.Tag) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
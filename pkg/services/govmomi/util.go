@@ -17,15 +17,14 @@ limitations under the License.
 package govmomi
 
 import (
+	"fmt"
 	gonet "net"
 
 	"github.com/pkg/errors"
-	"github.com/vmware/govmomi/object"
-	"github.com/vmware/govmomi/property"
 	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
-	"sigs.k8s.io/controller-runtime/pkg/event"
 
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/net"
 )
@@ -45,10 +44,14 @@ func sanitizeIPAddrs(ctx *context.VMContext, ipAddrs []string) []string {
 	return newIPAddrs
 }
 
-// findVM searches for a VM in one of two ways:
+// findVM searches for a VM in one of three ways:
 //   1. If the BIOS UUID is available, then it is used to find the VM.
 //   2. Lacking the BIOS UUID, the VM is queried by its instance UUID,
 //      which was assigned the value of the VSphereVM resource's UID string.
+//   3. Lacking a VM with that instance UUID, the VM is queried by its name
+//      and must be owned by the VSphereVM. This finds the VM of a VSphereVM
+//      that was moved to another management cluster, and so has a new UID,
+//      before its BIOS UUID was recorded.
 func findVM(ctx *context.VMContext) (types.ManagedObjectReference, error) {
 	if biosUUID := ctx.VSphereVM.Spec.BiosUUID; biosUUID != "" {
 		objRef, err := ctx.Session.FindByBIOSUUID(ctx, biosUUID)
@@ -66,10 +69,13 @@ func findVM(ctx *context.VMContext) (types.ManagedObjectReference, error) {
 	if err != nil {
 		return types.ManagedObjectReference{}, err
 	}
-	if objRef == nil {
-		return types.ManagedObjectReference{}, errNotFound{instanceUUID: true, uuid: instanceUUID}
+	if objRef != nil {
+		return objRef.Reference(), nil
+	}
+	if ref, ok, err := findVMByOwner(ctx); err != nil || ok {
+		return ref, err
 	}
-	return objRef.Reference(), nil
+	return types.ManagedObjectReference{}, errNotFound{instanceUUID: true, uuid: instanceUUID}
 }
 
 func getTask(ctx *context.VMContext) *mo.Task {
@@ -121,60 +127,35 @@ func reconcileInFlightTask(ctx *context.VMContext) (bool, error) {
 	}
 }
 
-func reconcileVSphereVMWhenNetworkIsReady(
-	ctx *virtualMachineContext,
-	powerOnTask *object.Task) {
-
-	reconcileVSphereVMOnChannel(
-		&ctx.VMContext,
-		func() (<-chan []interface{}, <-chan error, error) {
-
-			// Wait for the VM to be powered on.
-			powerOnTaskInfo, err := powerOnTask.WaitForResult(ctx)
-			if err != nil && powerOnTaskInfo == nil {
-				return nil, nil, errors.Wrapf(err, "failed to wait for power on op for vm %s", ctx)
-			}
-			powerState, err := ctx.Obj.PowerState(ctx)
-			if err != nil {
-				return nil, nil, errors.Wrapf(err, "failed to get power state for vm %s", ctx)
-			}
-			if powerState != types.VirtualMachinePowerStatePoweredOn {
-				return nil, nil, errors.Errorf(
-					"unexpected power state %v for vm %s",
-					powerState, ctx)
-			}
-
-			// Wait for all NICs to have valid MAC addresses.
-			if err := waitForMacAddresses(ctx); err != nil {
-				return nil, nil, errors.Wrapf(err, "failed to wait for mac addresses for vm %s", ctx)
-			}
-
-			// Get all the MAC addresses. This is done separately from waiting
-			// for all NICs to have MAC addresses in order to ensure the order
-			// of the retrieved MAC addresses matches the order of the device
-			// specs, and not the propery change order.
-			_, macToDeviceIndex, deviceToMacIndex, err := getMacAddresses(ctx)
-			if err != nil {
-				return nil, nil, errors.Wrapf(err, "failed to get mac addresses for vm %s", ctx)
-			}
+// reconcileVSphereVMWhenNetworkIsReady triggers a reconcile request for the
+// VSphereVM every time a requested IP address is discovered, until the VM has
+// all of the requested IP addresses.
+func reconcileVSphereVMWhenNetworkIsReady(ctx *virtualMachineContext) {
+	// Get all the MAC addresses in order to map the guest's NICs to the
+	// device specs.
+	macAddresses, macToDeviceIndex, deviceToMacIndex, err := getMacAddresses(ctx)
+	if err != nil {
+		ctx.Logger.Error(err, "failed to get mac addresses")
+		return
+	}
 
-			// Wait for the IP addresses to show up for the VM.
-			chanIPAddresses, chanErrs := waitForIPAddresses(ctx, macToDeviceIndex, deviceToMacIndex)
+	// A NIC without a MAC address cannot be mapped to its device spec yet,
+	// so a reconcile is triggered the next time the guest's network changes
+	// instead.
+	for _, mac := range macAddresses {
+		if mac == "" {
+			watchVMProperty(ctx, "guest.net", func(interface{}) (bool, bool) {
+				return true, true
+			})
+			return
+		}
+	}
 
-			// Trigger a reconcile every time a new IP is discovered.
-			chanOfLoggerKeysAndValues := make(chan []interface{})
-			go func() {
-				for ip := range chanIPAddresses {
-					chanOfLoggerKeysAndValues <- []interface{}{
-						"reason", "network",
-						"ipAddress", ip,
-					}
-				}
-			}()
-			return chanOfLoggerKeysAndValues, chanErrs, nil
-		})
+	watchVMProperty(ctx, "guest.net", newIPAddressHandler(ctx, macToDeviceIndex, deviceToMacIndex))
 }
 
+// reconcileVSphereVMOnTaskCompletion triggers a reconcile request for the
+// VSphereVM once its in-flight task completes.
 func reconcileVSphereVMOnTaskCompletion(ctx *context.VMContext) {
 	task := getTask(ctx)
 	if task == nil {
@@ -184,7 +165,6 @@ func reconcileVSphereVMOnTaskCompletion(ctx *context.VMContext) {
 		return
 	}
 	taskRef := task.Reference()
-	taskHelper := object.NewTask(ctx.Session.Client.Client, taskRef)
 
 	ctx.Logger.Info(
 		"enqueuing reconcile request on task completion",
@@ -193,126 +173,13 @@ func reconcileVSphereVMOnTaskCompletion(ctx *context.VMContext) {
 		"task-entity-name", task.Info.EntityName,
 		"task-description-id", task.Info.DescriptionId)
 
-	reconcileVSphereVMOnFuncCompletion(ctx, func() ([]interface{}, error) {
-		taskInfo, err := taskHelper.WaitForResult(ctx)
-
-		// An error is only returned if the process of waiting for the result
-		// failed, *not* if the task itself failed.
-		if err != nil && taskInfo == nil {
-			return nil, err
-		}
-
-		return []interface{}{
-			"reason", "task",
-			"task-ref", taskRef,
-			"task-name", taskInfo.Name,
-			"task-entity-name", taskInfo.EntityName,
-			"task-state", taskInfo.State,
-			"task-description-id", taskInfo.DescriptionId,
-		}, nil
-	})
-}
-
-func reconcileVSphereVMOnFuncCompletion(
-	ctx *context.VMContext,
-	waitFn func() (loggerKeysAndValues []interface{}, _ error)) {
-
-	obj := ctx.VSphereVM.DeepCopy()
-	gvk := obj.GetObjectKind().GroupVersionKind()
-
-	// Wait on the function to complete in a background goroutine.
-	go func() {
-		loggerKeysAndValues, err := waitFn()
-		if err != nil {
-			ctx.Logger.Error(err, "failed to wait on func")
-			return
-		}
-
-		// Once the task has completed (successfully or otherwise), trigger
-		// a reconcile event for the associated resource by sending a
-		// GenericEvent into the event channel for the resource type.
-		ctx.Logger.Info("triggering GenericEvent", loggerKeysAndValues...)
-		eventChannel := ctx.GetGenericEventChannelFor(gvk)
-		eventChannel <- event.GenericEvent{
-			Meta:   obj,
-			Object: obj,
-		}
-	}()
-}
-
-func reconcileVSphereVMOnChannel(
-	ctx *context.VMContext,
-	waitFn func() (<-chan []interface{}, <-chan error, error)) {
-
-	obj := ctx.VSphereVM.DeepCopy()
-	gvk := obj.GetObjectKind().GroupVersionKind()
-
-	// Send a generic event for every set of logger keys/values received
-	// on the channel.
-	go func() {
-		chanOfLoggerKeysAndValues, chanErrs, err := waitFn()
-		if err != nil {
-			ctx.Logger.Error(err, "failed to wait on func")
-			return
-		}
-		for {
-			select {
-			case loggerKeysAndValues := <-chanOfLoggerKeysAndValues:
-				if loggerKeysAndValues == nil {
-					return
-				}
-				go func() {
-					// Trigger a reconcile event for the associated resource by
-					// sending a GenericEvent into the event channel for the resource
-					// type.
-					ctx.Logger.Info("triggering GenericEvent", loggerKeysAndValues...)
-					eventChannel := ctx.GetGenericEventChannelFor(gvk)
-					eventChannel <- event.GenericEvent{
-						Meta:   obj,
-						Object: obj,
-					}
-				}()
-			case err := <-chanErrs:
-				if err != nil {
-					ctx.Logger.Error(err, "error occurred while waiting to trigger a generic event")
-				}
-				return
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-}
-
-// waitForMacAddresses waits for all configured network devices to have
-// valid MAC addresses.
-func waitForMacAddresses(ctx *virtualMachineContext) error {
-	return property.Wait(
-		ctx, property.DefaultCollector(ctx.Session.Client.Client),
-		ctx.Obj.Reference(), []string{"config.hardware.device"},
-		func(propertyChanges []types.PropertyChange) bool {
-			for _, propChange := range propertyChanges {
-				if propChange.Op != types.PropertyChangeOpAssign {
-					continue
-				}
-				deviceList := object.VirtualDeviceList(propChange.Val.(types.ArrayOfVirtualDevice).VirtualDevice)
-				for _, dev := range deviceList {
-					if nic, ok := dev.(types.BaseVirtualEthernetCard); ok {
-						mac := nic.GetVirtualEthernetCard().MacAddress
-						if mac == "" {
-							return false
-						}
-					}
-				}
-			}
-			return true
-		})
+	watchTask(ctx, taskRef)
 }
 
 // getMacAddresses gets the MAC addresses for all network devices.
-// This happens separately from waitForMacAddresses to ensure returned order of
-// devices matches the spec and not order in which the propery changes were
-// noticed.
+// This happens separately from handling the changes to the guest's network to
+// ensure returned order of devices matches the spec and not order in which the
+// propery changes were noticed.
 func getMacAddresses(ctx *virtualMachineContext) ([]string, map[string]int, map[int]string, error) {
 	var (
 		vm                   mo.VirtualMachine
@@ -336,41 +203,136 @@ func getMacAddresses(ctx *virtualMachineContext) ([]string, map[string]int, map[
 	return macAddresses, macToDeviceSpecIndex, deviceSpecIndexToMac, nil
 }
 
-// waitForIPAddresses waits for all network devices that should be getting an
-// IP address to have an IP address. This is any network device that specifies a
-// network name and DHCP for v4 or v6 or one or more static IP addresses.
+// networkInterface describes the addresses a VM's network interface should
+// have. The interface is either a network device, or a bond, VLAN or bridge
+// whose addresses are reported by VMware Tools with the MAC address of one of
+// the network devices on which the interface is built.
+type networkInterface struct {
+	name    string
+	devices []int
+	dhcp4   bool
+	dhcp6   bool
+	ipAddrs []string
+}
+
+// hasDevice returns true if the interface is built on the network device.
+func (n networkInterface) hasDevice(deviceIndex int) bool {
+	for _, i := range n.devices {
+		if i == deviceIndex {
+			return true
+		}
+	}
+	return false
+}
+
+// getNetworkInterfaces returns the network interfaces described by the
+// network spec. A bond is built on its member devices, a VLAN on its device
+// or the devices of its bond, and a bridge on its member devices and the
+// devices of its member bonds and VLANs.
+func getNetworkInterfaces(spec infrav1.NetworkSpec) []networkInterface {
+	var (
+		interfaces    []networkInterface
+		devicesByName = map[string][]int{}
+	)
+	toInts := func(indexes []int32) []int {
+		ints := make([]int, len(indexes))
+		for i := range indexes {
+			ints[i] = int(indexes[i])
+		}
+		return ints
+	}
+	add := func(name string, devices []int, config infrav1.NetworkInterfaceConfig) {
+		devicesByName[name] = devices
+		interfaces = append(interfaces, networkInterface{
+			name:    name,
+			devices: devices,
+			dhcp4:   config.DHCP4,
+			dhcp6:   config.DHCP6,
+			ipAddrs: config.IPAddrs,
+		})
+	}
+	for i, device := range spec.Devices {
+		interfaces = append(interfaces, networkInterface{
+			name:    fmt.Sprintf("id%d", i),
+			devices: []int{i},
+			dhcp4:   device.DHCP4,
+			dhcp6:   device.DHCP6,
+			ipAddrs: device.IPAddrs,
+		})
+	}
+	for _, bond := range spec.Bonds {
+		add(bond.Name, toInts(bond.Devices), bond.NetworkInterfaceConfig)
+	}
+	for _, vlan := range spec.VLANs {
+		devices := devicesByName[vlan.Bond]
+		if vlan.Device != nil {
+			devices = []int{int(*vlan.Device)}
+		}
+		add(vlan.Name, devices, vlan.NetworkInterfaceConfig)
+	}
+	for _, bridge := range spec.Bridges {
+		devices := toInts(bridge.Devices)
+		for _, name := range bridge.Interfaces {
+			devices = append(devices, devicesByName[name]...)
+		}
+		add(bridge.Name, devices, bridge.NetworkInterfaceConfig)
+	}
+	return interfaces
+}
+
+// isStaticIPAddr returns true if the IP address is one of the static IP
+// addresses, which may include a prefix length.
+func isStaticIPAddr(ipAddr string, staticIPAddrs []string) bool {
+	for _, staticIPAddr := range staticIPAddrs {
+		if ip, _, err := gonet.ParseCIDR(staticIPAddr); err == nil {
+			staticIPAddr = ip.String()
+		}
+		if ipAddr == staticIPAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// newIPAddressHandler returns a handler for changes to the guest's network
+// that triggers a reconcile every time an IP address is discovered, and that
+// is done once all network interfaces that should be getting an IP address
+// have an IP address. This is any network device, bond, VLAN or bridge that
+// specifies DHCP for v4 or v6 or one or more static IP addresses. The
+// addresses of a bond, VLAN or bridge are discovered on the network devices
+// on which it is built.
 // The gocyclo detector is disabled for this function as it is difficult to
 // rewrite muchs simpler due to the maps used to track state and the lambdas
 // that use the maps.
 // nolint:gocyclo
-func waitForIPAddresses(
+func newIPAddressHandler(
 	ctx *virtualMachineContext,
 	macToDeviceIndex map[string]int,
-	deviceToMacIndex map[int]string) (<-chan string, <-chan error) {
+	deviceToMacIndex map[int]string) propertyChangeHandler {
 
 	var (
-		chanErrs          = make(chan error)
-		chanIPAddresses   = make(chan string)
-		macToHasIPv4Lease = map[string]struct{}{}
-		macToHasIPv6Lease = map[string]struct{}{}
-		macToSkipped      = map[string]map[string]struct{}{}
-		macToHasStaticIP  = map[string]map[string]struct{}{}
-		propCollector     = property.DefaultCollector(ctx.Session.Client.Client)
+		numDevices          = len(ctx.VSphereVM.Spec.Network.Devices)
+		interfaces          = getNetworkInterfaces(ctx.VSphereVM.Spec.Network)
+		ifaceToHasIPv4Lease = map[int]struct{}{}
+		ifaceToHasIPv6Lease = map[int]struct{}{}
+		ifaceToHasStaticIP  = map[int]map[string]struct{}{}
+		macToSkipped        = map[string]map[string]struct{}{}
 	)
 
 	// Initialize the nested maps early.
 	for mac := range macToDeviceIndex {
 		macToSkipped[mac] = map[string]struct{}{}
-		macToHasStaticIP[mac] = map[string]struct{}{}
+	}
+	for i := range interfaces {
+		ifaceToHasStaticIP[i] = map[string]struct{}{}
 	}
 
-	onPropertyChange := func(propertyChanges []types.PropertyChange) bool {
-		for _, propChange := range propertyChanges {
-			if propChange.Op != types.PropertyChangeOpAssign {
-				continue
-			}
-			nics := propChange.Val.(types.ArrayOfGuestNicInfo).GuestNicInfo
-			for _, nic := range nics {
+	return func(value interface{}) (bool, bool) {
+		// Every discovered IP address triggers a reconcile.
+		discovered := false
+
+		if guestNet, ok := value.(types.ArrayOfGuestNicInfo); ok {
+			for _, nic := range guestNet.GuestNicInfo {
 				mac := nic.MacAddress
 				if mac == "" || nic.IpConfig == nil {
 					continue
@@ -379,21 +341,18 @@ func waitForIPAddresses(
 				// device spec.
 				deviceSpecIndex, ok := macToDeviceIndex[mac]
 				if !ok {
-					chanErrs <- errors.Errorf("unknown device spec index for mac %s while waiting for ip addresses for vm %s", mac, ctx)
-					// Return true to stop the property collector from waiting
-					// on any more changes.
-					return true
+					ctx.Logger.Error(errors.Errorf("unknown device spec index for mac %s while waiting for ip addresses for vm %s", mac, ctx),
+						"error occurred while waiting to trigger a generic event")
+					// Return true to stop waiting on any more changes.
+					return discovered, true
 				}
-				if deviceSpecIndex < 0 || deviceSpecIndex >= len(ctx.VSphereVM.Spec.Network.Devices) {
-					chanErrs <- errors.Errorf("invalid device spec index %d for mac %s while waiting for ip addresses for vm %s", deviceSpecIndex, mac, ctx)
-					// Return true to stop the property collector from waiting
-					// on any more changes.
-					return true
+				if deviceSpecIndex < 0 || deviceSpecIndex >= numDevices {
+					ctx.Logger.Error(errors.Errorf("invalid device spec index %d for mac %s while waiting for ip addresses for vm %s", deviceSpecIndex, mac, ctx),
+						"error occurred while waiting to trigger a generic event")
+					// Return true to stop waiting on any more changes.
+					return discovered, true
 				}
 
-				// Get the network device spec that corresponds to the MAC.
-				deviceSpec := ctx.VSphereVM.Spec.Network.Devices[deviceSpecIndex]
-
 				// Look at each IP and determine whether or not a reconcile has
 				// been triggered for the IP.
 				for _, discoveredIPInfo := range nic.IpConfig.IpAddress {
@@ -408,54 +367,55 @@ func waitForIPAddresses(
 						continue
 					}
 
-					// Check to see if the IP is in the list of the device
-					// spec's static IP addresses.
-					isStatic := false
-					for _, specIP := range deviceSpec.IPAddrs {
-						if discoveredIP == specIP {
-							isStatic = true
-							break
+					// The IP may belong to any of the interfaces built on the
+					// device that corresponds to the MAC.
+					for i, iface := range interfaces {
+						if !iface.hasDevice(deviceSpecIndex) {
+							continue
 						}
-					}
 
-					// If it's a static IP then check to see if the IP has
-					// triggered a reconcile yet.
-					switch {
-					case isStatic:
-						if _, ok := macToHasStaticIP[mac][discoveredIP]; !ok {
-							// No reconcile yet. Record the IP send it to the
-							// channel.
-							ctx.Logger.Info(
-								"discovered IP address",
-								"addressType", "static",
-								"addressValue", discoveredIP)
-							macToHasStaticIP[mac][discoveredIP] = struct{}{}
-							chanIPAddresses <- discoveredIP
-						}
-					case gonet.ParseIP(discoveredIP).To4() != nil:
-						// An IPv4 address...
-						if deviceSpec.DHCP4 {
-							// Has an IPv4 lease been discovered yet?
-							if _, ok := macToHasIPv4Lease[mac]; !ok {
+						// If it's one of the interface's static IPs then check
+						// to see if the IP has triggered a reconcile yet.
+						switch {
+						case isStaticIPAddr(discoveredIP, iface.ipAddrs):
+							if _, ok := ifaceToHasStaticIP[i][discoveredIP]; !ok {
+								// No reconcile yet. Record the IP and trigger a
+								// reconcile.
 								ctx.Logger.Info(
 									"discovered IP address",
-									"addressType", "dhcp4",
+									"interface", iface.name,
+									"addressType", "static",
 									"addressValue", discoveredIP)
-								macToHasIPv4Lease[mac] = struct{}{}
-								chanIPAddresses <- discoveredIP
+								ifaceToHasStaticIP[i][discoveredIP] = struct{}{}
+								discovered = true
 							}
-						}
-					default:
-						// An IPv6 address..
-						if deviceSpec.DHCP6 {
-							// Has an IPv6 lease been discovered yet?
-							if _, ok := macToHasIPv6Lease[mac]; !ok {
-								ctx.Logger.Info(
-									"discovered IP address",
-									"addressType", "dhcp6",
-									"addressValue", discoveredIP)
-								macToHasIPv6Lease[mac] = struct{}{}
-								chanIPAddresses <- discoveredIP
+						case gonet.ParseIP(discoveredIP).To4() != nil:
+							// An IPv4 address...
+							if iface.dhcp4 {
+								// Has an IPv4 lease been discovered yet?
+								if _, ok := ifaceToHasIPv4Lease[i]; !ok {
+									ctx.Logger.Info(
+										"discovered IP address",
+										"interface", iface.name,
+										"addressType", "dhcp4",
+										"addressValue", discoveredIP)
+									ifaceToHasIPv4Lease[i] = struct{}{}
+									discovered = true
+								}
+							}
+						default:
+							// An IPv6 address..
+							if iface.dhcp6 {
+								// Has an IPv6 lease been discovered yet?
+								if _, ok := ifaceToHasIPv6Lease[i]; !ok {
+									ctx.Logger.Info(
+										"discovered IP address",
+										"interface", iface.name,
+										"addressType", "dhcp6",
+										"addressValue", discoveredIP)
+									ifaceToHasIPv6Lease[i] = struct{}{}
+									discovered = true
+								}
 							}
 						}
 					}
@@ -465,66 +425,56 @@ func waitForIPAddresses(
 
 		// Determine whether or not the wait operation is over by whether
 		// or not the VM has all of the requested IP addresses.
-		for i, deviceSpec := range ctx.VSphereVM.Spec.Network.Devices {
-			mac, ok := deviceToMacIndex[i]
-			if !ok {
-				chanErrs <- errors.Errorf("invalid mac index %d waiting for ip addresses for vm %s", i, ctx)
-
-				// Return true to stop the property collector from waiting
-				// on any more changes.
-				return true
+		for i := 0; i < numDevices; i++ {
+			if _, ok := deviceToMacIndex[i]; !ok {
+				ctx.Logger.Error(errors.Errorf("invalid mac index %d waiting for ip addresses for vm %s", i, ctx),
+					"error occurred while waiting to trigger a generic event")
+
+				// Return true to stop waiting on any more changes.
+				return discovered, true
 			}
-			// If the device spec requires DHCP4 then the Wait is not
+		}
+		for i, iface := range interfaces {
+			// If the interface requires DHCP4 then the Wait is not
 			// over if there is no IPv4 lease.
-			if deviceSpec.DHCP4 {
-				if _, ok := macToHasIPv4Lease[mac]; !ok {
+			if iface.dhcp4 {
+				if _, ok := ifaceToHasIPv4Lease[i]; !ok {
 					ctx.Logger.Info(
 						"the VM is missing the requested IP address",
+						"interface", iface.name,
 						"addressType", "dhcp4")
-					return false
+					return discovered, false
 				}
 			}
-			// If the device spec requires DHCP6 then the Wait is not
-			// over if there is no IPv4 lease.
-			if deviceSpec.DHCP6 {
-				if _, ok := macToHasIPv6Lease[mac]; !ok {
+			// If the interface requires DHCP6 then the Wait is not
+			// over if there is no IPv6 lease.
+			if iface.dhcp6 {
+				if _, ok := ifaceToHasIPv6Lease[i]; !ok {
 					ctx.Logger.Info(
 						"the VM is missing the requested IP address",
+						"interface", iface.name,
 						"addressType", "dhcp6")
-					return false
+					return discovered, false
 				}
 			}
-			// If the device spec requires static IP addresses, the wait
-			// is not over if the device lacks one of those addresses.
-			for _, specIP := range deviceSpec.IPAddrs {
-				if _, ok := macToHasStaticIP[mac][specIP]; !ok {
+			// If the interface requires static IP addresses, the wait
+			// is not over if the interface lacks one of those addresses.
+			for _, specIP := range iface.ipAddrs {
+				if ip, _, err := gonet.ParseCIDR(specIP); err == nil {
+					specIP = ip.String()
+				}
+				if _, ok := ifaceToHasStaticIP[i][specIP]; !ok {
 					ctx.Logger.Info(
 						"the VM is missing the requested IP address",
+						"interface", iface.name,
 						"addressType", "static",
 						"addressValue", specIP)
-					return false
+					return discovered, false
 				}
 			}
 		}
 
 		ctx.Logger.Info("the VM has all of the requested IP addresses")
-		return true
+		return discovered, true
 	}
-
-	// The wait function will not return true until all the VM's
-	// network devices have IP assignments that match the requested
-	// network devie specs. However, every time a new IP is discovered,
-	// a reconcile request will be triggered for the VSphereVM.
-	go func() {
-		if err := property.Wait(
-			ctx, propCollector, ctx.Obj.Reference(),
-			[]string{"guest.net"}, onPropertyChange); err != nil {
-
-			chanErrs <- errors.Wrapf(err, "failed to wait for ip addresses for vm %s", ctx)
-		}
-		close(chanIPAddresses)
-		close(chanErrs)
-	}()
-
-	return chanIPAddresses, chanErrs
 }
@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"reflect"
+	"testing"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+func TestGetNetworkInterfaces(t *testing.T) {
+	device := int32(2)
+	spec := infrav1.NetworkSpec{
+		Devices: []infrav1.NetworkDeviceSpec{
+			{DHCP4: true},
+			{},
+			{},
+			{},
+		},
+		Bonds: []infrav1.NetworkBondSpec{
+			{
+				Name:    "bond0",
+				Devices: []int32{0, 1},
+			},
+		},
+		VLANs: []infrav1.NetworkVLANSpec{
+			{
+				Name: "bond0.100",
+				ID:   100,
+				Bond: "bond0",
+				NetworkInterfaceConfig: infrav1.NetworkInterfaceConfig{
+					DHCP6: true,
+				},
+			},
+			{
+				Name:   "vlan200",
+				ID:     200,
+				Device: &device,
+			},
+		},
+		Bridges: []infrav1.NetworkBridgeSpec{
+			{
+				Name:       "br0",
+				Devices:    []int32{3},
+				Interfaces: []string{"vlan200"},
+				NetworkInterfaceConfig: infrav1.NetworkInterfaceConfig{
+					IPAddrs: []string{"192.168.4.21/24"},
+				},
+			},
+		},
+	}
+
+	expected := []networkInterface{
+		{name: "id0", devices: []int{0}, dhcp4: true},
+		{name: "id1", devices: []int{1}},
+		{name: "id2", devices: []int{2}},
+		{name: "id3", devices: []int{3}},
+		{name: "bond0", devices: []int{0, 1}},
+		{name: "bond0.100", devices: []int{0, 1}, dhcp6: true},
+		{name: "vlan200", devices: []int{2}},
+		{name: "br0", devices: []int{3, 2}, ipAddrs: []string{"192.168.4.21/24"}},
+	}
+	if actual := getNetworkInterfaces(spec); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected interfaces %+v, got %+v", expected, actual)
+	}
+}
+
+func TestIsStaticIPAddr(t *testing.T) {
+	staticIPAddrs := []string{"192.168.4.21/24", "fd00::21"}
+	for ipAddr, expected := range map[string]bool{
+		"192.168.4.21": true,
+		"fd00::21":     true,
+		"192.168.4.22": false,
+	} {
+		if actual := isStaticIPAddr(ipAddr, staticIPAddrs); actual != expected {
+			t.Errorf("expected isStaticIPAddr(%q) to be %v", ipAddr, expected)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"encoding/json"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+// AnnotationVSphereVMField is the field of a VM's JSON annotation that
+// identifies the VSphereVM resource.
+const AnnotationVSphereVMField = "vsphereVM"
+
+// Annotation returns the annotation of the VM. The annotation identifies the
+// VSphereVM resource, and is a JSON object if the VSphereVM has annotation
+// fields.
+func Annotation(ctx *context.VMContext) string {
+	if len(ctx.VSphereVM.Spec.AnnotationFields) == 0 {
+		return ctx.String()
+	}
+	fields := make(map[string]string, len(ctx.VSphereVM.Spec.AnnotationFields)+1)
+	for k, v := range ctx.VSphereVM.Spec.AnnotationFields {
+		fields[k] = v
+	}
+	fields[AnnotationVSphereVMField] = ctx.String()
+	// Marshaling a map of strings cannot fail, and the keys are sorted, so
+	// the result may be compared with the VM's current annotation.
+	data, _ := json.Marshal(fields)
+	return string(data)
+}
@@ -26,6 +26,7 @@ import (
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/template"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
 )
 
 const (
@@ -34,7 +35,11 @@ const (
 )
 
 // Clone kicks off a clone operation on vCenter to create a new virtual machine.
-func Clone(ctx *context.VMContext, bootstrapData []byte) error {
+// Bootstrap data in the ignition format is applied to the clone spec with the
+// VM's hostname and network configuration embedded in it. The network
+// devices are matched by the MAC addresses in the VM's spec, if any, since
+// the generated MAC addresses are not known until the VM is cloned.
+func Clone(ctx *context.VMContext, bootstrapData []byte, bootstrapFormat infrav1.BootstrapFormat) error {
 	ctx = &context.VMContext{
 		ControllerContext: ctx.ControllerContext,
 		VSphereVM:         ctx.VSphereVM,
@@ -44,10 +49,23 @@ func Clone(ctx *context.VMContext, bootstrapData []byte) error {
 	}
 	ctx.Logger.Info("starting clone process")
 
+	// The owner of the VM is recorded so a VM whose VSphereVM no longer
+	// exists may be found.
 	var extraConfig extra.Config
+	extraConfig.SetOwner(ctx.VSphereVM.Namespace, ctx.VSphereVM.Name, string(ctx.VSphereVM.UID), ctx.ManagementClusterID)
 	if len(bootstrapData) > 0 {
+		if bootstrapFormat == infrav1.BootstrapFormatIgnition {
+			config, err := util.GetMachineIgnitionConfig(bootstrapData, ctx.VSphereVM.Name, *ctx.VSphereVM)
+			if err != nil {
+				return err
+			}
+			if err := extraConfig.SetIgnitionConfigData(config); err != nil {
+				return errors.Wrapf(err, "unable to apply bootstrap data to clone spec for %q", ctx)
+			}
+		} else if err := extraConfig.SetCloudInitUserData(bootstrapData); err != nil {
+			return errors.Wrapf(err, "unable to apply bootstrap data to clone spec for %q", ctx)
+		}
 		ctx.Logger.Info("applied bootstrap data to VM clone spec")
-		extraConfig.SetCloudInitUserData(bootstrapData)
 	}
 
 	tpl, err := template.FindTemplate(ctx, ctx.VSphereVM.Spec.Template)
@@ -55,10 +73,40 @@ func Clone(ctx *context.VMContext, bootstrapData []byte) error {
 		return err
 	}
 
+	folder, err := ctx.Session.Finder.FolderOrDefault(ctx, ctx.VSphereVM.Spec.Folder)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get folder for %q", ctx)
+	}
+
+	datastore, err := ctx.Session.Finder.DatastoreOrDefault(ctx, ctx.VSphereVM.Spec.Datastore)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get datastore for %q", ctx)
+	}
+
+	pool, err := ctx.Session.Finder.ResourcePoolOrDefault(ctx, ctx.VSphereVM.Spec.ResourcePool)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get resource pool for %q", ctx)
+	}
+
+	// If an instant clone is requested then the source must be a running VM.
+	// Otherwise the instant clone falls back to a linked clone.
+	// An Ignition config is applied when the guest first boots, so an
+	// instant clone of a running VM cannot be bootstrapped with Ignition.
+	if ctx.VSphereVM.Spec.CloneMode == infrav1.InstantClone && bootstrapFormat == infrav1.BootstrapFormatIgnition {
+		ctx.Logger.Info("instant clone not supported, falling back to linked clone", "reason", "bootstrap-format")
+	} else if ctx.VSphereVM.Spec.CloneMode == infrav1.InstantClone {
+		ctx.Logger.Info("instant clone requested")
+		ok, err := instantClone(ctx, tpl, folder, datastore, pool, extraConfig)
+		if err != nil || ok {
+			return err
+		}
+	}
+
 	// If a linked clone is requested then a MoRef for a snapshot must be
 	// found with which to perform the linked clone.
 	var snapshotRef *types.ManagedObjectReference
-	if ctx.VSphereVM.Spec.CloneMode == "" || ctx.VSphereVM.Spec.CloneMode == infrav1.LinkedClone {
+	switch ctx.VSphereVM.Spec.CloneMode {
+	case "", infrav1.LinkedClone, infrav1.InstantClone:
 		ctx.Logger.Info("linked clone requested")
 		// If the name of a snapshot was not provided then find the template's
 		// current snapshot.
@@ -92,21 +140,7 @@ func Clone(ctx *context.VMContext, bootstrapData []byte) error {
 		ctx.VSphereVM.Status.Snapshot = snapshotRef.Value
 		diskMoveType = linkCloneDiskMoveType
 	}
-
-	folder, err := ctx.Session.Finder.FolderOrDefault(ctx, ctx.VSphereVM.Spec.Folder)
-	if err != nil {
-		return errors.Wrapf(err, "unable to get folder for %q", ctx)
-	}
-
-	datastore, err := ctx.Session.Finder.DatastoreOrDefault(ctx, ctx.VSphereVM.Spec.Datastore)
-	if err != nil {
-		return errors.Wrapf(err, "unable to get datastore for %q", ctx)
-	}
-
-	pool, err := ctx.Session.Finder.ResourcePoolOrDefault(ctx, ctx.VSphereVM.Spec.ResourcePool)
-	if err != nil {
-		return errors.Wrapf(err, "unable to get resource pool for %q", ctx)
-	}
+	extraConfig.SetCloneMode(string(ctx.VSphereVM.Status.CloneMode), ctx.VSphereVM.Status.Snapshot)
 
 	devices, err := tpl.Device(ctx)
 	if err != nil {
@@ -146,7 +180,7 @@ func Clone(ctx *context.VMContext, bootstrapData []byte) error {
 
 	spec := types.VirtualMachineCloneSpec{
 		Config: &types.VirtualMachineConfigSpec{
-			Annotation: ctx.String(),
+			Annotation: Annotation(ctx),
 			// Assign the clone's InstanceUUID the value of the Kubernetes Machine
 			// object's UID. This allows lookup of the cloned VM prior to knowing
 			// the VM's UUID.
@@ -0,0 +1,186 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+// instantCloneMinAPIVersion is the earliest version of the vSphere API that
+// supports the InstantClone_Task method.
+var instantCloneMinAPIVersion = [2]int{6, 7}
+
+// instantClone kicks off an instant clone operation from the running source
+// VM. False is returned without an error if the source does not support an
+// instant clone, in which case the caller should fall back to another clone
+// mode.
+func instantClone(
+	ctx *context.VMContext,
+	src *object.VirtualMachine,
+	folder *object.Folder,
+	datastore *object.Datastore,
+	pool *object.ResourcePool,
+	extraConfig extra.Config) (bool, error) {
+
+	if apiVersion := ctx.Session.ServiceContent.About.ApiVersion; !isInstantCloneSupported(apiVersion) {
+		ctx.Logger.Info("instant clone not supported, falling back to linked clone", "reason", "api-version", "api-version", apiVersion)
+		return false, nil
+	}
+
+	powerState, err := src.PowerState(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "error getting power state of source %s for %q", ctx.VSphereVM.Spec.Template, ctx)
+	}
+	if powerState != types.VirtualMachinePowerStatePoweredOn {
+		ctx.Logger.Info("instant clone not supported, falling back to linked clone", "reason", "power-state", "power-state", powerState)
+		return false, nil
+	}
+
+	devices, err := src.Device(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "error getting devices for %q", ctx)
+	}
+	networkSpecs, err := getInstantCloneNetworkSpecs(ctx, devices)
+	if err != nil {
+		return false, err
+	}
+	if networkSpecs == nil {
+		ctx.Logger.Info("instant clone not supported, falling back to linked clone", "reason", "network-devices")
+		return false, nil
+	}
+
+	// The guest is running when the clone operation completes, so the
+	// metadata is injected along with the userdata.
+	metadata, err := util.GetMachineMetadata(ctx.VSphereVM.Name, *ctx.VSphereVM)
+	if err != nil {
+		return false, err
+	}
+	extraConfig.SetCloudInitMetadata(metadata)
+	extraConfig.SetCloneMode(string(infrav1.InstantClone), "")
+
+	// An instant clone's instance UUID cannot be assigned, so the clone's
+	// BIOS UUID is assigned the value of the Kubernetes VSphereVM object's
+	// UID instead. This allows lookup of the cloned VM prior to the clone
+	// operation completing.
+	biosUUID := string(ctx.VSphereVM.UID)
+
+	spec := types.VirtualMachineInstantCloneSpec{
+		Name: ctx.VSphereVM.Name,
+		Location: types.VirtualMachineRelocateSpec{
+			Datastore:    types.NewReference(datastore.Reference()),
+			DeviceChange: networkSpecs,
+			Folder:       types.NewReference(folder.Reference()),
+			Pool:         types.NewReference(pool.Reference()),
+		},
+		Config:   extraConfig,
+		BiosUuid: biosUUID,
+	}
+
+	ctx.Logger.Info("cloning machine", "cloneType", infrav1.InstantClone, "cloneSpec", spec)
+	res, err := methods.InstantClone_Task(ctx, ctx.Session.Client.Client, &types.InstantClone_Task{
+		This: src.Reference(),
+		Spec: spec,
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "error trigging instant clone op for machine %s", ctx)
+	}
+
+	ctx.VSphereVM.Spec.BiosUUID = biosUUID
+	ctx.VSphereVM.Status.CloneMode = infrav1.InstantClone
+	ctx.VSphereVM.Status.Snapshot = ""
+	ctx.VSphereVM.Status.TaskRef = res.Returnval.Value
+
+	return true, nil
+}
+
+// getInstantCloneNetworkSpecs returns the device specs that connect the
+// source VM's NICs to the networks of the machine config. An instant clone
+// cannot add or remove devices, so nil is returned if the number of NICs on
+// the source does not match the machine config.
+func getInstantCloneNetworkSpecs(
+	ctx *context.VMContext,
+	devices object.VirtualDeviceList) ([]types.BaseVirtualDeviceConfigSpec, error) {
+
+	nics := devices.SelectByType((*types.VirtualEthernetCard)(nil))
+	if len(nics) != len(ctx.VSphereVM.Spec.Network.Devices) {
+		return nil, nil
+	}
+
+	deviceSpecs := []types.BaseVirtualDeviceConfigSpec{}
+	for i := range ctx.VSphereVM.Spec.Network.Devices {
+		netSpec := &ctx.VSphereVM.Spec.Network.Devices[i]
+		ref, err := ctx.Session.Finder.Network(ctx, netSpec.NetworkName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to find network %q", netSpec.NetworkName)
+		}
+		backing, err := ref.EthernetCardBackingInfo(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create new ethernet card backing info for network %q on %q", netSpec.NetworkName, ctx)
+		}
+
+		nic := nics[i].(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+		nic.Backing = backing
+
+		// The clone is assigned a new MAC address unless one is specified.
+		nic.MacAddress = ""
+		nic.AddressType = string(types.VirtualEthernetCardMacTypeGenerated)
+		if netSpec.MACAddr != "" {
+			nic.MacAddress = netSpec.MACAddr
+			nic.AddressType = string(types.VirtualEthernetCardMacTypeManual)
+			ctx.Logger.V(4).Info("configured manual mac address", "mac-addr", nic.MacAddress)
+		}
+
+		deviceSpecs = append(deviceSpecs, &types.VirtualDeviceConfigSpec{
+			Device:    nics[i],
+			Operation: types.VirtualDeviceConfigSpecOperationEdit,
+		})
+	}
+
+	return deviceSpecs, nil
+}
+
+// isInstantCloneSupported returns true if the provided vSphere API version
+// supports instant clones.
+func isInstantCloneSupported(apiVersion string) bool {
+	parts := strings.SplitN(apiVersion, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	if major != instantCloneMinAPIVersion[0] {
+		return major > instantCloneMinAPIVersion[0]
+	}
+	return minor >= instantCloneMinAPIVersion[1]
+}
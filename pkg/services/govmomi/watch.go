@@ -0,0 +1,514 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	goctx "context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+// vmWatchProperties are the properties of the VMs that are watched. A change
+// to one of them triggers a reconcile request for the VM's VSphereVM if a
+// handler is registered for the property.
+var vmWatchProperties = []string{
+	"runtime.powerState",
+	"guest.net",
+	"config.extraConfig",
+}
+
+// vmWatches are the watches of the VMs and tasks of the VSphereVMs. There is
+// a single watch per vSphere session instead of a goroutine and property
+// collector filter per VM.
+var vmWatches vmWatchRegistry
+
+// propertyChangeHandler is called with the value of a VM's property when it
+// changes. It returns whether a reconcile request should be triggered for the
+// VSphereVM, and whether the handler is done and should be removed.
+type propertyChangeHandler func(value interface{}) (trigger, done bool)
+
+// vmWatchRegistry is the watch of each vSphere session. Watches are only
+// started while RunVMWatches is running.
+type vmWatchRegistry struct {
+	sync.Mutex
+	ctx      *context.ControllerContext
+	runCtx   goctx.Context
+	wg       sync.WaitGroup
+	sessions map[sessionWatchKey]*sessionWatch
+}
+
+// sessionWatchKey identifies the watch of a vSphere session. Sessions that
+// share a client but not a datacenter have separate watches.
+type sessionWatchKey struct {
+	client     *vim25.Client
+	datacenter types.ManagedObjectReference
+}
+
+// sessionWatch is a single property collector filter over a ListView of the
+// VMs and tasks that are watched in a session. Only the VMs and tasks with a
+// handler are in the ListView, so the values of the other VMs and tasks in
+// the datacenter are neither sent nor cached.
+type sessionWatch struct {
+	sync.Mutex
+	ctx    *context.ControllerContext
+	runCtx goctx.Context
+	client *vim25.Client
+	view   *view.ListView
+
+	// vms are the handlers of the VSphereVMs, by VM.
+	vms map[types.ManagedObjectReference]*vmWatch
+
+	// values are the last seen values of the properties with a handler, by
+	// VM.
+	values map[types.ManagedObjectReference]map[string]interface{}
+
+	// tasks are the VSphereVMs waiting on tasks, by task.
+	tasks map[types.ManagedObjectReference]*infrav1.VSphereVM
+
+	// viewMu serializes the changes to the ListView, and inView are the VMs
+	// and tasks in the ListView.
+	viewMu sync.Mutex
+	inView map[types.ManagedObjectReference]struct{}
+}
+
+// vmWatch is the handlers of a VSphereVM's VM, by property.
+type vmWatch struct {
+	obj      *infrav1.VSphereVM
+	handlers map[string]propertyChangeHandler
+}
+
+// vmTrigger is a reconcile request for a VSphereVM.
+type vmTrigger struct {
+	obj                 *infrav1.VSphereVM
+	loggerKeysAndValues []interface{}
+}
+
+// RunVMWatches enables the watches that trigger reconcile requests for
+// VSphereVMs when their VMs or tasks change until the stop channel is
+// closed. The watches are then stopped before this function returns.
+func RunVMWatches(ctx *context.ControllerContext, stop <-chan struct{}) error {
+	runCtx, cancel := goctx.WithCancel(ctx)
+	vmWatches.Lock()
+	vmWatches.ctx = ctx
+	vmWatches.runCtx = runCtx
+	vmWatches.sessions = map[sessionWatchKey]*sessionWatch{}
+	vmWatches.Unlock()
+
+	ctx.Logger.Info("starting VM watches")
+	<-stop
+
+	vmWatches.Lock()
+	vmWatches.ctx = nil
+	vmWatches.runCtx = nil
+	vmWatches.sessions = nil
+	cancel()
+	vmWatches.Unlock()
+	vmWatches.wg.Wait()
+	ctx.Logger.Info("stopped VM watches")
+	return nil
+}
+
+// getSessionWatch returns the watch of the VM's session, which is started if
+// it is not running. Nil is returned if the watches are not enabled or the
+// watch could not be started.
+func getSessionWatch(ctx *context.VMContext) *sessionWatch {
+	vmWatches.Lock()
+	defer vmWatches.Unlock()
+
+	if vmWatches.sessions == nil {
+		ctx.Logger.V(4).Info("skipping watch", "reason", "watches-disabled")
+		return nil
+	}
+	key := sessionWatchKey{
+		client:     ctx.Session.Client.Client,
+		datacenter: ctx.Session.Datacenter().Reference(),
+	}
+	if w, ok := vmWatches.sessions[key]; ok {
+		return w
+	}
+
+	listView, err := view.NewManager(key.client).CreateListView(ctx, nil)
+	if err != nil {
+		ctx.Logger.Error(err, "failed to create list view for session watch")
+		return nil
+	}
+	w := &sessionWatch{
+		ctx:    vmWatches.ctx,
+		runCtx: vmWatches.runCtx,
+		client: key.client,
+		view:   listView,
+		vms:    map[types.ManagedObjectReference]*vmWatch{},
+		values: map[types.ManagedObjectReference]map[string]interface{}{},
+		tasks:  map[types.ManagedObjectReference]*infrav1.VSphereVM{},
+		inView: map[types.ManagedObjectReference]struct{}{},
+	}
+	vmWatches.sessions[key] = w
+
+	server := ctx.VSphereVM.Spec.Server
+	vmWatches.wg.Add(1)
+	go func() {
+		defer vmWatches.wg.Done()
+		w.ctx.Logger.Info("starting session watch", "server", server, "datacenter", key.datacenter)
+		var triggers []vmTrigger
+		if err := w.run(); err != nil && w.runCtx.Err() == nil {
+			w.ctx.Logger.Error(err, "session watch failed", "server", server, "datacenter", key.datacenter)
+			triggers = w.failedTriggers()
+		}
+		_ = w.view.Destroy(goctx.Background())
+
+		// A watch that failed, ex. because the session expired, is started
+		// again with the next session that is used. The VSphereVMs that were
+		// watched are reconciled so they register with the next session
+		// instead of waiting for their resync period.
+		vmWatches.Lock()
+		if vmWatches.sessions[key] == w {
+			delete(vmWatches.sessions, key)
+		}
+		vmWatches.Unlock()
+		for _, trigger := range triggers {
+			go triggerVSphereVMReconcile(w.runCtx, w.ctx, trigger)
+		}
+	}()
+	return w
+}
+
+// failedTriggers returns a reconcile request for each VSphereVM with a
+// handler or waiting on a task when the watch fails.
+func (w *sessionWatch) failedTriggers() []vmTrigger {
+	w.Lock()
+	defer w.Unlock()
+	objs := map[string]*infrav1.VSphereVM{}
+	for _, watch := range w.vms {
+		objs[watch.obj.Namespace+"/"+watch.obj.Name] = watch.obj
+	}
+	for _, obj := range w.tasks {
+		objs[obj.Namespace+"/"+obj.Name] = obj
+	}
+	triggers := make([]vmTrigger, 0, len(objs))
+	for _, obj := range objs {
+		triggers = append(triggers, vmTrigger{
+			obj:                 obj,
+			loggerKeysAndValues: []interface{}{"reason", "session-watch-failed"},
+		})
+	}
+	return triggers
+}
+
+// run waits for updates to the VMs and tasks until the context is canceled.
+func (w *sessionWatch) run() error {
+	filter := &property.WaitFilter{
+		CreateFilter: types.CreateFilter{
+			Spec: types.PropertyFilterSpec{
+				ObjectSet: []types.ObjectSpec{
+					{
+						Obj:  w.view.Reference(),
+						Skip: types.NewBool(true),
+						SelectSet: []types.BaseSelectionSpec{
+							&types.TraversalSpec{Type: "ListView", Path: "view"},
+						},
+					},
+				},
+				PropSet: []types.PropertySpec{
+					{Type: "VirtualMachine", PathSet: vmWatchProperties},
+					{Type: morefTypeTask, PathSet: []string{"info.state"}},
+				},
+			},
+		},
+	}
+	return property.WaitForUpdates(w.runCtx, property.DefaultCollector(w.client), filter, func(updates []types.ObjectUpdate) bool {
+		triggers, unwatched := w.apply(updates)
+
+		// The reconcile requests are sent asynchronously, as the event
+		// channel may block and the updates must keep being received.
+		for _, trigger := range triggers {
+			go triggerVSphereVMReconcile(w.runCtx, w.ctx, trigger)
+		}
+		for _, ref := range unwatched {
+			w.syncView(w.runCtx, ref)
+		}
+		return false
+	})
+}
+
+// apply records the updates and returns the reconcile requests they trigger
+// and the VMs and tasks that are no longer watched.
+func (w *sessionWatch) apply(updates []types.ObjectUpdate) ([]vmTrigger, []types.ManagedObjectReference) {
+	w.Lock()
+	defer w.Unlock()
+
+	var (
+		triggers  []vmTrigger
+		unwatched []types.ManagedObjectReference
+	)
+	for _, update := range updates {
+		ref := update.Obj
+
+		// A VM or task that no longer exists is forgotten.
+		if update.Kind == types.ObjectUpdateKindLeave {
+			delete(w.vms, ref)
+			delete(w.values, ref)
+			delete(w.tasks, ref)
+			unwatched = append(unwatched, ref)
+			continue
+		}
+
+		for _, change := range update.ChangeSet {
+			value := change.Val
+			if change.Op == types.PropertyChangeOpRemove || change.Op == types.PropertyChangeOpIndirectRemove {
+				value = nil
+			}
+
+			if ref.Type == morefTypeTask {
+				state, _ := value.(types.TaskInfoState)
+				if obj, ok := w.tasks[ref]; ok && isTaskDone(state) {
+					delete(w.tasks, ref)
+					unwatched = append(unwatched, ref)
+					triggers = append(triggers, vmTrigger{
+						obj:                 obj,
+						loggerKeysAndValues: []interface{}{"reason", "task", "task-ref", ref, "task-state", state},
+					})
+				}
+				continue
+			}
+
+			trigger, triggered, done := w.handle(ref, change.Name, value)
+			if triggered {
+				triggers = append(triggers, trigger)
+			}
+			if done {
+				unwatched = append(unwatched, ref)
+			}
+		}
+	}
+	return triggers, unwatched
+}
+
+// handle calls the VM's handler for the property if the value differs from
+// the last seen value. The handler is removed once it is done, and the VM is
+// forgotten once it has no handlers, in which case done is true.
+func (w *sessionWatch) handle(ref types.ManagedObjectReference, name string, value interface{}) (_ vmTrigger, triggered, done bool) {
+	watch, ok := w.vms[ref]
+	if !ok {
+		return vmTrigger{}, false, false
+	}
+	handler, ok := watch.handlers[name]
+	if !ok {
+		return vmTrigger{}, false, false
+	}
+	if last, ok := w.values[ref][name]; ok && reflect.DeepEqual(last, value) {
+		return vmTrigger{}, false, false
+	}
+	w.values[ref][name] = value
+
+	trigger, handlerDone := handler(value)
+	if handlerDone {
+		delete(watch.handlers, name)
+		delete(w.values[ref], name)
+		if len(watch.handlers) == 0 {
+			delete(w.vms, ref)
+			delete(w.values, ref)
+			done = true
+		}
+	}
+	if !trigger {
+		return vmTrigger{}, false, done
+	}
+	return vmTrigger{
+		obj:                 watch.obj,
+		loggerKeysAndValues: []interface{}{"reason", "property", "vm-ref", ref, "property", name},
+	}, true, done
+}
+
+// syncView adds the VM or task to the ListView if it is watched, and removes
+// it otherwise. A VM or task that cannot be added is no longer watched, so a
+// later call to watch it is not mistaken for an existing watch.
+func (w *sessionWatch) syncView(ctx goctx.Context, ref types.ManagedObjectReference) {
+	w.viewMu.Lock()
+	defer w.viewMu.Unlock()
+
+	w.Lock()
+	_, watchedVM := w.vms[ref]
+	_, watchedTask := w.tasks[ref]
+	w.Unlock()
+	watched := watchedVM || watchedTask
+	_, inView := w.inView[ref]
+
+	switch {
+	case watched && !inView:
+		if err := w.view.Add(ctx, []types.ManagedObjectReference{ref}); err != nil {
+			w.ctx.Logger.Error(err, "failed to watch object", "ref", ref)
+			w.Lock()
+			delete(w.vms, ref)
+			delete(w.values, ref)
+			delete(w.tasks, ref)
+			w.Unlock()
+			return
+		}
+		w.inView[ref] = struct{}{}
+	case !watched && inView:
+		// The object may no longer exist, in which case it was already
+		// removed from the ListView.
+		if err := w.view.Remove(ctx, []types.ManagedObjectReference{ref}); err != nil {
+			w.ctx.Logger.V(4).Info("failed to stop watching object", "ref", ref, "error", err.Error())
+		}
+		delete(w.inView, ref)
+	}
+}
+
+// watchVMProperty registers a handler that is called when the VM's property
+// changes. The property's current value is retrieved as the baseline for
+// the changes, and the handler is called with it so it can observe the
+// baseline too, but a reconcile request is not triggered for it. A VSphereVM
+// that already has a handler for the property keeps it.
+func watchVMProperty(ctx *virtualMachineContext, name string, handler propertyChangeHandler) {
+	w := getSessionWatch(&ctx.VMContext)
+	if w == nil {
+		return
+	}
+
+	obj := ctx.VSphereVM.DeepCopy()
+	if w.updateVMWatch(ctx.Ref, name, obj) {
+		return
+	}
+
+	var content []types.ObjectContent
+	if err := property.DefaultCollector(w.client).Retrieve(ctx, []types.ManagedObjectReference{ctx.Ref}, []string{name}, &content); err != nil {
+		ctx.Logger.Error(err, "failed to retrieve property for watch", "property", name)
+		return
+	}
+	var value interface{}
+	for _, c := range content {
+		for _, p := range c.PropSet {
+			if p.Name == name {
+				value = p.Val
+			}
+		}
+	}
+	_, _ = handler(value)
+
+	w.Lock()
+	watch, ok := w.vms[ctx.Ref]
+	if !ok {
+		watch = &vmWatch{handlers: map[string]propertyChangeHandler{}}
+		w.vms[ctx.Ref] = watch
+		w.values[ctx.Ref] = map[string]interface{}{}
+	}
+	watch.obj = obj
+	if _, ok := watch.handlers[name]; ok {
+		w.Unlock()
+		return
+	}
+	watch.handlers[name] = handler
+	w.values[ctx.Ref][name] = value
+	w.Unlock()
+
+	w.syncView(ctx, ctx.Ref)
+}
+
+// updateVMWatch updates the VSphereVM of the VM's watch and returns true if
+// the VM already has a handler for the property.
+func (w *sessionWatch) updateVMWatch(ref types.ManagedObjectReference, name string, obj *infrav1.VSphereVM) bool {
+	w.Lock()
+	defer w.Unlock()
+	watch, ok := w.vms[ref]
+	if !ok {
+		return false
+	}
+	watch.obj = obj
+	_, ok = watch.handlers[name]
+	return ok
+}
+
+// watchTask triggers a reconcile request for the VSphereVM once the task
+// completes. A reconcile request is triggered immediately if the task
+// already completed.
+func watchTask(ctx *context.VMContext, taskRef types.ManagedObjectReference) {
+	w := getSessionWatch(ctx)
+	if w == nil {
+		return
+	}
+
+	obj := ctx.VSphereVM.DeepCopy()
+	var task mo.Task
+	if err := property.DefaultCollector(w.client).RetrieveOne(ctx, taskRef, []string{"info.state"}, &task); err != nil {
+		ctx.Logger.Error(err, "failed to retrieve task state for watch", "task-ref", taskRef)
+		return
+	}
+	if state := task.Info.State; isTaskDone(state) {
+		go triggerVSphereVMReconcile(w.runCtx, w.ctx, vmTrigger{
+			obj:                 obj,
+			loggerKeysAndValues: []interface{}{"reason", "task", "task-ref", taskRef, "task-state", state},
+		})
+		return
+	}
+
+	// The task's state is sent when the task is added to the ListView, so a
+	// task that completes in the meantime is not missed.
+	w.Lock()
+	w.tasks[taskRef] = obj
+	w.Unlock()
+	w.syncView(ctx, taskRef)
+}
+
+// reconcileVSphereVMAfter triggers a reconcile request for the VSphereVM
+// once the duration elapses.
+func reconcileVSphereVMAfter(ctx *context.VMContext, d time.Duration, loggerKeysAndValues ...interface{}) {
+	vmWatches.Lock()
+	watchCtx, runCtx := vmWatches.ctx, vmWatches.runCtx
+	vmWatches.Unlock()
+	if runCtx == nil {
+		ctx.Logger.V(4).Info("skipping timer", "reason", "watches-disabled")
+		return
+	}
+
+	trigger := vmTrigger{
+		obj:                 ctx.VSphereVM.DeepCopy(),
+		loggerKeysAndValues: loggerKeysAndValues,
+	}
+	time.AfterFunc(d, func() {
+		triggerVSphereVMReconcile(runCtx, watchCtx, trigger)
+	})
+}
+
+// triggerVSphereVMReconcile triggers a reconcile request for the VSphereVM
+// by sending a GenericEvent into the event channel for VSphereVMs.
+func triggerVSphereVMReconcile(runCtx goctx.Context, ctx *context.ControllerContext, trigger vmTrigger) {
+	obj := trigger.obj
+	ctx.Logger.Info("triggering GenericEvent",
+		append([]interface{}{"namespace", obj.Namespace, "name", obj.Name}, trigger.loggerKeysAndValues...)...)
+	eventChannel := ctx.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereVM"))
+	select {
+	case eventChannel <- event.GenericEvent{Meta: obj, Object: obj}:
+	case <-runCtx.Done():
+	}
+}
+
+// isTaskDone returns true if the task succeeded or failed.
+func isTaskDone(state types.TaskInfoState) bool {
+	return state == types.TaskInfoStateSuccess || state == types.TaskInfoStateError
+}
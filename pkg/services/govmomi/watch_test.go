@@ -0,0 +1,193 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/internal/vcsim"
+)
+
+// startVMWatches enables the VM watches and returns a function that stops
+// them. The watches must be stopped before the simulator is closed.
+func startVMWatches(ctx *context.ControllerContext) (<-chan event.GenericEvent, func()) {
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		_ = RunVMWatches(ctx, stop)
+		close(stopped)
+	}()
+
+	// Wait for the watches to be enabled.
+	for {
+		vmWatches.Lock()
+		enabled := vmWatches.sessions != nil
+		vmWatches.Unlock()
+		if enabled {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	eventChannel := ctx.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereVM"))
+	return eventChannel, func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// expectGenericEvent fails the test if a GenericEvent for the VSphereVM is
+// not received.
+func expectGenericEvent(t *testing.T, eventChannel <-chan event.GenericEvent, vsphereVM *infrav1.VSphereVM, reason string) {
+	select {
+	case e := <-eventChannel:
+		if e.Meta.GetNamespace() != vsphereVM.Namespace || e.Meta.GetName() != vsphereVM.Name {
+			t.Fatalf("expected event for %s/%s when %s, got %s/%s",
+				vsphereVM.Namespace, vsphereVM.Name, reason, e.Meta.GetNamespace(), e.Meta.GetName())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected event when %s", reason)
+	}
+}
+
+// expectNoGenericEvent fails the test if a GenericEvent is received.
+func expectNoGenericEvent(t *testing.T, eventChannel <-chan event.GenericEvent, reason string) {
+	select {
+	case e := <-eventChannel:
+		t.Fatalf("unexpected event for %s/%s when %s", e.Meta.GetNamespace(), e.Meta.GetName(), reason)
+	case <-time.After(time.Second):
+	}
+}
+
+func TestVMWatches(t *testing.T) {
+	sim := vcsim.New(t)
+	defer sim.Destroy()
+
+	vmContext := sim.NewVMContext(t)
+	authSession := vmContext.Session
+
+	eventChannel, stopVMWatches := startVMWatches(vmContext.ControllerContext)
+	defer stopVMWatches()
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	obj := object.NewVirtualMachine(authSession.Client.Client, vm.Reference())
+	ctx := &virtualMachineContext{
+		VMContext: *vmContext,
+		Obj:       obj,
+		Ref:       vm.Reference(),
+		State:     &infrav1.VirtualMachine{},
+	}
+
+	// A reconcile is triggered when a task completes.
+	task, err := obj.PowerOff(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+	reconcileVSphereVMOnTaskCompletion(&ctx.VMContext)
+	expectGenericEvent(t, eventChannel, ctx.VSphereVM, "the task completed")
+
+	// A reconcile is triggered immediately for a task that already
+	// completed.
+	if err := task.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reconcileVSphereVMOnTaskCompletion(&ctx.VMContext)
+	expectGenericEvent(t, eventChannel, ctx.VSphereVM, "the task already completed")
+
+	// A reconcile is not triggered for a VM that is already powered off, as
+	// only changes to the property trigger a reconcile.
+	reconcileVSphereVMWhenPoweredOff(ctx, time.Hour)
+	expectNoGenericEvent(t, eventChannel, "the vm was already powered off")
+
+	// A reconcile is triggered once when the VM's power state changes, even
+	// if the handler is registered more than once.
+	task, err = obj.PowerOn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reconcileVSphereVMWhenPoweredOff(ctx, time.Hour)
+	task, err = obj.PowerOff(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectGenericEvent(t, eventChannel, ctx.VSphereVM, "the vm was powered off")
+	expectNoGenericEvent(t, eventChannel, "the vm was powered off again")
+
+	// The VM is no longer watched once its handlers are done.
+	w := getSessionWatch(&ctx.VMContext)
+	w.Lock()
+	_, watched := w.vms[ctx.Ref]
+	_, cached := w.values[ctx.Ref]
+	w.Unlock()
+	if watched || cached {
+		t.Fatal("expected the vm to no longer be watched")
+	}
+
+	// A reconcile is triggered when the timeout expires.
+	reconcileVSphereVMAfter(&ctx.VMContext, time.Millisecond, "reason", "test")
+	expectGenericEvent(t, eventChannel, ctx.VSphereVM, "the timeout expired")
+
+	// The handlers of a VM that no longer exists are forgotten.
+	reconcileVSphereVMOnGuestReadinessChange(ctx, defaultGuestReadinessKey, "")
+	w.apply([]types.ObjectUpdate{{Kind: types.ObjectUpdateKindLeave, Obj: ctx.Ref}})
+	w.Lock()
+	_, ok := w.vms[ctx.Ref]
+	w.Unlock()
+	if ok {
+		t.Fatal("expected the watch of the destroyed vm to be forgotten")
+	}
+
+	// A reconcile is triggered for the watched VMs when the session watch
+	// fails, and the failed watch is dropped.
+	w = getSessionWatch(&ctx.VMContext)
+	reconcileVSphereVMOnGuestReadinessChange(ctx, defaultGuestReadinessKey, "")
+	userSession, err := authSession.SessionManager.UserSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := govmomi.NewClient(ctx, sim.Server.URL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SessionManager.TerminateSession(ctx, []string{userSession.Key}); err != nil {
+		t.Fatal(err)
+	}
+	simulator.Map.Update(vm, []types.PropertyChange{{Name: "runtime.powerState", Val: types.VirtualMachinePowerStatePoweredOn}})
+	expectGenericEvent(t, eventChannel, ctx.VSphereVM, "the session watch failed")
+	vmWatches.Lock()
+	for _, sessionWatch := range vmWatches.sessions {
+		if sessionWatch == w {
+			t.Error("expected the failed session watch to be dropped")
+		}
+	}
+	vmWatches.Unlock()
+}
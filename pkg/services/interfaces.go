@@ -30,3 +30,30 @@ type VirtualMachineService interface {
 	// DestroyVM powers off and removes a VM from the inventory.
 	DestroyVM(ctx *context.VMContext) (infrav1.VirtualMachine, error)
 }
+
+// ImageService is a service for importing images into vSphere as templates
+// and removing them.
+type ImageService interface {
+	// ReconcileImage imports the image and marks it as a template if the
+	// template does not already exist. The image's status is updated to
+	// reflect the progress of the import.
+	ReconcileImage(ctx *context.ImageContext) error
+
+	// DeleteImage removes the template created from the image. True is
+	// returned once the template no longer exists.
+	DeleteImage(ctx *context.ImageContext) (bool, error)
+}
+
+// SnapshotService is a service for creating, reverting and removing the
+// vSphere snapshots of VSphereVMSnapshots.
+type SnapshotService interface {
+	// ReconcileSnapshot creates the snapshots of the VMs if they do not
+	// already exist and reverts the VMs to the snapshots when requested. The
+	// VMs are only used to create the snapshots the first time. The
+	// snapshot's status is updated to reflect the progress of the operation.
+	ReconcileSnapshot(ctx *context.VMSnapshotContext, vms []infrav1.VSphereVM) error
+
+	// DeleteSnapshot removes the snapshots. True is returned once the
+	// snapshots no longer exist.
+	DeleteSnapshot(ctx *context.VMSnapshotContext) (bool, error)
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ipam allocates addresses from IPPools to IPAddressClaims.
+package ipam
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+// Allocate allocates an address from the pool to the claim and returns the
+// address with the prefix length of its subnet, ex. 192.168.1.10/24.
+//
+// The allocation is recorded in the pool's status, which must be updated on
+// the API server for the allocation to take effect. If the update fails
+// because the pool was modified, the pool must be fetched again and the
+// allocation retried. An address already allocated to the claim is returned
+// without modifying the pool.
+func Allocate(pool *infrav1.IPPool, claim *infrav1.IPAddressClaim) (string, error) {
+	subnets, err := parseSubnets(pool)
+	if err != nil {
+		return "", err
+	}
+
+	for _, allocation := range pool.Status.Allocations {
+		if allocation.ClaimUID == claim.UID {
+			return withPrefix(subnets, net.ParseIP(allocation.Address))
+		}
+	}
+
+	exclusions, err := parseExclusions(pool)
+	if err != nil {
+		return "", err
+	}
+	if gateway := pool.Spec.Gateway; gateway != "" {
+		ip := net.ParseIP(gateway)
+		if ip == nil {
+			return "", errors.Errorf("invalid gateway %q for IPPool %s/%s", gateway, pool.Namespace, pool.Name)
+		}
+		exclusions = append(exclusions, ipRange{start: ip.To16(), end: ip.To16()})
+	}
+	for _, allocation := range pool.Status.Allocations {
+		if ip := net.ParseIP(allocation.Address); ip != nil {
+			exclusions = append(exclusions, ipRange{start: ip.To16(), end: ip.To16()})
+		}
+	}
+
+	for _, subnet := range subnets {
+		first, last := subnetRange(subnet)
+		for ip := first; bytes.Compare(ip, last) <= 0; {
+			excluded := false
+			for _, r := range exclusions {
+				if r.contains(ip) {
+					// Skip to the address after the range.
+					if bytes.Compare(r.end, last) >= 0 {
+						ip = nil
+					} else {
+						ip = next(r.end)
+					}
+					excluded = true
+					break
+				}
+			}
+			if ip == nil {
+				break
+			}
+			if excluded {
+				continue
+			}
+			pool.Status.Allocations = append(pool.Status.Allocations, infrav1.IPAllocation{
+				Claim:    claim.Name,
+				ClaimUID: claim.UID,
+				Address:  ip.String(),
+			})
+			ones, _ := subnet.Mask.Size()
+			return fmt.Sprintf("%s/%d", ip, ones), nil
+		}
+	}
+
+	return "", errors.Errorf("IPPool %s/%s has no free addresses", pool.Namespace, pool.Name)
+}
+
+// Release removes the claim's allocation from the pool's status. Release
+// returns false if no address is allocated to the claim.
+func Release(pool *infrav1.IPPool, claim *infrav1.IPAddressClaim) bool {
+	for i, allocation := range pool.Status.Allocations {
+		if allocation.ClaimUID == claim.UID {
+			pool.Status.Allocations = append(pool.Status.Allocations[:i], pool.Status.Allocations[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ipRange is an inclusive range of addresses in their 16-byte form.
+type ipRange struct {
+	start, end net.IP
+}
+
+func (r ipRange) contains(ip net.IP) bool {
+	return bytes.Compare(ip, r.start) >= 0 && bytes.Compare(ip, r.end) <= 0
+}
+
+func parseSubnets(pool *infrav1.IPPool) ([]*net.IPNet, error) {
+	if len(pool.Spec.Subnets) == 0 {
+		return nil, errors.Errorf("IPPool %s/%s has no subnets", pool.Namespace, pool.Name)
+	}
+	subnets := make([]*net.IPNet, 0, len(pool.Spec.Subnets))
+	for _, s := range pool.Spec.Subnets {
+		_, subnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid subnet %q for IPPool %s/%s", s, pool.Namespace, pool.Name)
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+// parseExclusions parses exclusions that are addresses, ranges of addresses
+// separated by a hyphen, or CIDRs.
+func parseExclusions(pool *infrav1.IPPool) ([]ipRange, error) {
+	exclusions := make([]ipRange, 0, len(pool.Spec.Exclusions))
+	for _, s := range pool.Spec.Exclusions {
+		var r ipRange
+		switch {
+		case strings.Contains(s, "/"):
+			_, subnet, err := net.ParseCIDR(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid exclusion %q for IPPool %s/%s", s, pool.Namespace, pool.Name)
+			}
+			r.start, r.end = network(subnet), broadcast(subnet)
+		case strings.Contains(s, "-"):
+			parts := strings.SplitN(s, "-", 2)
+			r.start, r.end = net.ParseIP(strings.TrimSpace(parts[0])), net.ParseIP(strings.TrimSpace(parts[1]))
+		default:
+			r.start = net.ParseIP(s)
+			r.end = r.start
+		}
+		if r.start == nil || r.end == nil || bytes.Compare(r.start.To16(), r.end.To16()) > 0 {
+			return nil, errors.Errorf("invalid exclusion %q for IPPool %s/%s", s, pool.Namespace, pool.Name)
+		}
+		r.start, r.end = r.start.To16(), r.end.To16()
+		exclusions = append(exclusions, r)
+	}
+	return exclusions, nil
+}
+
+// subnetRange returns the first and last allocatable addresses of the
+// subnet. The network and broadcast addresses of IPv4 subnets larger than
+// /31 are not allocatable.
+func subnetRange(subnet *net.IPNet) (net.IP, net.IP) {
+	first, last := network(subnet), broadcast(subnet)
+	if ones, bits := subnet.Mask.Size(); bits == net.IPv4len*8 && ones < 31 {
+		first, last = next(first), prev(last)
+	}
+	return first, last
+}
+
+func withPrefix(subnets []*net.IPNet, ip net.IP) (string, error) {
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			ones, _ := subnet.Mask.Size()
+			return fmt.Sprintf("%s/%d", ip, ones), nil
+		}
+	}
+	return "", errors.Errorf("allocated address %s is not in any subnet", ip)
+}
+
+func network(subnet *net.IPNet) net.IP {
+	return subnet.IP.Mask(subnet.Mask).To16()
+}
+
+func broadcast(subnet *net.IPNet) net.IP {
+	ip := subnet.IP.Mask(subnet.Mask)
+	out := make(net.IP, len(ip))
+	for i := range ip {
+		out[i] = ip[i] | ^subnet.Mask[i]
+	}
+	return out.To16()
+}
+
+func next(ip net.IP) net.IP {
+	out := make(net.IP, len(ip))
+	copy(out, ip)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i]++
+		if out[i] != 0 {
+			break
+		}
+	}
+	return out
+}
+
+func prev(ip net.IP) net.IP {
+	out := make(net.IP, len(ip))
+	copy(out, ip)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i]--
+		if out[i] != 0xff {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/ipam"
+)
+
+func newClaim(name string) *infrav1.IPAddressClaim {
+	return &infrav1.IPAddressClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			UID:  types.UID(name + "-uid"),
+		},
+	}
+}
+
+func Test_Allocate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		spec        infrav1.IPPoolSpec
+		allocations []infrav1.IPAllocation
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "skips network address and gateway",
+			spec:     infrav1.IPPoolSpec{Subnets: []string{"192.168.1.0/24"}, Gateway: "192.168.1.1"},
+			expected: "192.168.1.2/24",
+		},
+		{
+			name: "skips exclusions",
+			spec: infrav1.IPPoolSpec{
+				Subnets:    []string{"192.168.1.0/24"},
+				Gateway:    "192.168.1.1",
+				Exclusions: []string{"192.168.1.2", "192.168.1.3-192.168.1.9", "192.168.1.8/29"},
+			},
+			expected: "192.168.1.16/24",
+		},
+		{
+			name: "skips allocations",
+			spec: infrav1.IPPoolSpec{Subnets: []string{"192.168.1.0/24"}},
+			allocations: []infrav1.IPAllocation{
+				{Claim: "a", ClaimUID: "a-uid", Address: "192.168.1.1"},
+			},
+			expected: "192.168.1.2/24",
+		},
+		{
+			name: "returns existing allocation",
+			spec: infrav1.IPPoolSpec{Subnets: []string{"192.168.1.0/24"}},
+			allocations: []infrav1.IPAllocation{
+				{Claim: "a", ClaimUID: "a-uid", Address: "192.168.1.1"},
+				{Claim: "claim", ClaimUID: "claim-uid", Address: "192.168.1.5"},
+			},
+			expected: "192.168.1.5/24",
+		},
+		{
+			name: "uses next subnet when first is exhausted",
+			spec: infrav1.IPPoolSpec{
+				Subnets: []string{"192.168.1.0/30", "10.0.0.0/24"},
+			},
+			allocations: []infrav1.IPAllocation{
+				{Claim: "a", ClaimUID: "a-uid", Address: "192.168.1.1"},
+				{Claim: "b", ClaimUID: "b-uid", Address: "192.168.1.2"},
+			},
+			expected: "10.0.0.1/24",
+		},
+		{
+			name: "allocates both addresses of a /31",
+			spec: infrav1.IPPoolSpec{Subnets: []string{"192.168.1.0/31"}},
+			allocations: []infrav1.IPAllocation{
+				{Claim: "a", ClaimUID: "a-uid", Address: "192.168.1.0"},
+			},
+			expected: "192.168.1.1/31",
+		},
+		{
+			name: "IPv6",
+			spec: infrav1.IPPoolSpec{
+				Subnets:    []string{"fd00::/64"},
+				Gateway:    "fd00::1",
+				Exclusions: []string{"fd00::-fd00::ff"},
+			},
+			expected: "fd00::100/64",
+		},
+		{
+			name:        "exhausted",
+			spec:        infrav1.IPPoolSpec{Subnets: []string{"192.168.1.0/30"}, Exclusions: []string{"192.168.1.0/30"}},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid subnet",
+			spec:        infrav1.IPPoolSpec{Subnets: []string{"192.168.1.0"}},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid exclusion",
+			spec:        infrav1.IPPoolSpec{Subnets: []string{"192.168.1.0/24"}, Exclusions: []string{"192.168.1.9-192.168.1.2"}},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewGomegaWithT(t)
+			pool := &infrav1.IPPool{
+				Spec:   tc.spec,
+				Status: infrav1.IPPoolStatus{Allocations: tc.allocations},
+			}
+			address, err := ipam.Allocate(pool, newClaim("claim"))
+			if tc.expectedErr {
+				g.Expect(err).To(gomega.HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(address).To(gomega.Equal(tc.expected))
+			g.Expect(pool.Status.Allocations).To(gomega.ContainElement(infrav1.IPAllocation{
+				Claim:    "claim",
+				ClaimUID: "claim-uid",
+				Address:  strings.SplitN(address, "/", 2)[0],
+			}))
+		})
+	}
+}
+
+func Test_AllocateUnique(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	pool := &infrav1.IPPool{Spec: infrav1.IPPoolSpec{Subnets: []string{"192.168.1.0/28"}}}
+	seen := map[string]bool{}
+	for i := 0; i < 14; i++ {
+		address, err := ipam.Allocate(pool, newClaim(fmt.Sprintf("claim-%d", i)))
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(seen).NotTo(gomega.HaveKey(address))
+		seen[address] = true
+	}
+	_, err := ipam.Allocate(pool, newClaim("claim-14"))
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	g.Expect(ipam.Release(pool, newClaim("claim-3"))).To(gomega.BeTrue())
+	g.Expect(ipam.Release(pool, newClaim("claim-3"))).To(gomega.BeFalse())
+	address, err := ipam.Allocate(pool, newClaim("claim-14"))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(address).To(gomega.Equal("192.168.1.4/28"))
+}
@@ -25,6 +25,8 @@ import (
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vapi/tags"
 	"github.com/vmware/govmomi/vim25/soap"
 
 	"sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
@@ -38,6 +40,15 @@ type Session struct {
 	*govmomi.Client
 	Finder     *find.Finder
 	datacenter *object.Datacenter
+	tags       *tagManager
+}
+
+// tagManager lazily creates the vAPI session used to manage tags. A pointer
+// to the tagManager is shared by the copies of a cached session.
+type tagManager struct {
+	sync.Mutex
+	user    *url.Userinfo
+	manager *tags.Manager
 }
 
 // GetOrCreate gets a cached session or creates a new one if one does not
@@ -73,7 +84,10 @@ func GetOrCreate(
 		return nil, errors.Wrapf(err, "error setting up new vSphere SOAP client")
 	}
 
-	session := Session{Client: client}
+	session := Session{
+		Client: client,
+		tags:   &tagManager{user: soapURL.User},
+	}
 	session.UserAgent = v1alpha3.GroupVersion.String()
 
 	// Assign the finder to the session.
@@ -96,6 +110,29 @@ func GetOrCreate(
 	return &session, nil
 }
 
+// Datacenter returns the session's datacenter.
+func (s *Session) Datacenter() *object.Datacenter {
+	return s.datacenter
+}
+
+// TagManager returns a client for the vAPI tagging service. The vAPI
+// session is created the first time this function is called.
+func (s *Session) TagManager(ctx context.Context) (*tags.Manager, error) {
+	if s.tags == nil {
+		return nil, errors.New("vSphere client is not initialized")
+	}
+	s.tags.Lock()
+	defer s.tags.Unlock()
+	if s.tags.manager == nil {
+		restClient := rest.NewClient(s.Client.Client)
+		if err := restClient.Login(ctx, s.tags.user); err != nil {
+			return nil, errors.Wrap(err, "error setting up new vSphere REST client")
+		}
+		s.tags.manager = tags.NewManager(restClient)
+	}
+	return s.tags.manager, nil
+}
+
 // FindByBIOSUUID finds an object by its BIOS UUID.
 //
 // To avoid comments about this function's name, please see the Golang
@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+// GetCondition returns the condition with the given type, or nil if the
+// condition is not present.
+func GetCondition(conditions []infrav1.Condition, conditionType infrav1.ConditionType) *infrav1.Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds the condition to the list or updates the existing
+// condition with the same type. The condition's LastTransitionTime is only
+// updated when its status changes.
+func SetCondition(conditions *[]infrav1.Condition, condition infrav1.Condition) {
+	existing := GetCondition(*conditions, condition.Type)
+	if existing == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		*conditions = append(*conditions, condition)
+		return
+	}
+	if existing.Status != condition.Status {
+		existing.Status = condition.Status
+		existing.LastTransitionTime = metav1.Now()
+	}
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+}
+
+// RemoveCondition removes the condition with the given type from the list.
+func RemoveCondition(conditions *[]infrav1.Condition, conditionType infrav1.ConditionType) {
+	result := (*conditions)[:0]
+	for _, c := range *conditions {
+		if c.Type != conditionType {
+			result = append(result, c)
+		}
+	}
+	*conditions = result
+}
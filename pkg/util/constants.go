@@ -27,19 +27,79 @@ network:
       match:
         macaddress: "{{ $net.MACAddr }}"
       wakeonlan: true
-      dhcp4: {{ $net.DHCP4 }}
-      dhcp6: {{ $net.DHCP6 }}
-      {{- if $net.IPAddrs }}
+      {{- template "interface" $net }}
+    {{- end }}
+  {{- if .Bonds }}
+  bonds:
+    {{- range .Bonds }}
+    {{ .Name }}:
+      interfaces:
+      {{- range .Devices }}
+      - id{{ . }}
+      {{- end }}
+      parameters:
+        mode: "{{ bondMode . }}"
+        {{- if .LACPRate }}
+        lacp-rate: "{{ .LACPRate }}"
+        {{- end }}
+        {{- if .MIIMonitorInterval }}
+        mii-monitor-interval: {{ .MIIMonitorInterval }}
+        {{- end }}
+        {{- if .TransmitHashPolicy }}
+        transmit-hash-policy: "{{ .TransmitHashPolicy }}"
+        {{- end }}
+      {{- template "interface" . }}
+    {{- end }}
+  {{- end }}
+  {{- if .VLANs }}
+  vlans:
+    {{- range .VLANs }}
+    {{ .Name }}:
+      id: {{ .ID }}
+      link: {{ if .Device }}id{{ .Device }}{{ else }}{{ .Bond }}{{ end }}
+      {{- template "interface" . }}
+    {{- end }}
+  {{- end }}
+  {{- if .Bridges }}
+  bridges:
+    {{- range .Bridges }}
+    {{ .Name }}:
+      interfaces:
+      {{- range .Devices }}
+      - id{{ . }}
+      {{- end }}
+      {{- range .Interfaces }}
+      - {{ . }}
+      {{- end }}
+      {{- if .STP }}
+      parameters:
+        stp: {{ .STP }}
+      {{- end }}
+      {{- template "interface" . }}
+    {{- end }}
+  {{- end }}
+  {{- if .Routes }}
+  routes:
+  {{- range .Routes }}
+  - to: "{{ .To }}"
+    via: "{{ .Via }}"
+    metric: {{ .Metric }}
+  {{- end }}
+  {{- end }}
+{{- define "interface" }}
+      dhcp4: {{ .DHCP4 }}
+      dhcp6: {{ .DHCP6 }}
+      {{- if .IPAddrs }}
       addresses:
-      {{- range $net.IPAddrs }}
+      {{- range .IPAddrs }}
       - "{{ . }}"
       {{- end }}
       {{- end }}
-      {{- if $net.Gateway4 }}
-      gateway4: "{{ $net.Gateway4 }}"
+      {{- if .Gateway4 }}
+      gateway4: "{{ .Gateway4 }}"
       {{- end }}
-      {{- if $net.Gateway6 }}
-      gateway6: "{{ $net.Gateway6 }}"
+      {{- if .Gateway6 }}
+      gateway6: "{{ .Gateway6 }}"
       {{- end }}
       {{- if .MTU }}
       mtu: {{ .MTU }}
@@ -52,28 +112,60 @@ network:
         metric: {{ .Metric }}
       {{- end }}
       {{- end }}
-      {{- if nameservers $net }}
+      {{- if or .Nameservers .SearchDomains }}
       nameservers:
-        {{- if $net.Nameservers }}
+        {{- if .Nameservers }}
         addresses:
-        {{- range $net.Nameservers }}
+        {{- range .Nameservers }}
         - "{{ . }}"
         {{- end }}
         {{- end }}
-        {{- if $net.SearchDomains }}
+        {{- if .SearchDomains }}
         search:
-        {{- range $net.SearchDomains }}
+        {{- range .SearchDomains }}
         - "{{ . }}"
         {{- end }}
         {{- end }}
       {{- end }}
-    {{- end }}
-  {{- if .Routes }}
-  routes:
-  {{- range .Routes }}
-  - to: "{{ .To }}"
-    via: "{{ .Via }}"
-    metric: {{ .Metric }}
-  {{- end }}
-  {{- end }}
+{{- end }}
+`
+
+// networkdFormat is the systemd-networkd configuration of a network device
+// that is equivalent to the device's configuration in metadataFormat.
+const networkdFormat = `[Match]
+{{- if .Device.MACAddr }}
+MACAddress={{ .Device.MACAddr }}
+{{- else }}
+Type=ether
+{{- end }}
+{{- if .Device.MTU }}
+
+[Link]
+MTUBytes={{ .Device.MTU }}
+{{- end }}
+
+[Network]
+DHCP={{ dhcp .Device }}
+{{- range .Device.IPAddrs }}
+Address={{ . }}
+{{- end }}
+{{- if .Device.Gateway4 }}
+Gateway={{ .Device.Gateway4 }}
+{{- end }}
+{{- if .Device.Gateway6 }}
+Gateway={{ .Device.Gateway6 }}
+{{- end }}
+{{- range .Device.Nameservers }}
+DNS={{ . }}
+{{- end }}
+{{- if .Device.SearchDomains }}
+Domains={{ join .Device.SearchDomains " " }}
+{{- end }}
+{{- range .Routes }}
+
+[Route]
+Destination={{ .To }}
+Gateway={{ .Via }}
+Metric={{ .Metric }}
+{{- end }}
 `
@@ -0,0 +1,55 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+// HibernationRole determines the order in which a cluster's VMs are powered
+// off when the cluster hibernates. VMs are powered on in the reverse order.
+type HibernationRole int
+
+const (
+	// HibernationRoleWorker is the role of worker VMs, which are powered
+	// off first.
+	HibernationRoleWorker HibernationRole = iota + 1
+
+	// HibernationRoleControlPlane is the role of control plane VMs.
+	HibernationRoleControlPlane
+
+	// HibernationRoleLoadBalancer is the role of load balancer VMs, which
+	// are powered off last.
+	HibernationRoleLoadBalancer
+)
+
+// hibernationPoweredOffRoles is the highest role of the VMs that are powered
+// off in each hibernation state.
+var hibernationPoweredOffRoles = map[infrav1.HibernationState]HibernationRole{
+	infrav1.HibernationStateHibernatingWorkers:      HibernationRoleWorker,
+	infrav1.HibernationStateHibernatingControlPlane: HibernationRoleControlPlane,
+	infrav1.HibernationStateHibernatingLoadBalancer: HibernationRoleLoadBalancer,
+	infrav1.HibernationStateHibernated:              HibernationRoleLoadBalancer,
+	infrav1.HibernationStateResumingLoadBalancer:    HibernationRoleControlPlane,
+	infrav1.HibernationStateResumingControlPlane:    HibernationRoleWorker,
+}
+
+// IsPoweredOffForHibernation returns true if VMs with the given role are
+// powered off in the hibernation state.
+func IsPoweredOffForHibernation(state infrav1.HibernationState, role HibernationRole) bool {
+	return role <= hibernationPoweredOffRoles[state]
+}
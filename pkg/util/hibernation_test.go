@@ -0,0 +1,89 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util_test
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+func Test_IsPoweredOffForHibernation(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		state                v1alpha3.HibernationState
+		expectedControlPlane bool
+		expectedWorker       bool
+		expectedLoadBalancer bool
+	}{
+		{
+			name: "running",
+		},
+		{
+			name:           "hibernating workers",
+			state:          v1alpha3.HibernationStateHibernatingWorkers,
+			expectedWorker: true,
+		},
+		{
+			name:                 "hibernating control plane",
+			state:                v1alpha3.HibernationStateHibernatingControlPlane,
+			expectedWorker:       true,
+			expectedControlPlane: true,
+		},
+		{
+			name:                 "hibernating load balancer",
+			state:                v1alpha3.HibernationStateHibernatingLoadBalancer,
+			expectedWorker:       true,
+			expectedControlPlane: true,
+			expectedLoadBalancer: true,
+		},
+		{
+			name:                 "hibernated",
+			state:                v1alpha3.HibernationStateHibernated,
+			expectedWorker:       true,
+			expectedControlPlane: true,
+			expectedLoadBalancer: true,
+		},
+		{
+			name:                 "resuming load balancer",
+			state:                v1alpha3.HibernationStateResumingLoadBalancer,
+			expectedWorker:       true,
+			expectedControlPlane: true,
+		},
+		{
+			name:           "resuming control plane",
+			state:          v1alpha3.HibernationStateResumingControlPlane,
+			expectedWorker: true,
+		},
+		{
+			name:  "resuming workers",
+			state: v1alpha3.HibernationStateResumingWorkers,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewGomegaWithT(t)
+			g.Expect(util.IsPoweredOffForHibernation(tc.state, util.HibernationRoleWorker)).To(gomega.Equal(tc.expectedWorker))
+			g.Expect(util.IsPoweredOffForHibernation(tc.state, util.HibernationRoleControlPlane)).To(gomega.Equal(tc.expectedControlPlane))
+			g.Expect(util.IsPoweredOffForHibernation(tc.state, util.HibernationRoleLoadBalancer)).To(gomega.Equal(tc.expectedLoadBalancer))
+		})
+	}
+}
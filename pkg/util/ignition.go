@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+// ignitionFileMode is the mode, 0644, of the files added to an Ignition
+// config.
+const ignitionFileMode = 420
+
+// GetMachineIgnitionConfig returns the Ignition config in the bootstrap data
+// with the machine's hostname and network configuration embedded in it. The
+// network configuration is the systemd-networkd equivalent of the cloud-init
+// metadata returned by GetMachineMetadata. Routes that are not specific to
+// a device are added to the first device.
+func GetMachineIgnitionConfig(bootstrapData []byte, hostname string, machine infrav1.VSphereVM, networkStatus ...infrav1.NetworkStatus) ([]byte, error) {
+	config := map[string]interface{}{}
+	if err := json.Unmarshal(bootstrapData, &config); err != nil {
+		return nil, errors.Wrapf(err,
+			"error parsing Ignition config for machine %s/%s/%s",
+			machine.Namespace, machine.ClusterName, machine.Name)
+	}
+	ignition, _ := config["ignition"].(map[string]interface{})
+	version, _ := ignition["version"].(string)
+	if version == "" {
+		return nil, errors.Errorf(
+			"Ignition config for machine %s/%s/%s has no version",
+			machine.Namespace, machine.ClusterName, machine.Name)
+	}
+
+	storage, _ := config["storage"].(map[string]interface{})
+	if storage == nil {
+		storage = map[string]interface{}{}
+		config["storage"] = storage
+	}
+	files, _ := storage["files"].([]interface{})
+	addFile := func(path, contents string) {
+		file := map[string]interface{}{
+			"path": path,
+			"mode": ignitionFileMode,
+			"contents": map[string]interface{}{
+				"source": "data:text/plain;charset=utf-8;base64," + base64.StdEncoding.EncodeToString([]byte(contents)),
+			},
+		}
+		// The files of a version 2 config are in a named filesystem, and
+		// the files of a version 3 config must be marked to overwrite the
+		// files in the image.
+		if strings.HasPrefix(version, "2.") {
+			file["filesystem"] = "root"
+		} else {
+			file["overwrite"] = true
+		}
+		for i := range files {
+			if f, ok := files[i].(map[string]interface{}); ok && f["path"] == path {
+				files[i] = file
+				return
+			}
+		}
+		files = append(files, file)
+	}
+
+	addFile("/etc/hostname", hostname+"\n")
+
+	tpl := template.Must(template.New("t").Funcs(
+		template.FuncMap{
+			"dhcp": func(spec infrav1.NetworkDeviceSpec) string {
+				switch {
+				case spec.DHCP4 && spec.DHCP6:
+					return "yes"
+				case spec.DHCP4:
+					return "ipv4"
+				case spec.DHCP6:
+					return "ipv6"
+				default:
+					return "no"
+				}
+			},
+			"join": strings.Join,
+		}).Parse(networkdFormat))
+	for i, device := range getMachineNetworkDevices(machine, networkStatus...) {
+		routes := device.Routes
+		if i == 0 {
+			routes = append(append([]infrav1.NetworkRouteSpec{}, routes...), machine.Spec.Network.Routes...)
+		}
+		buf := &bytes.Buffer{}
+		if err := tpl.Execute(buf, struct {
+			Device infrav1.NetworkDeviceSpec
+			Routes []infrav1.NetworkRouteSpec
+		}{
+			Device: device,
+			Routes: routes,
+		}); err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"error getting networkd configuration for machine %s/%s/%s",
+				machine.Namespace, machine.ClusterName, machine.Name)
+		}
+		addFile(fmt.Sprintf("/etc/systemd/network/10-id%d.network", i), buf.String())
+	}
+	storage["files"] = files
+
+	return json.Marshal(config)
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+type ignitionFile struct {
+	Filesystem string `json:"filesystem,omitempty"`
+	Path       string `json:"path"`
+	Mode       int    `json:"mode"`
+	Overwrite  bool   `json:"overwrite,omitempty"`
+	Contents   struct {
+		Source string `json:"source"`
+	} `json:"contents"`
+}
+
+type ignitionConfig struct {
+	Ignition struct {
+		Version string `json:"version"`
+	} `json:"ignition"`
+	Passwd  map[string]interface{} `json:"passwd"`
+	Storage struct {
+		Files []ignitionFile `json:"files"`
+	} `json:"storage"`
+}
+
+func decodeIgnitionFiles(t *testing.T, data []byte) (ignitionConfig, map[string]string) {
+	var config ignitionConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range config.Storage.Files {
+		source := f.Contents.Source
+		contents, err := base64.StdEncoding.DecodeString(source[strings.Index(source, ",")+1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Path] = string(contents)
+	}
+	return config, files
+}
+
+func Test_GetMachineIgnitionConfig(t *testing.T) {
+	machine := v1alpha3.VSphereVM{
+		Spec: v1alpha3.VSphereVMSpec{
+			VirtualMachineCloneSpec: v1alpha3.VirtualMachineCloneSpec{
+				Network: v1alpha3.NetworkSpec{
+					Devices: []v1alpha3.NetworkDeviceSpec{
+						{
+							NetworkName:   "network1",
+							IPAddrs:       []string{"192.168.4.21/24"},
+							Gateway4:      "192.168.4.1",
+							MTU:           toInt64Ptr(9000),
+							Nameservers:   []string{"1.1.1.1"},
+							SearchDomains: []string{"vmware.ci", "vmware.com"},
+						},
+						{
+							NetworkName: "network2",
+							DHCP6:       true,
+						},
+					},
+					Routes: []v1alpha3.NetworkRouteSpec{
+						{To: "10.0.0.0/8", Via: "192.168.4.254", Metric: 5},
+					},
+				},
+			},
+		},
+	}
+	networkStatus := []v1alpha3.NetworkStatus{
+		{MACAddr: "00:00:00:00:00"},
+		{MACAddr: "00:00:00:00:01"},
+	}
+
+	t.Run("version 3", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+		bootstrapData := []byte(`{"ignition":{"version":"3.0.0"},"passwd":{"users":[{"name":"core"}]},` +
+			`"storage":{"files":[{"path":"/etc/hostname","contents":{"source":"data:,old"}}]}}`)
+		data, err := util.GetMachineIgnitionConfig(bootstrapData, "test-vm", machine, networkStatus...)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		config, files := decodeIgnitionFiles(t, data)
+		g.Expect(config.Ignition.Version).To(gomega.Equal("3.0.0"))
+		g.Expect(config.Passwd).To(gomega.HaveKey("users"))
+		g.Expect(config.Storage.Files).To(gomega.HaveLen(3))
+		for _, f := range config.Storage.Files {
+			g.Expect(f.Overwrite).To(gomega.BeTrue())
+			g.Expect(f.Filesystem).To(gomega.BeEmpty())
+			g.Expect(f.Mode).To(gomega.Equal(420))
+		}
+		g.Expect(files["/etc/hostname"]).To(gomega.Equal("test-vm\n"))
+		g.Expect(files["/etc/systemd/network/10-id0.network"]).To(gomega.Equal(`[Match]
+MACAddress=00:00:00:00:00
+
+[Link]
+MTUBytes=9000
+
+[Network]
+DHCP=no
+Address=192.168.4.21/24
+Gateway=192.168.4.1
+DNS=1.1.1.1
+Domains=vmware.ci vmware.com
+
+[Route]
+Destination=10.0.0.0/8
+Gateway=192.168.4.254
+Metric=5
+`))
+		g.Expect(files["/etc/systemd/network/10-id1.network"]).To(gomega.Equal(`[Match]
+MACAddress=00:00:00:00:01
+
+[Network]
+DHCP=ipv6
+`))
+
+		// The config is the same when it is generated again.
+		again, err := util.GetMachineIgnitionConfig(bootstrapData, "test-vm", machine, networkStatus...)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(again).To(gomega.Equal(data))
+	})
+
+	t.Run("version 2", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+		data, err := util.GetMachineIgnitionConfig([]byte(`{"ignition":{"version":"2.3.0"}}`), "test-vm", machine, networkStatus...)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		config, _ := decodeIgnitionFiles(t, data)
+		g.Expect(config.Storage.Files).To(gomega.HaveLen(3))
+		for _, f := range config.Storage.Files {
+			g.Expect(f.Filesystem).To(gomega.Equal("root"))
+			g.Expect(f.Overwrite).To(gomega.BeFalse())
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+		_, err := util.GetMachineIgnitionConfig([]byte("#cloud-config"), "test-vm", machine)
+		g.Expect(err).To(gomega.HaveOccurred())
+		_, err = util.GetMachineIgnitionConfig([]byte("{}"), "test-vm", machine)
+		g.Expect(err).To(gomega.HaveOccurred())
+	})
+}
+
+func toInt64Ptr(i int64) *int64 {
+	return &i
+}
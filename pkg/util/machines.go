@@ -21,9 +21,11 @@ import (
 	"context"
 	"net"
 	"regexp"
+	"sort"
 	"text/template"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apitypes "k8s.io/apimachinery/pkg/types"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
@@ -103,24 +105,29 @@ func GetVSphereMachine(
 var ErrNoMachineIPAddr = errors.New("no IP addresses found for machine")
 
 // GetMachinePreferredIPAddress returns the preferred IP address for a
-// VSphereMachine resource.
+// VSphereMachine resource. The addresses of the machine's preferred IP family
+// are considered before the addresses of the other family, and when the
+// machine has preferred API server CIDRs, the address must be in one of them.
 func GetMachinePreferredIPAddress(machine *infrav1.VSphereMachine) (string, error) {
-	var cidr *net.IPNet
+	cidrStrings := machine.Spec.Network.PreferredAPIServerCIDRs
 	if cidrString := machine.Spec.Network.PreferredAPIServerCIDR; cidrString != "" {
-		var err error
-		if _, cidr, err = net.ParseCIDR(cidrString); err != nil {
-			return "", errors.New("error parsing preferred API server CIDR")
-		}
+		cidrStrings = append([]string{cidrString}, cidrStrings...)
+	}
+	cidrs, err := parseCIDRs(cidrStrings)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing preferred API server CIDR")
 	}
 
+	machineAddrs := []clusterv1.MachineAddress{}
 	for _, machineAddr := range machine.Status.Addresses {
-		if machineAddr.Type != clusterv1.MachineExternalIP {
-			continue
-		}
-		if cidr == nil {
-			return machineAddr.Address, nil
+		if machineAddr.Type == clusterv1.MachineExternalIP || machineAddr.Type == clusterv1.MachineInternalIP {
+			machineAddrs = append(machineAddrs, machineAddr)
 		}
-		if cidr.Contains(net.ParseIP(machineAddr.Address)) {
+	}
+	sortMachineAddresses(machineAddrs, machine.Spec.Network.PreferredAPIServerIPFamily)
+
+	for _, machineAddr := range machineAddrs {
+		if len(cidrs) == 0 || cidrsContain(cidrs, net.ParseIP(machineAddr.Address)) {
 			return machineAddr.Address, nil
 		}
 	}
@@ -128,6 +135,85 @@ func GetMachinePreferredIPAddress(machine *infrav1.VSphereMachine) (string, erro
 	return "", ErrNoMachineIPAddr
 }
 
+// GetMachineAddresses returns the machine addresses for the IP addresses
+// reported for a machine with the given network spec. The addresses in one of
+// the spec's internal CIDRs are InternalIP addresses, and all other addresses
+// are ExternalIP addresses. The addresses are ordered by IP family, with the
+// spec's preferred IP family first, and otherwise keep their reported order.
+// Duplicate and invalid IP addresses are omitted.
+func GetMachineAddresses(network infrav1.NetworkSpec, ipAddrs ...string) ([]clusterv1.MachineAddress, error) {
+	internalCIDRs, err := parseCIDRs(network.InternalCIDRs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing internal CIDR")
+	}
+
+	var (
+		machineAddrs []clusterv1.MachineAddress
+		seen         = map[string]struct{}{}
+	)
+	for _, ipAddr := range ipAddrs {
+		ip := net.ParseIP(ipAddr)
+		if ip == nil {
+			continue
+		}
+		if _, ok := seen[ip.String()]; ok {
+			continue
+		}
+		seen[ip.String()] = struct{}{}
+		addrType := clusterv1.MachineExternalIP
+		if cidrsContain(internalCIDRs, ip) {
+			addrType = clusterv1.MachineInternalIP
+		}
+		machineAddrs = append(machineAddrs, clusterv1.MachineAddress{
+			Type:    addrType,
+			Address: ip.String(),
+		})
+	}
+	sortMachineAddresses(machineAddrs, network.PreferredAPIServerIPFamily)
+
+	return machineAddrs, nil
+}
+
+// sortMachineAddresses orders the addresses with those of the preferred IP
+// family first. The family defaults to IPv4.
+func sortMachineAddresses(machineAddrs []clusterv1.MachineAddress, preferredFamily corev1.IPFamily) {
+	rank := func(addr string) int {
+		ip := net.ParseIP(addr)
+		switch {
+		case ip == nil:
+			return 2
+		case (ip.To4() == nil) == (preferredFamily == corev1.IPv6Protocol):
+			return 0
+		default:
+			return 1
+		}
+	}
+	sort.SliceStable(machineAddrs, func(i, j int) bool {
+		return rank(machineAddrs[i].Address) < rank(machineAddrs[j].Address)
+	})
+}
+
+func parseCIDRs(cidrStrings []string) ([]*net.IPNet, error) {
+	cidrs := make([]*net.IPNet, 0, len(cidrStrings))
+	for _, cidrString := range cidrStrings {
+		_, cidr, err := net.ParseCIDR(cidrString)
+		if err != nil {
+			return nil, err
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
+func cidrsContain(cidrs []*net.IPNet, ip net.IP) bool {
+	for _, cidr := range cidrs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // IsControlPlaneMachine returns true if the provided resource is
 // a member of the control plane.
 func IsControlPlaneMachine(machine metav1.Object) bool {
@@ -137,29 +223,38 @@ func IsControlPlaneMachine(machine metav1.Object) bool {
 // GetMachineMetadata returns the cloud-init metadata as a base-64 encoded
 // string for a given VSphereMachine.
 func GetMachineMetadata(hostname string, machine infrav1.VSphereVM, networkStatus ...infrav1.NetworkStatus) ([]byte, error) {
-	// Create a copy of the devices and add their MAC addresses from a network status.
-	devices := make([]infrav1.NetworkDeviceSpec, len(machine.Spec.Network.Devices))
-	for i := range machine.Spec.Network.Devices {
-		machine.Spec.Network.Devices[i].DeepCopyInto(&devices[i])
-		if len(networkStatus) > 0 {
-			devices[i].MACAddr = networkStatus[i].MACAddr
-		}
+	if err := validateNetworkInterfaces(machine.Spec.Network); err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"error getting cloud init metadata for machine %s/%s/%s",
+			machine.Namespace, machine.ClusterName, machine.Name)
 	}
 
+	devices := getMachineNetworkDevices(machine, networkStatus...)
+
 	buf := &bytes.Buffer{}
 	tpl := template.Must(template.New("t").Funcs(
 		template.FuncMap{
-			"nameservers": func(spec infrav1.NetworkDeviceSpec) bool {
-				return len(spec.Nameservers) > 0 || len(spec.SearchDomains) > 0
+			"bondMode": func(spec infrav1.NetworkBondSpec) string {
+				if spec.Mode == "" {
+					return "802.3ad"
+				}
+				return spec.Mode
 			},
 		}).Parse(metadataFormat))
 	if err := tpl.Execute(buf, struct {
 		Hostname string
 		Devices  []infrav1.NetworkDeviceSpec
+		Bonds    []infrav1.NetworkBondSpec
+		VLANs    []infrav1.NetworkVLANSpec
+		Bridges  []infrav1.NetworkBridgeSpec
 		Routes   []infrav1.NetworkRouteSpec
 	}{
 		Hostname: hostname, // note that hostname determines the Kubernetes node name
 		Devices:  devices,
+		Bonds:    machine.Spec.Network.Bonds,
+		VLANs:    machine.Spec.Network.VLANs,
+		Bridges:  machine.Spec.Network.Bridges,
 		Routes:   machine.Spec.Network.Routes,
 	}); err != nil {
 		return nil, errors.Wrapf(
@@ -170,6 +265,73 @@ func GetMachineMetadata(hostname string, machine infrav1.VSphereVM, networkStatu
 	return buf.Bytes(), nil
 }
 
+// validateNetworkInterfaces returns an error if a bond, VLAN or bridge
+// references a device that does not exist or an interface that is not
+// defined before it. A VLAN may reference a bond, and a bridge may
+// reference bonds and VLANs.
+func validateNetworkInterfaces(spec infrav1.NetworkSpec) error {
+	validDevice := func(i int32) bool {
+		return i >= 0 && int(i) < len(spec.Devices)
+	}
+	bonds, vlans := map[string]struct{}{}, map[string]struct{}{}
+	for _, bond := range spec.Bonds {
+		if len(bond.Devices) == 0 {
+			return errors.Errorf("bond %q has no devices", bond.Name)
+		}
+		for _, i := range bond.Devices {
+			if !validDevice(i) {
+				return errors.Errorf("bond %q has invalid device index %d", bond.Name, i)
+			}
+		}
+		bonds[bond.Name] = struct{}{}
+	}
+	for _, vlan := range spec.VLANs {
+		switch {
+		case vlan.Device != nil && vlan.Bond != "":
+			return errors.Errorf("vlan %q has both a device and a bond", vlan.Name)
+		case vlan.Device != nil:
+			if !validDevice(*vlan.Device) {
+				return errors.Errorf("vlan %q has invalid device index %d", vlan.Name, *vlan.Device)
+			}
+		case vlan.Bond != "":
+			if _, ok := bonds[vlan.Bond]; !ok {
+				return errors.Errorf("vlan %q has unknown bond %q", vlan.Name, vlan.Bond)
+			}
+		default:
+			return errors.Errorf("vlan %q has no device or bond", vlan.Name)
+		}
+		vlans[vlan.Name] = struct{}{}
+	}
+	for _, bridge := range spec.Bridges {
+		for _, i := range bridge.Devices {
+			if !validDevice(i) {
+				return errors.Errorf("bridge %q has invalid device index %d", bridge.Name, i)
+			}
+		}
+		for _, name := range bridge.Interfaces {
+			_, isBond := bonds[name]
+			_, isVLAN := vlans[name]
+			if !isBond && !isVLAN {
+				return errors.Errorf("bridge %q has unknown interface %q", bridge.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// getMachineNetworkDevices returns a copy of the machine's network devices
+// with their MAC addresses from a network status.
+func getMachineNetworkDevices(machine infrav1.VSphereVM, networkStatus ...infrav1.NetworkStatus) []infrav1.NetworkDeviceSpec {
+	devices := make([]infrav1.NetworkDeviceSpec, len(machine.Spec.Network.Devices))
+	for i := range machine.Spec.Network.Devices {
+		machine.Spec.Network.Devices[i].DeepCopyInto(&devices[i])
+		if len(networkStatus) > 0 {
+			devices[i].MACAddr = networkStatus[i].MACAddr
+		}
+	}
+	return devices
+}
+
 const (
 	// ProviderIDPrefix is the string data prefixed to a BIOS UUID in order
 	// to build a provider ID.
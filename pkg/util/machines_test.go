@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 
 	"sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
@@ -165,6 +166,85 @@ func Test_GetMachinePreferredIPAddress(t *testing.T) {
 			ipAddr:      "fdf3:35b5:9dad:6e09::0001",
 			expectedErr: nil,
 		},
+		{
+			name: "multiple IPv4 and IPv6 addresses, preferred IP family set to v6",
+			machine: &v1alpha3.VSphereMachine{
+				Spec: v1alpha3.VSphereMachineSpec{
+					VirtualMachineCloneSpec: v1alpha3.VirtualMachineCloneSpec{
+						Network: v1alpha3.NetworkSpec{
+							PreferredAPIServerIPFamily: corev1.IPv6Protocol,
+						},
+					},
+				},
+				Status: v1alpha3.VSphereMachineStatus{
+					Addresses: []clusterv1.MachineAddress{
+						{
+							Type:    clusterv1.MachineExternalIP,
+							Address: "192.168.0.1",
+						},
+						{
+							Type:    clusterv1.MachineExternalIP,
+							Address: "fdf3:35b5:9dad:6e09::0001",
+						},
+					},
+				},
+			},
+			ipAddr:      "fdf3:35b5:9dad:6e09::0001",
+			expectedErr: nil,
+		},
+		{
+			name: "multiple IPv4 and IPv6 addresses, preferred CIDRs for both families, preferred IP family set to v6",
+			machine: &v1alpha3.VSphereMachine{
+				Spec: v1alpha3.VSphereMachineSpec{
+					VirtualMachineCloneSpec: v1alpha3.VirtualMachineCloneSpec{
+						Network: v1alpha3.NetworkSpec{
+							PreferredAPIServerCIDRs:    []string{"192.168.0.0/16", "fdf3:35b5:9dad:6e09::/64"},
+							PreferredAPIServerIPFamily: corev1.IPv6Protocol,
+						},
+					},
+				},
+				Status: v1alpha3.VSphereMachineStatus{
+					Addresses: []clusterv1.MachineAddress{
+						{
+							Type:    clusterv1.MachineExternalIP,
+							Address: "fd00::0001",
+						},
+						{
+							Type:    clusterv1.MachineExternalIP,
+							Address: "192.168.0.1",
+						},
+						{
+							Type:    clusterv1.MachineExternalIP,
+							Address: "fdf3:35b5:9dad:6e09::0001",
+						},
+					},
+				},
+			},
+			ipAddr:      "fdf3:35b5:9dad:6e09::0001",
+			expectedErr: nil,
+		},
+		{
+			name: "preferred IP family set to v6, only IPv4 addresses",
+			machine: &v1alpha3.VSphereMachine{
+				Spec: v1alpha3.VSphereMachineSpec{
+					VirtualMachineCloneSpec: v1alpha3.VirtualMachineCloneSpec{
+						Network: v1alpha3.NetworkSpec{
+							PreferredAPIServerIPFamily: corev1.IPv6Protocol,
+						},
+					},
+				},
+				Status: v1alpha3.VSphereMachineStatus{
+					Addresses: []clusterv1.MachineAddress{
+						{
+							Type:    clusterv1.MachineInternalIP,
+							Address: "10.0.0.1",
+						},
+					},
+				},
+			},
+			ipAddr:      "10.0.0.1",
+			expectedErr: nil,
+		},
 		{
 			name: "no addresses found",
 			machine: &v1alpha3.VSphereMachine{
@@ -225,6 +305,68 @@ func Test_GetMachinePreferredIPAddress(t *testing.T) {
 	}
 }
 
+func Test_GetMachineAddresses(t *testing.T) {
+	testCases := []struct {
+		name          string
+		network       v1alpha3.NetworkSpec
+		ipAddrs       []string
+		expectedAddrs []clusterv1.MachineAddress
+		expectedErr   bool
+	}{
+		{
+			name:    "IPv4 and IPv6 addresses",
+			ipAddrs: []string{"fd00::1", "192.168.0.1", "10.0.0.1"},
+			expectedAddrs: []clusterv1.MachineAddress{
+				{Type: clusterv1.MachineExternalIP, Address: "192.168.0.1"},
+				{Type: clusterv1.MachineExternalIP, Address: "10.0.0.1"},
+				{Type: clusterv1.MachineExternalIP, Address: "fd00::1"},
+			},
+		},
+		{
+			name: "IPv4 and IPv6 addresses, preferred IP family set to v6, internal CIDRs",
+			network: v1alpha3.NetworkSpec{
+				PreferredAPIServerIPFamily: corev1.IPv6Protocol,
+				InternalCIDRs:              []string{"10.0.0.0/8", "fd00::/64"},
+			},
+			ipAddrs: []string{"192.168.0.1", "10.0.0.1", "fd00::0001", "2001:db8::1"},
+			expectedAddrs: []clusterv1.MachineAddress{
+				{Type: clusterv1.MachineInternalIP, Address: "fd00::1"},
+				{Type: clusterv1.MachineExternalIP, Address: "2001:db8::1"},
+				{Type: clusterv1.MachineExternalIP, Address: "192.168.0.1"},
+				{Type: clusterv1.MachineInternalIP, Address: "10.0.0.1"},
+			},
+		},
+		{
+			name:    "duplicate and invalid addresses",
+			ipAddrs: []string{"192.168.0.1", "invalid", "192.168.0.1"},
+			expectedAddrs: []clusterv1.MachineAddress{
+				{Type: clusterv1.MachineExternalIP, Address: "192.168.0.1"},
+			},
+		},
+		{
+			name: "invalid internal CIDR",
+			network: v1alpha3.NetworkSpec{
+				InternalCIDRs: []string{"10.0.0.0"},
+			},
+			ipAddrs:     []string{"10.0.0.1"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewGomegaWithT(t)
+			addrs, err := util.GetMachineAddresses(tc.network, tc.ipAddrs...)
+			if tc.expectedErr {
+				g.Expect(err).To(gomega.HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(gomega.HaveOccurred())
+			g.Expect(addrs).To(gomega.Equal(tc.expectedAddrs))
+		})
+	}
+}
+
 func Test_GetMachineMetadata(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -519,6 +661,128 @@ network:
       nameservers:
         search:
         - "vmware6.ci"
+`,
+		},
+		{
+			name: "bond-vlan-bridge",
+			machine: &v1alpha3.VSphereVM{
+				Spec: v1alpha3.VSphereVMSpec{
+					VirtualMachineCloneSpec: v1alpha3.VirtualMachineCloneSpec{
+						Network: v1alpha3.NetworkSpec{
+							Devices: []v1alpha3.NetworkDeviceSpec{
+								{
+									NetworkName: "network1",
+									MACAddr:     "00:00:00:00:00",
+								},
+								{
+									NetworkName: "network1",
+									MACAddr:     "00:00:00:00:01",
+								},
+								{
+									NetworkName: "network2",
+									MACAddr:     "00:00:00:00:02",
+								},
+							},
+							Bonds: []v1alpha3.NetworkBondSpec{
+								{
+									Name:               "bond0",
+									Devices:            []int32{0, 1},
+									LACPRate:           "fast",
+									TransmitHashPolicy: "layer3+4",
+									NetworkInterfaceConfig: v1alpha3.NetworkInterfaceConfig{
+										IPAddrs:  []string{"192.168.4.21/24"},
+										Gateway4: "192.168.4.1",
+									},
+								},
+							},
+							VLANs: []v1alpha3.NetworkVLANSpec{
+								{
+									Name: "vlan100",
+									ID:   100,
+									Bond: "bond0",
+									NetworkInterfaceConfig: v1alpha3.NetworkInterfaceConfig{
+										IPAddrs: []string{"10.0.100.21/24"},
+									},
+								},
+								{
+									Name:   "vlan200",
+									ID:     200,
+									Device: toInt32Ptr(2),
+								},
+							},
+							Bridges: []v1alpha3.NetworkBridgeSpec{
+								{
+									Name:       "br0",
+									Interfaces: []string{"vlan200"},
+									STP:        toBoolPtr(false),
+									NetworkInterfaceConfig: v1alpha3.NetworkInterfaceConfig{
+										DHCP4: true,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expected: `
+instance-id: "test-vm"
+local-hostname: "test-vm"
+network:
+  version: 2
+  ethernets:
+    id0:
+      match:
+        macaddress: "00:00:00:00:00"
+      wakeonlan: true
+      dhcp4: false
+      dhcp6: false
+    id1:
+      match:
+        macaddress: "00:00:00:00:01"
+      wakeonlan: true
+      dhcp4: false
+      dhcp6: false
+    id2:
+      match:
+        macaddress: "00:00:00:00:02"
+      wakeonlan: true
+      dhcp4: false
+      dhcp6: false
+  bonds:
+    bond0:
+      interfaces:
+      - id0
+      - id1
+      parameters:
+        mode: "802.3ad"
+        lacp-rate: "fast"
+        transmit-hash-policy: "layer3+4"
+      dhcp4: false
+      dhcp6: false
+      addresses:
+      - "192.168.4.21/24"
+      gateway4: "192.168.4.1"
+  vlans:
+    vlan100:
+      id: 100
+      link: bond0
+      dhcp4: false
+      dhcp6: false
+      addresses:
+      - "10.0.100.21/24"
+    vlan200:
+      id: 200
+      link: id2
+      dhcp4: false
+      dhcp6: false
+  bridges:
+    br0:
+      interfaces:
+      - vlan200
+      parameters:
+        stp: false
+      dhcp4: true
+      dhcp6: false
 `,
 		},
 	}
@@ -643,3 +907,45 @@ func mtu(i int64) *int64 {
 func toStringPtr(s string) *string {
 	return &s
 }
+
+func toInt32Ptr(i int32) *int32 {
+	return &i
+}
+
+func toBoolPtr(b bool) *bool {
+	return &b
+}
+
+func Test_GetMachineMetadataInvalidNetworkInterfaces(t *testing.T) {
+	devices := []v1alpha3.NetworkDeviceSpec{{NetworkName: "network1"}}
+	testCases := []struct {
+		name    string
+		network v1alpha3.NetworkSpec
+	}{
+		{
+			name:    "bond with invalid device",
+			network: v1alpha3.NetworkSpec{Devices: devices, Bonds: []v1alpha3.NetworkBondSpec{{Name: "bond0", Devices: []int32{1}}}},
+		},
+		{
+			name:    "vlan with unknown bond",
+			network: v1alpha3.NetworkSpec{Devices: devices, VLANs: []v1alpha3.NetworkVLANSpec{{Name: "vlan100", ID: 100, Bond: "bond0"}}},
+		},
+		{
+			name:    "vlan without link",
+			network: v1alpha3.NetworkSpec{Devices: devices, VLANs: []v1alpha3.NetworkVLANSpec{{Name: "vlan100", ID: 100}}},
+		},
+		{
+			name:    "bridge with unknown interface",
+			network: v1alpha3.NetworkSpec{Devices: devices, Bridges: []v1alpha3.NetworkBridgeSpec{{Name: "br0", Interfaces: []string{"bond0"}}}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewGomegaWithT(t)
+			machine := v1alpha3.VSphereVM{}
+			machine.Spec.Network = tc.network
+			_, err := util.GetMachineMetadata("test-vm", machine)
+			g.Expect(err).To(gomega.HaveOccurred())
+		})
+	}
+}